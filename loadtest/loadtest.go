@@ -0,0 +1,125 @@
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"golang-playground/s3audit"
+	"io"
+	"log"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// DefaultChecks are the checks of a load test when the options select none: the checks that only read
+// settings of the buckets the fake endpoint serves
+const DefaultChecks = "encryption,ownership,owner,bucket-policy,drift,naming"
+
+// Stats are the measures of a load test.
+type Stats struct {
+	Buckets   int
+	Elapsed   time.Duration
+	Requests  int64
+	Throttled int64
+	// PeakHeapBytes is the highest heap size sampled during the scan
+	PeakHeapBytes uint64
+	// AllocatedBytes is the memory allocated by the scan, freed or not
+	AllocatedBytes uint64
+}
+
+// Print prints the measures.
+func (s Stats) Print(w io.Writer) {
+	seconds := s.Elapsed.Seconds()
+	fmt.Fprintf(w, "Buckets: %d in %s (%.1f bucket(s)/s)\n", s.Buckets, s.Elapsed.Round(time.Millisecond), float64(s.Buckets)/seconds)
+	fmt.Fprintf(w, "Requests: %d (%.1f/s), %d throttled\n", s.Requests, float64(s.Requests)/seconds, s.Throttled)
+	fmt.Fprintf(w, "Peak heap: %.1f MiB, allocated: %.1f MiB\n", float64(s.PeakHeapBytes)/(1<<20), float64(s.AllocatedBytes)/(1<<20))
+}
+
+// Run audits the account of a fake endpoint with the options and measures the scan. The output of the audit
+// is discarded, only the measures are returned.
+func Run(c context.Context, cfg Config, options s3audit.Options) (Stats, error) {
+	server := NewServer(cfg)
+	defer server.Close()
+
+	awsCfg, err := server.AWSConfig(c)
+	if err != nil {
+		return Stats{}, err
+	}
+	if options.Checks == "" {
+		options.Checks = DefaultChecks
+	}
+
+	// the audit prints to the standard output and logs the errors of the services the endpoint does not fake
+	stdout := os.Stdout
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return Stats{}, err
+	}
+	defer devNull.Close()
+	os.Stdout = devNull
+	log.SetOutput(io.Discard)
+	defer func() {
+		os.Stdout = stdout
+		log.SetOutput(os.Stderr)
+	}()
+
+	var before runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	peak, stop := sampleHeap()
+
+	start := time.Now()
+	auditor, err := s3audit.New(c, awsCfg, options)
+	if err != nil {
+		stop()
+		return Stats{}, err
+	}
+	if _, err := auditor.Run(c); err != nil {
+		stop()
+		return Stats{}, err
+	}
+	elapsed := time.Since(start)
+	stop()
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	requests, throttled := server.Requests()
+	return Stats{
+		Buckets:        cfg.Buckets,
+		Elapsed:        elapsed,
+		Requests:       requests,
+		Throttled:      throttled,
+		PeakHeapBytes:  *peak,
+		AllocatedBytes: after.TotalAlloc - before.TotalAlloc,
+	}, nil
+}
+
+// sampleHeap samples the heap size every 50ms until stop is called, and keeps the highest sample in peak.
+func sampleHeap() (peak *uint64, stop func()) {
+	peak = new(uint64)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var stats runtime.MemStats
+			runtime.ReadMemStats(&stats)
+			if stats.HeapAlloc > *peak {
+				*peak = stats.HeapAlloc
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return peak, func() {
+		close(done)
+		wg.Wait()
+	}
+}
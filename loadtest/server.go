@@ -0,0 +1,220 @@
+// Package loadtest runs the audit against a fake S3 endpoint simulating an account of many buckets, with
+// configurable latencies and error rates, to measure the performance of the scan pipeline.
+package loadtest
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AccountID is the account of the fake endpoint
+const AccountID = "123456789012"
+
+// regions are the regions of the fake buckets, assigned in turn
+var regions = []string{"us-east-1", "us-west-2", "eu-west-1"}
+
+// Config defines the account the fake endpoint simulates.
+type Config struct {
+	// Buckets is the number of buckets of the account.
+	Buckets int
+	// Latency is the time the endpoint takes to answer each request.
+	Latency time.Duration
+	// ErrorRate is the share of the requests, between 0 and 1, answered with a SlowDown throttling error.
+	ErrorRate float64
+}
+
+// Server is a fake S3 endpoint, also answering the STS GetCallerIdentity requests. It serves the settings
+// the audit reads for the buckets, derived from their index, and a NotImplemented error for the other
+// requests, e.g. to the regional services.
+type Server struct {
+	*httptest.Server
+	config Config
+
+	mutex  sync.Mutex
+	random *rand.Rand
+
+	requests  atomic.Int64
+	throttled atomic.Int64
+}
+
+// NewServer starts a fake endpoint. Close stops it.
+func NewServer(config Config) *Server {
+	s := &Server{config: config, random: rand.New(rand.NewSource(1))}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Requests returns the number of requests served, and how many of them were throttled.
+func (s *Server) Requests() (total int64, throttled int64) {
+	return s.requests.Load(), s.throttled.Load()
+}
+
+// AWSConfig returns the configuration of the clients calling the endpoint, with static credentials and the
+// retries of the throttled requests.
+func (s *Server) AWSConfig(c context.Context) (aws.Config, error) {
+	return config.LoadDefaultConfig(c,
+		config.WithRegion("us-east-1"),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("AKIDLOADTEST", "loadtest", "")),
+		config.WithBaseEndpoint(s.URL),
+		config.WithRetryMaxAttempts(5),
+	)
+}
+
+// BucketName returns the name of the bucket of an index.
+func BucketName(i int) string {
+	return fmt.Sprintf("loadtest-bucket-%06d", i)
+}
+
+// bucketIndex returns the index of a bucket name, false when the bucket does not exist.
+func (s *Server) bucketIndex(name string) (int, bool) {
+	var i int
+	if _, err := fmt.Sscanf(name, "loadtest-bucket-%06d", &i); err != nil || i < 0 || i >= s.config.Buckets {
+		return 0, false
+	}
+	return i, true
+}
+
+// throttle draws whether a request is throttled.
+func (s *Server) throttle() bool {
+	if s.config.ErrorRate <= 0 {
+		return false
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.random.Float64() < s.config.ErrorRate
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.requests.Add(1)
+	time.Sleep(s.config.Latency)
+	if s.throttle() {
+		s.throttled.Add(1)
+		writeError(w, http.StatusServiceUnavailable, "SlowDown", "Please reduce your request rate.")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		r.ParseForm()
+		if r.Form.Get("Action") == "GetCallerIdentity" {
+			writeXML(w, `<GetCallerIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><GetCallerIdentityResult>`+
+				`<Arn>arn:aws:iam::`+AccountID+`:user/loadtest</Arn><UserId>AIDALOADTEST</UserId><Account>`+AccountID+`</Account>`+
+				`</GetCallerIdentityResult><ResponseMetadata><RequestId>loadtest</RequestId></ResponseMetadata></GetCallerIdentityResponse>`)
+			return
+		}
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The fake endpoint only implements S3 and STS GetCallerIdentity.")
+		return
+	}
+
+	name := strings.Trim(r.URL.Path, "/")
+	if name == "" {
+		if r.URL.Query().Get("x-id") == "ListBuckets" || len(r.URL.Query()) == 0 {
+			s.listBuckets(w)
+			return
+		}
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The fake endpoint only implements S3 and STS GetCallerIdentity.")
+		return
+	}
+	i, ok := s.bucketIndex(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist.")
+		return
+	}
+	s.bucketSetting(w, r, i)
+}
+
+// listBuckets answers ListBuckets with every bucket of the account.
+func (s *Server) listBuckets(w http.ResponseWriter) {
+	var body strings.Builder
+	body.WriteString(`<ListAllMyBucketsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`)
+	body.WriteString(`<Owner><ID>loadtest-owner</ID><DisplayName>loadtest</DisplayName></Owner><Buckets>`)
+	for i := 0; i < s.config.Buckets; i++ {
+		created := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * time.Hour)
+		fmt.Fprintf(&body, "<Bucket><Name>%s</Name><CreationDate>%s</CreationDate></Bucket>", BucketName(i), created.Format("2006-01-02T15:04:05.000Z"))
+	}
+	body.WriteString(`</Buckets></ListAllMyBucketsResult>`)
+	writeXML(w, body.String())
+}
+
+// bucketSetting answers the request of a bucket setting. The settings vary with the index of the bucket:
+// one bucket in five is not encrypted, one in two is not versioned, one in three lacks tags, one in four
+// allows ACLs and one in twenty has a public policy.
+func (s *Server) bucketSetting(w http.ResponseWriter, r *http.Request, i int) {
+	query := r.URL.Query()
+	region := regions[i%len(regions)]
+	switch {
+	case r.Method == http.MethodHead:
+		w.Header().Set("x-amz-bucket-region", region)
+		w.WriteHeader(http.StatusOK)
+	case query.Has("location"):
+		if region == "us-east-1" {
+			region = ""
+		}
+		writeXML(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">`+region+`</LocationConstraint>`)
+	case query.Has("acl"):
+		writeXML(w, `<AccessControlPolicy><Owner><ID>loadtest-owner</ID><DisplayName>loadtest</DisplayName></Owner><AccessControlList>`+
+			`<Grant><Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser"><ID>loadtest-owner</ID></Grantee>`+
+			`<Permission>FULL_CONTROL</Permission></Grant></AccessControlList></AccessControlPolicy>`)
+	case query.Has("encryption"):
+		if i%5 == 0 {
+			writeError(w, http.StatusNotFound, "ServerSideEncryptionConfigurationNotFoundError", "The server side encryption configuration was not found")
+			return
+		}
+		writeXML(w, `<ServerSideEncryptionConfiguration><Rule><ApplyServerSideEncryptionByDefault><SSEAlgorithm>AES256</SSEAlgorithm>`+
+			`</ApplyServerSideEncryptionByDefault></Rule></ServerSideEncryptionConfiguration>`)
+	case query.Has("ownershipControls"):
+		ownership := "BucketOwnerEnforced"
+		if i%4 == 0 {
+			ownership = "ObjectWriter"
+		}
+		writeXML(w, `<OwnershipControls><Rule><ObjectOwnership>`+ownership+`</ObjectOwnership></Rule></OwnershipControls>`)
+	case query.Has("policyStatus"):
+		writeXML(w, fmt.Sprintf(`<PolicyStatus><IsPublic>%t</IsPublic></PolicyStatus>`, i%20 == 0))
+	case query.Has("tagging"):
+		if i%3 == 0 {
+			writeError(w, http.StatusNotFound, "NoSuchTagSet", "The TagSet does not exist")
+			return
+		}
+		writeXML(w, fmt.Sprintf(`<Tagging><TagSet><Tag><Key>team</Key><Value>team-%d</Value></Tag></TagSet></Tagging>`, i%7))
+	case query.Has("versioning"):
+		if i%2 == 0 {
+			writeXML(w, `<VersioningConfiguration/>`)
+			return
+		}
+		writeXML(w, `<VersioningConfiguration><Status>Enabled</Status></VersioningConfiguration>`)
+	case query.Has("requestPayment"):
+		writeXML(w, `<RequestPaymentConfiguration><Payer>BucketOwner</Payer></RequestPaymentConfiguration>`)
+	case query.Has("accelerate"):
+		writeXML(w, `<AccelerateConfiguration/>`)
+	case query.Has("lifecycle"):
+		writeError(w, http.StatusNotFound, "NoSuchLifecycleConfiguration", "The lifecycle configuration does not exist")
+	case query.Has("intelligent-tiering"):
+		writeXML(w, `<ListBucketIntelligentTieringConfigurationsOutput><IsTruncated>false</IsTruncated></ListBucketIntelligentTieringConfigurationsOutput>`)
+	case query.Has("notification"):
+		writeXML(w, `<NotificationConfiguration/>`)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "The fake endpoint does not implement this request.")
+	}
+}
+
+// writeXML writes an XML document as the body of a successful response.
+func writeXML(w http.ResponseWriter, body string) {
+	w.Header().Set("Content-Type", "application/xml")
+	fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+body)
+}
+
+// writeError writes an S3 error response.
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><Error><Code>%s</Code><Message>%s</Message><RequestId>loadtest</RequestId></Error>`, code, message)
+}
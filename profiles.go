@@ -0,0 +1,78 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// profileFile defines the layout of the profiles file: every profile maps flag names to their values, e.g.
+//
+//     profiles:
+//       quick:
+//         checks: [bucket-policy, encryption]
+//         concurrency: 16
+//       cost:
+//         storage-lens: true
+//         checks: [intelligent-tiering]
+type profileFile struct {
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// defaultProfilesFile returns the path of the profiles file in the home directory, ~/.s3audit.yaml.
+func defaultProfilesFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".s3audit.yaml"
+	}
+	return filepath.Join(home, ".s3audit.yaml")
+}
+
+// applyProfile sets the flags of a named profile of the profiles file. The flags given on the command line
+// take precedence over the profile; lists are joined with commas.
+func applyProfile(flags *flag.FlagSet, file string, name string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var content profileFile
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return err
+	}
+
+	profile, ok := content.Profiles[name]
+	if !ok {
+		return fmt.Errorf("no profile %q in %s", name, file)
+	}
+
+	explicit := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	for key, value := range profile {
+		if flags.Lookup(key) == nil {
+			return fmt.Errorf("profile %q sets unknown flag %q", name, key)
+		}
+		if explicit[key] {
+			continue
+		}
+
+		text := fmt.Sprint(value)
+		if list, ok := value.([]interface{}); ok {
+			var items []string
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			text = strings.Join(items, ",")
+		}
+		if err := flags.Set(key, text); err != nil {
+			return fmt.Errorf("profile %q: invalid value for %q: %v", name, key, err)
+		}
+	}
+
+	return nil
+}
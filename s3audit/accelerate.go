@@ -0,0 +1,173 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"log"
+	"strings"
+	"time"
+)
+
+// AccelerationProbe defines the transfers of a Transfer Acceleration probe: Rounds uploads and downloads of
+// a payload of each of the Sizes, in bytes, through the standard and the accelerated endpoints of Bucket.
+// The payloads are written under Prefix and deleted once measured.
+type AccelerationProbe struct {
+	Bucket string
+	Prefix string
+	Sizes  []int64
+	Rounds int
+}
+
+// transferTimes are the durations of the uploads and downloads of a payload through an endpoint.
+type transferTimes struct {
+	uploads   []time.Duration
+	downloads []time.Duration
+}
+
+// median returns the median of durations, less sensitive than the mean to a slow round.
+func median(durations []time.Duration) time.Duration {
+	return percentile(durations, 0.5)
+}
+
+// throughput formats the duration of the transfer of size bytes and its rate.
+func throughput(size int64, d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%s (%.1f MB/s)", d.Round(time.Millisecond), float64(size)/(1<<20)/d.Seconds())
+}
+
+// gain formats how much faster the accelerated transfer is than the standard one, negative when slower.
+func gain(standard time.Duration, accelerated time.Duration) string {
+	if standard <= 0 || accelerated <= 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%+.0f%%", (float64(standard)/float64(accelerated)-1)*100)
+}
+
+// formatPayloadSize formats a payload size in KB or MB.
+func formatPayloadSize(size int64) string {
+	if size < 1<<20 {
+		return fmt.Sprintf("%d KB", size>>10)
+	}
+	return fmt.Sprintf("%d MB", size>>20)
+}
+
+// timeTransfer uploads then downloads a payload through an endpoint and returns the duration of each.
+func timeTransfer(c context.Context, api S3ClientAPI, bucket string, key string, payload []byte) (time.Duration, time.Duration, error) {
+	start := time.Now()
+	_, err := api.PutObject(c, &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(key), Body: bytes.NewReader(payload)})
+	if err != nil {
+		return 0, 0, fmt.Errorf("uploading %s: %v", key, err)
+	}
+	upload := time.Since(start)
+
+	start = time.Now()
+	object, err := api.GetObject(c, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return 0, 0, fmt.Errorf("downloading %s: %v", key, err)
+	}
+	_, err = io.Copy(io.Discard, object.Body)
+	object.Body.Close()
+	if err != nil {
+		return 0, 0, fmt.Errorf("downloading %s: %v", key, err)
+	}
+	return upload, time.Since(start), nil
+}
+
+// ProbeAcceleration measures the uploads and downloads of test payloads through the standard and the
+// accelerated endpoints of a bucket, from where the command runs, and reports how much faster the accelerated
+// ones are. The standard and accelerated transfers alternate, so both see the same network conditions.
+func ProbeAcceleration(c context.Context, cfg aws.Config, probe AccelerationProbe, w io.Writer) error {
+	if strings.Contains(probe.Bucket, ".") {
+		return fmt.Errorf("bucket %s cannot use Transfer Acceleration, its name contains dots", probe.Bucket)
+	}
+	standard, region, err := newBucketClient(c, cfg, probe.Bucket, "")
+	if err != nil {
+		return err
+	}
+	accelerate, err := standard.GetBucketAccelerateConfiguration(c, &s3.GetBucketAccelerateConfigurationInput{Bucket: aws.String(probe.Bucket)})
+	if err != nil {
+		return err
+	}
+	if accelerate.Status != types.BucketAccelerateStatusEnabled {
+		return fmt.Errorf("bucket %s does not have Transfer Acceleration enabled, enable it for the probe: "+
+			"aws s3api put-bucket-accelerate-configuration --bucket %s --accelerate-configuration Status=Enabled", probe.Bucket, probe.Bucket)
+	}
+	accelerated := newS3Client(cfg, region, "", func(options *s3.Options) {
+		options.UseAccelerate = true
+	})
+	endpoints := []struct {
+		name   string
+		client S3ClientAPI
+	}{{"standard", standard}, {"accelerated", accelerated}}
+
+	times := map[string]map[int64]*transferTimes{}
+	var keys []string
+	defer func() {
+		for _, key := range keys {
+			if _, err := standard.DeleteObject(c, &s3.DeleteObjectInput{Bucket: aws.String(probe.Bucket), Key: aws.String(key)}); err != nil {
+				log.Printf("Got an error deleting the probe payload %v: %v", key, err)
+			}
+		}
+	}()
+	for _, size := range probe.Sizes {
+		payload := make([]byte, size)
+		if _, err := rand.Read(payload); err != nil {
+			return err
+		}
+		for round := 0; round < probe.Rounds; round++ {
+			for _, endpoint := range endpoints {
+				key := fmt.Sprintf("%saccelerate-probe-%d-%s", probe.Prefix, size, endpoint.name)
+				if round == 0 {
+					keys = append(keys, key)
+				}
+				upload, download, err := timeTransfer(c, endpoint.client, probe.Bucket, key, payload)
+				if err != nil {
+					return fmt.Errorf("%s endpoint: %v", endpoint.name, err)
+				}
+				if times[endpoint.name] == nil {
+					times[endpoint.name] = map[int64]*transferTimes{}
+				}
+				if times[endpoint.name][size] == nil {
+					times[endpoint.name][size] = &transferTimes{}
+				}
+				t := times[endpoint.name][size]
+				t.uploads = append(t.uploads, upload)
+				t.downloads = append(t.downloads, download)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Transfer Acceleration of bucket %s (%s), median of %d rounds from this host\n", probe.Bucket, region, probe.Rounds)
+	t := newTable(false, column{header: "SIZE"}, column{header: "UPLOAD STANDARD"}, column{header: "UPLOAD ACCELERATED"},
+		column{header: "GAIN"}, column{header: "DOWNLOAD STANDARD"}, column{header: "DOWNLOAD ACCELERATED"}, column{header: "GAIN"})
+	var standardTotal, acceleratedTotal time.Duration
+	for _, size := range probe.Sizes {
+		s, a := times["standard"][size], times["accelerated"][size]
+		t.add(cell{text: formatPayloadSize(size)},
+			cell{text: throughput(size, median(s.uploads))}, cell{text: throughput(size, median(a.uploads))},
+			cell{text: gain(median(s.uploads), median(a.uploads))},
+			cell{text: throughput(size, median(s.downloads))}, cell{text: throughput(size, median(a.downloads))},
+			cell{text: gain(median(s.downloads), median(a.downloads))})
+		standardTotal += median(s.uploads) + median(s.downloads)
+		acceleratedTotal += median(a.uploads) + median(a.downloads)
+	}
+	t.write(w)
+
+	// acceleration is billed $0.04-$0.08 per GB on top of the transfer, it pays off for clearly faster transfers
+	if float64(standardTotal) > 1.2*float64(acceleratedTotal) {
+		fmt.Fprintf(w, "\nAcceleration is %s faster overall from this location, worth its extra $0.04-$0.08 per GB for latency-sensitive transfers\n",
+			gain(standardTotal, acceleratedTotal))
+	} else {
+		fmt.Fprintf(w, "\nAcceleration is %s faster overall from this location, not worth its extra $0.04-$0.08 per GB\n",
+			gain(standardTotal, acceleratedTotal))
+	}
+	return nil
+}
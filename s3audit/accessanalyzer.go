@@ -0,0 +1,197 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer"
+	"github.com/aws/aws-sdk-go-v2/service/accessanalyzer/types"
+	"sort"
+	"strings"
+)
+
+// AccessAnalyzerListAnalyzersApi defines the interface for the ListAnalyzers function.
+// We use this interface to test the function using a mocked service.
+type AccessAnalyzerListAnalyzersApi interface {
+	ListAnalyzers(ctx context.Context,
+		params *accessanalyzer.ListAnalyzersInput,
+		optFns ...func(*accessanalyzer.Options)) (*accessanalyzer.ListAnalyzersOutput, error)
+}
+
+// AccessAnalyzerListFindingsApi defines the interface for the ListFindings function.
+// We use this interface to test the function using a mocked service.
+type AccessAnalyzerListFindingsApi interface {
+	ListFindings(ctx context.Context,
+		params *accessanalyzer.ListFindingsInput,
+		optFns ...func(*accessanalyzer.Options)) (*accessanalyzer.ListFindingsOutput, error)
+}
+
+// accessAnalyzerApi groups the IAM Access Analyzer calls needed to read the external access findings of a region.
+type accessAnalyzerApi interface {
+	AccessAnalyzerListAnalyzersApi
+	AccessAnalyzerListFindingsApi
+}
+
+// externalAccess defines an active Access Analyzer finding confirming that a bucket is shared outside the
+// zone of trust of the analyzer
+type externalAccess struct {
+	id         string
+	principals []string
+	actions    []string
+	public     bool
+}
+
+// regionAnalysis holds the external access findings of the S3 buckets of a region, keyed by bucket name.
+// analyzer is empty when the region has no active analyzer, in which case nothing could be confirmed.
+type regionAnalysis struct {
+	analyzer string
+	buckets  map[string][]externalAccess
+}
+
+// ListAnalyzers retrieves the IAM Access Analyzer analyzers of a region.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListAnalyzersOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListAnalyzers.
+func ListAnalyzers(c context.Context, api AccessAnalyzerListAnalyzersApi, input *accessanalyzer.ListAnalyzersInput) (*accessanalyzer.ListAnalyzersOutput, error) {
+	return api.ListAnalyzers(c, input)
+}
+
+// ListFindings retrieves the findings generated by an analyzer.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListFindings.
+func ListFindings(c context.Context, api AccessAnalyzerListFindingsApi, input *accessanalyzer.ListFindingsInput) (*accessanalyzer.ListFindingsOutput, error) {
+	return api.ListFindings(c, input)
+}
+
+// newAccessAnalyzerClient returns an IAM Access Analyzer client for a region.
+func newAccessAnalyzerClient(cfg aws.Config, region string) *accessanalyzer.Client {
+	return accessanalyzer.NewFromConfig(cfg, func(options *accessanalyzer.Options) {
+		options.Region = region
+	})
+}
+
+// getRegionAnalysis finds the active external access analyzer of a region, preferring the account analyzer
+// over the organization one, and collects its active findings on S3 buckets.
+func getRegionAnalysis(c context.Context, api accessAnalyzerApi) (regionAnalysis, error) {
+	analysis := regionAnalysis{buckets: map[string][]externalAccess{}}
+
+	for _, analyzerType := range []types.Type{types.TypeAccount, types.TypeOrganization} {
+		analyzers, err := ListAnalyzers(c, api, &accessanalyzer.ListAnalyzersInput{Type: analyzerType})
+		if err != nil {
+			return analysis, err
+		}
+		for _, analyzer := range analyzers.Analyzers {
+			if analyzer.Status == types.AnalyzerStatusActive {
+				analysis.analyzer = aws.ToString(analyzer.Arn)
+				break
+			}
+		}
+		if analysis.analyzer != "" {
+			break
+		}
+	}
+	if analysis.analyzer == "" {
+		return analysis, nil
+	}
+
+	input := &accessanalyzer.ListFindingsInput{
+		AnalyzerArn: aws.String(analysis.analyzer),
+		Filter: map[string]types.Criterion{
+			"resourceType": {Eq: []string{string(types.ResourceTypeAwsS3Bucket)}},
+			"status":       {Eq: []string{string(types.FindingStatusActive)}},
+		},
+	}
+	for {
+		list, err := ListFindings(c, api, input)
+		if err != nil {
+			return analysis, err
+		}
+
+		for _, f := range list.Findings {
+			resource, err := arn.Parse(aws.ToString(f.Resource))
+			if err != nil {
+				continue
+			}
+
+			access := externalAccess{
+				id:      aws.ToString(f.Id),
+				actions: f.Action,
+				public:  aws.ToBool(f.IsPublic),
+			}
+			for principalType, principal := range f.Principal {
+				access.principals = append(access.principals, fmt.Sprintf("%s:%s", principalType, principal))
+			}
+			sort.Strings(access.principals)
+
+			analysis.buckets[resource.Resource] = append(analysis.buckets[resource.Resource], access)
+		}
+
+		if list.NextToken == nil {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+
+	return analysis, nil
+}
+
+// externalAccessFindings distinguishes a bucket policy that merely looks public from external access that
+// Access Analyzer confirms.
+func externalAccessFindings(b s3Bucket, analyzed bool) []finding {
+	var findings []finding
+
+	var confirmedPublic bool
+	for _, access := range b.externalAccess {
+		if access.public {
+			confirmedPublic = true
+			findings = append(findings, finding{
+				bucket:   b.name,
+				check:    "access-analyzer",
+				severity: severityCritical,
+				message:  fmt.Sprintf("Access Analyzer confirms public access (%s)", strings.Join(access.actions, ",")),
+			})
+			continue
+		}
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "access-analyzer",
+			severity: severityMedium,
+			message:  fmt.Sprintf("Access Analyzer confirms external access for %s", strings.Join(access.principals, ",")),
+		})
+	}
+
+	if b.policyPublic && !confirmedPublic {
+		message := "bucket policy looks public, not confirmed by Access Analyzer"
+		if !analyzed {
+			message = "bucket policy looks public, no Access Analyzer in the region to confirm it"
+		}
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "bucket-policy",
+			severity: severityHigh,
+			message:  message,
+		})
+	}
+
+	return findings
+}
+
+// printExternalAccess prints the public policy state and the confirmed external access of a bucket below its report line.
+func printExternalAccess(b s3Bucket) {
+	if b.policyPublic {
+		fmt.Println("\tBucket policy: public")
+	}
+	for _, access := range b.externalAccess {
+		fmt.Printf("\tExternal access: %s\t Public: %t\t Principals: %s\n", access.id, access.public, strings.Join(access.principals, ","))
+	}
+}
@@ -0,0 +1,420 @@
+package s3audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// forbiddenSpikeMinimum is the number of 403 responses an hour needs at least to be a spike
+const forbiddenSpikeMinimum = 10
+
+// forbiddenSpikeFactor is how many times the mean of the hours with 403 responses a spike reaches
+const forbiddenSpikeFactor = 3
+
+// unusualGeographyShare is the share of the requests of a bucket under which an unexpected geography is unusual
+const unusualGeographyShare = 0.01
+
+// LogAnalysis defines the access logs analyzed by AnalyzeLogs: the S3 server access logs or the CloudFront
+// standard logs written to Prefix in Bucket between From and To. GeoFile is a CSV file of cidr,country lines
+// locating the requester IPs; the CloudFront logs are located by the airport code of their edge location
+// without it. ExpectedCountries is the comma separated list of the usual geographies, the geographies under
+// 1% of the requests of a bucket are unusual when empty.
+type LogAnalysis struct {
+	Bucket            string
+	Prefix            string
+	From              time.Time
+	To                time.Time
+	Format            string
+	Top               int
+	GeoFile           string
+	ExpectedCountries string
+}
+
+// accessLogRecord is a request read from an access log.
+type accessLogRecord struct {
+	// bucket is the bucket of an S3 server access log, the host of a CloudFront log
+	bucket    string
+	time      time.Time
+	ip        string
+	requester string
+	status    int
+	// geography is the country of the IP, or the edge location of a CloudFront request
+	geography string
+}
+
+// bucketLogStats sums the requests of a bucket in the access logs.
+type bucketLogStats struct {
+	requests    int
+	anonymous   int
+	ips         map[string]int
+	requesters  map[string]int
+	geographies map[string]int
+	// forbidden counts the 403 responses by hour
+	forbidden map[time.Time]int
+}
+
+// geoRange maps a network to its country
+type geoRange struct {
+	network *net.IPNet
+	country string
+}
+
+// geoLocator locates the IPs with the networks of a GeoFile, caching the IPs already located.
+type geoLocator struct {
+	ranges []geoRange
+	cache  map[string]string
+}
+
+// loadGeoLocator reads a CSV file of cidr,country lines, e.g. 203.0.113.0/24,AU.
+func loadGeoLocator(file string) (*geoLocator, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 2
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	locator := &geoLocator{cache: map[string]string{}}
+	for i, line := range lines {
+		_, network, err := net.ParseCIDR(strings.TrimSpace(line[0]))
+		if err != nil {
+			// a header line
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid network %q", i+1, line[0])
+		}
+		locator.ranges = append(locator.ranges, geoRange{network: network, country: strings.ToUpper(strings.TrimSpace(line[1]))})
+	}
+	return locator, nil
+}
+
+// locate returns the country of an IP, unknown when no network of the file holds it.
+func (g *geoLocator) locate(address string) string {
+	if country, ok := g.cache[address]; ok {
+		return country
+	}
+	country := "unknown"
+	if ip := net.ParseIP(address); ip != nil {
+		for _, r := range g.ranges {
+			if r.network.Contains(ip) {
+				country = r.country
+				break
+			}
+		}
+	}
+	g.cache[address] = country
+	return country
+}
+
+// splitAccessLogLine splits a line of an S3 server access log in its fields, the [time] and the "quoted"
+// fields being one field each.
+func splitAccessLogLine(line string) []string {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ':
+			i++
+		case '[', '"':
+			closing := byte(']')
+			if line[i] == '"' {
+				closing = '"'
+			}
+			end := strings.IndexByte(line[i+1:], closing)
+			if end < 0 {
+				return append(fields, line[i+1:])
+			}
+			fields = append(fields, line[i+1:i+1+end])
+			i += end + 2
+		default:
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				return append(fields, line[i:])
+			}
+			fields = append(fields, line[i:i+end])
+			i += end
+		}
+	}
+	return fields
+}
+
+// parseAccessLogLine reads a request of an S3 server access log: bucket owner, bucket, time, remote IP,
+// requester, request ID, operation, key, request URI, HTTP status and the other fields.
+func parseAccessLogLine(line string) (accessLogRecord, error) {
+	fields := splitAccessLogLine(line)
+	if len(fields) < 10 {
+		return accessLogRecord{}, fmt.Errorf("%d fields, expected at least 10", len(fields))
+	}
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", fields[2])
+	if err != nil {
+		return accessLogRecord{}, err
+	}
+	status, _ := strconv.Atoi(fields[9])
+	return accessLogRecord{bucket: fields[1], time: t, ip: fields[3], requester: fields[4], status: status}, nil
+}
+
+// parseCloudFrontLog reads the requests of a CloudFront standard log, whose #Fields line names the columns.
+func parseCloudFrontLog(r io.Reader, record func(accessLogRecord)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	columns := map[string]int{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#Fields:") {
+			for i, name := range strings.Fields(strings.TrimPrefix(line, "#Fields:")) {
+				columns[name] = i
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "#") || line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		value := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(fields) {
+				return fields[i]
+			}
+			return ""
+		}
+		t, err := time.Parse("2006-01-02 15:04:05", value("date")+" "+value("time"))
+		if err != nil {
+			continue
+		}
+		status, _ := strconv.Atoi(value("sc-status"))
+		edge := value("x-edge-location")
+		if len(edge) > 3 {
+			edge = edge[:3]
+		}
+		record(accessLogRecord{bucket: value("cs(Host)"), time: t, ip: value("c-ip"), requester: "-", status: status, geography: edge})
+	}
+	return scanner.Err()
+}
+
+// add counts a request in the statistics of its bucket.
+func (s *bucketLogStats) add(r accessLogRecord) {
+	s.requests++
+	s.ips[r.ip]++
+	if r.requester == "-" || r.requester == "" {
+		s.anonymous++
+	} else {
+		s.requesters[r.requester]++
+	}
+	if r.geography != "" {
+		s.geographies[r.geography]++
+	}
+	if r.status == 403 {
+		s.forbidden[r.time.UTC().Truncate(time.Hour)]++
+	}
+}
+
+// forbiddenSpikes returns the hours whose 403 responses reach forbiddenSpikeFactor times the mean of the hours
+// with 403 responses, and forbiddenSpikeMinimum.
+func (s *bucketLogStats) forbiddenSpikes() []time.Time {
+	total := 0
+	for _, count := range s.forbidden {
+		total += count
+	}
+	var spikes []time.Time
+	if len(s.forbidden) == 0 {
+		return spikes
+	}
+	mean := float64(total) / float64(len(s.forbidden))
+	for hour, count := range s.forbidden {
+		if count >= forbiddenSpikeMinimum && float64(count) >= forbiddenSpikeFactor*mean {
+			spikes = append(spikes, hour)
+		}
+	}
+	sort.Slice(spikes, func(i, j int) bool { return spikes[i].Before(spikes[j]) })
+	return spikes
+}
+
+// unusualGeographies returns the geographies of the requests outside the expected ones, or under
+// unusualGeographyShare of the requests when none is expected.
+func (s *bucketLogStats) unusualGeographies(expected map[string]bool) []string {
+	var unusual []string
+	for geography, count := range s.geographies {
+		if geography == "unknown" {
+			continue
+		}
+		if len(expected) > 0 && !expected[geography] || len(expected) == 0 && float64(count) < unusualGeographyShare*float64(s.requests) {
+			unusual = append(unusual, fmt.Sprintf("%s (%d)", geography, count))
+		}
+	}
+	sort.Strings(unusual)
+	return unusual
+}
+
+// topCounts returns the n keys with the largest counts, with their count.
+func topCounts(counts map[string]int, n int) []string {
+	var keys []string
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	var top []string
+	for _, key := range keys {
+		top = append(top, fmt.Sprintf("%s (%d)", key, counts[key]))
+	}
+	return top
+}
+
+// AnalyzeLogs reads the access logs delivered between From and To, by the modification date of the log
+// objects, and writes the top requester IPs and ARNs, the anonymous requests, the spikes of 403 responses and
+// the unusual geographies of each bucket.
+func AnalyzeLogs(c context.Context, cfg aws.Config, analysis LogAnalysis, w io.Writer) error {
+	if analysis.Format != "s3" && analysis.Format != "cloudfront" {
+		return fmt.Errorf("invalid format %q, expected one of: s3, cloudfront", analysis.Format)
+	}
+	var locator *geoLocator
+	if analysis.GeoFile != "" {
+		var err error
+		if locator, err = loadGeoLocator(analysis.GeoFile); err != nil {
+			return fmt.Errorf("reading the geographies %v: %v", analysis.GeoFile, err)
+		}
+	}
+	expected := map[string]bool{}
+	for _, country := range splitList(analysis.ExpectedCountries) {
+		expected[strings.ToUpper(country)] = true
+	}
+
+	client, _, err := newBucketClient(c, cfg, analysis.Bucket, "")
+	if err != nil {
+		return err
+	}
+
+	stats := map[string]*bucketLogStats{}
+	record := func(r accessLogRecord) {
+		if r.time.Before(analysis.From) || !r.time.Before(analysis.To) {
+			return
+		}
+		if locator != nil {
+			r.geography = locator.locate(r.ip)
+		}
+		s, ok := stats[r.bucket]
+		if !ok {
+			s = &bucketLogStats{ips: map[string]int{}, requesters: map[string]int{}, geographies: map[string]int{}, forbidden: map[time.Time]int{}}
+			stats[r.bucket] = s
+		}
+		s.add(r)
+	}
+
+	objects, skipped := 0, 0
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(analysis.Bucket), Prefix: aws.String(analysis.Prefix)}
+	for {
+		page, err := client.ListObjectsV2(c, input)
+		if err != nil {
+			return fmt.Errorf("listing the logs: %v", err)
+		}
+		for _, object := range page.Contents {
+			// the logs are delivered within hours of the requests
+			modified := aws.ToTime(object.LastModified)
+			if modified.Before(analysis.From) || modified.After(analysis.To.Add(24*time.Hour)) {
+				continue
+			}
+			objects++
+			if err := readAccessLog(c, client, analysis.Bucket, aws.ToString(object.Key), analysis.Format, record); err != nil {
+				log.Printf("Got an error reading the log %v: %v", aws.ToString(object.Key), err)
+				skipped++
+			}
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+
+	writeLogAnalysis(w, analysis, stats, expected, objects, skipped)
+	return nil
+}
+
+// readAccessLog reads the requests of a log object, gzipped when its key ends with .gz.
+func readAccessLog(c context.Context, api ObjectReaderAPI, bucket string, key string, format string, record func(accessLogRecord)) error {
+	object, err := api.GetObject(c, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return err
+	}
+	defer object.Body.Close()
+	var body io.Reader = object.Body
+	if strings.HasSuffix(key, ".gz") {
+		gz, err := gzip.NewReader(object.Body)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	}
+
+	if format == "cloudfront" {
+		return parseCloudFrontLog(body, record)
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r, err := parseAccessLogLine(scanner.Text())
+		if err != nil {
+			continue
+		}
+		record(r)
+	}
+	return scanner.Err()
+}
+
+// writeLogAnalysis writes the statistics of each bucket of the logs.
+func writeLogAnalysis(w io.Writer, analysis LogAnalysis, stats map[string]*bucketLogStats, expected map[string]bool, objects int, skipped int) {
+	fmt.Fprintf(w, "Access logs of s3://%s/%s from %s to %s: %d log objects read", analysis.Bucket, analysis.Prefix,
+		analysis.From.Format("2006-01-02 15:04"), analysis.To.Format("2006-01-02 15:04"), objects)
+	if skipped > 0 {
+		fmt.Fprintf(w, ", %d could not be read", skipped)
+	}
+	fmt.Fprintln(w)
+	if len(stats) == 0 {
+		fmt.Fprintln(w, "No request in the period")
+		return
+	}
+
+	var buckets []string
+	for bucket := range stats {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	for _, bucket := range buckets {
+		s := stats[bucket]
+		fmt.Fprintf(w, "\nBucket: %s\t Requests: %d\t Anonymous: %d\n", bucket, s.requests, s.anonymous)
+		fmt.Fprintf(w, "\tTop IPs: %s\n", strings.Join(topCounts(s.ips, analysis.Top), ", "))
+		if len(s.requesters) > 0 {
+			fmt.Fprintf(w, "\tTop requesters: %s\n", strings.Join(topCounts(s.requesters, analysis.Top), ", "))
+		}
+		for _, hour := range s.forbiddenSpikes() {
+			fmt.Fprintf(w, "\t403 spike: %s\t Responses: %d\n", hour.Format("2006-01-02 15:00"), s.forbidden[hour])
+		}
+		if unusual := s.unusualGeographies(expected); len(unusual) > 0 {
+			fmt.Fprintf(w, "\tUnusual geographies: %s\n", strings.Join(unusual, ", "))
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/s3control/types"
+)
+
+// S3ControlListAccessPointsApi defines the interface for the ListAccessPoints function.
+// We use this interface to test the function using a mocked service.
+type S3ControlListAccessPointsApi interface {
+	ListAccessPoints(ctx context.Context,
+		params *s3control.ListAccessPointsInput,
+		optFns ...func(*s3control.Options)) (*s3control.ListAccessPointsOutput, error)
+}
+
+// S3ControlGetAccessPointPolicyApi defines the interface for the GetAccessPointPolicy function.
+// We use this interface to test the function using a mocked service.
+type S3ControlGetAccessPointPolicyApi interface {
+	GetAccessPointPolicy(ctx context.Context,
+		params *s3control.GetAccessPointPolicyInput,
+		optFns ...func(*s3control.Options)) (*s3control.GetAccessPointPolicyOutput, error)
+}
+
+// S3ControlGetAccessPointPolicyStatusApi defines the interface for the GetAccessPointPolicyStatus function.
+// We use this interface to test the function using a mocked service.
+type S3ControlGetAccessPointPolicyStatusApi interface {
+	GetAccessPointPolicyStatus(ctx context.Context,
+		params *s3control.GetAccessPointPolicyStatusInput,
+		optFns ...func(*s3control.Options)) (*s3control.GetAccessPointPolicyStatusOutput, error)
+}
+
+// s3AccessPointApi groups the S3 Control calls needed to audit the access points of a bucket.
+type s3AccessPointApi interface {
+	S3ControlListAccessPointsApi
+	S3ControlGetAccessPointPolicyApi
+	S3ControlGetAccessPointPolicyStatusApi
+}
+
+// accessPoint defines an access point attached to a bucket
+type accessPoint struct {
+	name          string
+	networkOrigin string
+	vpcID         string
+	policy        string
+	public        bool
+	wildcard      bool
+}
+
+// ListAccessPoints retrieves the access points of an account, optionally restricted to a single bucket.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListAccessPointsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListAccessPoints.
+func ListAccessPoints(c context.Context, api S3ControlListAccessPointsApi, input *s3control.ListAccessPointsInput) (*s3control.ListAccessPointsOutput, error) {
+	return api.ListAccessPoints(c, input)
+}
+
+// GetAccessPointPolicy returns the resource policy of an access point.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetAccessPointPolicyOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetAccessPointPolicy.
+func GetAccessPointPolicy(c context.Context, api S3ControlGetAccessPointPolicyApi, input *s3control.GetAccessPointPolicyInput) (*s3control.GetAccessPointPolicyOutput, error) {
+	return api.GetAccessPointPolicy(c, input)
+}
+
+// GetAccessPointPolicyStatus returns whether the policy of an access point is considered public by S3.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetAccessPointPolicyStatusOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetAccessPointPolicyStatus.
+func GetAccessPointPolicyStatus(c context.Context, api S3ControlGetAccessPointPolicyStatusApi, input *s3control.GetAccessPointPolicyStatusInput) (*s3control.GetAccessPointPolicyStatusOutput, error) {
+	return api.GetAccessPointPolicyStatus(c, input)
+}
+
+// getAccessPoints lists the access points of a bucket together with their network restrictions and policies.
+// api must target the region of the bucket, access points are regional resources.
+func getAccessPoints(c context.Context, api s3AccessPointApi, accountID string, bucket string) ([]accessPoint, error) {
+	var accessPoints []accessPoint
+	input := &s3control.ListAccessPointsInput{
+		AccountId: aws.String(accountID),
+		Bucket:    aws.String(bucket),
+	}
+	for {
+		list, err := ListAccessPoints(c, api, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ap := range list.AccessPointList {
+			a := accessPoint{
+				name:          aws.ToString(ap.Name),
+				networkOrigin: string(ap.NetworkOrigin),
+			}
+			if ap.NetworkOrigin == types.NetworkOriginVpc && ap.VpcConfiguration != nil {
+				a.vpcID = aws.ToString(ap.VpcConfiguration.VpcId)
+			}
+
+			// an access point without a policy returns NoSuchAccessPointPolicy, which leaves it without grants
+			policy, err := GetAccessPointPolicy(c, api, &s3control.GetAccessPointPolicyInput{
+				AccountId: aws.String(accountID),
+				Name:      ap.Name,
+			})
+			if err == nil {
+				a.policy = aws.ToString(policy.Policy)
+				if doc, err := parsePolicy(a.policy); err == nil {
+					a.wildcard = doc.hasWildcardPrincipal()
+				}
+
+				status, err := GetAccessPointPolicyStatus(c, api, &s3control.GetAccessPointPolicyStatusInput{
+					AccountId: aws.String(accountID),
+					Name:      ap.Name,
+				})
+				if err != nil {
+					return nil, err
+				}
+				a.public = status.PolicyStatus != nil && status.PolicyStatus.IsPublic
+			}
+
+			accessPoints = append(accessPoints, a)
+		}
+
+		if list.NextToken == nil {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+
+	return accessPoints, nil
+}
+
+// accessPointFindings flags access points whose policy is public or grants access to any principal.
+func accessPointFindings(bucket string, accessPoints []accessPoint) []finding {
+	var findings []finding
+	for _, a := range accessPoints {
+		switch {
+		case a.public && a.networkOrigin == string(types.NetworkOriginInternet):
+			findings = append(findings, finding{
+				bucket:   bucket,
+				check:    "access-point",
+				severity: severityCritical,
+				message:  fmt.Sprintf("access point %s has a public policy and is reachable from the internet", a.name),
+			})
+		case a.public:
+			findings = append(findings, finding{
+				bucket:   bucket,
+				check:    "access-point",
+				severity: severityHigh,
+				message:  fmt.Sprintf("access point %s has a public policy (VPC %s)", a.name, a.vpcID),
+			})
+		case a.wildcard:
+			findings = append(findings, finding{
+				bucket:   bucket,
+				check:    "access-point",
+				severity: severityMedium,
+				message:  fmt.Sprintf("access point %s policy grants access to a wildcard principal", a.name),
+			})
+		}
+	}
+	return findings
+}
+
+// printAccessPoints prints the access points of a bucket below its report line.
+func printAccessPoints(accessPoints []accessPoint) {
+	for _, a := range accessPoints {
+		origin := a.networkOrigin
+		if a.vpcID != "" {
+			origin = fmt.Sprintf("%s (%s)", a.networkOrigin, a.vpcID)
+		}
+		fmt.Printf("\tAccess point: %s\t Network: %s\t Policy: %t\t Public: %t\n", a.name, origin, a.policy != "", a.public)
+	}
+}
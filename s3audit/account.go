@@ -0,0 +1,132 @@
+package s3audit
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/account"
+	"github.com/aws/aws-sdk-go-v2/service/account/types"
+	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// STSGetCallerIdentityApi defines the interface for the GetCallerIdentity function.
+// We use this interface to test the function using a mocked service.
+type STSGetCallerIdentityApi interface {
+	GetCallerIdentity(ctx context.Context,
+		params *sts.GetCallerIdentityInput,
+		optFns ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
+}
+
+// IAMListAccountAliasesApi defines the interface for the ListAccountAliases function.
+// We use this interface to test the function using a mocked service.
+type IAMListAccountAliasesApi interface {
+	ListAccountAliases(ctx context.Context,
+		params *iam.ListAccountAliasesInput,
+		optFns ...func(*iam.Options)) (*iam.ListAccountAliasesOutput, error)
+}
+
+// AccountListRegionsApi defines the interface for the ListRegions function.
+// We use this interface to test the function using a mocked service.
+type AccountListRegionsApi interface {
+	ListRegions(ctx context.Context,
+		params *account.ListRegionsInput,
+		optFns ...func(*account.Options)) (*account.ListRegionsOutput, error)
+}
+
+// GetCallerIdentity returns details about the IAM identity whose credentials are used to call the API.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetCallerIdentityOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetCallerIdentity.
+func GetCallerIdentity(c context.Context, api STSGetCallerIdentityApi, input *sts.GetCallerIdentityInput) (*sts.GetCallerIdentityOutput, error) {
+	return api.GetCallerIdentity(c, input)
+}
+
+// callerIdentity identifies the account and the principal the audit runs as.
+type callerIdentity struct {
+	// accountID is the ID of the account the credentials belong to; account-level APIs such as S3 Control
+	// require it on every request
+	accountID string
+	// arn is the ARN of the principal of the credentials, e.g. an assumed role session
+	arn string
+}
+
+// getCallerIdentity returns the account and the principal of the credentials of cfg.
+func getCallerIdentity(c context.Context, cfg aws.Config) (callerIdentity, error) {
+	identity, err := GetCallerIdentity(c, sts.NewFromConfig(cfg), &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return callerIdentity{}, err
+	}
+	return callerIdentity{accountID: aws.ToString(identity.Account), arn: aws.ToString(identity.Arn)}, nil
+}
+
+// ListAccountAliases returns the alias of the account, an account has at most one.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListAccountAliasesOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListAccountAliases.
+func ListAccountAliases(c context.Context, api IAMListAccountAliasesApi, input *iam.ListAccountAliasesInput) (*iam.ListAccountAliasesOutput, error) {
+	return api.ListAccountAliases(c, input)
+}
+
+// newIAMClient returns an IAM client, IAM is a global service called in the region of the partition.
+func newIAMClient(cfg aws.Config, region string) *iam.Client {
+	return iam.NewFromConfig(cfg, func(options *iam.Options) {
+		options.Region = region
+	})
+}
+
+// getAccountAlias returns the alias of the account, or "" when it has none.
+func getAccountAlias(c context.Context, api IAMListAccountAliasesApi) (string, error) {
+	aliases, err := ListAccountAliases(c, api, &iam.ListAccountAliasesInput{})
+	if err != nil {
+		return "", err
+	}
+	if len(aliases.AccountAliases) == 0 {
+		return "", nil
+	}
+	return aliases.AccountAliases[0], nil
+}
+
+// ListRegions returns the regions of the account and whether they are enabled.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListRegionsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListRegions.
+func ListRegions(c context.Context, api AccountListRegionsApi, input *account.ListRegionsInput) (*account.ListRegionsOutput, error) {
+	return api.ListRegions(c, input)
+}
+
+// getEnabledRegions returns the regions enabled in the account, by default or after opting in.
+func getEnabledRegions(c context.Context, api AccountListRegionsApi) ([]string, error) {
+	var regions []string
+
+	input := &account.ListRegionsInput{
+		RegionOptStatusContains: []types.RegionOptStatus{types.RegionOptStatusEnabled, types.RegionOptStatusEnabledByDefault},
+	}
+	for {
+		list, err := ListRegions(c, api, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, region := range list.Regions {
+			regions = append(regions, aws.ToString(region.RegionName))
+		}
+
+		if list.NextToken == nil {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+
+	return regions, nil
+}
@@ -0,0 +1,83 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"sort"
+	"sync"
+)
+
+// apiCalls counts the AWS API calls of an audit by service, and refuses the calls beyond the budget.
+type apiCalls struct {
+	mutex    sync.Mutex
+	services map[string]int
+	total    int
+	refused  int
+	// max is the budget of calls, 0 for no budget
+	max int
+}
+
+// newAPICalls returns a counter with a budget of max calls, 0 for no budget.
+func newAPICalls(max int) *apiCalls {
+	return &apiCalls{services: map[string]int{}, max: max}
+}
+
+// count records a call to a service, or returns ErrBudgetExceeded when the budget is spent.
+func (calls *apiCalls) count(service string) error {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	if calls.max > 0 && calls.total >= calls.max {
+		calls.refused++
+		return fmt.Errorf("%w: %d API calls made", ErrBudgetExceeded, calls.total)
+	}
+	calls.services[service]++
+	calls.total++
+	return nil
+}
+
+// exceeded reports whether the budget is spent.
+func (calls *apiCalls) exceeded() bool {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	return calls.max > 0 && calls.total >= calls.max
+}
+
+// instrument counts the calls of every client created from the config.
+func (calls *apiCalls) instrument(cfg aws.Config) aws.Config {
+	cfg = cfg.Copy()
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("APICallBudget",
+			func(c context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				if err := calls.count(awsmiddleware.GetServiceID(c)); err != nil {
+					return middleware.InitializeOutput{}, middleware.Metadata{}, err
+				}
+				return next.HandleInitialize(c, in)
+			}), middleware.Before)
+	})
+	return cfg
+}
+
+// print prints the number of calls by service, and how many were refused by the budget.
+func (calls *apiCalls) print() {
+	calls.mutex.Lock()
+	defer calls.mutex.Unlock()
+
+	var services []string
+	for service := range calls.services {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	fmt.Printf("\nAPI calls: %d\n", calls.total)
+	for _, service := range services {
+		fmt.Printf("Service: %s\t Calls: %d\n", service, calls.services[service])
+	}
+	if calls.refused > 0 {
+		fmt.Printf("Budget of %d call(s) reached, %d call(s) refused\n", calls.max, calls.refused)
+	}
+}
@@ -0,0 +1,316 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/athena/types"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// athenaPollInterval is the time between two reads of the state of a running Athena query
+const athenaPollInterval = time.Second
+
+// AthenaStartQueryExecutionApi defines the interface for the StartQueryExecution function.
+// We use this interface to test the function using a mocked service.
+type AthenaStartQueryExecutionApi interface {
+	StartQueryExecution(ctx context.Context,
+		params *athena.StartQueryExecutionInput,
+		optFns ...func(*athena.Options)) (*athena.StartQueryExecutionOutput, error)
+}
+
+// AthenaGetQueryExecutionApi defines the interface for the GetQueryExecution function.
+// We use this interface to test the function using a mocked service.
+type AthenaGetQueryExecutionApi interface {
+	GetQueryExecution(ctx context.Context,
+		params *athena.GetQueryExecutionInput,
+		optFns ...func(*athena.Options)) (*athena.GetQueryExecutionOutput, error)
+}
+
+// AthenaGetQueryResultsApi defines the interface for the GetQueryResults function.
+// We use this interface to test the function using a mocked service.
+type AthenaGetQueryResultsApi interface {
+	GetQueryResults(ctx context.Context,
+		params *athena.GetQueryResultsInput,
+		optFns ...func(*athena.Options)) (*athena.GetQueryResultsOutput, error)
+}
+
+// athenaApi groups the Athena calls of the inventory analytics.
+type athenaApi interface {
+	AthenaStartQueryExecutionApi
+	AthenaGetQueryExecutionApi
+	AthenaGetQueryResultsApi
+}
+
+// StartQueryExecution starts an Athena query, it runs in the background.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a StartQueryExecutionOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to StartQueryExecution.
+func StartQueryExecution(c context.Context, api AthenaStartQueryExecutionApi, input *athena.StartQueryExecutionInput) (*athena.StartQueryExecutionOutput, error) {
+	return api.StartQueryExecution(c, input)
+}
+
+// GetQueryExecution returns the state of an Athena query.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetQueryExecutionOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetQueryExecution.
+func GetQueryExecution(c context.Context, api AthenaGetQueryExecutionApi, input *athena.GetQueryExecutionInput) (*athena.GetQueryExecutionOutput, error) {
+	return api.GetQueryExecution(c, input)
+}
+
+// GetQueryResults returns a page of the rows of a completed Athena query.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetQueryResultsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetQueryResults.
+func GetQueryResults(c context.Context, api AthenaGetQueryResultsApi, input *athena.GetQueryResultsInput) (*athena.GetQueryResultsOutput, error) {
+	return api.GetQueryResults(c, input)
+}
+
+// AthenaAnalysis defines the canned queries run over an Athena table of S3 Inventory data. Location is the
+// hive/ folder of Parquet inventory reports the table is created over, e.g. s3://inventory/fleet/hive/; the
+// existing table is used when empty. Queries are encryption, storage-class and orphaned-prefixes, an orphaned
+// prefix holding no object modified for OrphanDays.
+type AthenaAnalysis struct {
+	Database       string
+	Table          string
+	Location       string
+	Workgroup      string
+	OutputLocation string
+	Queries        string
+	OrphanDays     int
+	// Format is the format the results are written in: table, csv or json
+	Format string
+}
+
+// athenaIdentifierPattern matches the database and table names Athena accepts without quoting
+var athenaIdentifierPattern = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// athenaQueryResult defines the rows of a completed Athena query.
+type athenaQueryResult struct {
+	name    string
+	columns []string
+	rows    [][]string
+}
+
+// inventoryTableDDL creates the table over the hive/ folder of Parquet inventory reports, a partition per
+// report date, dt. The optional fields an inventory does not include read as null.
+func inventoryTableDDL(database string, table string, location string) string {
+	return fmt.Sprintf(`CREATE EXTERNAL TABLE IF NOT EXISTS %s.%s (
+  bucket string,
+  key string,
+  version_id string,
+  is_latest boolean,
+  is_delete_marker boolean,
+  size bigint,
+  last_modified_date timestamp,
+  e_tag string,
+  storage_class string,
+  encryption_status string,
+  bucket_key_status string
+)
+PARTITIONED BY (dt string)
+ROW FORMAT SERDE 'org.apache.hadoop.hive.ql.io.parquet.serde.ParquetHiveSerDe'
+STORED AS INPUTFORMAT 'org.apache.hadoop.hive.ql.io.SymlinkTextInputFormat'
+OUTPUTFORMAT 'org.apache.hadoop.hive.ql.io.IgnoreKeyTextOutputFormat'
+LOCATION '%s'`, database, table, strings.TrimSuffix(location, "/")+"/")
+}
+
+// inventoryQueries returns the canned queries over the current objects of the latest report of a table.
+func inventoryQueries(table string, orphanDays int) map[string]string {
+	current := fmt.Sprintf("dt = (SELECT MAX(dt) FROM %s) AND COALESCE(is_latest, true) AND NOT COALESCE(is_delete_marker, false)", table)
+	return map[string]string{
+		"encryption": fmt.Sprintf(`SELECT bucket, encryption_status, COUNT(*) AS objects, SUM(size) AS bytes
+FROM %s WHERE %s
+GROUP BY bucket, encryption_status ORDER BY bucket, encryption_status`, table, current),
+		"storage-class": fmt.Sprintf(`SELECT bucket, storage_class, COUNT(*) AS objects, SUM(size) AS bytes
+FROM %s WHERE %s
+GROUP BY bucket, storage_class ORDER BY bucket, bytes DESC`, table, current),
+		"orphaned-prefixes": fmt.Sprintf(`SELECT bucket, regexp_extract(key, '^[^/]*/') AS prefix, COUNT(*) AS objects, SUM(size) AS bytes,
+  MAX(last_modified_date) AS last_modified
+FROM %s WHERE %s AND strpos(key, '/') > 0
+GROUP BY bucket, regexp_extract(key, '^[^/]*/')
+HAVING MAX(last_modified_date) < date_add('day', -%d, current_timestamp)
+ORDER BY bytes DESC`, table, current, orphanDays),
+	}
+}
+
+// runAthenaQuery runs a query and waits for it to complete. The rows of its result are returned for a SELECT,
+// the first one being the header. The queries name the database of their tables, it may not exist yet.
+func runAthenaQuery(c context.Context, api athenaApi, analysis AthenaAnalysis, query string) (*athenaQueryResult, error) {
+	input := &athena.StartQueryExecutionInput{QueryString: aws.String(query)}
+	if analysis.Workgroup != "" {
+		input.WorkGroup = aws.String(analysis.Workgroup)
+	}
+	if analysis.OutputLocation != "" {
+		input.ResultConfiguration = &types.ResultConfiguration{OutputLocation: aws.String(analysis.OutputLocation)}
+	}
+	started, err := StartQueryExecution(c, api, input)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		execution, err := GetQueryExecution(c, api, &athena.GetQueryExecutionInput{QueryExecutionId: started.QueryExecutionId})
+		if err != nil {
+			return nil, err
+		}
+		status := execution.QueryExecution.Status
+		if status.State == types.QueryExecutionStateSucceeded {
+			break
+		}
+		if status.State == types.QueryExecutionStateFailed || status.State == types.QueryExecutionStateCancelled {
+			return nil, fmt.Errorf("query %s: %s", strings.ToLower(string(status.State)), aws.ToString(status.StateChangeReason))
+		}
+		select {
+		case <-c.Done():
+			return nil, c.Err()
+		case <-time.After(athenaPollInterval):
+		}
+	}
+
+	result := &athenaQueryResult{}
+	resultsInput := &athena.GetQueryResultsInput{QueryExecutionId: started.QueryExecutionId}
+	for {
+		page, err := GetQueryResults(c, api, resultsInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range page.ResultSet.Rows {
+			var values []string
+			for _, datum := range row.Data {
+				values = append(values, aws.ToString(datum.VarCharValue))
+			}
+			if result.columns == nil {
+				result.columns = values
+				continue
+			}
+			result.rows = append(result.rows, values)
+		}
+		if page.NextToken == nil {
+			return result, nil
+		}
+		resultsInput.NextToken = page.NextToken
+	}
+}
+
+// AnalyzeAthena creates the Athena database and the table of the inventory data when a Location is given,
+// loads the partitions of the new reports, then runs the canned queries and writes their results.
+func AnalyzeAthena(c context.Context, cfg aws.Config, analysis AthenaAnalysis, w io.Writer) error {
+	if !athenaIdentifierPattern.MatchString(analysis.Database) || !athenaIdentifierPattern.MatchString(analysis.Table) {
+		return fmt.Errorf("invalid database or table name, expected lower case letters, digits and underscores")
+	}
+	if analysis.Format != "table" && analysis.Format != "csv" && analysis.Format != "json" {
+		return fmt.Errorf("invalid format %q, expected one of: table, csv, json", analysis.Format)
+	}
+	table := analysis.Database + "." + analysis.Table
+	queries := inventoryQueries(table, analysis.OrphanDays)
+	names := splitList(analysis.Queries)
+	for _, name := range names {
+		if _, ok := queries[name]; !ok {
+			return fmt.Errorf("unknown query %q, expected one of: encryption, storage-class, orphaned-prefixes", name)
+		}
+	}
+
+	client := athena.NewFromConfig(cfg)
+
+	if analysis.Location != "" {
+		if !strings.HasPrefix(analysis.Location, "s3://") {
+			return fmt.Errorf("invalid location %q, expected the s3:// URL of the hive/ folder of the inventory", analysis.Location)
+		}
+		for _, statement := range []string{
+			"CREATE DATABASE IF NOT EXISTS " + analysis.Database,
+			inventoryTableDDL(analysis.Database, analysis.Table, analysis.Location),
+			"MSCK REPAIR TABLE " + table,
+		} {
+			if _, err := runAthenaQuery(c, client, analysis, statement); err != nil {
+				return fmt.Errorf("creating the table %s: %v", table, err)
+			}
+		}
+	}
+
+	var results []*athenaQueryResult
+	for _, name := range names {
+		result, err := runAthenaQuery(c, client, analysis, queries[name])
+		if err != nil {
+			return fmt.Errorf("running the %s query: %v", name, err)
+		}
+		result.name = name
+		results = append(results, result)
+	}
+	return writeAthenaResults(w, results, analysis.Format)
+}
+
+// writeAthenaResults writes the results of the queries as tables, as CSV sections or as a JSON object of the
+// rows of each query.
+func writeAthenaResults(w io.Writer, results []*athenaQueryResult, format string) error {
+	switch format {
+	case "json":
+		document := map[string][]map[string]string{}
+		for _, result := range results {
+			rows := []map[string]string{}
+			for _, row := range result.rows {
+				record := map[string]string{}
+				for i, column := range result.columns {
+					if i < len(row) {
+						record[column] = row[i]
+					}
+				}
+				rows = append(rows, record)
+			}
+			document[result.name] = rows
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(document)
+	case "csv":
+		writer := csv.NewWriter(w)
+		for _, result := range results {
+			writer.Write(append([]string{"query"}, result.columns...))
+			for _, row := range result.rows {
+				writer.Write(append([]string{result.name}, row...))
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		for _, result := range results {
+			fmt.Fprintf(w, "\n%s:\n", result.name)
+			if len(result.rows) == 0 {
+				fmt.Fprintln(w, "\tnone")
+				continue
+			}
+			var columns []column
+			for _, name := range result.columns {
+				columns = append(columns, column{header: strings.ToUpper(name)})
+			}
+			t := newTable(false, columns...)
+			for _, row := range result.rows {
+				var cells []cell
+				for _, value := range row {
+					cells = append(cells, cell{text: value})
+				}
+				t.add(cells...)
+			}
+			t.write(w)
+		}
+		return nil
+	}
+}
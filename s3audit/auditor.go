@@ -0,0 +1,1282 @@
+// Package s3audit audits the configuration of the S3 buckets of an AWS account.
+package s3audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/guardduty"
+	"github.com/aws/aws-sdk-go-v2/service/macie2"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options defines what the audit checks and reports. The zero value of a field disables the feature.
+type Options struct {
+	// StorageLens includes the account's S3 Storage Lens dashboards and their fleet-level storage trends.
+	StorageLens bool
+	// KMSMatrix includes a matrix of the KMS keys the buckets are encrypted with, their rotation and the
+	// number of principals of their key policy.
+	KMSMatrix bool
+	// Fix is a comma separated list of remediations to apply, e.g. intelligent-tiering,enforce-bucket-owner,enable-bucket-key.
+	// The destructive ones, delete-empty, are only applied once confirmed on the terminal.
+	Fix string
+	// SensitiveTags is a comma separated list of key=value tags marking buckets that hold sensitive data.
+	SensitiveTags string
+	// Export is the destination the findings are exported to, one of: securityhub.
+	Export string
+	// SecurityHubRegion is the region of the Security Hub the findings are exported to.
+	SecurityHubRegion string
+	// TerraformImport is the file Terraform import blocks are written to for the buckets not managed as code.
+	TerraformImport string
+	// ManagedTags is a comma separated list of key=value tags marking buckets already managed as code.
+	ManagedTags string
+	// TerraformState is the Terraform state to detect drift against, a local file or an s3://bucket/key URL.
+	TerraformState string
+	// Diagram is the file the data-flow diagram is written to, D2 for a .d2 file and Graphviz DOT otherwise.
+	Diagram string
+	// NamePattern is the regular expression every bucket name must match.
+	NamePattern string
+	// RequiredTags is a comma separated list of tags every bucket must carry, as key or key=value.
+	RequiredTags string
+	// CostTags is a comma separated list of the cost allocation tags every bucket must carry, reported with
+	// their coverage in the statistics. CostTagDefaults is the YAML file of the rules inferring the missing
+	// ones from the bucket names and the creators, offered as the cost-tags remediation.
+	CostTags        string
+	CostTagDefaults string
+	// CostExplorerTag is a cost allocation tag whose billed S3 costs of the last complete month are read from
+	// Cost Explorer, grouped by its values, and reported for the buckets carrying them, e.g. a bucket tag
+	// holding the bucket name for the cost of each bucket, or a team tag for the cost of its buckets together.
+	CostExplorerTag string
+	// Suppressions is the YAML file of accepted findings.
+	Suppressions string
+	// FailOn is the severity from which an unsuppressed finding fails the audit.
+	FailOn string
+	// TopFindings is the number of findings listed in the prioritized summary.
+	TopFindings int
+	// ConfigRules compares the results of the AWS Config S3 managed rules with the audit.
+	ConfigRules bool
+	// Concurrency is the number of buckets audited at the same time, 1 when not set.
+	Concurrency int
+	// AdaptiveConcurrency ignores Concurrency and adjusts the number of buckets audited at the same time to
+	// the throttling of the account: it ramps up until requests are throttled, then backs off.
+	AdaptiveConcurrency bool
+	// Checks is a comma separated list of the checks to run, all of them when empty. The settings of a bucket
+	// are only read when a check that uses them runs. The checks are also named by the setting they read:
+	// acl, versioning, cors and website.
+	Checks string
+	// SkipChecks is a comma separated list of the checks not to run.
+	SkipChecks string
+	// Buckets is a comma separated list of glob patterns of the buckets to audit, all of them when empty.
+	Buckets string
+	// CacheTTL is how long the bucket locations and CloudWatch size metrics are cached on disk, 0 disables the cache.
+	CacheTTL time.Duration
+	// CacheDir is the directory of the cache, a directory of the user cache directory when empty.
+	CacheDir string
+	// Checkpoint is the file the completed buckets are recorded in, no progress is recorded when empty. Run
+	// removes it once every bucket was recorded, and keeps it when the scan is incomplete.
+	Checkpoint string
+	// Resume skips the buckets recorded in the checkpoint file by a previous, interrupted scan. Stream does
+	// not yield them again.
+	Resume bool
+	// DryRun prints the calls and payloads of every operation that changes AWS, the remediations and the
+	// export of the findings, instead of making them.
+	DryRun bool
+	// Plan is the file the remediations selected with Fix, all of them when Fix is empty, are written to
+	// instead of being applied. The plan is applied later with ApplyPlan.
+	Plan string
+	// Output is a comma separated list of format=file reports written at the end of the audit, e.g.
+	// json=report.json,table=- where - is the standard output, also used by a format without a file. The
+	// formats are csv, github, html, json, jsonl, sarif and table; jsonl writes a line per bucket as soon as
+	// it is audited. The other formats, and the summary sections without any output, are built at the end
+	// from the compact result of every bucket, which the scan keeps in memory. With jsonl and the history as
+	// the only outputs, and no option working on every bucket such as Email, Fix, Plan, Jira or Export, the
+	// scan only keeps the first Top results: its memory no longer grows with the number of buckets.
+	Output string
+	// NoColor prints the tables of the report without colors.
+	NoColor bool
+	// Sort is the order of the buckets in the summary and the reports: name, size, created or risk. Size,
+	// creation date and risk list the largest, newest and riskiest buckets first.
+	Sort string
+	// Top limits the summary and the reports to the first buckets in the Sort order, all of them when 0. The
+	// statistics cover every bucket. With jsonl and the history as the only outputs, see Output, the scan
+	// keeps these results only, in a heap, and none when 0.
+	Top int
+	// OlderThan only audits the buckets created at least this long ago, all of them when 0.
+	OlderThan time.Duration
+	// NewerThan only audits the buckets created at most this long ago, all of them when 0.
+	NewerThan time.Duration
+	// ExpectedOwner flags the buckets owned by someone else: an account ID, or the canonical ID or display
+	// name of the owner in the bucket ACL.
+	ExpectedOwner string
+	// AccountID is set as the ExpectedBucketOwner of every request about a bucket, so a bucket name recycled
+	// by another account is refused by S3 instead of being audited.
+	AccountID string
+	// MaxAPICalls is the budget of AWS API calls of the audit, 0 for no budget. Once it is spent, the calls
+	// are refused, the settings they read are reported as unchecked and the remaining buckets are not audited.
+	MaxAPICalls int
+	// History is where the snapshots of the buckets are kept after each scan, e.g. dynamodb://table or
+	// sqlite://history.db; no history is kept when empty.
+	History string
+	// Database is a PostgreSQL database, as a postgres:// URL, the buckets, checks and findings of each scan
+	// are written to in normalized tables.
+	Database string
+	// Email is a comma separated list of addresses the HTML report is sent to through Amazon SES at the end
+	// of the audit, from the EmailFrom identity verified in SES.
+	Email     string
+	EmailFrom string
+	// Jira is the URL of a Jira site where an issue is opened for each new critical finding, and for each
+	// unencrypted bucket carrying one of the JiraProductionTags, in the JiraProject. The issues are closed
+	// once their finding disappears. The JIRA_USER and JIRA_API_TOKEN environment variables authenticate.
+	Jira               string
+	JiraProject        string
+	JiraProductionTags string
+	// PagerDuty triggers a PagerDuty event when a bucket became public or lost its default encryption since
+	// the previous scan kept in the History or the Database. The PAGERDUTY_ROUTING_KEY environment variable is
+	// the integration key of the service paged.
+	PagerDuty bool
+	// Record saves the responses of the AWS API calls to this directory, without the account ID and the
+	// identity of the caller. Replay runs the audit offline from the responses recorded in a directory.
+	Record string
+	Replay string
+	// S3Client returns the S3 client of a region, the region of the configuration when empty. It defaults to
+	// the clients of the SDK, e.g. s3audittest.FakeS3 audits a fake account instead.
+	S3Client func(region string) S3ClientAPI
+	// BucketTimeout bounds the time the audit of a bucket takes, no bound when 0. The settings not read in
+	// time are reported as unchecked, so a slow region does not stall the scan.
+	BucketTimeout time.Duration
+	// UseFIPS and UseDualStack call the FIPS and the dual-stack (IPv4 and IPv6) endpoints of the services.
+	UseFIPS      bool
+	UseDualStack bool
+	// Partition is the partition of the ARNs of the generated IAM policy, aws when empty, e.g. aws-us-gov or
+	// aws-cn. The audit takes the partition of each bucket from its region.
+	Partition string
+	// HTTP configures the HTTP client of the API calls, e.g. a proxy and the CA bundle of the network.
+	HTTP HTTPOptions
+	// Fields are the comma separated dot paths of the bucket fields the csv, json and table reports write,
+	// e.g. name,region,encryption.algorithm,tags.team, instead of their usual content
+	Fields string
+	// Redact replaces the bucket names by hashes and removes the KMS keys and the account IDs from the
+	// reports of Output and Email, so they can be shared outside the organization. The hashes are keyed by
+	// the S3AUDIT_REDACT_KEY environment variable, the same from scan to scan, or by a random key otherwise.
+	Redact bool
+	// SignKey signs the json and html reports of Output written to a file, in a detached <file>.sig: a PEM
+	// file of an Ed25519, ECDSA or RSA private key, or kms:<key> for a KMS asymmetric key.
+	SignKey string
+	// SplitBy writes a report per value of a tag, tag:<key>, next to each report of Output written to a file,
+	// e.g. report-data.json for the buckets tagged team=data with tag:team and json=report.json.
+	SplitBy string
+	// SplitWebhooks is the YAML file mapping the tag values of SplitBy to the URL their JSON report is posted
+	// to, * for the values it does not list.
+	SplitWebhooks string
+	// Creators looks up the CreateBucket event of each bucket to report who created it and when, and lists
+	// the creators of the orphan buckets, those missing a RequiredTags tag or any tag, as their probable
+	// owners. The CloudTrail event history covers 90 days; CreatorsTable, the <database>.<table> of an Athena
+	// table of the CloudTrail logs, covers the retention of the trail, its results written to
+	// CreatorsOutputLocation or to the location of the primary workgroup.
+	Creators               bool
+	CreatorsTable          string
+	CreatorsOutputLocation string
+	// TrustedAccounts is a comma separated list of the account IDs the bucket policies may grant access to,
+	// the principals of the other external accounts are flagged by the cross-account check.
+	TrustedAccounts string
+	// VPCEndpoints is the YAML file of the VPC-only buckets, with the VPC endpoints and VPCs their policy must
+	// restrict the requests to.
+	VPCEndpoints string
+	// EncryptionPolicy is the YAML file of the encryption each environment requires: the algorithms, the S3
+	// Bucket Key and the aliases of the KMS keys, the environment being the value of a tag of the buckets.
+	EncryptionPolicy string
+	// RequireDSSE flags the buckets whose default encryption is not dual-layer DSSE-KMS, for regulated
+	// workloads, and suggests the enable-dsse remediation.
+	RequireDSSE bool
+	// StaleDays flags the buckets without requests nor sampled writes for that many days, and lists them as
+	// the candidates for archival or deletion; 0 does not read the activity of the buckets.
+	StaleDays int
+	// KeepBuckets is a comma separated list of glob patterns of the empty buckets the delete-empty
+	// remediation never deletes, e.g. the buckets an application fills on demand.
+	KeepBuckets string
+	// ScanObjects lists the objects of every bucket to print their breakdown by storage class and the
+	// TopObjects largest of them, a ListObjectsV2 request per 1000 objects.
+	ScanObjects bool
+	TopObjects  int
+	// ActiveProbes sends unauthenticated HTTPS requests to the buckets found public, listing them and reading
+	// the ProbeKey sentinel object, or the first object of the bucket when it lacks the sentinel, to confirm
+	// from the outside whether they leak.
+	ActiveProbes bool
+	ProbeKey     string
+	// CloudFront maps the CloudFront distributions and the Route 53 records fronting each bucket, to flag the
+	// buckets served without Origin Access Control or public although fronted by CloudFront.
+	CloudFront bool
+}
+
+// Auditor audits the S3 buckets of the account of an AWS configuration.
+type Auditor struct {
+	cfg       aws.Config
+	options   Options
+	accountID string
+	// accountAlias is the IAM alias of the account, empty when it has none or it could not be read
+	accountAlias string
+	// callerArn is the ARN of the principal the audit runs as
+	callerArn string
+	s3Client  func(region string) S3ClientAPI
+	// unownedS3Client returns a client without the AccountID expected owner, for the requests that must reach
+	// a bucket of another account
+	unownedS3Client func(region string) S3ClientAPI
+
+	sensitive     tagMatcher
+	production    tagMatcher
+	jira          *jiraClient
+	pagerDutyKey  string
+	managed       tagMatcher
+	naming        namingRules
+	costTags      []string
+	suppressions  []suppression
+	failThreshold severity
+	declared      map[string]*declaredBucket
+	checks        checkSelection
+	buckets       []string
+	cache         *diskCache
+	outputs       []reportOutput
+	color         bool
+	checkpoint    *checkpoint
+	calls         *apiCalls
+	limiter       *concurrencyLimiter
+	quarantine    *regionQuarantine
+	histories     []historyStore
+	redactor      *redactor
+	signer        signer
+	splitKey      string
+	teamWebhooks  map[string]string
+	creatorsTable AthenaAnalysis
+	fields        []string
+	trusted       map[string]bool
+	vpcEndpoints  []vpcOnlyBucket
+	// encryptionPolicy is nil without an EncryptionPolicy file, aliases caches the aliases of its KMS keys
+	encryptionPolicy *encryptionPolicy
+	aliases          kmsAliasCache
+	// costTagDefaults is nil without a CostTagDefaults file
+	costTagDefaults *costTagDefaults
+
+	publicAccessBlock accountPublicAccessBlock
+	publicAccessErr   error
+	// fronts are the distributions and records fronting each bucket, only read with CloudFront
+	fronts map[string][]bucketFront
+	// listOwner is the owner returned by ListBuckets, the canonical user of the account
+	listOwner *types.Owner
+
+	// the data read once per region is loaded by the first bucket of the region, the mutex guards the map and
+	// not the loads
+	mutex   sync.Mutex
+	regions map[string]*regionState
+}
+
+// regionState holds the data read once per region and shared by the buckets of the region. once loads it,
+// the other buckets of the region wait for the load without holding up the buckets of the other regions.
+type regionState struct {
+	once sync.Once
+
+	analysis      regionAnalysis
+	coverage      []trailCoverage
+	configResults map[string][]configRuleResult
+	sensitiveData map[string]map[string]int64
+	guardDuty     regionGuardDuty
+}
+
+// Finding is a problem detected on a bucket. Suppressed holds the reason the finding was accepted, if any.
+type Finding struct {
+	Bucket     string `json:"bucket"`
+	Check      string `json:"check"`
+	Severity   string `json:"severity"`
+	Message    string `json:"message"`
+	Suppressed string `json:"suppressed,omitempty"`
+}
+
+// BucketResult is the outcome of the audit of one bucket.
+type BucketResult struct {
+	Name     string
+	Region   string
+	Created  time.Time
+	Findings []Finding
+	// Errors holds the settings that could not be read, their checks were skipped
+	Errors []ReadError
+	// Duration is the time the audit of the bucket took, and TimedOut whether it ran out of BucketTimeout
+	Duration time.Duration
+	TimedOut bool
+	// Retried is true for the buckets of a quarantined region, audited again at the end of the scan
+	Retried bool
+
+	// public is true when the bucket was found public, kept for the statistics once the settings are dropped
+	public bool
+
+	bucket       s3Bucket
+	findings     []finding
+	remediations []remediation
+	score        int
+	// restored is true for the buckets completed by a previous, interrupted scan
+	restored bool
+	// deferred is true for the buckets of a quarantined region, not audited yet
+	deferred bool
+	// creator is the identity that created the bucket, nil when not looked up or not found
+	creator *bucketCreator
+	// cost is the billed cost of its CostExplorerTag value, nil when not read or the bucket does not carry it
+	cost *bucketCost
+	// unrecorded is true when the bucket was left out of the checkpoint, a resumed scan audits it again
+	unrecorded bool
+}
+
+// New validates the options and returns an Auditor for the account of cfg.
+func New(c context.Context, cfg aws.Config, options Options) (*Auditor, error) {
+	// the recording wraps the client configured with the HTTP options
+	cfg, err := withHTTPOptions(cfg, options.HTTP)
+	if err != nil {
+		return nil, err
+	}
+	if cfg, err = withFixtures(cfg, options.Record, options.Replay); err != nil {
+		return nil, err
+	}
+	if cfg, err = withEndpointOptions(cfg, options.UseFIPS, options.UseDualStack); err != nil {
+		return nil, err
+	}
+	// every call of the audit is counted against the budget, from the calls made by New on
+	calls := newAPICalls(options.MaxAPICalls)
+	cfg = calls.instrument(cfg)
+	limiter := newConcurrencyLimiter(options.Concurrency, options.AdaptiveConcurrency)
+	cfg = limiter.instrument(cfg)
+	a := &Auditor{cfg: cfg, options: options, calls: calls, limiter: limiter, quarantine: newRegionQuarantine(),
+		regions: map[string]*regionState{}, aliases: kmsAliasCache{aliases: map[string][]string{}}}
+	a.s3Client = options.S3Client
+	a.unownedS3Client = options.S3Client
+	if a.s3Client == nil {
+		a.s3Client = a.newS3Client
+		a.unownedS3Client = func(region string) S3ClientAPI {
+			return newS3Client(a.cfg, region, "")
+		}
+	}
+
+	if a.sensitive, err = parseTagMatcher(options.SensitiveTags); err != nil {
+		return nil, fmt.Errorf("invalid sensitive tags: %v", err)
+	}
+	if a.managed, err = parseTagMatcher(options.ManagedTags); err != nil {
+		return nil, fmt.Errorf("invalid managed tags: %v", err)
+	}
+	if options.NamePattern != "" {
+		if a.naming.pattern, err = regexp.Compile(options.NamePattern); err != nil {
+			return nil, fmt.Errorf("invalid name pattern: %v", err)
+		}
+	}
+	a.costTags = splitList(options.CostTags)
+	if options.CostTagDefaults != "" {
+		if len(a.costTags) == 0 {
+			return nil, fmt.Errorf("inferring cost allocation tags needs the list of the cost allocation tags")
+		}
+		if a.costTagDefaults, err = loadCostTagDefaults(options.CostTagDefaults); err != nil {
+			return nil, fmt.Errorf("loading the cost allocation tag defaults: %v", err)
+		}
+	}
+	if a.naming.requiredTags, err = parseRequiredTags(options.RequiredTags); err != nil {
+		return nil, fmt.Errorf("invalid required tags: %v", err)
+	}
+	if options.Suppressions != "" {
+		if a.suppressions, err = loadSuppressions(options.Suppressions); err != nil {
+			return nil, fmt.Errorf("invalid suppressions: %v", err)
+		}
+	}
+	if options.FailOn != "" {
+		if a.failThreshold, err = parseSeverity(options.FailOn); err != nil {
+			return nil, fmt.Errorf("invalid fail-on severity: %v", err)
+		}
+	}
+	if a.checks, err = newCheckSelection(options.Checks, options.SkipChecks); err != nil {
+		return nil, err
+	}
+	if a.trusted, err = parseTrustedAccounts(options.TrustedAccounts); err != nil {
+		return nil, fmt.Errorf("invalid trusted accounts: %v", err)
+	}
+	if options.VPCEndpoints != "" {
+		if a.vpcEndpoints, err = loadVPCEndpoints(options.VPCEndpoints); err != nil {
+			return nil, fmt.Errorf("invalid VPC endpoints: %v", err)
+		}
+	}
+	if options.EncryptionPolicy != "" {
+		if a.encryptionPolicy, err = loadEncryptionPolicy(options.EncryptionPolicy); err != nil {
+			return nil, fmt.Errorf("invalid encryption policy: %v", err)
+		}
+	}
+	for _, pattern := range splitList(options.Buckets) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid bucket pattern %q", pattern)
+		}
+		a.buckets = append(a.buckets, pattern)
+	}
+
+	cacheDir := options.CacheDir
+	if cacheDir == "" {
+		cacheDir = defaultCacheDir()
+	}
+	if a.cache, err = newDiskCache(cacheDir, options.CacheTTL); err != nil {
+		return nil, fmt.Errorf("creating the cache: %v", err)
+	}
+
+	if options.Checkpoint != "" {
+		if a.checkpoint, err = loadCheckpoint(options.Checkpoint, options.Resume); err != nil {
+			return nil, fmt.Errorf("reading the checkpoint %v: %v", options.Checkpoint, err)
+		}
+	} else if options.Resume {
+		return nil, errors.New("resuming requires a checkpoint file")
+	}
+
+	a.color = useColor(options.NoColor)
+	if options.AccountID != "" && !accountIDPattern.MatchString(options.AccountID) {
+		return nil, fmt.Errorf("invalid account ID %q, expected 12 digits", options.AccountID)
+	}
+	if options.StaleDays < 0 {
+		return nil, fmt.Errorf("invalid stale days %d, expected 0 or more", options.StaleDays)
+	}
+	if options.Sort != "" && !sortKeys[options.Sort] {
+		return nil, fmt.Errorf("invalid sort %q, expected one of: name, size, created, risk", options.Sort)
+	}
+	if a.outputs, err = parseOutputs(options.Output); err != nil {
+		return nil, err
+	}
+	if a.redactor, err = newRedactor(options.Redact); err != nil {
+		return nil, fmt.Errorf("creating the redaction key: %v", err)
+	}
+	if options.SignKey != "" {
+		if a.signer, err = newSigner(c, cfg, options.SignKey); err != nil {
+			return nil, fmt.Errorf("loading the signing key: %v", err)
+		}
+	}
+	if options.SplitBy != "" {
+		if a.splitKey, err = parseSplitBy(options.SplitBy); err != nil {
+			return nil, err
+		}
+	}
+	if options.SplitWebhooks != "" {
+		if a.splitKey == "" {
+			return nil, fmt.Errorf("posting the reports of the teams needs the tag they are split by")
+		}
+		if a.teamWebhooks, err = loadTeamWebhooks(options.SplitWebhooks); err != nil {
+			return nil, fmt.Errorf("loading the team webhooks: %v", err)
+		}
+	}
+	if options.CreatorsTable != "" {
+		if !options.Creators {
+			return nil, fmt.Errorf("querying a CloudTrail table needs the creators lookup")
+		}
+		if a.creatorsTable.Database, a.creatorsTable.Table, err = parseCreatorsTable(options.CreatorsTable); err != nil {
+			return nil, err
+		}
+		a.creatorsTable.OutputLocation = options.CreatorsOutputLocation
+	}
+	if a.fields, err = parseFields(options.Fields); err != nil {
+		return nil, err
+	}
+	if options.Jira != "" {
+		if options.JiraProject == "" {
+			return nil, fmt.Errorf("missing the Jira project of the issues")
+		}
+		if a.jira, err = newJiraClient(options.Jira); err != nil {
+			return nil, err
+		}
+		if a.production, err = parseTagMatcher(options.JiraProductionTags); err != nil {
+			return nil, fmt.Errorf("invalid production tags: %v", err)
+		}
+	}
+	if options.Email != "" && options.EmailFrom == "" {
+		return nil, fmt.Errorf("missing the sender of the email report, an identity verified in SES")
+	}
+
+	switch options.Export {
+	case "", "securityhub":
+	default:
+		return nil, fmt.Errorf("invalid export: unknown destination %q", options.Export)
+	}
+
+	if options.TerraformState != "" {
+		data, err := readTerraformState(c, cfg, options.TerraformState)
+		if err != nil {
+			return nil, fmt.Errorf("reading the Terraform state %v: %v", options.TerraformState, err)
+		}
+		if a.declared, err = parseTerraformState(data); err != nil {
+			return nil, fmt.Errorf("parsing the Terraform state %v: %v", options.TerraformState, err)
+		}
+	}
+
+	identity, err := getCallerIdentity(c, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("retrieving the account ID: %v", err)
+	}
+	a.accountID, a.callerArn = identity.accountID, identity.arn
+	// the alias only names the account in the reports, the audit goes on without it
+	if a.accountAlias, err = getAccountAlias(c, newIAMClient(a.cfg, cfg.Region)); err != nil {
+		log.Printf("Got an error retrieving the account alias: %v", err)
+	}
+	for _, location := range []string{options.History, options.Database} {
+		if location == "" {
+			continue
+		}
+		history, err := openHistory(c, cfg, location)
+		if err != nil {
+			return nil, fmt.Errorf("opening the history: %v", err)
+		}
+		a.histories = append(a.histories, history)
+	}
+	if options.PagerDuty {
+		if len(a.histories) == 0 {
+			return nil, fmt.Errorf("paging on regressions needs the previous scan, kept with a history or a database")
+		}
+		if a.pagerDutyKey, err = pagerDutyRoutingKey(); err != nil {
+			return nil, err
+		}
+	}
+
+	a.publicAccessBlock, a.publicAccessErr = getAccountPublicAccessBlock(c, s3control.NewFromConfig(cfg), a.accountID)
+
+	if options.CloudFront && a.checks.enabled("cloudfront") {
+		if a.fronts, err = loadBucketFronts(c, newCloudFrontClient(a.cfg), newRoute53Client(a.cfg)); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, nil
+}
+
+// Stream audits the buckets of the account and yields the result of each bucket as soon as it completes, so
+// callers can render progressively. Errors that prevent the audit of a bucket, or of the whole account, are
+// sent on the error channel. Both channels are unbuffered and closed when the audit is over: the caller must
+// receive from both in the same select loop until they are closed, or cancel c to stop the audit, since the
+// audit blocks on a channel nobody receives from.
+func (a *Auditor) Stream(c context.Context) (<-chan BucketResult, <-chan error) {
+	results := make(chan BucketResult)
+	errs := make(chan error)
+
+	go func() {
+		defer close(errs)
+		defer close(results)
+
+		allBuckets, err := a.s3Client("").ListBuckets(c, &s3.ListBucketsInput{})
+		if err != nil {
+			select {
+			case errs <- fmt.Errorf("retrieving buckets: %w", classifyError(err)):
+			case <-c.Done():
+			}
+			return
+		}
+
+		a.mutex.Lock()
+		a.listOwner = allBuckets.Owner
+		a.mutex.Unlock()
+
+		// the buckets of the quarantined regions are retried once the other buckets are done
+		var deferredMutex sync.Mutex
+		var deferred []types.Bucket
+		// work starts the workers auditing the buckets of a channel, the limiter lets a varying number of them
+		// audit a bucket at the same time; retried is set for the retry of the deferred buckets
+		work := func(buckets <-chan types.Bucket, retried bool) *sync.WaitGroup {
+			var wg sync.WaitGroup
+			for i := 0; i < a.limiter.workers(); i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for bucket := range buckets {
+						a.limiter.acquire()
+						result, err := a.scanBucket(c, bucket)
+						a.limiter.release()
+						if err == nil && result.deferred {
+							deferredMutex.Lock()
+							deferred = append(deferred, bucket)
+							deferredMutex.Unlock()
+							continue
+						}
+						if err != nil {
+							select {
+							case errs <- err:
+							case <-c.Done():
+								return
+							}
+							continue
+						}
+						result.Retried = retried
+						if result.incomplete() {
+							result.unrecorded = true
+						} else if err := a.checkpoint.record(result); err != nil {
+							log.Printf("Got an error saving the checkpoint: %v", err)
+							result.unrecorded = true
+						}
+						select {
+						case results <- result:
+						case <-c.Done():
+							return
+						}
+					}
+				}()
+			}
+			return &wg
+		}
+		buckets := make(chan types.Bucket)
+		wg := work(buckets, false)
+
+		skipped := 0
+	feed:
+		for _, bucket := range allBuckets.Buckets {
+			if !a.selected(aws.ToString(bucket.Name)) || !a.inAgeRange(aws.ToTime(bucket.CreationDate)) ||
+				a.checkpoint.done(aws.ToString(bucket.Name)) {
+				continue
+			}
+			if a.calls.exceeded() {
+				skipped++
+				continue
+			}
+			select {
+			case buckets <- bucket:
+			case <-c.Done():
+				break feed
+			}
+		}
+		close(buckets)
+		wg.Wait()
+
+		// the deferred buckets are retried by the workers as well, the quarantine lifted defers no more of them
+		a.quarantine.lift()
+		retry := make(chan types.Bucket)
+		wg = work(retry, true)
+	retried:
+		for _, bucket := range deferred {
+			select {
+			case retry <- bucket:
+			case <-c.Done():
+				break retried
+			}
+		}
+		close(retry)
+		wg.Wait()
+
+		if skipped > 0 {
+			select {
+			case errs <- fmt.Errorf("%w: %d bucket(s) not audited", ErrBudgetExceeded, skipped):
+			case <-c.Done():
+			}
+		}
+	}()
+
+	return results, errs
+}
+
+// region returns the data of a region, reading it on first use. The reads are shared by the buckets of the
+// region, so they run under a deadline of their own, the bucket timeout, rather than the one of the bucket
+// that happens to come first.
+func (a *Auditor) region(c context.Context, region string) *regionState {
+	a.mutex.Lock()
+	state, ok := a.regions[region]
+	if !ok {
+		state = &regionState{}
+		a.regions[region] = state
+	}
+	a.mutex.Unlock()
+
+	state.once.Do(func() {
+		c, cancel := a.bucketContext(c)
+		defer cancel()
+		a.loadRegion(c, region, state)
+	})
+	return state
+}
+
+// loadRegion reads the data of a region into state, logging what could not be read.
+func (a *Auditor) loadRegion(c context.Context, region string, state *regionState) {
+	var err error
+
+	// external access findings are read once per region, from the analyzer of the region
+	if a.checks.enabled("access-analyzer", "bucket-policy", "risk") {
+		state.analysis, err = getRegionAnalysis(c, newAccessAnalyzerClient(a.cfg, region))
+		if err != nil {
+			log.Printf("Got an error retrieving Access Analyzer findings in region %v: %v", region, err)
+		}
+	}
+
+	// likewise the trails recording S3 data events
+	if a.checks.enabled("data-events") {
+		state.coverage, err = getDataEventCoverage(c, a.cfg, region)
+		if err != nil {
+			log.Printf("Got an error retrieving CloudTrail trails in region %v: %v", region, err)
+		}
+	}
+
+	if a.options.ConfigRules {
+		configClient := configservice.NewFromConfig(a.cfg, func(options *configservice.Options) {
+			options.Region = region
+		})
+		state.configResults, err = getConfigRuleResults(c, configClient)
+		if err != nil {
+			log.Printf("Got an error retrieving AWS Config rule results in region %v: %v", region, err)
+		}
+	}
+
+	// and the sensitive data Macie detected, nil for the regions where Macie is not enabled; it raises the
+	// severity of the exposure findings
+	if a.checks.enabled("access-analyzer", "access-point", "bucket-policy", "encryption", "risk") {
+		macieClient := macie2.NewFromConfig(a.cfg, func(options *macie2.Options) {
+			options.Region = region
+		})
+		state.sensitiveData, err = getSensitiveData(c, macieClient)
+		if err != nil {
+			log.Printf("Got an error retrieving Macie findings in region %v: %v", region, err)
+		}
+	}
+
+	if a.checks.enabled("guardduty") {
+		guardDutyClient := guardduty.NewFromConfig(a.cfg, func(options *guardduty.Options) {
+			options.Region = region
+		})
+		state.guardDuty, err = getRegionGuardDuty(c, guardDutyClient)
+		if err != nil {
+			log.Printf("Got an error retrieving GuardDuty findings in region %v: %v", region, err)
+		}
+	}
+}
+
+// scanBucket reads the configuration of a bucket and evaluates the checks on it. The settings that cannot be
+// read, e.g. because a service control policy denies it, are logged and recorded in the result, and the audit
+// goes on with what could be read.
+func (a *Auditor) scanBucket(c context.Context, bucket types.Bucket) (BucketResult, error) {
+	// the bucket reads run under the deadline of the bucket, the region reads are shared with other buckets
+	parent := c
+	c, cancel := a.bucketContext(parent)
+	defer cancel()
+	start := time.Now()
+
+	// the settings that could not be read are logged and reported as unchecked
+	var readErrors []ReadError
+	failed := func(setting string, err error) {
+		readError := newReadError(*bucket.Name, setting, err)
+		log.Printf("Got an error %v", readError)
+		readErrors = append(readErrors, *readError)
+	}
+
+	// Get the location of the bucket, use it to update the client in order to make a request to the correct S3 endpoint
+	var region string
+	if !a.cache.get(*bucket.Name, "location", &region) {
+		location, err := a.s3Client("").GetBucketLocation(c, &s3.GetBucketLocationInput{
+			Bucket:              bucket.Name,
+			ExpectedBucketOwner: a.expectedBucketOwner(),
+		})
+		if err == nil {
+			// update the client with the buckets' region; if location is "" then it must be the default
+			// region of the partition, e.g. us-east-1
+			region = locationRegion(location.LocationConstraint, a.cfg.Region)
+			a.cache.put(*bucket.Name, "location", region)
+		} else {
+			failed("location", err)
+			// HeadBucket reports the region under another permission, the configured region is the last resort
+			head, headErr := a.s3Client("").HeadBucket(c, &s3.HeadBucketInput{
+				Bucket:              bucket.Name,
+				ExpectedBucketOwner: a.expectedBucketOwner(),
+			})
+			if headErr == nil && aws.ToString(head.BucketRegion) != "" {
+				region = aws.ToString(head.BucketRegion)
+			} else {
+				region = a.cfg.Region
+			}
+		}
+	}
+
+	if a.quarantine.isQuarantined(region) {
+		return BucketResult{Name: *bucket.Name, Region: region, deferred: true}, nil
+	}
+
+	// the requests of the helpers below carry the expected bucket owner through the client
+	client := a.s3Client(region)
+
+	// the settings are only read for the checks that use them
+	var err error
+	acl := &s3.GetBucketAclOutput{}
+	aclRead := false
+	if a.checks.enabled("ownership", "owner") {
+		output, err := client.GetBucketAcl(c, &s3.GetBucketAclInput{
+			Bucket:              bucket.Name,
+			ExpectedBucketOwner: a.expectedBucketOwner(),
+		})
+		if err != nil {
+			failed("acl", err)
+		} else {
+			acl, aclRead = output, true
+		}
+	}
+
+	var encryption *s3.GetBucketEncryptionOutput
+	encryptionState := encryptionUnknown
+	if a.checks.enabled("encryption", "risk", "drift", "bucket-key") || a.options.ConfigRules {
+		encryption, err = client.GetBucketEncryption(c, &s3.GetBucketEncryptionInput{
+			Bucket:              bucket.Name,
+			ExpectedBucketOwner: a.expectedBucketOwner(),
+		})
+		encryptionState = encryptionConfigured
+		if apiErrorCode(err) == "ServerSideEncryptionConfigurationNotFoundError" {
+			encryptionState = encryptionNone
+		} else if err != nil {
+			encryptionState = encryptionUnknown
+			failed("encryption", err)
+		}
+	}
+
+	// access points are regional, they are listed through S3 Control in the bucket's region
+	var accessPoints []accessPoint
+	if a.checks.enabled("access-point", "risk") {
+		controlClient := s3control.NewFromConfig(a.cfg, func(options *s3control.Options) {
+			options.Region = region
+		})
+		accessPoints, err = getAccessPoints(c, controlClient, a.accountID, *bucket.Name)
+		if err != nil {
+			failed("access points", err)
+		}
+	}
+
+	var lifecycle *s3.GetBucketLifecycleConfigurationOutput
+	var tiering []types.IntelligentTieringConfiguration
+	if a.checks.enabled("intelligent-tiering") {
+		lifecycle, err = client.GetBucketLifecycleConfiguration(c, &s3.GetBucketLifecycleConfigurationInput{
+			Bucket:              bucket.Name,
+			ExpectedBucketOwner: a.expectedBucketOwner(),
+		})
+		if err != nil && apiErrorCode(err) != "NoSuchLifecycleConfiguration" {
+			failed("lifecycle configuration", err)
+		}
+
+		tiering, err = getIntelligentTieringConfigurations(c, client, *bucket.Name)
+		if err != nil {
+			failed("Intelligent-Tiering configurations", err)
+		}
+	}
+
+	var notifications []notificationTarget
+	if a.checks.enabled("notification") || a.options.Diagram != "" {
+		notifications, err = getNotificationTargets(c, client, a.accountID, *bucket.Name)
+		if err != nil {
+			failed("notification configuration", err)
+		}
+		if err := checkLambdaTargets(c, a.cfg, notifications); err != nil {
+			failed("notification targets", err)
+		}
+	}
+
+	var ownership types.ObjectOwnership
+	if a.checks.enabled("ownership") {
+		ownership, err = getObjectOwnership(c, client, *bucket.Name)
+		if err != nil {
+			failed("ownership controls", err)
+		}
+	}
+
+	var policyPublic bool
+	policyStatusRead := false
+	fronts := a.fronts[*bucket.Name]
+	if a.checks.enabled("bucket-policy", "access-analyzer", "risk") || a.options.ConfigRules || len(fronts) > 0 {
+		policyPublic, err = isPolicyPublic(c, client, *bucket.Name)
+		if err != nil {
+			failed("policy status", err)
+		}
+		policyStatusRead = err == nil
+	}
+
+	// the policy document is only read for the cross-account check, for the VPC-only buckets and for the
+	// buckets fronted by CloudFront
+	var policy string
+	policyRead := false
+	vpcRule, vpcOnly := vpcOnlyRule(a.vpcEndpoints, *bucket.Name)
+	vpcOnly = vpcOnly && a.checks.enabled("vpc-endpoint")
+	if a.checks.enabled("cross-account") || vpcOnly || len(fronts) > 0 {
+		policy, err = getBucketPolicy(c, client, *bucket.Name)
+		if err != nil {
+			failed("policy", err)
+		}
+		policyRead = err == nil
+	}
+	var principals []policyPrincipal
+	if policyRead && a.checks.enabled("cross-account") {
+		if principals, err = policyPrincipals(policy); err != nil {
+			failed("policy", err)
+		}
+	}
+	if policyRead && len(fronts) > 0 {
+		grants, err := cloudFrontGrants(policy)
+		if err != nil {
+			failed("policy", err)
+		}
+		fronts = withGrants(fronts, grants)
+	}
+	var vpcFindings []finding
+	if policyRead && vpcOnly {
+		if vpcFindings, err = vpcEndpointFindings(*bucket.Name, policy, vpcRule); err != nil {
+			failed("policy", err)
+		}
+	}
+
+	var tags map[string]string
+	if a.readsTags() {
+		tags, err = getBucketTags(c, client, *bucket.Name)
+		if err != nil {
+			failed("tags", err)
+		}
+	}
+
+	state := a.region(parent, region)
+
+	var versioning types.BucketVersioningStatus
+	if a.checks.enabled("drift") {
+		versioning, err = getBucketVersioning(c, client, *bucket.Name)
+		if err != nil {
+			failed("versioning", err)
+		}
+	}
+
+	var dataFlows []dataFlow
+	if a.options.Diagram != "" {
+		dataFlows, err = getDataFlows(c, client, *bucket.Name)
+		if err != nil {
+			failed("replication, logging and inventory destinations", err)
+		}
+	}
+
+	var notOwned bool
+	if accountIDPattern.MatchString(a.options.ExpectedOwner) {
+		owned, err := ownedByAccount(c, client, a.unownedS3Client(region), *bucket.Name, a.options.ExpectedOwner)
+		if err != nil {
+			failed("owner account", err)
+		}
+		notOwned = err == nil && !owned
+	}
+
+	// the size is only read to sort by it, for the stale buckets and for the estimate next to the billed cost,
+	// it costs a CloudWatch request per bucket
+	var size float64
+	if (a.options.Sort == "size" || a.options.StaleDays > 0 || a.options.CostExplorerTag != "") && !a.cache.get(*bucket.Name, "size-bytes", &size) {
+		cw := cloudwatch.NewFromConfig(a.cfg, func(options *cloudwatch.Options) {
+			options.Region = region
+		})
+		size, err = getBucketSizeBytes(c, cw, *bucket.Name)
+		if err != nil {
+			failed("size", err)
+		} else {
+			a.cache.put(*bucket.Name, "size-bytes", size)
+		}
+	}
+
+	var empty bool
+	if a.checks.enabled("empty") {
+		empty, err = bucketEmpty(c, client, *bucket.Name)
+		if err != nil {
+			failed("object versions", err)
+		}
+	}
+
+	var objects *objectStats
+	if a.options.ScanObjects {
+		objects, err = scanObjects(c, client, *bucket.Name, a.options.TopObjects, time.Now())
+		if err != nil {
+			failed("objects", err)
+		}
+	}
+
+	var activity *bucketActivity
+	if a.options.StaleDays > 0 && a.checks.enabled("stale") {
+		cw := cloudwatch.NewFromConfig(a.cfg, func(options *cloudwatch.Options) {
+			options.Region = region
+		})
+		read, err := getBucketActivity(c, cw, client, *bucket.Name, a.options.StaleDays)
+		if err != nil {
+			failed("activity", err)
+		} else {
+			activity = &read
+		}
+	}
+
+	var billing bucketBilling
+	if a.checks.enabled("billing") {
+		billing, err = getBucketBilling(c, client, *bucket.Name)
+		if err != nil {
+			failed("billing settings", err)
+		}
+	}
+
+	b := s3Bucket{
+		name:               *bucket.Name,
+		creationDate:       aws.ToTime(bucket.CreationDate),
+		acl:                *acl,
+		encryptionState:    encryptionState,
+		objectOwnership:    ownership,
+		accessPoints:       accessPoints,
+		intelligentTiering: tiering,
+		notifications:      notifications,
+		billing:            billing,
+		policyPublic:       policyPublic,
+		publicUnknown:      !policyStatusRead || !aclRead,
+		policyPrincipals:   principals,
+		externalAccess:     state.analysis.buckets[*bucket.Name],
+		tags:               tags,
+		dataEventTrails:    loggingTrails(state.coverage, *bucket.Name),
+		configRules:        state.configResults[*bucket.Name],
+		sensitiveData:      state.sensitiveData[*bucket.Name],
+		guardDuty:          state.guardDuty.buckets[*bucket.Name],
+		versioning:         versioning,
+		dataFlows:          dataFlows,
+		sizeBytes:          size,
+		activity:           activity,
+		empty:              empty,
+		objects:            objects,
+		fronts:             fronts,
+		notOwnedByAccount:  notOwned,
+	}
+	if lifecycle != nil {
+		b.lifecycle = lifecycle.Rules
+	}
+	if encryption != nil {
+		b.encryption = *encryption
+	}
+	if d, ok := a.declared[b.name]; ok {
+		b.drift = detectDrift(b, d)
+	}
+	if a.options.ActiveProbes && a.checks.enabled("anonymous-access") && scoreBucket(b, a.sensitive).public {
+		if b.probe, err = probeAnonymousAccess(c, a.cfg, client, region, b.name, a.options.ProbeKey); err != nil {
+			failed("anonymous probe", err)
+		}
+	}
+
+	encryptionFindings, err := a.encryptionPolicyFindings(c, b, region)
+	if err != nil {
+		failed("KMS key aliases", err)
+	}
+
+	result := BucketResult{Name: b.name, Region: region, Created: b.creationDate, Errors: readErrors, bucket: b}
+	result.TimedOut = errors.Is(c.Err(), context.DeadlineExceeded) && parent.Err() == nil
+
+	var findings []finding
+	findings = append(findings, accessPointFindings(b.name, b.accessPoints)...)
+	findings = append(findings, notificationFindings(b.name, b.notifications)...)
+	findings = append(findings, externalAccessFindings(b, state.analysis.analyzer != "")...)
+	findings = append(findings, crossAccountFindings(b, a.accountID, a.trusted)...)
+	findings = append(findings, vpcFindings...)
+	if f, ok := anonymousAccessFinding(b); ok {
+		findings = append(findings, f)
+	}
+	findings = append(findings, cloudFrontFindings(b)...)
+	if f, ok := dataEventFinding(b, a.sensitive); ok {
+		findings = append(findings, f)
+	}
+	if f, ok := encryptionFinding(b); ok {
+		findings = append(findings, f)
+	}
+	findings = append(findings, encryptionFindings...)
+	if b.empty {
+		findings = append(findings, emptyFinding(b.name))
+		if !matchesAny(splitList(a.options.KeepBuckets), b.name) {
+			result.remediations = append(result.remediations, deleteEmptyRemediation(b.name, region))
+		}
+	}
+	if f, ok := staleFinding(b, a.options.StaleDays, time.Now()); ok {
+		findings = append(findings, f)
+	}
+	if a.options.RequireDSSE && a.checks.enabled("encryption") {
+		if f, ok := dsseFinding(b); ok {
+			findings = append(findings, f)
+		}
+		if b.encryptionState == encryptionNone || b.encryptionState == encryptionConfigured &&
+			encryptionAlgorithm(b) != string(types.ServerSideEncryptionAwsKmsDsse) {
+			result.remediations = append(result.remediations, dsseRemediation(b, region))
+		}
+	}
+	raiseSensitiveFindings(findings, b)
+	findings = append(findings, guardDutyFindings(b)...)
+	findings = append(findings, driftFindings(b)...)
+	tagsRead := a.readsTags() && !unreadSetting(readErrors, "tags")
+	findings = append(findings, namingFindings(b, a.naming, tagsRead)...)
+	if len(a.costTags) > 0 && tagsRead {
+		if f, ok := costTagFinding(b, a.costTags); ok {
+			findings = append(findings, f)
+		}
+	}
+	if f, ok := ownerFinding(b, a.options.ExpectedOwner); ok {
+		findings = append(findings, f)
+	}
+	findings = append(findings, customFindings(c, client, b, region, a.checks)...)
+
+	risk := scoreBucket(b, a.sensitive)
+	result.score = risk.score
+	result.public = risk.public
+	if f, ok := riskFinding(b, risk); ok {
+		findings = append(findings, f)
+	}
+
+	if f, ok := ownershipFinding(b); ok {
+		findings = append(findings, f)
+		result.remediations = append(result.remediations, ownershipRemediation(b, region))
+	}
+
+	if transitionsToIntelligentTiering(b.lifecycle) && !hasArchiveTiers(b.intelligentTiering) {
+		cw := cloudwatch.NewFromConfig(a.cfg, func(options *cloudwatch.Options) {
+			options.Region = region
+		})
+		var size float64
+		if !a.cache.get(b.name, "archive-instant-access-bytes", &size) {
+			size, err = getArchiveInstantAccessBytes(c, cw, b.name)
+			if err != nil {
+				log.Printf("Got an error retrieving Intelligent-Tiering size of bucket %v: %v", b.name, err)
+			} else {
+				a.cache.put(b.name, "archive-instant-access-bytes", size)
+			}
+		}
+		result.remediations = append(result.remediations, intelligentTieringRemediation(b.name, region, size))
+	}
+
+	if a.checks.enabled("bucket-key") && withoutBucketKey(b) {
+		cw := cloudwatch.NewFromConfig(a.cfg, func(options *cloudwatch.Options) {
+			options.Region = region
+		})
+		var requests float64
+		found := a.cache.get(b.name, "monthly-object-requests", &requests)
+		if !found {
+			requests, found, err = getMonthlyObjectRequests(c, cw, b.name)
+			if err != nil {
+				log.Printf("Got an error retrieving the request metrics of bucket %v: %v", b.name, err)
+			} else if found {
+				a.cache.put(b.name, "monthly-object-requests", requests)
+			}
+		}
+		findings = append(findings, bucketKeyFinding(b, requests, found))
+		result.remediations = append(result.remediations, bucketKeyRemediation(b, region, requests, found))
+	}
+
+	findings = a.enabledFindings(findings)
+	if a.publicAccessErr == nil {
+		applyAccountPublicAccessBlock(findings, a.publicAccessBlock)
+	}
+	applySuppressions(findings, a.suppressions, time.Now())
+	result.findings = findings
+	result.Findings = exportFindings(findings)
+	result.Duration = time.Since(start)
+	a.quarantine.observe(region, regionFailure(result))
+
+	return result, nil
+}
+
+// selected reports whether a bucket matches the bucket patterns of the options.
+func (a *Auditor) selected(bucket string) bool {
+	if len(a.buckets) == 0 {
+		return true
+	}
+	for _, pattern := range a.buckets {
+		if matched, _ := path.Match(pattern, bucket); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// budgetExceeded reports whether settings of the bucket were left unread because the API call budget ran out.
+func (r BucketResult) budgetExceeded() bool {
+	for _, err := range r.Errors {
+		if errors.Is(err.Err, ErrBudgetExceeded) {
+			return true
+		}
+	}
+	return false
+}
+
+// incomplete reports whether the audit of the bucket is to be done again on resume: it was cut short by the
+// budget or its deadline, or it still failed in its region after the retry.
+func (r BucketResult) incomplete() bool {
+	return r.budgetExceeded() || r.TimedOut || (r.Retried && regionFailure(r))
+}
+
+// expectedBucketOwner returns the ExpectedBucketOwner of the requests about a bucket, nil when not set.
+func (a *Auditor) expectedBucketOwner() *string {
+	if a.options.AccountID == "" {
+		return nil
+	}
+	return aws.String(a.options.AccountID)
+}
+
+// inAgeRange reports whether a bucket created at created is within the OlderThan and NewerThan ages.
+func (a *Auditor) inAgeRange(created time.Time) bool {
+	age := time.Since(created)
+	if a.options.OlderThan > 0 && age < a.options.OlderThan {
+		return false
+	}
+	if a.options.NewerThan > 0 && age > a.options.NewerThan {
+		return false
+	}
+	return true
+}
+
+// enabledFindings keeps the findings of the checks enabled by the options.
+func (a *Auditor) enabledFindings(findings []finding) []finding {
+	var enabled []finding
+	for _, f := range findings {
+		if a.checks.enabled(f.check) {
+			enabled = append(enabled, f)
+		}
+	}
+	return enabled
+}
+
+// splitList splits a comma separated list, dropping the empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// exportFindings converts findings to their exported form.
+func exportFindings(findings []finding) []Finding {
+	var exported []Finding
+	for _, f := range findings {
+		exported = append(exported, Finding{
+			Bucket:     f.bucket,
+			Check:      f.check,
+			Severity:   f.severity.String(),
+			Message:    f.message,
+			Suppressed: f.suppressed,
+		})
+	}
+	return exported
+}
+
+// print prints the report lines of the bucket and returns how many AWS Config results agree and disagree
+// with the audit.
+func (r BucketResult) print() (agree int, disagree int) {
+	b := r.bucket
+	switch b.encryptionState {
+	case encryptionConfigured:
+		fmt.Printf("Bucket: %+v\t Created: %s\t KeyID: %+v\n", b.name, formatCreationDate(b.creationDate), encryptionKeyID(b))
+	case encryptionNone:
+		fmt.Printf("Bucket: %+v\t Created: %s\t Encryption: NONE\n", b.name, formatCreationDate(b.creationDate))
+	default:
+		fmt.Printf("Bucket: %+v\t Created: %s\t Encryption: unknown, the configuration could not be read\n", b.name, formatCreationDate(b.creationDate))
+	}
+	fmt.Printf("\tOwner: %s\n", formatOwner(b.acl.Owner))
+	printAccessPoints(b.accessPoints)
+	printIntelligentTiering(b.intelligentTiering)
+	printNotificationTargets(b.notifications)
+	printExternalAccess(b)
+	printAnonymousProbe(b)
+	printBucketFronts(b.fronts)
+	printDataEventTrails(b.dataEventTrails)
+	printSensitiveData(b)
+	printObjectStats(b)
+	printGuardDutyFindings(b)
+	printDrift(b)
+	return printConfigRuleResults(b)
+}
@@ -0,0 +1,125 @@
+package s3audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"log"
+	"sort"
+	"time"
+)
+
+// RegionBenchmark defines a latency benchmark of candidate regions: Rounds uploads and downloads of a payload
+// of Size bytes to a temporary bucket created in each of the Regions, named after BucketPrefix.
+type RegionBenchmark struct {
+	Regions      []string
+	Size         int64
+	Rounds       int
+	BucketPrefix string
+}
+
+// regionLatency holds the latencies measured to a region, or the error that stopped its benchmark.
+type regionLatency struct {
+	region string
+	times  transferTimes
+	err    error
+}
+
+// percentile returns the duration under which the share p of the durations fall.
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(float64(len(sorted)) * p)
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+// benchmarkRegion creates a temporary bucket in a region, times the transfers of a payload to it, then deletes
+// the payload and the bucket. The first transfer opens the connection and is not counted.
+func benchmarkRegion(c context.Context, cfg aws.Config, region string, bucket string, payload []byte, rounds int) (transferTimes, error) {
+	client := newS3Client(cfg, region, "")
+	input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+	// us-east-1 is the default location, it is not accepted as a constraint
+	if region != "us-east-1" {
+		input.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: types.BucketLocationConstraint(region)}
+	}
+	if _, err := client.CreateBucket(c, input); err != nil {
+		return transferTimes{}, fmt.Errorf("creating bucket %s: %v", bucket, err)
+	}
+	key := "benchmark"
+	defer func() {
+		if _, err := client.DeleteObject(c, &s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)}); err != nil {
+			log.Printf("Got an error deleting the benchmark payload of bucket %v: %v", bucket, err)
+		}
+		if _, err := client.DeleteBucket(c, &s3.DeleteBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			log.Printf("Got an error deleting the benchmark bucket %v, delete it by hand: %v", bucket, err)
+		}
+	}()
+
+	var times transferTimes
+	for round := 0; round <= rounds; round++ {
+		upload, download, err := timeTransfer(c, client, bucket, key, payload)
+		if err != nil {
+			return transferTimes{}, err
+		}
+		if round > 0 {
+			times.uploads = append(times.uploads, upload)
+			times.downloads = append(times.downloads, download)
+		}
+	}
+	return times, nil
+}
+
+// BenchmarkRegions measures the latency of the PUT and GET requests from the current host to each candidate
+// region, to choose the region of the buckets of a new workload. The regions are measured one after the other,
+// so they do not compete for the bandwidth of the host.
+func BenchmarkRegions(c context.Context, cfg aws.Config, benchmark RegionBenchmark, w io.Writer) error {
+	payload := make([]byte, benchmark.Size)
+	if _, err := rand.Read(payload); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+
+	var latencies []regionLatency
+	for _, region := range benchmark.Regions {
+		bucket := fmt.Sprintf("%s-%s-%s", benchmark.BucketPrefix, region, hex.EncodeToString(suffix))
+		times, err := benchmarkRegion(c, cfg, region, bucket, payload, benchmark.Rounds)
+		latencies = append(latencies, regionLatency{region: region, times: times, err: err})
+	}
+	sort.SliceStable(latencies, func(i, j int) bool {
+		if (latencies[i].err == nil) != (latencies[j].err == nil) {
+			return latencies[i].err == nil
+		}
+		return median(latencies[i].times.downloads) < median(latencies[j].times.downloads)
+	})
+
+	fmt.Fprintf(w, "Latency from this host, %d rounds of a %s payload per region, fastest GET first\n", benchmark.Rounds, formatPayloadSize(benchmark.Size))
+	t := newTable(false, column{header: "REGION"}, column{header: "PUT P50"}, column{header: "PUT P90"},
+		column{header: "GET P50"}, column{header: "GET P90"})
+	for _, latency := range latencies {
+		if latency.err != nil {
+			t.add(cell{text: latency.region}, cell{text: "error: " + latency.err.Error()}, cell{}, cell{}, cell{})
+			continue
+		}
+		t.add(cell{text: latency.region},
+			cell{text: percentile(latency.times.uploads, 0.5).Round(time.Millisecond).String()},
+			cell{text: percentile(latency.times.uploads, 0.9).Round(time.Millisecond).String()},
+			cell{text: percentile(latency.times.downloads, 0.5).Round(time.Millisecond).String()},
+			cell{text: percentile(latency.times.downloads, 0.9).Round(time.Millisecond).String()})
+	}
+	t.write(w)
+	return nil
+}
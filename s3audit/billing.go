@@ -0,0 +1,57 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// bucketBilling defines the settings of a bucket that change who pays for requests and how much
+type bucketBilling struct {
+	requesterPays bool
+	accelerated   bool
+}
+
+// getBucketBilling reads whether Requester Pays and Transfer Acceleration are enabled on a bucket.
+func getBucketBilling(c context.Context, api BucketSettingsAPI, bucket string) (bucketBilling, error) {
+	var billing bucketBilling
+
+	payment, err := api.GetBucketRequestPayment(c, &s3.GetBucketRequestPaymentInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return billing, err
+	}
+	billing.requesterPays = payment.Payer == types.PayerRequester
+
+	accelerate, err := api.GetBucketAccelerateConfiguration(c, &s3.GetBucketAccelerateConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return billing, err
+	}
+	billing.accelerated = accelerate.Status == types.BucketAccelerateStatusEnabled
+
+	return billing, nil
+}
+
+// printBilling prints the billing section of the report: every bucket with Requester Pays or Transfer
+// Acceleration enabled. Accelerated transfers are charged on top of the regular data transfer price.
+func printBilling(buckets []s3Bucket) {
+	fmt.Println("\nBilling:")
+
+	var count int
+	for _, b := range buckets {
+		if !b.billing.requesterPays && !b.billing.accelerated {
+			continue
+		}
+		count++
+
+		acceleration := "Disabled"
+		if b.billing.accelerated {
+			acceleration = "Enabled (extra $0.04-$0.08 per GB transferred)"
+		}
+		fmt.Printf("Bucket: %s\t Requester Pays: %t\t Transfer Acceleration: %s\n", b.name, b.billing.requesterPays, acceleration)
+	}
+	if count == 0 {
+		fmt.Println("No bucket has Requester Pays or Transfer Acceleration enabled")
+	}
+}
@@ -0,0 +1,120 @@
+package s3audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"log"
+	"path"
+	"time"
+)
+
+// s3Bucket defines a bucket and their configurations
+type s3Bucket struct {
+	name string
+	acl s3.GetBucketAclOutput
+	objectOwnership types.ObjectOwnership
+	encryption s3.GetBucketEncryptionOutput
+	encryptionState encryptionState
+	creationDate time.Time
+	accessPoints []accessPoint
+	lifecycle []types.LifecycleRule
+	intelligentTiering []types.IntelligentTieringConfiguration
+	notifications []notificationTarget
+	billing bucketBilling
+	policyPublic bool
+	// publicUnknown is true when the policy status or the ACL was not read, a bucket found not public may then
+	// be public
+	publicUnknown bool
+	// policyPrincipals are the principals the bucket policy grants access to, only read by the cross-account check
+	policyPrincipals []policyPrincipal
+	externalAccess []externalAccess
+	tags map[string]string
+	dataEventTrails []string
+	configRules []configRuleResult
+	sensitiveData map[string]int64
+	guardDuty []guardDutyFinding
+	versioning types.BucketVersioningStatus
+	drift []drift
+	dataFlows []dataFlow
+	// notOwnedByAccount is true when S3 reports that the bucket does not belong to the expected account
+	notOwnedByAccount bool
+	// sizeBytes is the size of the bucket, only read when sorting by size or looking for stale buckets
+	sizeBytes float64
+	// activity is the recent activity of the bucket, only read with StaleDays
+	activity *bucketActivity
+	// empty is true when the bucket holds no object, no version and no delete marker
+	empty bool
+	// objects is the breakdown of the objects by storage class, only read with ScanObjects
+	objects *objectStats
+	// probe is the outcome of the unauthenticated requests, only sent with ActiveProbes to the public buckets
+	probe *anonymousProbe
+	// fronts are the CloudFront distributions and Route 53 records fronting the bucket, only read with CloudFront
+	fronts []bucketFront
+}
+
+// formatCreationDate formats the creation date of a bucket in UTC, or - when ListBuckets did not return it.
+func formatCreationDate(created time.Time) string {
+	if created.IsZero() {
+		return "-"
+	}
+	return created.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// apiErrorCode returns the error code of an AWS API error, or "" if err did not come from the service.
+func apiErrorCode(err error) string {
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		return ae.ErrorCode()
+	}
+	return ""
+}
+
+// regionalBucket is a bucket a command works on, with the S3 client of its region.
+type regionalBucket struct {
+	name   string
+	region string
+	client S3ClientAPI
+}
+
+// matchesAny reports whether a bucket name matches one of the glob patterns.
+func matchesAny(patterns []string, bucket string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, bucket); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchBuckets lists the buckets matching the comma separated glob patterns, all of them when empty, with
+// the client of their region. The buckets whose location cannot be read are logged and left out.
+func matchBuckets(c context.Context, cfg aws.Config, buckets string) ([]regionalBucket, error) {
+	client := newS3Client(cfg, "", "")
+	allBuckets, err := client.ListBuckets(c, &s3.ListBucketsInput{})
+	if err != nil {
+		return nil, fmt.Errorf("retrieving buckets: %v", err)
+	}
+	patterns := splitList(buckets)
+
+	var matched []regionalBucket
+	for _, bucket := range allBuckets.Buckets {
+		name := aws.ToString(bucket.Name)
+		if len(patterns) > 0 && !matchesAny(patterns, name) {
+			continue
+		}
+
+		location, err := client.GetBucketLocation(c, &s3.GetBucketLocationInput{Bucket: aws.String(name)})
+		if err != nil {
+			log.Printf("Got an error retrieving the location of bucket %v: %v", name, err)
+			continue
+		}
+		region := locationRegion(location.LocationConstraint, cfg.Region)
+		matched = append(matched, regionalBucket{name: name, region: region, client: newS3Client(cfg, region, "")})
+	}
+	return matched, nil
+}
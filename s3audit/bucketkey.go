@@ -0,0 +1,100 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"time"
+)
+
+// us-east-1 list price of the KMS requests, and the share of them an S3 Bucket Key saves
+const (
+	priceKMSRequest       = 0.03 / 10000
+	bucketKeyRequestShare = 0.99
+)
+
+// withoutBucketKey reports whether a bucket encrypts with SSE-KMS by default without an S3 Bucket Key, so every
+// object request calls KMS. DSSE-KMS does not support Bucket Keys.
+func withoutBucketKey(b s3Bucket) bool {
+	if b.encryptionState != encryptionConfigured || encryptionAlgorithm(b) != string(types.ServerSideEncryptionAwsKms) {
+		return false
+	}
+	return !aws.ToBool(b.encryption.ServerSideEncryptionConfiguration.Rules[0].BucketKeyEnabled)
+}
+
+// getMonthlyObjectRequests reads the GET and PUT requests of a bucket over the last 30 days, from the request
+// metrics of its EntireBucket filter, and whether the bucket publishes them.
+func getMonthlyObjectRequests(c context.Context, api CloudWatchGetMetricDataApi, bucket string) (float64, bool, error) {
+	end := time.Now().UTC()
+	output, err := GetMetricData(c, api, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(end.AddDate(0, 0, -30)),
+		EndTime:   aws.Time(end),
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			{
+				Id: aws.String("requests"),
+				Expression: aws.String(fmt.Sprintf(
+					`SUM(SEARCH('{AWS/S3,BucketName,FilterId} (MetricName="GetRequests" OR MetricName="PutRequests") BucketName="%s" FilterId="EntireBucket"', 'Sum', 86400))`,
+					bucket)),
+			},
+		},
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	var requests float64
+	found := false
+	for _, result := range output.MetricDataResults {
+		for _, value := range result.Values {
+			requests += value
+			found = true
+		}
+	}
+	return requests, found, nil
+}
+
+// formatKMSRequestCost describes the KMS requests of a bucket over a month and what a Bucket Key saves on them.
+func formatKMSRequestCost(requests float64, found bool) string {
+	if !found {
+		return "the KMS request cost could not be estimated, the bucket has no EntireBucket request metrics"
+	}
+	savings := requests * priceKMSRequest * bucketKeyRequestShare
+	return fmt.Sprintf("%.0f object request(s) in 30 days called KMS, a Bucket Key saves up to $%.2f/month (us-east-1 prices)", requests, savings)
+}
+
+// bucketKeyFinding flags a bucket encrypting with SSE-KMS without an S3 Bucket Key, with the estimate of the
+// cost of its KMS requests.
+func bucketKeyFinding(b s3Bucket, requests float64, found bool) finding {
+	return finding{
+		bucket:   b.name,
+		check:    "bucket-key",
+		severity: severityLow,
+		message:  "SSE-KMS without S3 Bucket Key: " + formatKMSRequestCost(requests, found),
+	}
+}
+
+// bucketKeyRemediation builds the remediation enabling the S3 Bucket Key, keeping the algorithm and the KMS key
+// of the default encryption of the bucket. Only the new objects use the Bucket Key.
+func bucketKeyRemediation(b s3Bucket, region string, requests float64, found bool) remediation {
+	var rules []types.ServerSideEncryptionRule
+	for _, rule := range b.encryption.ServerSideEncryptionConfiguration.Rules {
+		rule.BucketKeyEnabled = aws.Bool(true)
+		rules = append(rules, rule)
+	}
+
+	return remediation{
+		bucket: b.name,
+		region: region,
+		name:   "enable-bucket-key",
+		description: "enable the S3 Bucket Key of the default SSE-KMS encryption for the new objects; " +
+			formatKMSRequestCost(requests, found),
+		input: &s3.PutBucketEncryptionInput{
+			Bucket:                            aws.String(b.name),
+			ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{Rules: rules},
+		},
+	}
+}
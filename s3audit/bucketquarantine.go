@@ -0,0 +1,256 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	cloudtrailtypes "github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CloudTrailPutEventSelectorsApi defines the interface for the PutEventSelectors function.
+// We use this interface to test the function using a mocked service.
+type CloudTrailPutEventSelectorsApi interface {
+	PutEventSelectors(ctx context.Context,
+		params *cloudtrail.PutEventSelectorsInput,
+		optFns ...func(*cloudtrail.Options)) (*cloudtrail.PutEventSelectorsOutput, error)
+}
+
+// PutEventSelectors replaces the event selectors of a trail.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a PutEventSelectorsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to PutEventSelectors.
+func PutEventSelectors(c context.Context, api CloudTrailPutEventSelectorsApi, input *cloudtrail.PutEventSelectorsInput) (*cloudtrail.PutEventSelectorsOutput, error) {
+	return api.PutEventSelectors(c, input)
+}
+
+// quarantineSid is the Sid of the statement denying access to a quarantined bucket.
+const quarantineSid = "DenyAllQuarantine"
+
+// Quarantine defines the containment of a bucket: all access is denied but to SecurityRole, the ARN of the
+// role of the incident responders, and the data events of the bucket are recorded by Trail, a trail name or
+// ARN. Exempt lists the comma separated principal ARNs or aws:PrincipalArn patterns keeping access as well,
+// none by default: the caller is often the broad role involved in the leak. Snapshot is the file the previous
+// settings are saved to, and restored from by unquarantine.
+type Quarantine struct {
+	Bucket       string
+	SecurityRole string
+	Exempt       string
+	Trail        string
+	Snapshot     string
+}
+
+// quarantineSnapshot holds the settings of a bucket and of the trail replaced by its quarantine. Policy is
+// empty when the bucket had no policy; the ACL and the selectors are only restored when they were changed.
+type quarantineSnapshot struct {
+	Bucket                 string                                  `json:"bucket"`
+	Region                 string                                  `json:"region"`
+	Taken                  time.Time                               `json:"taken"`
+	Policy                 string                                  `json:"policy,omitempty"`
+	AclReset               bool                                    `json:"aclReset"`
+	Owner                  *types.Owner                            `json:"owner,omitempty"`
+	Grants                 []types.Grant                           `json:"grants,omitempty"`
+	Trail                  string                                  `json:"trail,omitempty"`
+	TrailRegion            string                                  `json:"trailRegion,omitempty"`
+	EventSelectors         []cloudtrailtypes.EventSelector         `json:"eventSelectors,omitempty"`
+	AdvancedEventSelectors []cloudtrailtypes.AdvancedEventSelector `json:"advancedEventSelectors,omitempty"`
+}
+
+// trailRegion returns the region of a trail from its ARN, or the default region for a trail name.
+func trailRegion(trail string, defaultRegion string) string {
+	parts := strings.SplitN(trail, ":", 6)
+	if len(parts) == 6 && parts[0] == "arn" {
+		return parts[3]
+	}
+	return defaultRegion
+}
+
+// aclGrantsOthers reports whether the ACL of a bucket grants access to anyone but its owner.
+func aclGrantsOthers(acl *s3.GetBucketAclOutput) bool {
+	for _, grant := range acl.Grants {
+		if grant.Grantee == nil || acl.Owner == nil || aws.ToString(grant.Grantee.ID) != aws.ToString(acl.Owner.ID) {
+			return true
+		}
+	}
+	return false
+}
+
+// dataEventSelectors returns the selectors of a trail with the S3 data events of a bucket added, in the form
+// the trail already uses: CloudTrail refuses a mix of basic and advanced selectors.
+func dataEventSelectors(selectors *cloudtrail.GetEventSelectorsOutput, partition string, bucket string) *cloudtrail.PutEventSelectorsInput {
+	objects := bucketArn(partition, bucket) + "/"
+	if len(selectors.AdvancedEventSelectors) > 0 {
+		advanced := append([]cloudtrailtypes.AdvancedEventSelector(nil), selectors.AdvancedEventSelectors...)
+		advanced = append(advanced, cloudtrailtypes.AdvancedEventSelector{
+			Name: aws.String("Quarantine of " + bucket),
+			FieldSelectors: []cloudtrailtypes.AdvancedFieldSelector{
+				{Field: aws.String("eventCategory"), Equals: []string{"Data"}},
+				{Field: aws.String("resources.type"), Equals: []string{"AWS::S3::Object"}},
+				{Field: aws.String("resources.ARN"), StartsWith: []string{objects}},
+			},
+		})
+		return &cloudtrail.PutEventSelectorsInput{AdvancedEventSelectors: advanced}
+	}
+	basic := append([]cloudtrailtypes.EventSelector(nil), selectors.EventSelectors...)
+	basic = append(basic, cloudtrailtypes.EventSelector{
+		IncludeManagementEvents: aws.Bool(false),
+		ReadWriteType:           cloudtrailtypes.ReadWriteTypeAll,
+		DataResources:           []cloudtrailtypes.DataResource{{Type: aws.String("AWS::S3::Object"), Values: []string{objects}}},
+	})
+	return &cloudtrail.PutEventSelectorsInput{EventSelectors: basic}
+}
+
+// QuarantineBucket contains a bucket during an incident: it saves its policy and ACL to the snapshot file, then
+// resets an ACL granting access to others to private, adds the data events of the bucket to the selectors of
+// the trail, and last replaces its policy with one denying all access but to the security role and the exempted
+// principals. The snapshot is written before any change, a bucket is never contained without a way back; the
+// quarantine is lifted by the security role, or an exempted principal.
+func QuarantineBucket(c context.Context, cfg aws.Config, q Quarantine, w io.Writer) error {
+	if _, err := os.Stat(q.Snapshot); err == nil {
+		return fmt.Errorf("snapshot %s already exists, the bucket may already be quarantined", q.Snapshot)
+	}
+	client, region, err := newBucketClient(c, cfg, q.Bucket, "")
+	if err != nil {
+		return err
+	}
+
+	snapshot := quarantineSnapshot{Bucket: q.Bucket, Region: region, Taken: time.Now().UTC()}
+	policy, err := client.GetBucketPolicy(c, &s3.GetBucketPolicyInput{Bucket: aws.String(q.Bucket)})
+	if err != nil && apiErrorCode(err) != "NoSuchBucketPolicy" {
+		return fmt.Errorf("reading the bucket policy: %v", err)
+	}
+	if policy != nil {
+		snapshot.Policy = aws.ToString(policy.Policy)
+	}
+	acl, err := client.GetBucketAcl(c, &s3.GetBucketAclInput{Bucket: aws.String(q.Bucket)})
+	if err != nil {
+		return fmt.Errorf("reading the bucket ACL: %v", err)
+	}
+	ownership, err := getObjectOwnership(c, client, q.Bucket)
+	if err != nil {
+		return fmt.Errorf("reading the object ownership: %v", err)
+	}
+	// ACLs are ignored by a bucket with the BucketOwnerEnforced ownership, and cannot be changed
+	snapshot.AclReset = ownership != types.ObjectOwnershipBucketOwnerEnforced && aclGrantsOthers(acl)
+	snapshot.Owner, snapshot.Grants = acl.Owner, acl.Grants
+
+	var trailClient *cloudtrail.Client
+	var selectors *cloudtrail.PutEventSelectorsInput
+	if q.Trail != "" {
+		snapshot.Trail, snapshot.TrailRegion = q.Trail, trailRegion(q.Trail, cfg.Region)
+		trailClient = cloudtrail.NewFromConfig(cfg, func(options *cloudtrail.Options) {
+			options.Region = snapshot.TrailRegion
+		})
+		current, err := GetEventSelectors(c, trailClient, &cloudtrail.GetEventSelectorsInput{TrailName: aws.String(q.Trail)})
+		if err != nil {
+			return fmt.Errorf("reading the event selectors of trail %s: %v", q.Trail, err)
+		}
+		coverage := trailCoverage{trail: q.Trail, buckets: map[string]bool{}, excluded: map[string]bool{}}
+		addBasicSelectors(&coverage, current.EventSelectors)
+		addAdvancedSelectors(&coverage, current.AdvancedEventSelectors)
+		if coverage.covers(q.Bucket) {
+			fmt.Fprintf(w, "Trail %s already records the data events of bucket %s\n", q.Trail, q.Bucket)
+			snapshot.Trail = ""
+		} else {
+			snapshot.EventSelectors, snapshot.AdvancedEventSelectors = current.EventSelectors, current.AdvancedEventSelectors
+			selectors = dataEventSelectors(current, partitionOf(region), q.Bucket)
+			selectors.TrailName = aws.String(q.Trail)
+		}
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(q.Snapshot, data, 0600); err != nil {
+		return fmt.Errorf("saving the snapshot: %v", err)
+	}
+	fmt.Fprintf(w, "Policy and ACL of bucket %s saved to %s\n", q.Bucket, q.Snapshot)
+
+	if snapshot.AclReset {
+		if _, err := client.PutBucketAcl(c, &s3.PutBucketAclInput{Bucket: aws.String(q.Bucket), ACL: types.BucketCannedACLPrivate}); err != nil {
+			return fmt.Errorf("resetting the ACL: %v", err)
+		}
+		fmt.Fprintf(w, "ACL of bucket %s reset to private\n", q.Bucket)
+	}
+	if selectors != nil {
+		if _, err := PutEventSelectors(c, trailClient, selectors); err != nil {
+			return fmt.Errorf("adding the data events to trail %s: %v", q.Trail, err)
+		}
+		fmt.Fprintf(w, "Trail %s records the data events of bucket %s\n", q.Trail, q.Bucket)
+	}
+	// the deny-all policy goes last: unless the caller is exempted, it denies the caller the changes above
+	exempted := append([]string{q.SecurityRole}, splitList(q.Exempt)...)
+	deny, err := denyAllPolicy(quarantineSid, q.Bucket, partitionOf(region), exempted)
+	if err != nil {
+		return err
+	}
+	if _, err := client.PutBucketPolicy(c, &s3.PutBucketPolicyInput{Bucket: aws.String(q.Bucket), Policy: aws.String(deny)}); err != nil {
+		return fmt.Errorf("applying the deny-all policy: %v", err)
+	}
+	fmt.Fprintf(w, "Bucket %s denies all access but to %s\n", q.Bucket, strings.Join(exempted, " and "))
+	fmt.Fprintf(w, "Bucket %s quarantined, lift it as %s with unquarantine -snapshot %s\n", q.Bucket, q.SecurityRole, q.Snapshot)
+	return nil
+}
+
+// UnquarantineBucket restores the policy, the ACL and the trail selectors saved by QuarantineBucket in a
+// snapshot file.
+func UnquarantineBucket(c context.Context, cfg aws.Config, path string, w io.Writer) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var snapshot quarantineSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("reading the snapshot: %v", err)
+	}
+	client := newS3Client(cfg, snapshot.Region, "")
+
+	if snapshot.Policy == "" {
+		_, err = client.DeleteBucketPolicy(c, &s3.DeleteBucketPolicyInput{Bucket: aws.String(snapshot.Bucket)})
+	} else {
+		_, err = client.PutBucketPolicy(c, &s3.PutBucketPolicyInput{Bucket: aws.String(snapshot.Bucket), Policy: aws.String(snapshot.Policy)})
+	}
+	if err != nil {
+		return fmt.Errorf("restoring the bucket policy: %v", err)
+	}
+	fmt.Fprintf(w, "Policy of bucket %s restored\n", snapshot.Bucket)
+	if snapshot.AclReset {
+		_, err := client.PutBucketAcl(c, &s3.PutBucketAclInput{
+			Bucket:              aws.String(snapshot.Bucket),
+			AccessControlPolicy: &types.AccessControlPolicy{Owner: snapshot.Owner, Grants: snapshot.Grants},
+		})
+		if err != nil {
+			return fmt.Errorf("restoring the ACL: %v", err)
+		}
+		fmt.Fprintf(w, "ACL of bucket %s restored\n", snapshot.Bucket)
+	}
+	if snapshot.Trail != "" {
+		trailClient := cloudtrail.NewFromConfig(cfg, func(options *cloudtrail.Options) {
+			options.Region = snapshot.TrailRegion
+		})
+		input := &cloudtrail.PutEventSelectorsInput{TrailName: aws.String(snapshot.Trail)}
+		if len(snapshot.AdvancedEventSelectors) > 0 {
+			input.AdvancedEventSelectors = snapshot.AdvancedEventSelectors
+		} else {
+			input.EventSelectors = snapshot.EventSelectors
+		}
+		if _, err := PutEventSelectors(c, trailClient, input); err != nil {
+			return fmt.Errorf("restoring the event selectors of trail %s: %v", snapshot.Trail, err)
+		}
+		fmt.Fprintf(w, "Event selectors of trail %s restored\n", snapshot.Trail)
+	}
+	fmt.Fprintf(w, "Quarantine of bucket %s lifted, settings of %s restored\n", snapshot.Bucket, snapshot.Taken.Format(time.RFC3339))
+	return nil
+}
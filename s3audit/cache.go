@@ -0,0 +1,87 @@
+package s3audit
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// diskCache keeps the results of expensive calls on disk, keyed by bucket and check, so repeated runs within
+// the TTL skip them. A nil cache is disabled: lookups miss and stores are dropped.
+type diskCache struct {
+	dir string
+	ttl time.Duration
+}
+
+// cacheEntry defines the content of a cache file
+type cacheEntry struct {
+	Stored time.Time       `json:"stored"`
+	Value  json.RawMessage `json:"value"`
+}
+
+// newDiskCache returns a cache storing its entries in dir, or nil when ttl is not positive.
+func newDiskCache(dir string, ttl time.Duration) (*diskCache, error) {
+	if ttl <= 0 {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &diskCache{dir: dir, ttl: ttl}, nil
+}
+
+// defaultCacheDir returns the directory of the cache in the user cache directory.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "s3audit")
+}
+
+// file returns the path of the cache file of a bucket and check.
+func (d *diskCache) file(bucket string, check string) string {
+	return filepath.Join(d.dir, fmt.Sprintf("%x.json", sha256.Sum256([]byte(bucket+"/"+check))))
+}
+
+// get decodes the cached value of a bucket and check into value. It reports false when there is no entry
+// younger than the TTL.
+func (d *diskCache) get(bucket string, check string, value interface{}) bool {
+	if d == nil {
+		return false
+	}
+	data, err := os.ReadFile(d.file(bucket, check))
+	if err != nil {
+		return false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.Stored) > d.ttl {
+		return false
+	}
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+// put stores the value of a bucket and check. Failures are logged, the cache is only an optimization.
+func (d *diskCache) put(bucket string, check string, value interface{}) {
+	if d == nil {
+		return
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Got an error caching %v of bucket %v: %v", check, bucket, err)
+		return
+	}
+	data, err := json.Marshal(cacheEntry{Stored: time.Now(), Value: raw})
+	if err != nil {
+		log.Printf("Got an error caching %v of bucket %v: %v", check, bucket, err)
+		return
+	}
+	if err := os.WriteFile(d.file(bucket, check), data, 0600); err != nil {
+		log.Printf("Got an error caching %v of bucket %v: %v", check, bucket, err)
+	}
+}
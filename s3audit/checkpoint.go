@@ -0,0 +1,164 @@
+package s3audit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+// checkpoint records the buckets whose audit completed, so an interrupted scan can resume where it left off.
+// Only what the summary of the report and the remediations need is kept: the region, risk score, findings and
+// remediations of each bucket. The file holds a JSON line per bucket, appended as each bucket completes.
+type checkpoint struct {
+	path      string
+	mutex     sync.Mutex
+	Completed map[string]checkpointBucket
+}
+
+// checkpointBucket defines the recorded outcome of the audit of a bucket
+type checkpointBucket struct {
+	Bucket       string           `json:"bucket"`
+	Region       string           `json:"region"`
+	Score        int              `json:"score"`
+	Findings     []Finding        `json:"findings"`
+	Remediations []plannedRequest `json:"remediations,omitempty"`
+}
+
+// loadCheckpoint reads the checkpoint file at path. When resume is false, or the file does not exist yet, an
+// empty checkpoint is returned and the scan starts from the first bucket. A line cut short by an interruption
+// is dropped, the bucket is audited again.
+func loadCheckpoint(path string, resume bool) (*checkpoint, error) {
+	cp := &checkpoint{path: path, Completed: map[string]checkpointBucket{}}
+	if !resume {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return cp, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(f)
+	for {
+		var completed checkpointBucket
+		err := decoder.Decode(&completed)
+		if err == io.EOF {
+			return cp, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// the next lines are appended after the last complete one
+			return cp, f.Truncate(decoder.InputOffset())
+		}
+		if err != nil {
+			return nil, err
+		}
+		if completed.Bucket == "" {
+			return nil, fmt.Errorf("not a checkpoint of this version, remove it to start over")
+		}
+		cp.Completed[completed.Bucket] = completed
+	}
+}
+
+// done reports whether the audit of a bucket completed in a previous run.
+func (cp *checkpoint) done(bucket string) bool {
+	if cp == nil {
+		return false
+	}
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	_, ok := cp.Completed[bucket]
+	return ok
+}
+
+// record appends a completed bucket to the checkpoint file, a line written at once so an interruption loses at
+// most the bucket being recorded.
+func (cp *checkpoint) record(result BucketResult) error {
+	if cp == nil {
+		return nil
+	}
+	completed := checkpointBucket{Bucket: result.Name, Region: result.Region, Score: result.score, Findings: result.Findings}
+	for _, r := range result.remediations {
+		planned, err := newPlannedRequest(r)
+		if err != nil {
+			return err
+		}
+		completed.Remediations = append(completed.Remediations, planned)
+	}
+	data, err := json.Marshal(completed)
+	if err != nil {
+		return err
+	}
+
+	cp.mutex.Lock()
+	defer cp.mutex.Unlock()
+
+	f, err := os.OpenFile(cp.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	cp.Completed[result.Name] = completed
+	return nil
+}
+
+// remove deletes the checkpoint file once the scan is complete.
+func (cp *checkpoint) remove() error {
+	if cp == nil {
+		return nil
+	}
+	if err := os.Remove(cp.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// restoredResult rebuilds the result of a bucket completed in a previous run from its findings, risk score and
+// remediations, which -fix applies on resume. The bucket is neither printed again nor part of the billing and
+// diagram sections.
+func restoredResult(name string, completed checkpointBucket) BucketResult {
+	result := BucketResult{
+		Name:     name,
+		Region:   completed.Region,
+		Findings: completed.Findings,
+		bucket:   s3Bucket{name: name},
+		score:    completed.Score,
+		restored: true,
+	}
+	for _, f := range completed.Findings {
+		s, _ := parseSeverity(f.Severity)
+		result.findings = append(result.findings, finding{
+			bucket:     f.Bucket,
+			check:      f.Check,
+			severity:   s,
+			message:    f.Message,
+			suppressed: f.Suppressed,
+		})
+	}
+	for _, planned := range completed.Remediations {
+		r, err := planned.remediation()
+		if err != nil {
+			log.Printf("Got an error restoring a remediation of the checkpoint: %v", err)
+			continue
+		}
+		result.remediations = append(result.remediations, r)
+	}
+	return result
+}
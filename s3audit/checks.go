@@ -0,0 +1,179 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Check is a custom check evaluated on every bucket after the built-in ones. Teams compile their checks in
+// and register them from an init function, without forking the scanner:
+//
+//     func init() {
+//         s3audit.Register(myCheck{})
+//     }
+type Check interface {
+	// Name identifies the check in the findings and the suppressions.
+	Name() string
+	// Evaluate returns the finding of the check on a bucket, or nil when the bucket passes. client is the S3
+	// client of the audit for the region of the bucket. The Severity of the finding is one of LOW, MEDIUM,
+	// HIGH or CRITICAL.
+	Evaluate(c context.Context, client S3ClientAPI, bucket Bucket) *Finding
+}
+
+// Bucket is the view of a bucket given to the custom checks.
+type Bucket struct {
+	Name   string
+	Region string
+	Tags   map[string]string
+}
+
+// registry holds the registered custom checks, keyed by name
+var registry = struct {
+	sync.Mutex
+	checks map[string]Check
+}{checks: map[string]Check{}}
+
+// Register adds a custom check to the audit. It panics if a check with the same name is already registered.
+func Register(check Check) {
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, ok := registry.checks[check.Name()]; ok {
+		panic("s3audit: Register called twice for check " + check.Name())
+	}
+	registry.checks[check.Name()] = check
+}
+
+// Checks returns the registered custom checks, sorted by name.
+func Checks() []Check {
+	registry.Lock()
+	defer registry.Unlock()
+
+	var checks []Check
+	for _, check := range registry.checks {
+		checks = append(checks, check)
+	}
+	sort.Slice(checks, func(i, j int) bool { return checks[i].Name() < checks[j].Name() })
+	return checks
+}
+
+// customFindings evaluates the selected custom checks on a bucket. A finding without bucket or check is
+// attributed to the bucket and the check evaluated, an unknown severity is taken as MEDIUM.
+func customFindings(c context.Context, client S3ClientAPI, b s3Bucket, region string, selection checkSelection) []finding {
+	var findings []finding
+	bucket := Bucket{Name: b.name, Region: region, Tags: b.tags}
+
+	for _, check := range Checks() {
+		if !selection.enabled(check.Name()) {
+			continue
+		}
+		f := check.Evaluate(c, client, bucket)
+		if f == nil {
+			continue
+		}
+
+		converted := finding{bucket: f.Bucket, check: f.Check, message: f.Message}
+		if converted.bucket == "" {
+			converted.bucket = b.name
+		}
+		if converted.check == "" {
+			converted.check = check.Name()
+		}
+		severity, err := parseSeverity(f.Severity)
+		if err != nil {
+			severity = severityMedium
+		}
+		converted.severity = severity
+		findings = append(findings, converted)
+	}
+
+	return findings
+}
+
+// builtinChecks holds the names of the built-in checks, as used in the findings and the suppressions. billing
+// has no finding, it is the billing section of the report.
+var builtinChecks = []string{
+	"access-analyzer", "access-point", "account-public-access-block", "anonymous-access", "billing", "bucket-key", "bucket-policy", "cloudfront", "cost-tags", "cross-account", "data-events", "drift",
+	"empty", "encryption", "guardduty", "intelligent-tiering", "naming", "notification", "owner", "ownership",
+	"required-tags", "risk", "stale", "vpc-endpoint",
+}
+
+// checkAliases names the checks by the setting they read: acl selects the checks of the bucket ACL and
+// versioning the one of the versioning status. No check reads the CORS or the website configuration, so
+// cors and website select none.
+var checkAliases = map[string][]string{
+	"acl":        {"owner", "ownership"},
+	"cors":       {},
+	"versioning": {"drift"},
+	"website":    {},
+}
+
+// checkSelection defines the checks an audit runs: the only ones when set, minus the skipped ones.
+type checkSelection struct {
+	only map[string]bool
+	skip map[string]bool
+}
+
+// newCheckSelection reads the comma separated lists of checks to run and to skip. The names are the built-in
+// checks, their aliases and the registered custom checks.
+func newCheckSelection(only string, skip string) (checkSelection, error) {
+	known := map[string]bool{}
+	for _, name := range builtinChecks {
+		known[name] = true
+	}
+	for name := range checkAliases {
+		known[name] = true
+	}
+	for _, check := range Checks() {
+		known[check.Name()] = true
+	}
+
+	parse := func(value string) (map[string]bool, error) {
+		var checks map[string]bool
+		for _, name := range splitList(value) {
+			if !known[name] {
+				var names []string
+				for name := range known {
+					names = append(names, name)
+				}
+				sort.Strings(names)
+				return nil, fmt.Errorf("unknown check %q, expected one of: %s", name, strings.Join(names, ", "))
+			}
+			if checks == nil {
+				checks = map[string]bool{}
+			}
+			if aliased, ok := checkAliases[name]; ok {
+				for _, check := range aliased {
+					checks[check] = true
+				}
+				continue
+			}
+			checks[name] = true
+		}
+		return checks, nil
+	}
+
+	var selection checkSelection
+	var err error
+	if selection.only, err = parse(only); err != nil {
+		return checkSelection{}, err
+	}
+	if selection.skip, err = parse(skip); err != nil {
+		return checkSelection{}, err
+	}
+	return selection, nil
+}
+
+// enabled reports whether any of the checks runs. The settings of a bucket are only read when a check that
+// uses them runs.
+func (s checkSelection) enabled(checks ...string) bool {
+	for _, check := range checks {
+		if (s.only == nil || s.only[check]) && !s.skip[check] {
+			return true
+		}
+	}
+	return false
+}
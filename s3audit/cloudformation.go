@@ -0,0 +1,321 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// cfnTemplate defines a CloudFormation template
+type cfnTemplate struct {
+	AWSTemplateFormatVersion string
+	Description              string
+	Resources                map[string]cfnResource
+}
+
+// cfnResource defines a resource of a CloudFormation template. Retain keeps the bucket when the stack is
+// deleted, which is required to import existing buckets into a stack.
+type cfnResource struct {
+	Type           string
+	DeletionPolicy string `json:",omitempty"`
+	Properties     map[string]interface{}
+}
+
+// nonAlphanumeric matches the characters not allowed in the logical IDs of a template
+var nonAlphanumeric = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+// cfnLiveBucket defines the configuration of a bucket that is captured in the template
+type cfnLiveBucket struct {
+	name       string
+	encryption *types.ServerSideEncryptionConfiguration
+	versioning types.BucketVersioningStatus
+	lifecycle  []types.LifecycleRule
+	tags       map[string]string
+	policy     string
+}
+
+// ExportCloudFormation reads the current configuration of every bucket of the account of cfg and writes a
+// CloudFormation template declaring it to w.
+func ExportCloudFormation(c context.Context, cfg aws.Config, w io.Writer) error {
+	client := newS3Client(cfg, "", "")
+
+	allBuckets, err := client.ListBuckets(c, &s3.ListBucketsInput{})
+	if err != nil {
+		return fmt.Errorf("retrieving buckets: %v", err)
+	}
+
+	var buckets []cfnLiveBucket
+	for _, bucket := range allBuckets.Buckets {
+		b, err := getCfnLiveBucket(c, cfg, client, aws.ToString(bucket.Name))
+		if err != nil {
+			log.Printf("Got an error retrieving the configuration of bucket %v: %v", aws.ToString(bucket.Name), err)
+			continue
+		}
+		buckets = append(buckets, b)
+	}
+
+	return writeCloudFormationTemplate(w, buckets)
+}
+
+// getCfnLiveBucket reads the configuration of a bucket captured in the template, from the region of the bucket.
+func getCfnLiveBucket(c context.Context, cfg aws.Config, client S3ClientAPI, bucket string) (cfnLiveBucket, error) {
+	b := cfnLiveBucket{name: bucket}
+
+	location, err := client.GetBucketLocation(c, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return b, err
+	}
+	region := locationRegion(location.LocationConstraint, cfg.Region)
+	client = newS3Client(cfg, region, "")
+
+	encryption, err := client.GetBucketEncryption(c, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil && apiErrorCode(err) != "ServerSideEncryptionConfigurationNotFoundError" {
+		return b, err
+	}
+	if encryption != nil {
+		b.encryption = encryption.ServerSideEncryptionConfiguration
+	}
+
+	if b.versioning, err = getBucketVersioning(c, client, bucket); err != nil {
+		return b, err
+	}
+
+	lifecycle, err := client.GetBucketLifecycleConfiguration(c, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil && apiErrorCode(err) != "NoSuchLifecycleConfiguration" {
+		return b, err
+	}
+	if lifecycle != nil {
+		b.lifecycle = lifecycle.Rules
+	}
+
+	if b.tags, err = getBucketTags(c, client, bucket); err != nil {
+		return b, err
+	}
+
+	b.policy, err = getBucketPolicy(c, client, bucket)
+	return b, err
+}
+
+// writeCloudFormationTemplate writes a JSON template with an AWS::S3::Bucket, and an AWS::S3::BucketPolicy
+// for the buckets that have one, per bucket.
+func writeCloudFormationTemplate(w io.Writer, buckets []cfnLiveBucket) error {
+	template := cfnTemplate{
+		AWSTemplateFormatVersion: "2010-09-09",
+		Description:              "S3 buckets captured from their live configuration",
+		Resources:                map[string]cfnResource{},
+	}
+
+	for _, b := range buckets {
+		id := cfnLogicalID(b.name, template.Resources)
+		template.Resources[id] = cfnResource{
+			Type:           "AWS::S3::Bucket",
+			DeletionPolicy: "Retain",
+			Properties:     cfnBucketProperties(b),
+		}
+
+		if b.policy != "" {
+			var document interface{}
+			if err := json.Unmarshal([]byte(b.policy), &document); err != nil {
+				return fmt.Errorf("policy of bucket %s: %v", b.name, err)
+			}
+			template.Resources[id+"Policy"] = cfnResource{
+				Type:           "AWS::S3::BucketPolicy",
+				DeletionPolicy: "Retain",
+				Properties: map[string]interface{}{
+					"Bucket":         map[string]string{"Ref": id},
+					"PolicyDocument": document,
+				},
+			}
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(template)
+}
+
+// cfnLogicalID turns a bucket name into a logical ID not used yet by the resources of the template.
+func cfnLogicalID(bucket string, resources map[string]cfnResource) string {
+	var id strings.Builder
+	for _, part := range nonAlphanumeric.Split(bucket, -1) {
+		if part != "" {
+			id.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	base := "Bucket" + id.String()
+
+	unique := base
+	for i := 2; ; i++ {
+		_, taken := resources[unique]
+		_, policyTaken := resources[unique+"Policy"]
+		if !taken && !policyTaken {
+			return unique
+		}
+		unique = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// cfnBucketProperties returns the properties of the AWS::S3::Bucket resource of a bucket.
+func cfnBucketProperties(b cfnLiveBucket) map[string]interface{} {
+	properties := map[string]interface{}{"BucketName": b.name}
+
+	if b.encryption != nil {
+		var rules []map[string]interface{}
+		for _, rule := range b.encryption.Rules {
+			r := map[string]interface{}{}
+			if rule.ApplyServerSideEncryptionByDefault != nil {
+				byDefault := map[string]string{"SSEAlgorithm": string(rule.ApplyServerSideEncryptionByDefault.SSEAlgorithm)}
+				if key := aws.ToString(rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID); key != "" {
+					byDefault["KMSMasterKeyID"] = key
+				}
+				r["ServerSideEncryptionByDefault"] = byDefault
+			}
+			if rule.BucketKeyEnabled != nil {
+				r["BucketKeyEnabled"] = aws.ToBool(rule.BucketKeyEnabled)
+			}
+			rules = append(rules, r)
+		}
+		properties["BucketEncryption"] = map[string]interface{}{"ServerSideEncryptionConfiguration": rules}
+	}
+
+	if b.versioning != "" {
+		properties["VersioningConfiguration"] = map[string]string{"Status": string(b.versioning)}
+	}
+
+	if len(b.lifecycle) > 0 {
+		var rules []map[string]interface{}
+		for _, rule := range b.lifecycle {
+			rules = append(rules, cfnLifecycleRule(rule))
+		}
+		properties["LifecycleConfiguration"] = map[string]interface{}{"Rules": rules}
+	}
+
+	var keys []string
+	for key := range b.tags {
+		// the aws: tags are reserved, CloudFormation sets them itself
+		if !strings.HasPrefix(key, "aws:") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var tags []map[string]string
+	for _, key := range keys {
+		tags = append(tags, map[string]string{"Key": key, "Value": b.tags[key]})
+	}
+	if len(tags) > 0 {
+		properties["Tags"] = tags
+	}
+
+	return properties
+}
+
+// cfnLifecycleRule converts a lifecycle rule to the Rule property type of AWS::S3::Bucket.
+func cfnLifecycleRule(rule types.LifecycleRule) map[string]interface{} {
+	r := map[string]interface{}{"Status": string(rule.Status)}
+	if rule.ID != nil {
+		r["Id"] = aws.ToString(rule.ID)
+	}
+
+	prefix := rule.Prefix
+	var tags []types.Tag
+	if filter := rule.Filter; filter != nil {
+		if filter.Prefix != nil {
+			prefix = filter.Prefix
+		}
+		if filter.Tag != nil {
+			tags = append(tags, *filter.Tag)
+		}
+		if filter.ObjectSizeGreaterThan != nil {
+			r["ObjectSizeGreaterThan"] = fmt.Sprint(aws.ToInt64(filter.ObjectSizeGreaterThan))
+		}
+		if filter.ObjectSizeLessThan != nil {
+			r["ObjectSizeLessThan"] = fmt.Sprint(aws.ToInt64(filter.ObjectSizeLessThan))
+		}
+		if and := filter.And; and != nil {
+			if and.Prefix != nil {
+				prefix = and.Prefix
+			}
+			tags = append(tags, and.Tags...)
+			if and.ObjectSizeGreaterThan != nil {
+				r["ObjectSizeGreaterThan"] = fmt.Sprint(aws.ToInt64(and.ObjectSizeGreaterThan))
+			}
+			if and.ObjectSizeLessThan != nil {
+				r["ObjectSizeLessThan"] = fmt.Sprint(aws.ToInt64(and.ObjectSizeLessThan))
+			}
+		}
+	}
+	if aws.ToString(prefix) != "" {
+		r["Prefix"] = aws.ToString(prefix)
+	}
+	if len(tags) > 0 {
+		var tagFilters []map[string]string
+		for _, tag := range tags {
+			tagFilters = append(tagFilters, map[string]string{"Key": aws.ToString(tag.Key), "Value": aws.ToString(tag.Value)})
+		}
+		r["TagFilters"] = tagFilters
+	}
+
+	if expiration := rule.Expiration; expiration != nil {
+		if expiration.Days != nil {
+			r["ExpirationInDays"] = aws.ToInt32(expiration.Days)
+		}
+		if expiration.Date != nil {
+			r["ExpirationDate"] = expiration.Date.Format("2006-01-02T15:04:05Z")
+		}
+		if expiration.ExpiredObjectDeleteMarker != nil {
+			r["ExpiredObjectDeleteMarker"] = aws.ToBool(expiration.ExpiredObjectDeleteMarker)
+		}
+	}
+
+	var transitions []map[string]interface{}
+	for _, transition := range rule.Transitions {
+		t := map[string]interface{}{"StorageClass": string(transition.StorageClass)}
+		if transition.Days != nil {
+			t["TransitionInDays"] = aws.ToInt32(transition.Days)
+		}
+		if transition.Date != nil {
+			t["TransitionDate"] = transition.Date.Format("2006-01-02T15:04:05Z")
+		}
+		transitions = append(transitions, t)
+	}
+	if len(transitions) > 0 {
+		r["Transitions"] = transitions
+	}
+
+	if expiration := rule.NoncurrentVersionExpiration; expiration != nil {
+		e := map[string]interface{}{"NoncurrentDays": aws.ToInt32(expiration.NoncurrentDays)}
+		if expiration.NewerNoncurrentVersions != nil {
+			e["NewerNoncurrentVersions"] = aws.ToInt32(expiration.NewerNoncurrentVersions)
+		}
+		r["NoncurrentVersionExpiration"] = e
+	}
+
+	var noncurrentTransitions []map[string]interface{}
+	for _, transition := range rule.NoncurrentVersionTransitions {
+		t := map[string]interface{}{
+			"StorageClass":     string(transition.StorageClass),
+			"TransitionInDays": aws.ToInt32(transition.NoncurrentDays),
+		}
+		if transition.NewerNoncurrentVersions != nil {
+			t["NewerNoncurrentVersions"] = aws.ToInt32(transition.NewerNoncurrentVersions)
+		}
+		noncurrentTransitions = append(noncurrentTransitions, t)
+	}
+	if len(noncurrentTransitions) > 0 {
+		r["NoncurrentVersionTransitions"] = noncurrentTransitions
+	}
+
+	if abort := rule.AbortIncompleteMultipartUpload; abort != nil {
+		r["AbortIncompleteMultipartUpload"] = map[string]int32{"DaysAfterInitiation": aws.ToInt32(abort.DaysAfterInitiation)}
+	}
+
+	return r
+}
@@ -0,0 +1,257 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudfront"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// CloudFrontListDistributionsApi defines the interface for the ListDistributions function.
+// We use this interface to test the function using a mocked service.
+type CloudFrontListDistributionsApi interface {
+	ListDistributions(ctx context.Context,
+		params *cloudfront.ListDistributionsInput,
+		optFns ...func(*cloudfront.Options)) (*cloudfront.ListDistributionsOutput, error)
+}
+
+// ListDistributions returns a page of the CloudFront distributions of the account.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListDistributionsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListDistributions.
+func ListDistributions(c context.Context, api CloudFrontListDistributionsApi, input *cloudfront.ListDistributionsInput) (*cloudfront.ListDistributionsOutput, error) {
+	return api.ListDistributions(c, input)
+}
+
+// newCloudFrontClient creates a CloudFront client, a global service of us-east-1 in aws, in the partition of
+// the configured region.
+func newCloudFrontClient(cfg aws.Config) *cloudfront.Client {
+	return cloudfront.NewFromConfig(cfg, func(options *cloudfront.Options) {
+		options.Region = globalRegion(cfg.Region)
+	})
+}
+
+// frontAccess is how a CloudFront distribution reads the bucket of its origin.
+type frontAccess string
+
+const (
+	// frontOAC is an Origin Access Control, granted by the bucket policy to the distribution
+	frontOAC frontAccess = "OAC"
+	// frontOAI is a legacy Origin Access Identity
+	frontOAI frontAccess = "OAI"
+	// frontWebsite is the website endpoint of the bucket, a custom origin CloudFront reads anonymously
+	frontWebsite frontAccess = "website endpoint"
+	// frontNone is the REST endpoint without OAC nor OAI, anonymous requests as well
+	frontNone frontAccess = "no OAC"
+	// frontDirect is a DNS record pointing at the bucket itself, bypassing CloudFront
+	frontDirect frontAccess = "direct"
+)
+
+// bucketFront is a CloudFront distribution with the bucket as origin, or a Route 53 record pointing at the
+// bucket without CloudFront.
+type bucketFront struct {
+	// distribution is the ID of the distribution, empty for a record pointing at the bucket
+	distribution string
+	arn          string
+	domain       string
+	// origin is the ID of the origin of the distribution reading the bucket
+	origin string
+	// names are the aliases of the distribution and the Route 53 records pointing at it, or the record
+	names  []string
+	access frontAccess
+}
+
+// describe names the distribution, or the record, and its DNS names.
+func (f bucketFront) describe() string {
+	if f.distribution == "" {
+		return "Route 53 record " + strings.Join(f.names, ", ")
+	}
+	description := "distribution " + f.distribution + " (" + f.domain
+	if len(f.names) > 0 {
+		description += ", " + strings.Join(f.names, ", ")
+	}
+	return description + ")"
+}
+
+// loadBucketFronts maps the buckets of the origins of the CloudFront distributions of the account, and of the
+// Route 53 records pointing at S3, to the distributions and records fronting them. The OAC of the distributions
+// is only known from the policy of their bucket, see cloudFrontGrants.
+func loadBucketFronts(c context.Context, cf CloudFrontListDistributionsApi, r53 route53Api) (map[string][]bucketFront, error) {
+	records, err := listDNSRecords(c, r53)
+	if err != nil {
+		return nil, fmt.Errorf("reading the Route 53 records: %v", err)
+	}
+	fronts := map[string][]bucketFront{}
+	input := &cloudfront.ListDistributionsInput{}
+	for {
+		page, err := ListDistributions(c, cf, input)
+		if err != nil {
+			return nil, fmt.Errorf("reading the CloudFront distributions: %v", err)
+		}
+		if page.DistributionList == nil {
+			break
+		}
+		for _, distribution := range page.DistributionList.Items {
+			domain := strings.ToLower(aws.ToString(distribution.DomainName))
+			var names []string
+			if distribution.Aliases != nil {
+				names = append(names, distribution.Aliases.Items...)
+			}
+			for _, record := range records {
+				if strings.EqualFold(record.target, domain) && !containsFold(names, record.name) {
+					names = append(names, record.name)
+				}
+			}
+			if distribution.Origins == nil {
+				continue
+			}
+			for _, origin := range distribution.Origins.Items {
+				bucket, ok := s3RecordBucket("", aws.ToString(origin.DomainName))
+				if !ok || bucket == "" {
+					continue
+				}
+				front := bucketFront{
+					distribution: aws.ToString(distribution.Id),
+					arn:          aws.ToString(distribution.ARN),
+					domain:       domain,
+					origin:       aws.ToString(origin.Id),
+					names:        names,
+					access:       frontNone,
+				}
+				switch {
+				case strings.Contains(strings.ToLower(aws.ToString(origin.DomainName)), ".s3-website"):
+					front.access = frontWebsite
+				case origin.S3OriginConfig != nil && aws.ToString(origin.S3OriginConfig.OriginAccessIdentity) != "":
+					front.access = frontOAI
+				}
+				fronts[bucket] = append(fronts[bucket], front)
+			}
+		}
+		if !aws.ToBool(page.DistributionList.IsTruncated) {
+			break
+		}
+		input.Marker = page.DistributionList.NextMarker
+	}
+	for _, record := range records {
+		if bucket, ok := s3RecordBucket(record.name, record.target); ok {
+			fronts[bucket] = append(fronts[bucket], bucketFront{names: []string{record.name}, domain: record.target, access: frontDirect})
+		}
+	}
+	return fronts, nil
+}
+
+// containsFold reports whether a list holds a string, ignoring the case as DNS names do.
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloudFrontGrants returns the distributions an Allow statement of a bucket policy grants to the CloudFront
+// service principal, the values of its AWS:SourceArn condition. An OAC signs the requests of its distribution
+// as cloudfront.amazonaws.com; a grant without condition, "*", lets any distribution of any account read.
+func cloudFrontGrants(policy string) ([]string, error) {
+	if policy == "" {
+		return nil, nil
+	}
+	doc, err := parsePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	var grants []string
+	for _, statement := range doc.Statement {
+		if statement.Effect != "Allow" || !containsFold(statement.principals()["Service"], "cloudfront.amazonaws.com") {
+			continue
+		}
+		var arns []string
+		for _, conditions := range statement.Condition {
+			for key, raw := range conditions {
+				if strings.EqualFold(key, "AWS:SourceArn") {
+					arns = append(arns, stringOrList(raw)...)
+				}
+			}
+		}
+		if len(arns) == 0 {
+			arns = []string{"*"}
+		}
+		grants = append(grants, arns...)
+	}
+	return grants, nil
+}
+
+// arnLike matches an ARN against a value of an ArnLike condition, whose * and ? also match the slashes.
+func arnLike(pattern string, arn string) bool {
+	expression := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern))
+	matched, _ := regexp.MatchString("^"+expression+"$", arn)
+	return matched
+}
+
+// withGrants returns the fronts of a bucket with the access of the distributions its policy grants.
+func withGrants(fronts []bucketFront, grants []string) []bucketFront {
+	var granted []bucketFront
+	for _, front := range fronts {
+		if front.distribution != "" && front.access == frontNone {
+			for _, grant := range grants {
+				if arnLike(grant, front.arn) {
+					front.access = frontOAC
+					break
+				}
+			}
+		}
+		granted = append(granted, front)
+	}
+	return granted
+}
+
+// cloudFrontFindings flags the distributions reading a bucket without OAC, the records serving it directly,
+// and a bucket fronted by CloudFront that is public anyway: its objects are reachable bypassing CloudFront.
+func cloudFrontFindings(b s3Bucket) []finding {
+	var findings []finding
+	var distributions []string
+	for _, front := range b.fronts {
+		if front.distribution != "" {
+			distributions = append(distributions, front.distribution)
+		}
+		var message string
+		switch front.access {
+		case frontWebsite:
+			message = front.describe() + " reads the website endpoint, which requires a public bucket; use the REST endpoint with an Origin Access Control"
+		case frontNone:
+			message = front.describe() + " reads the bucket without Origin Access Control, the bucket policy grants it no access"
+		case frontOAI:
+			message = front.describe() + " reads the bucket with a legacy Origin Access Identity, migrate it to an Origin Access Control"
+		case frontDirect:
+			message = front.describe() + " serves the bucket directly, without CloudFront"
+		default:
+			continue
+		}
+		findings = append(findings, finding{bucket: b.name, check: "cloudfront", severity: severityMedium, message: message})
+	}
+	if len(distributions) > 0 && (b.policyPublic || aclPublic(b.acl)) {
+		sort.Strings(distributions)
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "cloudfront",
+			severity: severityHigh,
+			message:  "public although fronted by CloudFront distribution " + strings.Join(distributions, ", ") + ", its objects can be read without CloudFront",
+		})
+	}
+	return findings
+}
+
+// printBucketFronts prints the distributions and records fronting a bucket below its report line.
+func printBucketFronts(fronts []bucketFront) {
+	for _, front := range fronts {
+		fmt.Printf("\tFronted by: %s\t Access: %s\n", front.describe(), front.access)
+	}
+}
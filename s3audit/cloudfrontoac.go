@@ -0,0 +1,162 @@
+package s3audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"os"
+	"strings"
+)
+
+// oacStatement is the statement of the bucket policy letting the OAC of a distribution read the objects.
+func oacStatement(bucket string, distributionArn string) map[string]interface{} {
+	partition := "aws"
+	if parts := strings.SplitN(distributionArn, ":", 3); len(parts) == 3 {
+		partition = parts[1]
+	}
+	return map[string]interface{}{
+		"Sid":       "AllowCloudFrontOAC" + distributionArn[strings.LastIndex(distributionArn, "/")+1:],
+		"Effect":    "Allow",
+		"Principal": map[string]string{"Service": "cloudfront.amazonaws.com"},
+		"Action":    "s3:GetObject",
+		"Resource":  fmt.Sprintf("arn:%s:s3:::%s/*", partition, bucket),
+		"Condition": map[string]interface{}{
+			"StringEquals": map[string]string{"AWS:SourceArn": distributionArn},
+		},
+	}
+}
+
+// oacPolicy returns the policy of a bucket with the statements granting the distributions read access, added
+// to its current statements. The other fields of the policy are kept as they are.
+func oacPolicy(policy string, bucket string, distributionArns []string) (string, error) {
+	doc := map[string]interface{}{"Version": "2012-10-17"}
+	var statements []interface{}
+	if policy != "" {
+		if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+			return "", fmt.Errorf("reading the bucket policy: %v", err)
+		}
+		// a policy with a single statement may hold it as an object rather than a list
+		switch current := doc["Statement"].(type) {
+		case []interface{}:
+			statements = current
+		case map[string]interface{}:
+			statements = []interface{}{current}
+		}
+	}
+	for _, arn := range distributionArns {
+		statements = append(statements, oacStatement(bucket, arn))
+	}
+	doc["Statement"] = statements
+	data, err := json.MarshalIndent(doc, "", "  ")
+	return string(data), err
+}
+
+// oacCommands are the AWS CLI commands switching the origin of a distribution to an OAC: the update replaces
+// the whole configuration of the distribution, so this step is left to the operator.
+func oacCommands(bucket string, region string, front bucketFront) []string {
+	return []string{
+		fmt.Sprintf("aws cloudfront create-origin-access-control --origin-access-control-config "+
+			"Name=%s,SigningProtocol=sigv4,SigningBehavior=always,OriginAccessControlOriginType=s3", bucket),
+		fmt.Sprintf("aws cloudfront get-distribution-config --id %s > %s.json", front.distribution, front.distribution),
+		fmt.Sprintf("edit the origin %s of DistributionConfig in %s.json: DomainName %s.s3.%s.amazonaws.com, "+
+			"OriginAccessControlId the Id of the OAC, S3OriginConfig.OriginAccessIdentity \"\", and no CustomOriginConfig",
+			front.origin, front.distribution, bucket, region),
+		fmt.Sprintf("aws cloudfront update-distribution --id %s --if-match <ETag of %s.json> --distribution-config <DistributionConfig of %s.json>",
+			front.distribution, front.distribution, front.distribution),
+		fmt.Sprintf("aws cloudfront wait distribution-deployed --id %s", front.distribution),
+	}
+}
+
+// LockToCloudFront is the guided remediation of a bucket fronted by CloudFront without Origin Access Control:
+// it switches the origins of the distributions to an OAC, grants the OAC read access in the bucket policy, then
+// blocks the public access of the bucket. distribution limits the workflow to one distribution. Without apply,
+// the changes are only printed; with apply, each change to the bucket is applied once confirmed on the terminal.
+func LockToCloudFront(c context.Context, cfg aws.Config, bucket string, distribution string, apply bool, w io.Writer) error {
+	all, err := loadBucketFronts(c, newCloudFrontClient(cfg), newRoute53Client(cfg))
+	if err != nil {
+		return err
+	}
+
+	client, region, err := newBucketClient(c, cfg, bucket, "")
+	if err != nil {
+		return err
+	}
+	policy, err := getBucketPolicy(c, client, bucket)
+	if err != nil {
+		return fmt.Errorf("reading the bucket policy: %v", err)
+	}
+	grants, err := cloudFrontGrants(policy)
+	if err != nil {
+		return fmt.Errorf("reading the bucket policy: %v", err)
+	}
+
+	var fronts []bucketFront
+	var arns []string
+	for _, front := range withGrants(all[bucket], grants) {
+		if front.distribution == "" || front.access == frontOAC || distribution != "" && front.distribution != distribution {
+			continue
+		}
+		fronts = append(fronts, front)
+		if !contains(arns, front.arn) {
+			arns = append(arns, front.arn)
+		}
+	}
+	if len(fronts) == 0 {
+		fmt.Fprintf(w, "Bucket %s is not fronted by a CloudFront distribution without Origin Access Control\n", bucket)
+		return nil
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	confirm := func(description string) bool {
+		return apply && confirmRemediation(in, w, remediation{bucket: bucket, region: region, name: "cloudfront-oac", description: description})
+	}
+
+	fmt.Fprintln(w, "Step 1/3: switch the origins of the distributions to an Origin Access Control")
+	for _, front := range fronts {
+		fmt.Fprintf(w, "%s, origin %s, access %s:\n", front.describe(), front.origin, front.access)
+		for _, command := range oacCommands(bucket, region, front) {
+			fmt.Fprintf(w, "\t%s\n", command)
+		}
+	}
+
+	fmt.Fprintln(w, "\nStep 2/3: grant the distributions read access in the bucket policy")
+	locked, err := oacPolicy(policy, bucket, arns)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "%s\n", locked)
+	if confirm("put the bucket policy above") {
+		if _, err := client.PutBucketPolicy(c, &s3.PutBucketPolicyInput{Bucket: aws.String(bucket), Policy: aws.String(locked)}); err != nil {
+			return fmt.Errorf("putting the bucket policy: %v", err)
+		}
+		fmt.Fprintln(w, "Bucket policy applied")
+	}
+
+	fmt.Fprintln(w, "\nStep 3/3: block the public access of the bucket, once the distributions are deployed with the OAC")
+	fmt.Fprintf(w, "\taws s3api put-public-access-block --bucket %s --public-access-block-configuration "+
+		"BlockPublicAcls=true,IgnorePublicAcls=true,BlockPublicPolicy=true,RestrictPublicBuckets=true\n", bucket)
+	if confirm("enable Block Public Access, the distributions must read the bucket through their OAC already") {
+		_, err := client.PutPublicAccessBlock(c, &s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+			PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(true),
+				IgnorePublicAcls:      aws.Bool(true),
+				BlockPublicPolicy:     aws.Bool(true),
+				RestrictPublicBuckets: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("blocking the public access: %v", err)
+		}
+		fmt.Fprintln(w, "Block Public Access enabled")
+	}
+	if !apply {
+		fmt.Fprintln(w, "\nRun with -apply to apply the bucket policy and Block Public Access, each once confirmed")
+	}
+	return nil
+}
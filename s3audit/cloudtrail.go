@@ -0,0 +1,248 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"strings"
+)
+
+// CloudTrailDescribeTrailsApi defines the interface for the DescribeTrails function.
+// We use this interface to test the function using a mocked service.
+type CloudTrailDescribeTrailsApi interface {
+	DescribeTrails(ctx context.Context,
+		params *cloudtrail.DescribeTrailsInput,
+		optFns ...func(*cloudtrail.Options)) (*cloudtrail.DescribeTrailsOutput, error)
+}
+
+// CloudTrailGetTrailStatusApi defines the interface for the GetTrailStatus function.
+// We use this interface to test the function using a mocked service.
+type CloudTrailGetTrailStatusApi interface {
+	GetTrailStatus(ctx context.Context,
+		params *cloudtrail.GetTrailStatusInput,
+		optFns ...func(*cloudtrail.Options)) (*cloudtrail.GetTrailStatusOutput, error)
+}
+
+// CloudTrailGetEventSelectorsApi defines the interface for the GetEventSelectors function.
+// We use this interface to test the function using a mocked service.
+type CloudTrailGetEventSelectorsApi interface {
+	GetEventSelectors(ctx context.Context,
+		params *cloudtrail.GetEventSelectorsInput,
+		optFns ...func(*cloudtrail.Options)) (*cloudtrail.GetEventSelectorsOutput, error)
+}
+
+// trailCoverage defines which buckets a logging trail records S3 data events for
+type trailCoverage struct {
+	trail      string
+	allBuckets bool
+	buckets    map[string]bool
+	excluded   map[string]bool
+}
+
+// covers reports whether the trail records the data events of a bucket.
+func (t trailCoverage) covers(bucket string) bool {
+	if t.excluded[bucket] {
+		return false
+	}
+	return t.allBuckets || t.buckets[bucket]
+}
+
+// DescribeTrails retrieves the trails that apply to the region of the client.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a DescribeTrailsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to DescribeTrails.
+func DescribeTrails(c context.Context, api CloudTrailDescribeTrailsApi, input *cloudtrail.DescribeTrailsInput) (*cloudtrail.DescribeTrailsOutput, error) {
+	return api.DescribeTrails(c, input)
+}
+
+// GetTrailStatus returns whether a trail is logging.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetTrailStatusOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetTrailStatus.
+func GetTrailStatus(c context.Context, api CloudTrailGetTrailStatusApi, input *cloudtrail.GetTrailStatusInput) (*cloudtrail.GetTrailStatusOutput, error) {
+	return api.GetTrailStatus(c, input)
+}
+
+// GetEventSelectors returns the event selectors of a trail.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetEventSelectorsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetEventSelectors.
+func GetEventSelectors(c context.Context, api CloudTrailGetEventSelectorsApi, input *cloudtrail.GetEventSelectorsInput) (*cloudtrail.GetEventSelectorsOutput, error) {
+	return api.GetEventSelectors(c, input)
+}
+
+// getDataEventCoverage returns, for every logging trail that applies to a region, the buckets whose S3 data
+// events it records. Status and selectors are read from the home region of each trail.
+func getDataEventCoverage(c context.Context, cfg aws.Config, region string) ([]trailCoverage, error) {
+	client := cloudtrail.NewFromConfig(cfg, func(options *cloudtrail.Options) {
+		options.Region = region
+	})
+	trails, err := DescribeTrails(c, client, &cloudtrail.DescribeTrailsInput{IncludeShadowTrails: aws.Bool(true)})
+	if err != nil {
+		return nil, err
+	}
+
+	var coverage []trailCoverage
+	for _, trail := range trails.TrailList {
+		homeClient := cloudtrail.NewFromConfig(cfg, func(options *cloudtrail.Options) {
+			options.Region = aws.ToString(trail.HomeRegion)
+		})
+
+		status, err := GetTrailStatus(c, homeClient, &cloudtrail.GetTrailStatusInput{Name: trail.TrailARN})
+		if err != nil {
+			return nil, err
+		}
+		if !aws.ToBool(status.IsLogging) {
+			continue
+		}
+
+		selectors, err := GetEventSelectors(c, homeClient, &cloudtrail.GetEventSelectorsInput{TrailName: trail.TrailARN})
+		if err != nil {
+			return nil, err
+		}
+
+		t := trailCoverage{trail: aws.ToString(trail.Name), buckets: map[string]bool{}, excluded: map[string]bool{}}
+		addBasicSelectors(&t, selectors.EventSelectors)
+		addAdvancedSelectors(&t, selectors.AdvancedEventSelectors)
+		if t.allBuckets || len(t.buckets) > 0 {
+			coverage = append(coverage, t)
+		}
+	}
+
+	return coverage, nil
+}
+
+// addBasicSelectors adds the buckets selected by the data resources of basic event selectors.
+func addBasicSelectors(t *trailCoverage, selectors []types.EventSelector) {
+	for _, selector := range selectors {
+		for _, resource := range selector.DataResources {
+			if aws.ToString(resource.Type) != "AWS::S3::Object" {
+				continue
+			}
+			for _, value := range resource.Values {
+				if bucket, all := bucketFromObjectArn(value); all {
+					t.allBuckets = true
+				} else {
+					t.buckets[bucket] = true
+				}
+			}
+		}
+	}
+}
+
+// addAdvancedSelectors adds the buckets selected by advanced event selectors on S3 object data events. A
+// selector without a resources.ARN field selects every bucket.
+func addAdvancedSelectors(t *trailCoverage, selectors []types.AdvancedEventSelector) {
+	for _, selector := range selectors {
+		var data, objects bool
+		var arnSelectors []types.AdvancedFieldSelector
+		for _, field := range selector.FieldSelectors {
+			switch aws.ToString(field.Field) {
+			case "eventCategory":
+				data = contains(field.Equals, "Data")
+			case "resources.type":
+				objects = contains(field.Equals, "AWS::S3::Object")
+			case "resources.ARN":
+				arnSelectors = append(arnSelectors, field)
+			}
+		}
+		if !data || !objects {
+			continue
+		}
+
+		if len(arnSelectors) == 0 {
+			t.allBuckets = true
+			continue
+		}
+		for _, field := range arnSelectors {
+			if len(field.Equals) == 0 && len(field.StartsWith) == 0 {
+				t.allBuckets = true
+			}
+			for _, values := range [][]string{field.Equals, field.StartsWith} {
+				for _, value := range values {
+					if bucket, all := bucketFromObjectArn(value); all {
+						t.allBuckets = true
+					} else {
+						t.buckets[bucket] = true
+					}
+				}
+			}
+			for _, values := range [][]string{field.NotEquals, field.NotStartsWith} {
+				for _, value := range values {
+					// only excluding a whole bucket removes it from the coverage, not excluding a prefix of it
+					if bucket, all := bucketFromObjectArn(value); !all && strings.HasSuffix(value, bucket+"/") {
+						t.excluded[bucket] = true
+					}
+				}
+			}
+		}
+	}
+}
+
+// bucketFromObjectArn returns the bucket of an S3 object ARN or ARN prefix used in event selectors, such as
+// "arn:aws:s3:::bucket/prefix". all is true for the prefixes selecting every bucket ("arn:aws:s3" and "arn:aws:s3:::").
+func bucketFromObjectArn(value string) (bucket string, all bool) {
+	parts := strings.SplitN(value, ":::", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return "", true
+	}
+	return strings.SplitN(parts[1], "/", 2)[0], false
+}
+
+// contains reports whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// loggingTrails returns the names of the trails recording the data events of a bucket.
+func loggingTrails(coverage []trailCoverage, bucket string) []string {
+	var trails []string
+	for _, t := range coverage {
+		if t.covers(bucket) {
+			trails = append(trails, t.trail)
+		}
+	}
+	return trails
+}
+
+// dataEventFinding flags a sensitive-tagged bucket whose S3 data events no trail records.
+func dataEventFinding(b s3Bucket, sensitive tagMatcher) (finding, bool) {
+	tag, ok := sensitive.match(b.tags)
+	if !ok || len(b.dataEventTrails) > 0 {
+		return finding{}, false
+	}
+	return finding{
+		bucket:   b.name,
+		check:    "data-events",
+		severity: severityHigh,
+		message:  fmt.Sprintf("bucket is tagged %s but no logging trail records its S3 data events", tag),
+	}, true
+}
+
+// printDataEventTrails prints the trails recording the data events of a bucket below its report line.
+func printDataEventTrails(trails []string) {
+	if len(trails) == 0 {
+		fmt.Println("\tData events: not logged")
+		return
+	}
+	fmt.Printf("\tData events: %s\n", strings.Join(trails, ","))
+}
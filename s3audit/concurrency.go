@@ -0,0 +1,133 @@
+package s3audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/smithy-go/middleware"
+	"sync"
+	"time"
+)
+
+// The bounds of the adaptive concurrency: it starts low and ramps up to maxAdaptiveConcurrency buckets at
+// the same time, halving at most once per backoffInterval when the requests are throttled.
+const (
+	initialAdaptiveConcurrency = 2
+	maxAdaptiveConcurrency     = 64
+	backoffInterval            = time.Second
+)
+
+// concurrencyLimiter bounds the number of buckets audited at the same time. An adaptive limiter follows AIMD:
+// the limit grows by one with each bucket audited without throttling, and is halved when a request is
+// throttled, so the audit finds the rate the account quotas allow.
+type concurrencyLimiter struct {
+	mutex    sync.Mutex
+	cond     *sync.Cond
+	adaptive bool
+	limit    int
+	max      int
+	inUse    int
+	// throttled is set by a throttled request, until the next bucket completes
+	throttled   bool
+	lastBackoff time.Time
+	peak        int
+	backoffs    int
+}
+
+// newConcurrencyLimiter returns a limiter of fixed concurrency, or an adaptive one when adaptive is true.
+func newConcurrencyLimiter(concurrency int, adaptive bool) *concurrencyLimiter {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	l := &concurrencyLimiter{limit: concurrency, max: concurrency, adaptive: adaptive}
+	if adaptive {
+		l.limit, l.max = initialAdaptiveConcurrency, maxAdaptiveConcurrency
+	}
+	l.peak = l.limit
+	l.cond = sync.NewCond(&l.mutex)
+	return l
+}
+
+// workers returns the number of workers the limiter may let run at the same time.
+func (l *concurrencyLimiter) workers() int {
+	return l.max
+}
+
+// acquire waits for a slot under the limit.
+func (l *concurrencyLimiter) acquire() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for l.inUse >= l.limit {
+		l.cond.Wait()
+	}
+	l.inUse++
+}
+
+// release frees the slot of a completed bucket, and raises the limit when no request was throttled since the
+// previous bucket completed.
+func (l *concurrencyLimiter) release() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.inUse--
+	if l.adaptive && !l.throttled && l.limit < l.max {
+		l.limit++
+		if l.limit > l.peak {
+			l.peak = l.limit
+		}
+	}
+	l.throttled = false
+	l.cond.Broadcast()
+}
+
+// throttle halves the limit after a throttled request. The requests in flight when the limit drops are
+// throttled too, so the limit is only halved once per backoffInterval.
+func (l *concurrencyLimiter) throttle() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.throttled = true
+	if !l.adaptive || time.Since(l.lastBackoff) < backoffInterval {
+		return
+	}
+	l.lastBackoff = time.Now()
+	l.limit /= 2
+	if l.limit < 1 {
+		l.limit = 1
+	}
+	l.backoffs++
+}
+
+// instrument reports the throttled attempts of every client created from the config. The middleware runs
+// after the retry middleware, so each attempt is seen rather than only the final error.
+func (l *concurrencyLimiter) instrument(cfg aws.Config) aws.Config {
+	cfg = cfg.Copy()
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		observe := middleware.FinalizeMiddlewareFunc("AdaptiveConcurrency",
+			func(c context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+				out, metadata, err := next.HandleFinalize(c, in)
+				if errors.Is(classifyError(err), ErrThrottled) {
+					l.throttle()
+				}
+				return out, metadata, err
+			})
+		if err := stack.Finalize.Insert(observe, "Retry", middleware.After); err != nil {
+			return stack.Finalize.Add(observe, middleware.After)
+		}
+		return nil
+	})
+	return cfg
+}
+
+// print prints the range the adaptive concurrency reached.
+func (l *concurrencyLimiter) print() {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.adaptive {
+		fmt.Printf("\nConcurrency: up to %d bucket(s) at the same time, backed off %d time(s) on throttling, %d at the end\n",
+			l.peak, l.backoffs, l.limit)
+	}
+}
@@ -0,0 +1,156 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/configservice"
+	"github.com/aws/aws-sdk-go-v2/service/configservice/types"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"strings"
+)
+
+// ConfigDescribeConfigRulesApi defines the interface for the DescribeConfigRules function.
+// We use this interface to test the function using a mocked service.
+type ConfigDescribeConfigRulesApi interface {
+	DescribeConfigRules(ctx context.Context,
+		params *configservice.DescribeConfigRulesInput,
+		optFns ...func(*configservice.Options)) (*configservice.DescribeConfigRulesOutput, error)
+}
+
+// ConfigGetComplianceDetailsByConfigRuleApi defines the interface for the GetComplianceDetailsByConfigRule function.
+// We use this interface to test the function using a mocked service.
+type ConfigGetComplianceDetailsByConfigRuleApi interface {
+	GetComplianceDetailsByConfigRule(ctx context.Context,
+		params *configservice.GetComplianceDetailsByConfigRuleInput,
+		optFns ...func(*configservice.Options)) (*configservice.GetComplianceDetailsByConfigRuleOutput, error)
+}
+
+// configApi groups the AWS Config calls needed to read the results of the S3 managed rules of a region.
+type configApi interface {
+	ConfigDescribeConfigRulesApi
+	ConfigGetComplianceDetailsByConfigRuleApi
+}
+
+// configRuleResult defines the evaluation of a bucket by an AWS Config managed rule
+type configRuleResult struct {
+	rule       string
+	identifier string
+	compliance types.ComplianceType
+}
+
+// DescribeConfigRules retrieves the AWS Config rules of a region.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a DescribeConfigRulesOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to DescribeConfigRules.
+func DescribeConfigRules(c context.Context, api ConfigDescribeConfigRulesApi, input *configservice.DescribeConfigRulesInput) (*configservice.DescribeConfigRulesOutput, error) {
+	return api.DescribeConfigRules(c, input)
+}
+
+// GetComplianceDetailsByConfigRule retrieves the evaluation results of an AWS Config rule.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetComplianceDetailsByConfigRuleOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetComplianceDetailsByConfigRule.
+func GetComplianceDetailsByConfigRule(c context.Context, api ConfigGetComplianceDetailsByConfigRuleApi, input *configservice.GetComplianceDetailsByConfigRuleInput) (*configservice.GetComplianceDetailsByConfigRuleOutput, error) {
+	return api.GetComplianceDetailsByConfigRule(c, input)
+}
+
+// getConfigRuleResults reads the evaluations of every S3 managed rule (source identifiers starting with S3_)
+// deployed in the region of api, keyed by bucket name.
+func getConfigRuleResults(c context.Context, api configApi) (map[string][]configRuleResult, error) {
+	results := map[string][]configRuleResult{}
+
+	rulesInput := &configservice.DescribeConfigRulesInput{}
+	for {
+		rules, err := DescribeConfigRules(c, api, rulesInput)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, rule := range rules.ConfigRules {
+			if rule.Source == nil || rule.Source.Owner != types.OwnerAws || !strings.HasPrefix(aws.ToString(rule.Source.SourceIdentifier), "S3_") {
+				continue
+			}
+
+			detailsInput := &configservice.GetComplianceDetailsByConfigRuleInput{ConfigRuleName: rule.ConfigRuleName}
+			for {
+				details, err := GetComplianceDetailsByConfigRule(c, api, detailsInput)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, evaluation := range details.EvaluationResults {
+					if evaluation.EvaluationResultIdentifier == nil || evaluation.EvaluationResultIdentifier.EvaluationResultQualifier == nil {
+						continue
+					}
+					qualifier := evaluation.EvaluationResultIdentifier.EvaluationResultQualifier
+					if aws.ToString(qualifier.ResourceType) != "AWS::S3::Bucket" {
+						continue
+					}
+
+					bucket := aws.ToString(qualifier.ResourceId)
+					results[bucket] = append(results[bucket], configRuleResult{
+						rule:       aws.ToString(rule.ConfigRuleName),
+						identifier: aws.ToString(rule.Source.SourceIdentifier),
+						compliance: evaluation.ComplianceType,
+					})
+				}
+
+				if details.NextToken == nil {
+					break
+				}
+				detailsInput.NextToken = details.NextToken
+			}
+		}
+
+		if rules.NextToken == nil {
+			break
+		}
+		rulesInput.NextToken = rules.NextToken
+	}
+
+	return results, nil
+}
+
+// auditorVerdict returns whether the auditor considers a bucket compliant with the intent of an AWS Config
+// managed rule. known is false for the rules the auditor has no equivalent check for.
+func auditorVerdict(b s3Bucket, identifier string) (compliant bool, known bool) {
+	switch identifier {
+	case "S3_BUCKET_SERVER_SIDE_ENCRYPTION_ENABLED":
+		return b.encryptionState == encryptionConfigured, b.encryptionState != encryptionUnknown
+	case "S3_DEFAULT_ENCRYPTION_KMS":
+		return encryptionAlgorithm(b) == string(s3types.ServerSideEncryptionAwsKms), b.encryptionState != encryptionUnknown
+	case "S3_BUCKET_ACL_PROHIBITED":
+		return b.objectOwnership == s3types.ObjectOwnershipBucketOwnerEnforced, true
+	case "S3_BUCKET_PUBLIC_READ_PROHIBITED", "S3_BUCKET_PUBLIC_WRITE_PROHIBITED":
+		return !b.policyPublic, true
+	}
+	return false, false
+}
+
+// printConfigRuleResults prints the AWS Config evaluations of a bucket below its report line, next to the
+// auditor's own verdict where it has an equivalent check. It returns how many results agree and disagree.
+func printConfigRuleResults(b s3Bucket) (agree int, disagree int) {
+	for _, result := range b.configRules {
+		verdict := "no equivalent check"
+		if compliant, known := auditorVerdict(b, result.identifier); known && result.compliance != types.ComplianceTypeNotApplicable && result.compliance != types.ComplianceTypeInsufficientData {
+			if compliant == (result.compliance == types.ComplianceTypeCompliant) {
+				verdict = "auditor agrees"
+				agree++
+			} else {
+				verdict = "AUDITOR DISAGREES"
+				disagree++
+			}
+		}
+		fmt.Printf("\tConfig rule: %s\t %s\t %s\n", result.rule, result.compliance, verdict)
+	}
+	return agree, disagree
+}
@@ -0,0 +1,200 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// costExplorerService is the value of the SERVICE dimension of the S3 costs in Cost Explorer
+const costExplorerService = "Amazon Simple Storage Service"
+
+// CostExplorerGetCostAndUsageApi defines the interface for the GetCostAndUsage function.
+// We use this interface to test the function using a mocked service.
+type CostExplorerGetCostAndUsageApi interface {
+	GetCostAndUsage(ctx context.Context,
+		params *costexplorer.GetCostAndUsageInput,
+		optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+}
+
+// GetCostAndUsage returns the costs of a period, a page at a time. Each call is billed by Cost Explorer.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetCostAndUsageOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetCostAndUsage.
+func GetCostAndUsage(c context.Context, api CostExplorerGetCostAndUsageApi, input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+	return api.GetCostAndUsage(c, input)
+}
+
+// newCostExplorerClient creates a Cost Explorer client, a global service of us-east-1 in aws, in the partition
+// of the configured region.
+func newCostExplorerClient(cfg aws.Config) *costexplorer.Client {
+	return costexplorer.NewFromConfig(cfg, func(options *costexplorer.Options) {
+		options.Region = globalRegion(cfg.Region)
+	})
+}
+
+// tagCosts holds the billed S3 cost of each value of a cost allocation tag over a period, the untagged costs
+// under the empty value.
+type tagCosts struct {
+	tag   string
+	start time.Time
+	end   time.Time
+	unit  string
+	costs map[string]float64
+}
+
+// bucketCost is the billed cost of the value of the cost allocation tag a bucket carries, shared by the
+// buckets carrying the same value.
+type bucketCost struct {
+	costs   *tagCosts
+	value   string
+	amount  float64
+	buckets int
+}
+
+// lastMonth returns the first day of the last complete month and of the current month, the end of the
+// period being excluded by Cost Explorer.
+func lastMonth(now time.Time) (time.Time, time.Time) {
+	end := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return end.AddDate(0, -1, 0), end
+}
+
+// getTagCosts reads the S3 costs of the last complete month grouped by the values of a cost allocation tag.
+// The tag must be activated as a cost allocation tag in the billing console, its costs are only recorded
+// from then on.
+func getTagCosts(c context.Context, api CostExplorerGetCostAndUsageApi, tag string, now time.Time) (*tagCosts, error) {
+	start, end := lastMonth(now)
+	costs := &tagCosts{tag: tag, start: start, end: end, costs: map[string]float64{}}
+	input := &costexplorer.GetCostAndUsageInput{
+		TimePeriod: &types.DateInterval{
+			Start: aws.String(start.Format("2006-01-02")),
+			End:   aws.String(end.Format("2006-01-02")),
+		},
+		Granularity: types.GranularityMonthly,
+		Metrics:     []string{string(types.MetricUnblendedCost)},
+		Filter: &types.Expression{
+			Dimensions: &types.DimensionValues{
+				Key:    types.DimensionService,
+				Values: []string{costExplorerService},
+			},
+		},
+		GroupBy: []types.GroupDefinition{{
+			Type: types.GroupDefinitionTypeTag,
+			Key:  aws.String(tag),
+		}},
+	}
+	for {
+		page, err := GetCostAndUsage(c, api, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range page.ResultsByTime {
+			for _, group := range result.Groups {
+				if len(group.Keys) == 0 {
+					continue
+				}
+				metric, ok := group.Metrics[string(types.MetricUnblendedCost)]
+				if !ok {
+					continue
+				}
+				amount, err := strconv.ParseFloat(aws.ToString(metric.Amount), 64)
+				if err != nil {
+					continue
+				}
+				// the keys of a tag group are <tag>$<value>, <tag>$ for the untagged costs
+				value := strings.TrimPrefix(group.Keys[0], tag+"$")
+				costs.costs[value] += amount
+				costs.unit = aws.ToString(metric.Unit)
+			}
+		}
+		if page.NextPageToken == nil {
+			return costs, nil
+		}
+		input.NextPageToken = page.NextPageToken
+	}
+}
+
+// joinTagCosts sets the cost of the tag value of each bucket, along with the number of buckets sharing it.
+func joinTagCosts(results []BucketResult, costs *tagCosts) {
+	buckets := map[string]int{}
+	for _, result := range results {
+		if value := result.bucket.tags[costs.tag]; value != "" {
+			buckets[value]++
+		}
+	}
+	for i := range results {
+		value := results[i].bucket.tags[costs.tag]
+		if value == "" {
+			continue
+		}
+		if amount, ok := costs.costs[value]; ok {
+			results[i].cost = &bucketCost{costs: costs, value: value, amount: amount, buckets: buckets[value]}
+		}
+	}
+}
+
+// printTagCosts prints the billed S3 cost of each value of the tag next to the estimate of the Standard
+// storage of its buckets from their size alone. The costs of the values no audited bucket carries, e.g. of
+// another account of the organization, and the untagged costs are printed as well.
+func printTagCosts(results []BucketResult, costs *tagCosts) {
+	fmt.Printf("\nBilled S3 cost by tag %s, %s to %s:\n", costs.tag, costs.start.Format("2006-01-02"),
+		costs.end.AddDate(0, 0, -1).Format("2006-01-02"))
+	buckets := map[string]int{}
+	sizes := map[string]float64{}
+	for _, result := range results {
+		// the tags of the buckets restored from a checkpoint were not kept
+		if result.restored {
+			continue
+		}
+		value := result.bucket.tags[costs.tag]
+		buckets[value]++
+		sizes[value] += result.bucket.sizeBytes
+	}
+	values := map[string]bool{}
+	for value := range costs.costs {
+		values[value] = true
+	}
+	for value := range buckets {
+		values[value] = true
+	}
+	var sorted []string
+	for value := range values {
+		sorted = append(sorted, value)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if costs.costs[sorted[i]] != costs.costs[sorted[j]] {
+			return costs.costs[sorted[i]] > costs.costs[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	t := newTable(false, column{header: "VALUE"}, column{header: "BUCKETS"}, column{header: "BILLED"}, column{header: "SIZE ESTIMATE"})
+	var total float64
+	for _, value := range sorted {
+		name := value
+		if name == "" {
+			name = "(untagged)"
+		}
+		billed := "n/a"
+		if amount, ok := costs.costs[value]; ok {
+			billed = fmt.Sprintf("%.2f %s", amount, costs.unit)
+			total += amount
+		}
+		estimate := fmt.Sprintf("%.2f USD", sizes[value]/(1<<30)*priceStandardGB)
+		t.add(cell{text: name}, cell{text: strconv.Itoa(buckets[value])}, cell{text: billed}, cell{text: estimate})
+	}
+	t.write(os.Stdout)
+	fmt.Printf("Total billed: %.2f %s; the size estimates price all the data as Standard storage (us-east-1), without requests nor transfer\n",
+		total, costs.unit)
+}
@@ -0,0 +1,184 @@
+package s3audit
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gopkg.in/yaml.v3"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// costTagRule infers tags from a value, the name of a bucket or the ARN of its creator: when the pattern
+// matches, the tags get their values, with the named groups of the pattern expanded, e.g. ${team}.
+type costTagRule struct {
+	Pattern string            `yaml:"pattern"`
+	Tags    map[string]string `yaml:"tags"`
+
+	pattern *regexp.Regexp
+}
+
+// costTagDefaults defines the rules inferring the cost allocation tags a bucket is missing: the rules of its
+// name, then the rules of its creator, looked up with Creators. The first rule giving a value to a tag wins.
+type costTagDefaults struct {
+	Names    []costTagRule `yaml:"names"`
+	Creators []costTagRule `yaml:"creators"`
+}
+
+// inferredTag is a tag inferred for a bucket, from its name or its creator
+type inferredTag struct {
+	key   string
+	value string
+	from  string
+}
+
+// loadCostTagDefaults reads a file of cost allocation tag rules, e.g.
+//
+//	names:
+//	  - pattern: '^(?P<team>[a-z]+)-(prod|dev)-'
+//	    tags: {team: '${team}'}
+//	creators:
+//	  - pattern: ':assumed-role/(?P<team>[a-z]+)-deployer/'
+//	    tags: {team: '${team}', cost-center: shared}
+func loadCostTagDefaults(file string) (*costTagDefaults, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var defaults costTagDefaults
+	if err := yaml.Unmarshal(data, &defaults); err != nil {
+		return nil, err
+	}
+	compile := func(kind string, rules []costTagRule) error {
+		for i := range rules {
+			if len(rules[i].Tags) == 0 {
+				return fmt.Errorf("%s rule %d: no tags", kind, i+1)
+			}
+			if rules[i].pattern, err = regexp.Compile(rules[i].Pattern); err != nil {
+				return fmt.Errorf("%s rule %d: invalid pattern: %v", kind, i+1, err)
+			}
+		}
+		return nil
+	}
+	if err := compile("names", defaults.Names); err != nil {
+		return nil, err
+	}
+	if err := compile("creators", defaults.Creators); err != nil {
+		return nil, err
+	}
+	return &defaults, nil
+}
+
+// infer returns the values the rules give to the missing tags of a bucket, in the order of missing.
+func (d *costTagDefaults) infer(missing []string, name string, creator *bucketCreator) []inferredTag {
+	values := map[string]inferredTag{}
+	apply := func(rules []costTagRule, value string, from string) {
+		for _, rule := range rules {
+			match := rule.pattern.FindStringSubmatchIndex(value)
+			if match == nil {
+				continue
+			}
+			for _, key := range missing {
+				template, ok := rule.Tags[key]
+				if _, inferred := values[key]; !ok || inferred {
+					continue
+				}
+				if expanded := string(rule.pattern.ExpandString(nil, template, value, match)); expanded != "" {
+					values[key] = inferredTag{key: key, value: expanded, from: from}
+				}
+			}
+		}
+	}
+	apply(d.Names, name, "name")
+	if creator != nil {
+		apply(d.Creators, creator.principal, "creator")
+	}
+
+	var inferred []inferredTag
+	for _, key := range missing {
+		if tag, ok := values[key]; ok {
+			inferred = append(inferred, tag)
+		}
+	}
+	return inferred
+}
+
+// missingCostTags returns the cost allocation tags a bucket does not carry, or carries with an empty value.
+func missingCostTags(tags map[string]string, keys []string) []string {
+	var missing []string
+	for _, key := range keys {
+		if tags[key] == "" {
+			missing = append(missing, key)
+		}
+	}
+	return missing
+}
+
+// costTagFinding flags a bucket missing cost allocation tags, its cost is not attributed in the billing.
+func costTagFinding(b s3Bucket, keys []string) (finding, bool) {
+	missing := missingCostTags(b.tags, keys)
+	if len(missing) == 0 {
+		return finding{}, false
+	}
+	return finding{
+		bucket:   b.name,
+		check:    "cost-tags",
+		severity: severityLow,
+		message:  fmt.Sprintf("bucket is missing cost allocation tag(s) %s", strings.Join(missing, ",")),
+	}, true
+}
+
+// costTagRemediation builds the remediation adding the cost allocation tags inferred for a bucket to its tags.
+// PutBucketTagging replaces all the tags, so none is offered when the tags could not be read, or when the
+// bucket carries aws: tags, e.g. of CloudFormation, which the call cannot set again.
+func costTagRemediation(result BucketResult, keys []string, defaults *costTagDefaults) (remediation, bool) {
+	if result.restored || unreadSetting(result.Errors, "tags") {
+		return remediation{}, false
+	}
+	missing := missingCostTags(result.bucket.tags, keys)
+	inferred := defaults.infer(missing, result.Name, result.creator)
+	if len(inferred) == 0 {
+		return remediation{}, false
+	}
+	tags := map[string]string{}
+	for key, value := range result.bucket.tags {
+		if strings.HasPrefix(key, "aws:") {
+			return remediation{}, false
+		}
+		tags[key] = value
+	}
+
+	var added []string
+	for _, tag := range inferred {
+		tags[tag.key] = tag.value
+		added = append(added, fmt.Sprintf("%s=%s (from the %s)", tag.key, tag.value, tag.from))
+	}
+	description := "add the cost allocation tag(s) " + strings.Join(added, ", ")
+	if left := missingCostTags(tags, keys); len(left) > 0 {
+		description += fmt.Sprintf("; no value inferred for %s", strings.Join(left, ","))
+	}
+
+	var sorted []string
+	for key := range tags {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+	var tagSet []types.Tag
+	for _, key := range sorted {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+	}
+	return remediation{
+		bucket:      result.Name,
+		region:      result.Region,
+		name:        "cost-tags",
+		description: description,
+		input: &s3.PutBucketTaggingInput{
+			Bucket:  aws.String(result.Name),
+			Tagging: &types.Tagging{TagSet: tagSet},
+		},
+	}, true
+}
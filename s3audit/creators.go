@@ -0,0 +1,214 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail"
+	"github.com/aws/aws-sdk-go-v2/service/cloudtrail/types"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CloudTrailLookupEventsApi defines the interface for the LookupEvents function.
+// We use this interface to test the function using a mocked service.
+type CloudTrailLookupEventsApi interface {
+	LookupEvents(ctx context.Context,
+		params *cloudtrail.LookupEventsInput,
+		optFns ...func(*cloudtrail.Options)) (*cloudtrail.LookupEventsOutput, error)
+}
+
+// LookupEvents returns the management events of the last 90 days matching a lookup attribute, a page at a time.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a LookupEventsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to LookupEvents.
+func LookupEvents(c context.Context, api CloudTrailLookupEventsApi, input *cloudtrail.LookupEventsInput) (*cloudtrail.LookupEventsOutput, error) {
+	return api.LookupEvents(c, input)
+}
+
+// bucketCreator is the identity that created a bucket, taken from its CreateBucket event.
+type bucketCreator struct {
+	principal string
+	created   time.Time
+	// source is where the event was found: cloudtrail for the event history, athena for a CloudTrail table
+	source string
+}
+
+// createBucketEvent holds the fields of a CreateBucket event, as recorded by CloudTrail
+type createBucketEvent struct {
+	EventTime    time.Time `json:"eventTime"`
+	UserIdentity struct {
+		Type        string `json:"type"`
+		ARN         string `json:"arn"`
+		PrincipalID string `json:"principalId"`
+		InvokedBy   string `json:"invokedBy"`
+	} `json:"userIdentity"`
+	RequestParameters struct {
+		BucketName string `json:"bucketName"`
+	} `json:"requestParameters"`
+	ErrorCode string `json:"errorCode"`
+}
+
+// principal returns the identity of the caller of the event: its ARN, or the service or principal ID that
+// made the call when it has none.
+func (e createBucketEvent) principal() string {
+	identity := e.UserIdentity
+	switch {
+	case identity.ARN != "":
+		return identity.ARN
+	case identity.InvokedBy != "":
+		return identity.InvokedBy
+	}
+	return identity.PrincipalID
+}
+
+// addCreator keeps the latest creator of a bucket, the one of the bucket existing now when a name was deleted
+// and created again.
+func addCreator(creators map[string]bucketCreator, bucket string, creator bucketCreator) {
+	if bucket == "" || creator.principal == "" {
+		return
+	}
+	if known, ok := creators[bucket]; !ok || creator.created.After(known.created) {
+		creators[bucket] = creator
+	}
+}
+
+// lookupCreators returns the creators of the buckets created in the regions during the 90 days the CloudTrail
+// event history covers. LookupEvents is limited to 2 calls per second per region, the pages are read one at a
+// time.
+func lookupCreators(c context.Context, cfg aws.Config, regions []string) (map[string]bucketCreator, error) {
+	creators := map[string]bucketCreator{}
+	for _, region := range regions {
+		client := cloudtrail.NewFromConfig(cfg, func(options *cloudtrail.Options) {
+			options.Region = region
+		})
+		input := &cloudtrail.LookupEventsInput{
+			LookupAttributes: []types.LookupAttribute{{
+				AttributeKey:   types.LookupAttributeKeyEventName,
+				AttributeValue: aws.String("CreateBucket"),
+			}},
+		}
+		for {
+			page, err := LookupEvents(c, client, input)
+			if err != nil {
+				return nil, fmt.Errorf("region %s: %v", region, err)
+			}
+			for _, e := range page.Events {
+				var event createBucketEvent
+				if err := json.Unmarshal([]byte(aws.ToString(e.CloudTrailEvent)), &event); err != nil || event.ErrorCode != "" {
+					continue
+				}
+				addCreator(creators, event.RequestParameters.BucketName, bucketCreator{
+					principal: event.principal(),
+					created:   event.EventTime,
+					source:    "cloudtrail",
+				})
+			}
+			if page.NextToken == nil {
+				break
+			}
+			input.NextToken = page.NextToken
+		}
+	}
+	return creators, nil
+}
+
+// creatorsQuery selects the successful CreateBucket events of a table of the CloudTrail logs, created as the
+// CloudTrail documentation describes.
+func creatorsQuery(table string) string {
+	return fmt.Sprintf(`SELECT json_extract_scalar(requestparameters, '$.bucketName') AS bucket,
+  coalesce(useridentity.arn, useridentity.invokedby, useridentity.principalid) AS principal,
+  eventtime
+FROM %s
+WHERE eventsource = 's3.amazonaws.com' AND eventname = 'CreateBucket' AND errorcode IS NULL`, table)
+}
+
+// parseCreatorsTable reads the -creators-table option, <database>.<table>.
+func parseCreatorsTable(value string) (database string, table string, err error) {
+	database, table, found := strings.Cut(value, ".")
+	if !found || !athenaIdentifierPattern.MatchString(database) || !athenaIdentifierPattern.MatchString(table) {
+		return "", "", fmt.Errorf("invalid CloudTrail table %q, expected <database>.<table> in lower case letters, digits and underscores", value)
+	}
+	return database, table, nil
+}
+
+// queryCreators returns the creators of the buckets found in a CloudTrail table, which covers the retention of
+// the trail instead of the 90 days of the event history.
+func queryCreators(c context.Context, api athenaApi, analysis AthenaAnalysis) (map[string]bucketCreator, error) {
+	result, err := runAthenaQuery(c, api, analysis, creatorsQuery(analysis.Database+"."+analysis.Table))
+	if err != nil {
+		return nil, err
+	}
+	creators := map[string]bucketCreator{}
+	for _, row := range result.rows {
+		if len(row) < 3 {
+			continue
+		}
+		created, err := time.Parse(time.RFC3339, row[2])
+		if err != nil {
+			continue
+		}
+		addCreator(creators, row[0], bucketCreator{principal: row[1], created: created, source: "athena"})
+	}
+	return creators, nil
+}
+
+// findCreators returns the creators of the buckets, from the CloudTrail table of the options when set,
+// otherwise from the event history of the regions of the buckets.
+func (a *Auditor) findCreators(c context.Context, results []BucketResult) (map[string]bucketCreator, error) {
+	if a.creatorsTable.Table != "" {
+		client := athena.NewFromConfig(a.cfg)
+		return queryCreators(c, client, a.creatorsTable)
+	}
+	seen := map[string]bool{}
+	var regions []string
+	for _, result := range results {
+		if !seen[result.Region] {
+			seen[result.Region] = true
+			regions = append(regions, result.Region)
+		}
+	}
+	sort.Strings(regions)
+	return lookupCreators(c, a.cfg, regions)
+}
+
+// orphanBucket reports whether a bucket lacks an owner: it misses one of the required tags, or carries no tag
+// at all when no tag is required.
+func orphanBucket(result BucketResult, required tagMatcher) bool {
+	if len(required) > 0 {
+		return len(required.missingTags(result.bucket.tags)) > 0
+	}
+	return len(result.bucket.tags) == 0
+}
+
+// printProbableOwners prints the creator of the orphan buckets, their probable owner for the cleanup campaigns.
+func printProbableOwners(results []BucketResult, required tagMatcher) {
+	fmt.Println("\nProbable owners of the orphan buckets, from their CreateBucket event:")
+	t := newTable(false, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "CREATOR"}, column{header: "CREATED"},
+		column{header: "SOURCE"})
+	orphans := 0
+	for _, result := range results {
+		if result.restored || !orphanBucket(result, required) {
+			continue
+		}
+		orphans++
+		creator, created, source := "unknown", formatCreationDate(result.Created), "-"
+		if result.creator != nil {
+			creator, created, source = result.creator.principal, result.creator.created.Format(time.RFC3339), result.creator.source
+		}
+		t.add(cell{text: result.Name}, cell{text: result.Region}, cell{text: creator}, cell{text: created}, cell{text: source})
+	}
+	if orphans == 0 {
+		fmt.Println("\tnone")
+		return
+	}
+	t.write(os.Stdout)
+}
@@ -0,0 +1,137 @@
+package s3audit
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// principalAccountPattern matches the account of an AWS principal, given as an account ID or an IAM ARN
+var principalAccountPattern = regexp.MustCompile(`^(?:arn:aws[a-z-]*:(?:iam|sts)::)?([0-9]{12})(?::|$)`)
+
+// policyPrincipal is a principal an Allow statement of a bucket policy grants access to.
+type policyPrincipal struct {
+	// principalType is the type of the principal in the policy, e.g. AWS, Service, Federated, or * for anonymous
+	principalType string
+	value         string
+	// account is the account of an AWS principal, empty for the other types and for *
+	account string
+}
+
+// parseTrustedAccounts reads a comma separated list of the account IDs trusted with access to the buckets.
+func parseTrustedAccounts(value string) (map[string]bool, error) {
+	trusted := map[string]bool{}
+	for _, id := range splitList(value) {
+		if !accountIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid account ID %q, expected 12 digits", id)
+		}
+		trusted[id] = true
+	}
+	return trusted, nil
+}
+
+// policyPrincipals returns the distinct principals the Allow statements of a bucket policy grant access to,
+// nil for a bucket without a policy.
+func policyPrincipals(policy string) ([]policyPrincipal, error) {
+	if policy == "" {
+		return nil, nil
+	}
+	document, err := parsePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[policyPrincipal]bool{}
+	var principals []policyPrincipal
+	for _, statement := range document.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for principalType, values := range statement.principals() {
+			for _, value := range values {
+				p := policyPrincipal{principalType: principalType, value: value}
+				if value == "*" {
+					p.principalType = "*"
+				} else if match := principalAccountPattern.FindStringSubmatch(value); principalType == "AWS" && match != nil {
+					p.account = match[1]
+				}
+				if !seen[p] {
+					seen[p] = true
+					principals = append(principals, p)
+				}
+			}
+		}
+	}
+	sort.Slice(principals, func(i, j int) bool { return principals[i].value < principals[j].value })
+	return principals, nil
+}
+
+// crossAccountFindings flags the principals of a bucket policy that belong to an account other than the
+// audited one and not in the trusted accounts. The anonymous principals are left to the bucket-policy check.
+func crossAccountFindings(b s3Bucket, accountID string, trusted map[string]bool) []finding {
+	var findings []finding
+	for _, p := range b.policyPrincipals {
+		if p.account == "" || p.account == accountID || trusted[p.account] {
+			continue
+		}
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "cross-account",
+			severity: severityMedium,
+			message:  fmt.Sprintf("bucket policy grants access to %s of account %s, not a trusted account", p.value, p.account),
+		})
+	}
+	return findings
+}
+
+// printPolicyPrincipals prints the inventory of the principals the bucket policies grant access to across the
+// buckets, the external accounts not trusted first. The principals of the audited account are left out.
+func printPolicyPrincipals(results []BucketResult, accountID string, trusted map[string]bool, color bool) {
+	buckets := map[policyPrincipal][]string{}
+	for _, result := range results {
+		for _, p := range result.bucket.policyPrincipals {
+			if p.account != accountID {
+				buckets[p] = append(buckets[p], result.Name)
+			}
+		}
+	}
+	fmt.Println("\nPolicy principals:")
+	if len(buckets) == 0 {
+		fmt.Println("\tno bucket policy grants access outside the account")
+		return
+	}
+
+	var principals []policyPrincipal
+	for p := range buckets {
+		principals = append(principals, p)
+	}
+	untrusted := func(p policyPrincipal) bool { return p.account != "" && !trusted[p.account] }
+	sort.Slice(principals, func(i, j int) bool {
+		if untrusted(principals[i]) != untrusted(principals[j]) {
+			return untrusted(principals[i])
+		}
+		if principals[i].principalType != principals[j].principalType {
+			return principals[i].principalType < principals[j].principalType
+		}
+		return principals[i].value < principals[j].value
+	})
+
+	t := newTable(color, column{header: "PRINCIPAL"}, column{header: "TYPE"}, column{header: "ACCOUNT"}, column{header: "TRUSTED"},
+		column{header: "BUCKETS"}, column{header: "NAMES", max: 60})
+	for _, p := range principals {
+		status, statusColor := "", ""
+		if p.account != "" {
+			status = strconv.FormatBool(trusted[p.account])
+			if !trusted[p.account] {
+				statusColor = colorRed
+			}
+		}
+		names := buckets[p]
+		sort.Strings(names)
+		t.add(cell{text: p.value}, cell{text: p.principalType}, cell{text: p.account}, cell{text: status, color: statusColor},
+			cell{text: strconv.Itoa(len(names))}, cell{text: strings.Join(names, ", ")})
+	}
+	t.write(os.Stdout)
+}
@@ -0,0 +1,388 @@
+package s3audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// decommissionTag is the tag recording the end of the quarantine of a bucket being decommissioned, the
+// checkpoint telling a later run of decommission where to resume.
+const decommissionTag = "s3audit:decommission-after"
+
+// decommissionSid is the Sid of the statement denying access to a quarantined bucket.
+const decommissionSid = "DenyAllDecommissioning"
+
+// Decommission defines the decommissioning of a bucket. The first run removes the configurations referencing
+// it and denies all access to it for Quarantine, so whatever still depends on the bucket fails loudly while its
+// data can still be restored; a run after the quarantine empties and deletes it. DryRun prints the calls
+// instead of making them.
+type Decommission struct {
+	Bucket     string
+	Quarantine time.Duration
+	DryRun     bool
+}
+
+// decommissionStep is a call of the decommissioning of a bucket, on the bucket or on one referencing it.
+type decommissionStep struct {
+	bucket    string
+	region    string
+	operation string
+	input     interface{}
+}
+
+// principalPatterns returns the patterns of aws:PrincipalArn matching the caller: an assumed role is matched
+// on its role, whatever its session. The ARN of the session lacks the path of the role, so the role is matched
+// at the root and under any path, but never a role whose name only ends with the same name.
+func principalPatterns(callerArn string) []string {
+	parts := strings.SplitN(callerArn, ":", 6)
+	if len(parts) != 6 || !strings.HasPrefix(parts[5], "assumed-role/") {
+		return []string{callerArn}
+	}
+	role := strings.Split(strings.TrimPrefix(parts[5], "assumed-role/"), "/")[0]
+	return []string{
+		fmt.Sprintf("arn:%s:iam::%s:role/%s", parts[1], parts[4], role),
+		fmt.Sprintf("arn:%s:iam::%s:role/*/%s", parts[1], parts[4], role),
+	}
+}
+
+// denyAllPolicy returns the policy denying every S3 action on the bucket and its objects to all principals but
+// the exempted ones, aws:PrincipalArn patterns.
+func denyAllPolicy(sid string, bucket string, partition string, exempted []string) (string, error) {
+	doc := map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{map[string]interface{}{
+			"Sid":       sid,
+			"Effect":    "Deny",
+			"Principal": "*",
+			"Action":    "s3:*",
+			"Resource":  []string{bucketArn(partition, bucket), bucketArn(partition, bucket) + "/*"},
+			"Condition": map[string]interface{}{
+				"ArnNotLike": map[string][]string{"aws:PrincipalArn": exempted},
+			},
+		}},
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	return string(data), err
+}
+
+// referenceSteps returns the calls removing the replication and event notifications of a bucket, and the
+// replication rules, access logging and inventories of the other buckets of the account delivering to it.
+func referenceSteps(c context.Context, cfg aws.Config, bucket string, region string) ([]decommissionStep, error) {
+	steps := []decommissionStep{
+		{bucket: bucket, region: region, operation: "DeleteBucketReplication", input: &s3.DeleteBucketReplicationInput{Bucket: aws.String(bucket)}},
+		{bucket: bucket, region: region, operation: "PutBucketNotificationConfiguration", input: &s3.PutBucketNotificationConfigurationInput{
+			Bucket:                    aws.String(bucket),
+			NotificationConfiguration: &types.NotificationConfiguration{},
+		}},
+	}
+
+	others, err := matchBuckets(c, cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, other := range others {
+		if other.name == bucket {
+			continue
+		}
+		flows, err := getDataFlows(c, other.client, other.name)
+		if err != nil {
+			return nil, fmt.Errorf("reading the configurations of bucket %s: %v", other.name, err)
+		}
+		kinds := map[string]bool{}
+		for _, flow := range flows {
+			if flow.target == bucket {
+				kinds[flow.kind] = true
+			}
+		}
+		if kinds["replication"] {
+			step, err := replicationStep(c, other, bucket)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+		if kinds["access logs"] {
+			steps = append(steps, decommissionStep{bucket: other.name, region: other.region, operation: "PutBucketLogging",
+				input: &s3.PutBucketLoggingInput{Bucket: aws.String(other.name), BucketLoggingStatus: &types.BucketLoggingStatus{}}})
+		}
+		if kinds["inventory"] {
+			inventorySteps, err := inventorySteps(c, other, bucket)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, inventorySteps...)
+		}
+	}
+	return steps, nil
+}
+
+// replicationStep returns the call removing the replication rules of a bucket to the decommissioned one, the
+// whole configuration when no other rule is left.
+func replicationStep(c context.Context, other regionalBucket, bucket string) (decommissionStep, error) {
+	replication, err := other.client.GetBucketReplication(c, &s3.GetBucketReplicationInput{Bucket: aws.String(other.name)})
+	if err != nil {
+		return decommissionStep{}, fmt.Errorf("reading the replication of bucket %s: %v", other.name, err)
+	}
+	configuration := *replication.ReplicationConfiguration
+	configuration.Rules = nil
+	for _, rule := range replication.ReplicationConfiguration.Rules {
+		if rule.Destination == nil || bucketFromArn(aws.ToString(rule.Destination.Bucket)) != bucket {
+			configuration.Rules = append(configuration.Rules, rule)
+		}
+	}
+	if len(configuration.Rules) == 0 {
+		return decommissionStep{bucket: other.name, region: other.region, operation: "DeleteBucketReplication",
+			input: &s3.DeleteBucketReplicationInput{Bucket: aws.String(other.name)}}, nil
+	}
+	return decommissionStep{bucket: other.name, region: other.region, operation: "PutBucketReplication",
+		input: &s3.PutBucketReplicationInput{Bucket: aws.String(other.name), ReplicationConfiguration: &configuration}}, nil
+}
+
+// inventorySteps returns the calls removing the inventories of a bucket delivered to the decommissioned one.
+func inventorySteps(c context.Context, other regionalBucket, bucket string) ([]decommissionStep, error) {
+	var steps []decommissionStep
+	input := &s3.ListBucketInventoryConfigurationsInput{Bucket: aws.String(other.name)}
+	for {
+		inventories, err := other.client.ListBucketInventoryConfigurations(c, input)
+		if err != nil {
+			return nil, fmt.Errorf("reading the inventories of bucket %s: %v", other.name, err)
+		}
+		for _, inventory := range inventories.InventoryConfigurationList {
+			if inventory.Destination == nil || inventory.Destination.S3BucketDestination == nil ||
+				bucketFromArn(aws.ToString(inventory.Destination.S3BucketDestination.Bucket)) != bucket {
+				continue
+			}
+			steps = append(steps, decommissionStep{bucket: other.name, region: other.region, operation: "DeleteBucketInventoryConfiguration",
+				input: &s3.DeleteBucketInventoryConfigurationInput{Bucket: aws.String(other.name), Id: inventory.Id}})
+		}
+		if !aws.ToBool(inventories.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = inventories.NextContinuationToken
+	}
+	return steps, nil
+}
+
+// applyDecommissionStep makes the call of a step with the client of the region of its bucket. Removing a
+// configuration that does not exist is not an error, so an interrupted run can be started again.
+func applyDecommissionStep(c context.Context, cfg aws.Config, step decommissionStep) error {
+	client := newS3Client(cfg, step.region, "")
+	var err error
+	switch input := step.input.(type) {
+	case *s3.DeleteBucketReplicationInput:
+		_, err = client.DeleteBucketReplication(c, input)
+	case *s3.PutBucketReplicationInput:
+		_, err = client.PutBucketReplication(c, input)
+	case *s3.PutBucketNotificationConfigurationInput:
+		_, err = client.PutBucketNotificationConfiguration(c, input)
+	case *s3.PutBucketLoggingInput:
+		_, err = client.PutBucketLogging(c, input)
+	case *s3.DeleteBucketInventoryConfigurationInput:
+		_, err = client.DeleteBucketInventoryConfiguration(c, input)
+	case *s3.PutBucketPolicyInput:
+		_, err = client.PutBucketPolicy(c, input)
+	case *s3.PutBucketTaggingInput:
+		_, err = client.PutBucketTagging(c, input)
+	default:
+		err = fmt.Errorf("unsupported request %T", step.input)
+	}
+	if code := apiErrorCode(err); code == "ReplicationConfigurationNotFoundError" || code == "NoSuchConfiguration" {
+		return nil
+	}
+	return err
+}
+
+// emptyBucket deletes every object version and delete marker of a bucket, 1000 at a time, then aborts its
+// multipart uploads in progress. It returns the number of versions and markers, and of uploads, removed.
+func emptyBucket(c context.Context, client S3ClientAPI, bucket string) (int, int, error) {
+	var deleted, aborted int
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)}
+	for {
+		page, err := client.ListObjectVersions(c, input)
+		if err != nil {
+			return deleted, aborted, err
+		}
+		var objects []types.ObjectIdentifier
+		for _, version := range page.Versions {
+			objects = append(objects, types.ObjectIdentifier{Key: version.Key, VersionId: version.VersionId})
+		}
+		for _, marker := range page.DeleteMarkers {
+			objects = append(objects, types.ObjectIdentifier{Key: marker.Key, VersionId: marker.VersionId})
+		}
+		for start := 0; start < len(objects); start += 1000 {
+			end := start + 1000
+			if end > len(objects) {
+				end = len(objects)
+			}
+			output, err := client.DeleteObjects(c, &s3.DeleteObjectsInput{
+				Bucket: aws.String(bucket),
+				Delete: &types.Delete{Objects: objects[start:end], Quiet: aws.Bool(true)},
+			})
+			if err != nil {
+				return deleted, aborted, err
+			}
+			if len(output.Errors) > 0 {
+				e := output.Errors[0]
+				return deleted, aborted, fmt.Errorf("deleting %s version %s: %s, and %d more errors",
+					aws.ToString(e.Key), aws.ToString(e.VersionId), aws.ToString(e.Message), len(output.Errors)-1)
+			}
+			deleted += end - start
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		input.KeyMarker, input.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+	}
+
+	uploadsInput := &s3.ListMultipartUploadsInput{Bucket: aws.String(bucket)}
+	for {
+		page, err := client.ListMultipartUploads(c, uploadsInput)
+		if err != nil {
+			return deleted, aborted, err
+		}
+		for _, upload := range page.Uploads {
+			_, err := client.AbortMultipartUpload(c, &s3.AbortMultipartUploadInput{Bucket: aws.String(bucket), Key: upload.Key, UploadId: upload.UploadId})
+			if err != nil && apiErrorCode(err) != "NoSuchUpload" {
+				return deleted, aborted, err
+			}
+			aborted++
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		uploadsInput.KeyMarker, uploadsInput.UploadIdMarker = page.NextKeyMarker, page.NextUploadIdMarker
+	}
+	return deleted, aborted, nil
+}
+
+// DecommissionBucket runs the decommissioning of a bucket up to where it can go. The end of the quarantine is
+// kept in a tag of the bucket, so each run resumes from the last completed stage: a bucket without the tag is
+// quarantined, one whose quarantine is over is emptied then deleted once confirmed on the terminal.
+func DecommissionBucket(c context.Context, cfg aws.Config, d Decommission, w io.Writer) error {
+	client, region, err := newBucketClient(c, cfg, d.Bucket, "")
+	if err != nil {
+		return err
+	}
+	tags, err := getBucketTags(c, client, d.Bucket)
+	if err != nil {
+		return fmt.Errorf("reading the tags: %v", err)
+	}
+
+	after, quarantined := tags[decommissionTag]
+	if !quarantined {
+		// without a quarantine period, the bucket is emptied and deleted in the same run
+		if err := quarantineBucket(c, cfg, d, region, tags, w); err != nil || d.Quarantine > 0 || d.DryRun {
+			return err
+		}
+		after = tags[decommissionTag]
+	}
+	until, err := time.Parse(time.RFC3339, after)
+	if err != nil {
+		return fmt.Errorf("invalid %s tag %q: %v", decommissionTag, after, err)
+	}
+	if time.Now().Before(until) {
+		fmt.Fprintf(w, "Bucket %s is quarantined until %s, run decommission again after it to delete the bucket\n", d.Bucket, until.Format(time.RFC3339))
+		return nil
+	}
+
+	if d.DryRun {
+		count := 0
+		input := &s3.ListObjectVersionsInput{Bucket: aws.String(d.Bucket)}
+		for {
+			page, err := client.ListObjectVersions(c, input)
+			if err != nil {
+				return err
+			}
+			count += len(page.Versions) + len(page.DeleteMarkers)
+			if !aws.ToBool(page.IsTruncated) {
+				break
+			}
+			input.KeyMarker, input.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+		}
+		fmt.Fprintf(w, "Quarantine of bucket %s ended %s, %d object versions and delete markers to delete\n", d.Bucket, until.Format(time.RFC3339), count)
+		printDryRun("DeleteBucket", region, &s3.DeleteBucketInput{Bucket: aws.String(d.Bucket)})
+		return nil
+	}
+
+	r := remediation{bucket: d.Bucket, region: region, name: "decommission",
+		description: "delete every object version of the bucket, then the bucket, its name becomes available to any account"}
+	if !confirmRemediation(bufio.NewReader(os.Stdin), w, r) {
+		fmt.Fprintf(w, "Bucket %s left quarantined\n", d.Bucket)
+		return nil
+	}
+	deleted, aborted, err := emptyBucket(c, client, d.Bucket)
+	fmt.Fprintf(w, "%d object versions and delete markers deleted, %d multipart uploads aborted\n", deleted, aborted)
+	if err != nil {
+		return fmt.Errorf("emptying the bucket, run decommission again to resume: %v", err)
+	}
+	if _, err := client.DeleteBucket(c, &s3.DeleteBucketInput{Bucket: aws.String(d.Bucket)}); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Bucket %s deleted\n", d.Bucket)
+	return nil
+}
+
+// quarantineBucket removes the configurations referencing a bucket, replaces its policy with one denying all
+// access, then tags it with the end of its quarantine. The tag is written last, so an interrupted run starts
+// over from the first call.
+func quarantineBucket(c context.Context, cfg aws.Config, d Decommission, region string, tags map[string]string, w io.Writer) error {
+	identity, err := getCallerIdentity(c, cfg)
+	if err != nil {
+		return err
+	}
+	client := newS3Client(cfg, region, "")
+	current, err := client.GetBucketPolicy(c, &s3.GetBucketPolicyInput{Bucket: aws.String(d.Bucket)})
+	if err != nil && apiErrorCode(err) != "NoSuchBucketPolicy" {
+		return fmt.Errorf("reading the bucket policy: %v", err)
+	}
+	// the principal decommissioning the bucket must still be able to empty and delete it afterwards
+	policy, err := denyAllPolicy(decommissionSid, d.Bucket, partitionOf(region), principalPatterns(identity.arn))
+	if err != nil {
+		return err
+	}
+
+	steps, err := referenceSteps(c, cfg, d.Bucket, region)
+	if err != nil {
+		return err
+	}
+	until := time.Now().UTC().Add(d.Quarantine).Truncate(time.Second)
+	tags[decommissionTag] = until.Format(time.RFC3339)
+	var tagSet []types.Tag
+	for key, value := range tags {
+		tagSet = append(tagSet, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	steps = append(steps,
+		decommissionStep{bucket: d.Bucket, region: region, operation: "PutBucketPolicy",
+			input: &s3.PutBucketPolicyInput{Bucket: aws.String(d.Bucket), Policy: aws.String(policy)}},
+		decommissionStep{bucket: d.Bucket, region: region, operation: "PutBucketTagging",
+			input: &s3.PutBucketTaggingInput{Bucket: aws.String(d.Bucket), Tagging: &types.Tagging{TagSet: tagSet}}})
+
+	if d.DryRun {
+		for _, step := range steps {
+			printDryRun(step.operation+" on "+step.bucket, step.region, step.input)
+		}
+		return nil
+	}
+	if current != nil {
+		fmt.Fprintf(w, "Current policy of bucket %s, to put back if the decommissioning is cancelled:\n%s\n", d.Bucket, aws.ToString(current.Policy))
+	}
+	for _, step := range steps {
+		if err := applyDecommissionStep(c, cfg, step); err != nil {
+			return fmt.Errorf("%s on bucket %s: %v", step.operation, step.bucket, err)
+		}
+		fmt.Fprintf(w, "%s on bucket %s: done\n", step.operation, step.bucket)
+	}
+	if d.Quarantine > 0 {
+		fmt.Fprintf(w, "Bucket %s quarantined until %s, run decommission again after it to delete the bucket\n", d.Bucket, until.Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// dataFlow defines an edge of the data-flow diagram, from a bucket to a bucket or a notification target
+type dataFlow struct {
+	kind   string
+	target string
+}
+
+// getDataFlows returns the buckets the data of a bucket is replicated, logged and inventoried to.
+func getDataFlows(c context.Context, api BucketSettingsAPI, bucket string) ([]dataFlow, error) {
+	var flows []dataFlow
+
+	replication, err := api.GetBucketReplication(c, &s3.GetBucketReplicationInput{Bucket: aws.String(bucket)})
+	if err != nil && apiErrorCode(err) != "ReplicationConfigurationNotFoundError" {
+		return nil, err
+	}
+	if replication != nil && replication.ReplicationConfiguration != nil {
+		for _, rule := range replication.ReplicationConfiguration.Rules {
+			if rule.Destination != nil {
+				flows = append(flows, dataFlow{kind: "replication", target: bucketFromArn(aws.ToString(rule.Destination.Bucket))})
+			}
+		}
+	}
+
+	logging, err := api.GetBucketLogging(c, &s3.GetBucketLoggingInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return nil, err
+	}
+	if logging.LoggingEnabled != nil {
+		flows = append(flows, dataFlow{kind: "access logs", target: aws.ToString(logging.LoggingEnabled.TargetBucket)})
+	}
+
+	input := &s3.ListBucketInventoryConfigurationsInput{Bucket: aws.String(bucket)}
+	for {
+		inventories, err := api.ListBucketInventoryConfigurations(c, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, inventory := range inventories.InventoryConfigurationList {
+			if inventory.Destination != nil && inventory.Destination.S3BucketDestination != nil {
+				flows = append(flows, dataFlow{kind: "inventory", target: bucketFromArn(aws.ToString(inventory.Destination.S3BucketDestination.Bucket))})
+			}
+		}
+		if !aws.ToBool(inventories.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = inventories.NextContinuationToken
+	}
+
+	return flows, nil
+}
+
+// bucketFromArn returns the name of a bucket from its ARN, arn:aws:s3:::name in any partition.
+func bucketFromArn(value string) string {
+	return value[strings.LastIndex(value, ":")+1:]
+}
+
+// diagramNode defines a node of the data-flow diagram
+type diagramNode struct {
+	id    string
+	shape string
+}
+
+// diagramEdge defines an edge of the data-flow diagram
+type diagramEdge struct {
+	from  string
+	to    string
+	label string
+}
+
+// dataFlowGraph builds the nodes and edges of the data-flow diagram of the scanned buckets: buckets are
+// cylinders, notification targets are boxes labelled with their ARN.
+func dataFlowGraph(buckets []s3Bucket) ([]diagramNode, []diagramEdge) {
+	nodes := map[string]string{}
+	var edges []diagramEdge
+
+	for _, b := range buckets {
+		nodes[b.name] = "cylinder"
+		for _, flow := range b.dataFlows {
+			nodes[flow.target] = "cylinder"
+			edges = append(edges, diagramEdge{from: b.name, to: flow.target, label: flow.kind})
+		}
+		for _, target := range b.notifications {
+			nodes[target.arn] = "rectangle"
+			edges = append(edges, diagramEdge{from: b.name, to: target.arn, label: target.service + " notification"})
+		}
+	}
+
+	var sorted []diagramNode
+	for id, shape := range nodes {
+		sorted = append(sorted, diagramNode{id: id, shape: shape})
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].id < sorted[j].id })
+	return sorted, edges
+}
+
+// writeDOT writes the data-flow diagram in the Graphviz DOT language.
+func writeDOT(w io.Writer, nodes []diagramNode, edges []diagramEdge) error {
+	var dot strings.Builder
+	dot.WriteString("digraph s3 {\n  rankdir=LR;\n")
+	for _, node := range nodes {
+		shape := node.shape
+		if shape == "rectangle" {
+			shape = "box"
+		}
+		fmt.Fprintf(&dot, "  %q [shape=%s];\n", node.id, shape)
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&dot, "  %q -> %q [label=%q];\n", edge.from, edge.to, edge.label)
+	}
+	dot.WriteString("}\n")
+
+	_, err := io.WriteString(w, dot.String())
+	return err
+}
+
+// writeD2 writes the data-flow diagram in the D2 language.
+func writeD2(w io.Writer, nodes []diagramNode, edges []diagramEdge) error {
+	var d2 strings.Builder
+	d2.WriteString("direction: right\n")
+	for _, node := range nodes {
+		fmt.Fprintf(&d2, "%q: {shape: %s}\n", node.id, node.shape)
+	}
+	for _, edge := range edges {
+		fmt.Fprintf(&d2, "%q -> %q: %q\n", edge.from, edge.to, edge.label)
+	}
+
+	_, err := io.WriteString(w, d2.String())
+	return err
+}
+
+// saveDiagram writes the data-flow diagram of the scanned buckets to a file, in D2 when the file has the .d2
+// extension and in DOT otherwise.
+func saveDiagram(path string, buckets []s3Bucket) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	nodes, edges := dataFlowGraph(buckets)
+	if strings.HasSuffix(path, ".d2") {
+		err = writeD2(file, nodes, edges)
+	} else {
+		err = writeDOT(file, nodes, edges)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
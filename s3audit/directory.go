@@ -0,0 +1,152 @@
+package s3audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// directoryBucket defines an S3 Express One Zone directory bucket and the configurations audited for it.
+// zone is the ID of the Availability Zone or Local Zone the bucket is placed in. errors holds the settings
+// that could not be read, their checks are skipped.
+type directoryBucket struct {
+	name              string
+	region            string
+	zone              string
+	encryption        string
+	wildcardPrincipal bool
+	errors            []ReadError
+}
+
+// directoryBucketZone returns the zone ID of a directory bucket from its name, bucket-base-name--zone-id--x-s3.
+func directoryBucketZone(bucket string) string {
+	parts := strings.Split(strings.TrimSuffix(bucket, "--x-s3"), "--")
+	return parts[len(parts)-1]
+}
+
+// getDirectoryBuckets lists the directory buckets of a region with their default encryption and whether
+// their policy grants access to any principal. The settings of a bucket that cannot be read are logged and
+// recorded in its errors, the other buckets are still read.
+func getDirectoryBuckets(c context.Context, api S3ClientAPI, region string) ([]directoryBucket, error) {
+	var buckets []directoryBucket
+
+	input := &s3.ListDirectoryBucketsInput{}
+	for {
+		list, err := api.ListDirectoryBuckets(c, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, bucket := range list.Buckets {
+			b := directoryBucket{name: aws.ToString(bucket.Name), region: region, zone: directoryBucketZone(aws.ToString(bucket.Name))}
+			failed := func(setting string, err error) {
+				readError := newReadError(b.name, setting, err)
+				log.Printf("Got an error %v", readError)
+				b.errors = append(b.errors, *readError)
+			}
+
+			encryption, err := api.GetBucketEncryption(c, &s3.GetBucketEncryptionInput{Bucket: bucket.Name})
+			if err != nil {
+				failed("encryption", err)
+			} else if configuration := encryption.ServerSideEncryptionConfiguration; configuration != nil && len(configuration.Rules) > 0 && configuration.Rules[0].ApplyServerSideEncryptionByDefault != nil {
+				b.encryption = string(configuration.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+			}
+
+			policy, err := getBucketPolicy(c, api, b.name)
+			if err != nil {
+				failed("policy", err)
+			} else if policy != "" {
+				document, err := parsePolicy(policy)
+				if err != nil {
+					failed("policy", err)
+				} else {
+					b.wildcardPrincipal = document.hasWildcardPrincipal()
+				}
+			}
+
+			buckets = append(buckets, b)
+		}
+
+		if aws.ToString(list.ContinuationToken) == "" {
+			break
+		}
+		input.ContinuationToken = list.ContinuationToken
+	}
+
+	return buckets, nil
+}
+
+// scanDirectoryBuckets lists the directory buckets of every region in parallel. The regions that fail are
+// returned in errs, keyed by region, without stopping the scan of the others; the regions where S3 Express
+// One Zone is not available are skipped.
+func scanDirectoryBuckets(c context.Context, cfg aws.Config, regions []string) (buckets []directoryBucket, errs map[string]error) {
+	errs = map[string]error{}
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, region := range regions {
+		wg.Add(1)
+		go func(region string) {
+			defer wg.Done()
+			client := newS3Client(cfg, region, "")
+			found, err := getDirectoryBuckets(c, client, region)
+
+			// regions without S3 Express One Zone have no control endpoint to resolve
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) {
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs[region] = err
+				return
+			}
+			buckets = append(buckets, found...)
+		}(region)
+	}
+	wg.Wait()
+
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].name < buckets[j].name })
+	return buckets, errs
+}
+
+// directoryBucketFindings flags a directory bucket whose policy grants access to any principal.
+func directoryBucketFindings(b directoryBucket) []finding {
+	if !b.wildcardPrincipal {
+		return nil
+	}
+	return []finding{{
+		bucket:   b.name,
+		check:    "bucket-policy",
+		severity: severityHigh,
+		message:  "directory bucket policy grants access to any principal",
+	}}
+}
+
+// printDirectoryBuckets prints the directory buckets section of the report.
+func printDirectoryBuckets(buckets []directoryBucket) {
+	fmt.Println("\nDirectory buckets:")
+	if len(buckets) == 0 {
+		fmt.Println("No directory buckets")
+		return
+	}
+	for _, b := range buckets {
+		encryption := b.encryption
+		if unreadSetting(b.errors, "encryption") {
+			encryption = "unknown"
+		}
+		fmt.Printf("Bucket: %s\t Region: %s\t Zone: %s\t Encryption: %s\n", b.name, b.region, b.zone, encryption)
+		if len(b.errors) > 0 {
+			fmt.Printf("\tUnchecked: %s\n", strings.Join(uncheckedSettings(b.errors), ", "))
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// tfState defines the parts of a Terraform state file (format version 4) read by the drift detection
+type tfState struct {
+	Version   int `json:"version"`
+	Resources []struct {
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Instances []struct {
+			Attributes json.RawMessage `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// tfEncryptionRule defines the rule block shared by aws_s3_bucket and aws_s3_bucket_server_side_encryption_configuration
+type tfEncryptionRule struct {
+	ApplyServerSideEncryptionByDefault []struct {
+		SSEAlgorithm   string `json:"sse_algorithm"`
+		KMSMasterKeyID string `json:"kms_master_key_id"`
+	} `json:"apply_server_side_encryption_by_default"`
+}
+
+// tfBucketAttributes defines the attributes of the aws_s3_bucket resources and of their standalone
+// versioning and encryption resources that are compared with the live configuration
+type tfBucketAttributes struct {
+	Bucket     string            `json:"bucket"`
+	Tags       map[string]string `json:"tags"`
+	TagsAll    map[string]string `json:"tags_all"`
+	Versioning []struct {
+		Enabled bool `json:"enabled"`
+	} `json:"versioning"`
+	VersioningConfiguration []struct {
+		Status string `json:"status"`
+	} `json:"versioning_configuration"`
+	ServerSideEncryptionConfiguration []struct {
+		Rule []tfEncryptionRule `json:"rule"`
+	} `json:"server_side_encryption_configuration"`
+	Rule []tfEncryptionRule `json:"rule"`
+}
+
+// declaredBucket defines the configuration a Terraform state declares for a bucket. The *Declared fields
+// tell whether the state says anything about the attribute at all.
+type declaredBucket struct {
+	versioningDeclared bool
+	versioning         bool
+	encryptionDeclared bool
+	sseAlgorithm       string
+	kmsKeyID           string
+	tagsDeclared       bool
+	tags               map[string]string
+}
+
+// drift defines an attribute whose live value differs from the value declared in the Terraform state
+type drift struct {
+	attribute string
+	declared  string
+	live      string
+}
+
+// readTerraformState reads a Terraform state from a local file, or from S3 when location is an s3://bucket/key URL
+// as used by the S3 backend.
+func readTerraformState(c context.Context, cfg aws.Config, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "s3://") {
+		return os.ReadFile(location)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(location, "s3://"), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid state location %q, expected s3://bucket/key", location)
+	}
+
+	// the state bucket can live in any region, the object is read from its own region
+	client, _, err := newBucketClient(c, cfg, parts[0], "")
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := client.GetObject(c, &s3.GetObjectInput{Bucket: aws.String(parts[0]), Key: aws.String(parts[1])})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+	return io.ReadAll(object.Body)
+}
+
+// parseTerraformState returns the configuration declared for each bucket of a Terraform state, keyed by
+// bucket name. Standalone aws_s3_bucket_versioning and aws_s3_bucket_server_side_encryption_configuration
+// resources take precedence over the inline blocks of aws_s3_bucket.
+func parseTerraformState(data []byte) (map[string]*declaredBucket, error) {
+	var state tfState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("unsupported state format version %d", state.Version)
+	}
+
+	declared := map[string]*declaredBucket{}
+	get := func(bucket string) *declaredBucket {
+		if declared[bucket] == nil {
+			declared[bucket] = &declaredBucket{}
+		}
+		return declared[bucket]
+	}
+
+	// the standalone resources are applied last so they override the inline blocks
+	order := []string{"aws_s3_bucket", "aws_s3_bucket_versioning", "aws_s3_bucket_server_side_encryption_configuration"}
+	for _, resourceType := range order {
+		for _, resource := range state.Resources {
+			if resource.Mode != "managed" || resource.Type != resourceType {
+				continue
+			}
+			for _, instance := range resource.Instances {
+				var attributes tfBucketAttributes
+				if err := json.Unmarshal(instance.Attributes, &attributes); err != nil {
+					return nil, err
+				}
+				if attributes.Bucket == "" {
+					continue
+				}
+				d := get(attributes.Bucket)
+
+				switch resourceType {
+				case "aws_s3_bucket":
+					// tags_all includes the default tags of the provider, which are also on the live bucket
+					if attributes.TagsAll != nil {
+						d.tagsDeclared, d.tags = true, attributes.TagsAll
+					} else if attributes.Tags != nil {
+						d.tagsDeclared, d.tags = true, attributes.Tags
+					}
+					if len(attributes.Versioning) > 0 {
+						d.versioningDeclared, d.versioning = true, attributes.Versioning[0].Enabled
+					}
+					if len(attributes.ServerSideEncryptionConfiguration) > 0 {
+						d.setEncryption(attributes.ServerSideEncryptionConfiguration[0].Rule)
+					}
+				case "aws_s3_bucket_versioning":
+					if len(attributes.VersioningConfiguration) > 0 {
+						d.versioningDeclared = true
+						d.versioning = attributes.VersioningConfiguration[0].Status == string(types.BucketVersioningStatusEnabled)
+					}
+				case "aws_s3_bucket_server_side_encryption_configuration":
+					d.setEncryption(attributes.Rule)
+				}
+			}
+		}
+	}
+
+	return declared, nil
+}
+
+// setEncryption records the default encryption declared by the first rule of an encryption configuration.
+func (d *declaredBucket) setEncryption(rules []tfEncryptionRule) {
+	if len(rules) == 0 || len(rules[0].ApplyServerSideEncryptionByDefault) == 0 {
+		return
+	}
+	d.encryptionDeclared = true
+	d.sseAlgorithm = rules[0].ApplyServerSideEncryptionByDefault[0].SSEAlgorithm
+	d.kmsKeyID = rules[0].ApplyServerSideEncryptionByDefault[0].KMSMasterKeyID
+}
+
+// detectDrift compares the declared configuration of a bucket with its live configuration, attribute by attribute.
+func detectDrift(b s3Bucket, d *declaredBucket) []drift {
+	var drifts []drift
+
+	if d.encryptionDeclared && b.encryptionState != encryptionUnknown {
+		if live := encryptionAlgorithm(b); live != d.sseAlgorithm {
+			drifts = append(drifts, drift{attribute: "encryption.sse_algorithm", declared: d.sseAlgorithm, live: live})
+		}
+		live := encryptionKeyID(b)
+		// the state can hold a key ID where the bucket reports the key ARN
+		if live != d.kmsKeyID && !strings.HasSuffix(live, "/"+d.kmsKeyID) {
+			drifts = append(drifts, drift{attribute: "encryption.kms_master_key_id", declared: d.kmsKeyID, live: live})
+		}
+	}
+
+	if d.versioningDeclared {
+		if live := b.versioning == types.BucketVersioningStatusEnabled; live != d.versioning {
+			drifts = append(drifts, drift{attribute: "versioning.enabled", declared: fmt.Sprint(d.versioning), live: fmt.Sprint(live)})
+		}
+	}
+
+	if d.tagsDeclared {
+		keys := map[string]bool{}
+		for key := range d.tags {
+			keys[key] = true
+		}
+		for key := range b.tags {
+			// the tags CloudFormation and AWS add are not part of the declaration
+			if !strings.HasPrefix(key, "aws:") {
+				keys[key] = true
+			}
+		}
+		var sorted []string
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			declared, isDeclared := d.tags[key]
+			live, isLive := b.tags[key]
+			if isDeclared != isLive || declared != live {
+				drifts = append(drifts, drift{attribute: "tags." + key, declared: tagValue(declared, isDeclared), live: tagValue(live, isLive)})
+			}
+		}
+	}
+
+	return drifts
+}
+
+// tagValue formats a tag value for the drift report, <absent> when the tag is not set.
+func tagValue(value string, ok bool) string {
+	if !ok {
+		return "<absent>"
+	}
+	return value
+}
+
+// encryptionKeyID returns the KMS key of the default encryption of a bucket, or "" if it has none.
+func encryptionKeyID(b s3Bucket) string {
+	configuration := b.encryption.ServerSideEncryptionConfiguration
+	if configuration == nil || len(configuration.Rules) == 0 || configuration.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return ""
+	}
+	return aws.ToString(configuration.Rules[0].ApplyServerSideEncryptionByDefault.KMSMasterKeyID)
+}
+
+// driftFindings reports each drifted attribute of a bucket as a finding.
+func driftFindings(b s3Bucket) []finding {
+	var findings []finding
+	for _, d := range b.drift {
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "drift",
+			severity: severityMedium,
+			message:  fmt.Sprintf("%s is %q, Terraform state declares %q", d.attribute, d.live, d.declared),
+		})
+	}
+	return findings
+}
+
+// printDrift prints the drifted attributes of a bucket below its report line.
+func printDrift(b s3Bucket) {
+	for _, d := range b.drift {
+		fmt.Printf("\tDrift: %s\t Declared: %s\t Live: %s\n", d.attribute, d.declared, d.live)
+	}
+}
+
+// missingDeclaredBuckets returns the sorted names of the buckets declared in the state that the scan did not find.
+func missingDeclaredBuckets(declared map[string]*declaredBucket, buckets []s3Bucket) []string {
+	found := map[string]bool{}
+	for _, b := range buckets {
+		found[b.name] = true
+	}
+
+	var missing []string
+	for name := range declared {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
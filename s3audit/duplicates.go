@@ -0,0 +1,201 @@
+package s3audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// prefixContent is the content of a prefix of a bucket, fingerprinted by the keys relative to the prefix and
+// the sizes of its objects. etags fingerprints their ETags too, the copies of an object uploaded with other
+// multipart part sizes have the same size but another ETag.
+type prefixContent struct {
+	bucket  string
+	prefix  string
+	objects int
+	bytes   int64
+	lines   []string
+	etags   []string
+}
+
+// duplicateGroup is a set of prefixes holding the same keys and sizes, in different buckets.
+type duplicateGroup struct {
+	prefixes []*prefixContent
+	// etagsMatch is true when the ETags of the objects match too, the data is then very likely identical
+	etagsMatch bool
+}
+
+// wastedBytes returns the bytes stored more than once by a group, every copy but one.
+func (g duplicateGroup) wastedBytes() int64 {
+	return g.prefixes[0].bytes * int64(len(g.prefixes)-1)
+}
+
+// objectPrefix returns the prefix of a key made of its first depth folders, e.g. logs/2024/ at depth 2,
+// and whether the key is that deep.
+func objectPrefix(key string, depth int) (string, bool) {
+	end := 0
+	for i := 0; i < depth; i++ {
+		next := strings.Index(key[end:], "/")
+		if next < 0 {
+			return "", false
+		}
+		end += next + 1
+	}
+	return key[:end], true
+}
+
+// listPrefixContents lists the objects of a bucket, up to maxObjects of them when not 0, by prefix of the
+// depth. The objects above the depth belong to no prefix and are left out.
+func listPrefixContents(c context.Context, api ObjectReaderAPI, bucket string, depth int, maxObjects int) (map[string]*prefixContent, bool, error) {
+	contents := map[string]*prefixContent{}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	listed := 0
+	for {
+		page, err := api.ListObjectsV2(c, input)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, object := range page.Contents {
+			listed++
+			key := aws.ToString(object.Key)
+			prefix, ok := objectPrefix(key, depth)
+			if !ok {
+				continue
+			}
+			content, ok := contents[prefix]
+			if !ok {
+				content = &prefixContent{bucket: bucket, prefix: prefix}
+				contents[prefix] = content
+			}
+			size := aws.ToInt64(object.Size)
+			content.objects++
+			content.bytes += size
+			content.lines = append(content.lines, key[len(prefix):]+"\x00"+strconv.FormatInt(size, 10))
+			content.etags = append(content.etags, aws.ToString(object.ETag))
+		}
+		if maxObjects > 0 && listed >= maxObjects {
+			return contents, true, nil
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			return contents, false, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// fingerprint hashes lines, in the order of the keys since S3 lists them in that order.
+func fingerprint(lines []string) string {
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line))
+		hash.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// duplicateGroups groups the prefixes holding the same keys and sizes in at least two buckets, the ones
+// storing the most bytes more than once first.
+func duplicateGroups(contents []*prefixContent) []duplicateGroup {
+	byFingerprint := map[string][]*prefixContent{}
+	for _, content := range contents {
+		key := fingerprint(content.lines)
+		byFingerprint[key] = append(byFingerprint[key], content)
+	}
+
+	var groups []duplicateGroup
+	for _, prefixes := range byFingerprint {
+		buckets := map[string]bool{}
+		for _, p := range prefixes {
+			buckets[p.bucket] = true
+		}
+		// the folders holding only empty objects are alike everywhere
+		if len(buckets) < 2 || prefixes[0].bytes == 0 {
+			continue
+		}
+		group := duplicateGroup{prefixes: prefixes, etagsMatch: true}
+		etags := fingerprint(prefixes[0].etags)
+		for _, p := range prefixes[1:] {
+			group.etagsMatch = group.etagsMatch && fingerprint(p.etags) == etags
+		}
+		sort.Slice(prefixes, func(i, j int) bool {
+			return prefixes[i].bucket+"/"+prefixes[i].prefix < prefixes[j].bucket+"/"+prefixes[j].prefix
+		})
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].wastedBytes() != groups[j].wastedBytes() {
+			return groups[i].wastedBytes() > groups[j].wastedBytes()
+		}
+		return groups[i].prefixes[0].bucket < groups[j].prefixes[0].bucket
+	})
+	return groups
+}
+
+// DuplicateSweep lists the objects of the buckets matching the bucket patterns, all of them when empty, and
+// writes the prefixes of the depth holding the same keys and sizes in several buckets, the dedup
+// opportunities. With maxObjects, only that many objects per bucket are listed, so a prefix listed partly
+// may be missed.
+func DuplicateSweep(c context.Context, cfg aws.Config, buckets string, depth int, maxObjects int, w io.Writer) error {
+	if depth < 1 {
+		return fmt.Errorf("invalid depth %d, expected 1 or more", depth)
+	}
+	matched, err := matchBuckets(c, cfg, buckets)
+	if err != nil {
+		return err
+	}
+
+	var contents []*prefixContent
+	var truncated []string
+	for _, bucket := range matched {
+		prefixes, partial, err := listPrefixContents(c, bucket.client, bucket.name, depth, maxObjects)
+		if err != nil {
+			log.Printf("Got an error listing the objects of bucket %v: %v", bucket.name, err)
+			continue
+		}
+		if partial {
+			truncated = append(truncated, bucket.name)
+		}
+		for _, content := range prefixes {
+			contents = append(contents, content)
+		}
+	}
+
+	writeDuplicateSweep(w, duplicateGroups(contents), truncated)
+	return nil
+}
+
+// writeDuplicateSweep writes the duplicated prefixes, a line per copy, and the bytes deduplicating them saves.
+func writeDuplicateSweep(w io.Writer, groups []duplicateGroup, truncated []string) {
+	fmt.Fprintln(w, "Dedup opportunities, prefixes with the same keys and sizes in several buckets:")
+	if len(groups) == 0 {
+		fmt.Fprintln(w, "\tnone")
+	} else {
+		t := newTable(false, column{header: "GROUP"}, column{header: "BUCKET"}, column{header: "PREFIX"}, column{header: "OBJECTS"},
+			column{header: "GB"}, column{header: "ETAGS MATCH"})
+		var wasted int64
+		for i, group := range groups {
+			etags := "yes"
+			if !group.etagsMatch {
+				etags = "no"
+			}
+			for _, p := range group.prefixes {
+				t.add(cell{text: strconv.Itoa(i + 1)}, cell{text: p.bucket}, cell{text: p.prefix}, cell{text: strconv.Itoa(p.objects)},
+					cell{text: fmt.Sprintf("%.1f", float64(p.bytes)/(1<<30))}, cell{text: etags})
+			}
+			wasted += group.wastedBytes()
+		}
+		t.write(w)
+		fmt.Fprintf(w, "\nKeeping a single copy of each group saves %.1f GB\n", float64(wasted)/(1<<30))
+	}
+	if len(truncated) > 0 {
+		fmt.Fprintf(w, "Only part of the objects of these buckets were listed: %s\n", strings.Join(truncated, ", "))
+	}
+}
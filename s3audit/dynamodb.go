@@ -0,0 +1,200 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dynamoDBBatchSize is the maximum number of items BatchWriteItem accepts per call
+const dynamoDBBatchSize = 25
+
+// dynamoDBScanDayIndex is the global secondary index of the history table reading the snapshots of a day: its
+// partition key is scanDay, the UTC date of the scan as 2006-01-02, and its sort key scanTime, both strings.
+const dynamoDBScanDayIndex = "scanDay-scanTime"
+
+// DynamoDBBatchWriteItemApi defines the interface for the BatchWriteItem function.
+// We use this interface to test the function using a mocked service.
+type DynamoDBBatchWriteItemApi interface {
+	BatchWriteItem(ctx context.Context,
+		params *dynamodb.BatchWriteItemInput,
+		optFns ...func(*dynamodb.Options)) (*dynamodb.BatchWriteItemOutput, error)
+}
+
+// DynamoDBQueryApi defines the interface for the Query function.
+// We use this interface to test the function using a mocked service.
+type DynamoDBQueryApi interface {
+	Query(ctx context.Context,
+		params *dynamodb.QueryInput,
+		optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// dynamoDBApi groups the DynamoDB calls of the scan history.
+type dynamoDBApi interface {
+	DynamoDBBatchWriteItemApi
+	DynamoDBQueryApi
+}
+
+// BatchWriteItem puts or deletes up to 25 items in one or more DynamoDB tables.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a BatchWriteItemOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to BatchWriteItem.
+func BatchWriteItem(c context.Context, api DynamoDBBatchWriteItemApi, input *dynamodb.BatchWriteItemInput) (*dynamodb.BatchWriteItemOutput, error) {
+	return api.BatchWriteItem(c, input)
+}
+
+// Query reads the items of a partition of a DynamoDB table or index, a page at a time.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a QueryOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to Query.
+func Query(c context.Context, api DynamoDBQueryApi, input *dynamodb.QueryInput) (*dynamodb.QueryOutput, error) {
+	return api.Query(c, input)
+}
+
+// newDynamoDBClient returns a DynamoDB client for a region.
+func newDynamoDBClient(cfg aws.Config, region string) *dynamodb.Client {
+	return dynamodb.NewFromConfig(cfg, func(options *dynamodb.Options) {
+		options.Region = region
+	})
+}
+
+// dynamoDBHistory keeps the scan history in a DynamoDB table with the bucket name as partition key and the
+// scan time as sort key, both strings, so serverless deployments keep history without a filesystem. The
+// snapshots since a time are read a day at a time from the index dynamoDBScanDayIndex, rather than by a scan of
+// the whole table; the items saved before the index existed lack scanDay and are not read.
+type dynamoDBHistory struct {
+	api   dynamoDBApi
+	table string
+}
+
+// newDynamoDBHistory returns the history store of a table.
+func newDynamoDBHistory(api dynamoDBApi, table string) *dynamoDBHistory {
+	return &dynamoDBHistory{api: api, table: table}
+}
+
+func (h *dynamoDBHistory) save(c context.Context, snapshots []BucketSnapshot) error {
+	var requests []types.WriteRequest
+	for _, snapshot := range snapshots {
+		snapshot.ScanTime = snapshot.ScanTime.UTC()
+		item, err := attributevalue.MarshalMap(snapshot)
+		if err != nil {
+			return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+		}
+		// the sort keys are compared as strings, the SDK format of the times does not sort
+		item["scanTime"] = &types.AttributeValueMemberS{Value: snapshot.ScanTime.Format(scanTimeLayout)}
+		item["scanDay"] = &types.AttributeValueMemberS{Value: snapshot.ScanTime.Format("2006-01-02")}
+		requests = append(requests, types.WriteRequest{PutRequest: &types.PutRequest{Item: item}})
+	}
+
+	for start := 0; start < len(requests); start += dynamoDBBatchSize {
+		end := start + dynamoDBBatchSize
+		if end > len(requests) {
+			end = len(requests)
+		}
+
+		// the items DynamoDB could not write for lack of capacity are written again
+		pending := map[string][]types.WriteRequest{h.table: requests[start:end]}
+		for attempt := 0; len(pending) > 0; attempt++ {
+			if attempt == 5 {
+				return fmt.Errorf("%d item(s) left unprocessed", len(pending[h.table]))
+			}
+			if attempt > 0 {
+				time.Sleep(time.Duration(attempt) * 200 * time.Millisecond)
+			}
+			output, err := BatchWriteItem(c, h.api, &dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = output.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+func (h *dynamoDBHistory) since(c context.Context, t time.Time) ([]BucketSnapshot, error) {
+	var snapshots []BucketSnapshot
+	err := h.query(c, t, time.Now(), nil, func(page []BucketSnapshot) {
+		snapshots = append(snapshots, page...)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].ScanTime.Before(snapshots[j].ScanTime) })
+	return snapshots, nil
+}
+
+func (h *dynamoDBHistory) latest(c context.Context, from time.Time, to time.Time) (map[string]BucketSnapshot, error) {
+	latest := map[string]BucketSnapshot{}
+	// only the attributes compared for the regressions are read
+	attributes := []string{"bucket", "scanTime", "accountId", "region", "encryption", "public", "publicUnknown"}
+	err := h.query(c, from, to, attributes, func(page []BucketSnapshot) {
+		for _, s := range page {
+			keepLatest(latest, s, to)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return latest, nil
+}
+
+// query reads the snapshots of the scans at or after from, up to the day of to, a day of the index
+// dynamoDBScanDayIndex at a time, and hands them to read a page at a time. Only the attributes are read when
+// set.
+func (h *dynamoDBHistory) query(c context.Context, from time.Time, to time.Time, attributes []string, read func([]BucketSnapshot)) error {
+	from = from.UTC()
+	last := to.UTC().Format("2006-01-02")
+	for day := from; day.Format("2006-01-02") <= last; day = day.AddDate(0, 0, 1) {
+		input := &dynamodb.QueryInput{
+			TableName:                aws.String(h.table),
+			IndexName:                aws.String(dynamoDBScanDayIndex),
+			KeyConditionExpression:   aws.String("#scanDay = :day AND #scanTime >= :since"),
+			ExpressionAttributeNames: map[string]string{"#scanDay": "scanDay", "#scanTime": "scanTime"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":day":   &types.AttributeValueMemberS{Value: day.Format("2006-01-02")},
+				":since": &types.AttributeValueMemberS{Value: from.Format(scanTimeLayout)},
+			},
+		}
+		if len(attributes) > 0 {
+			// the names are placeholders, some attributes are DynamoDB reserved words
+			var projection []string
+			for _, attribute := range attributes {
+				input.ExpressionAttributeNames["#"+attribute] = attribute
+				projection = append(projection, "#"+attribute)
+			}
+			input.ProjectionExpression = aws.String(strings.Join(projection, ", "))
+		}
+		for {
+			output, err := Query(c, h.api, input)
+			if err != nil {
+				return err
+			}
+			var page []BucketSnapshot
+			if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+				return err
+			}
+			read(page)
+
+			if len(output.LastEvaluatedKey) == 0 {
+				break
+			}
+			input.ExclusiveStartKey = output.LastEvaluatedKey
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// SESV2SendEmailApi defines the interface for the SendEmail function.
+// We use this interface to test the function using a mocked service.
+type SESV2SendEmailApi interface {
+	SendEmail(ctx context.Context,
+		params *sesv2.SendEmailInput,
+		optFns ...func(*sesv2.Options)) (*sesv2.SendEmailOutput, error)
+}
+
+// SendEmail sends an email through Amazon SES.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a SendEmailOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to SendEmail.
+func SendEmail(c context.Context, api SESV2SendEmailApi, input *sesv2.SendEmailInput) (*sesv2.SendEmailOutput, error) {
+	return api.SendEmail(c, input)
+}
+
+// emailReport sends the HTML report from a sender identity verified in SES to the recipients.
+func emailReport(c context.Context, api SESV2SendEmailApi, from string, to []string, report *Report) error {
+	var body bytes.Buffer
+	if err := (htmlReportWriter{}).WriteReport(&body, report); err != nil {
+		return fmt.Errorf("rendering the report: %v", err)
+	}
+	subject := fmt.Sprintf("S3 audit of account %s: %d bucket(s), %d finding(s)", report.accountName(), len(report.Buckets), len(report.Findings))
+
+	_, err := SendEmail(c, api, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(from),
+		Destination:      &types.Destination{ToAddresses: to},
+		Content: &types.EmailContent{
+			Simple: &types.Message{
+				Subject: &types.Content{Data: aws.String(subject), Charset: aws.String("UTF-8")},
+				Body:    &types.Body{Html: &types.Content{Data: aws.String(body.String()), Charset: aws.String("UTF-8")}},
+			},
+		},
+	})
+	return err
+}
@@ -0,0 +1,62 @@
+package s3audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"strings"
+)
+
+// bucketEmpty reports whether a bucket holds no object, no object version and no delete marker, the
+// condition for S3 to delete it.
+func bucketEmpty(c context.Context, api ObjectReaderAPI, bucket string) (bool, error) {
+	output, err := api.ListObjectVersions(c, &s3.ListObjectVersionsInput{Bucket: aws.String(bucket), MaxKeys: aws.Int32(1)})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Versions) == 0 && len(output.DeleteMarkers) == 0, nil
+}
+
+// emptyFinding flags an empty bucket, a leftover to delete unless something still writes to it.
+func emptyFinding(bucket string) finding {
+	return finding{
+		bucket:   bucket,
+		check:    "empty",
+		severity: severityLow,
+		message:  "bucket holds no object, version or delete marker, candidate for deletion with -fix delete-empty",
+	}
+}
+
+// deleteEmptyRemediation builds the remediation deleting an empty bucket. The bucket is listed again right
+// before it is deleted, since something may have written to it since the audit.
+func deleteEmptyRemediation(bucket string, region string) remediation {
+	return remediation{
+		bucket:      bucket,
+		region:      region,
+		name:        "delete-empty",
+		description: "delete the empty bucket, its name becomes available to any account",
+		input:       &s3.DeleteBucketInput{Bucket: aws.String(bucket)},
+	}
+}
+
+// destructive reports whether a remediation cannot be undone, it is only applied once confirmed.
+func (r remediation) destructive() bool {
+	_, ok := r.input.(*s3.DeleteBucketInput)
+	return ok
+}
+
+// confirmRemediation asks on the terminal whether to apply a destructive remediation, anything but yes
+// declines it, as does the end of the input when not run interactively.
+func confirmRemediation(in *bufio.Reader, out io.Writer, r remediation) bool {
+	fmt.Fprintf(out, "Bucket: %s\t Fix: %s\t %s. Apply? [yes/no] ", r.bucket, r.name, r.description)
+	answer, err := in.ReadString('\n')
+	if err != nil && answer == "" {
+		fmt.Fprintln(out)
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "yes" || answer == "y"
+}
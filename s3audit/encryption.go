@@ -0,0 +1,107 @@
+package s3audit
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// encryptionState tells whether a bucket has default encryption, or whether it could not be read
+type encryptionState int
+
+const (
+	// encryptionUnknown is the state of a bucket whose encryption configuration could not be read
+	encryptionUnknown encryptionState = iota
+	// encryptionNone is the state of a bucket without encryption configuration
+	encryptionNone
+	// encryptionConfigured is the state of a bucket with an encryption configuration
+	encryptionConfigured
+)
+
+// encryptionAlgorithm returns the default server-side encryption algorithm of a bucket, or "" if it has none.
+func encryptionAlgorithm(b s3Bucket) string {
+	configuration := b.encryption.ServerSideEncryptionConfiguration
+	if configuration == nil || len(configuration.Rules) == 0 || configuration.Rules[0].ApplyServerSideEncryptionByDefault == nil {
+		return ""
+	}
+	return string(configuration.Rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm)
+}
+
+// formatEncryption describes the default encryption of a bucket: its algorithm and KMS key, none, or unknown
+// when it could not be read.
+func formatEncryption(b s3Bucket) string {
+	switch b.encryptionState {
+	case encryptionNone:
+		return "none"
+	case encryptionUnknown:
+		return "unknown"
+	}
+	encryption := encryptionAlgorithm(b)
+	if key := encryptionKeyID(b); key != "" {
+		encryption += " " + key
+	}
+	return encryption
+}
+
+// encryptionFinding flags a bucket without default server-side encryption. A bucket whose configuration
+// could not be read is not flagged, it is reported as unchecked instead.
+func encryptionFinding(b s3Bucket) (finding, bool) {
+	switch {
+	case b.encryptionState == encryptionNone:
+		return finding{
+			bucket:   b.name,
+			check:    "encryption",
+			severity: severityHigh,
+			message:  "encryption: none, bucket has no server-side encryption configuration",
+		}, true
+	case b.encryptionState == encryptionConfigured && encryptionAlgorithm(b) == "":
+		return finding{
+			bucket:   b.name,
+			check:    "encryption",
+			severity: severityMedium,
+			message:  "bucket encryption configuration has no default server-side encryption rule",
+		}, true
+	}
+	return finding{}, false
+}
+
+// dsseFinding flags a bucket whose default encryption is not dual-layer DSSE-KMS, when the audit requires it
+// for regulated workloads. The buckets without default encryption are already flagged by encryptionFinding.
+func dsseFinding(b s3Bucket) (finding, bool) {
+	algorithm := encryptionAlgorithm(b)
+	if b.encryptionState != encryptionConfigured || algorithm == "" || algorithm == string(types.ServerSideEncryptionAwsKmsDsse) {
+		return finding{}, false
+	}
+	return finding{
+		bucket:   b.name,
+		check:    "encryption",
+		severity: severityMedium,
+		message:  fmt.Sprintf("encryption: %s, dual-layer DSSE-KMS (aws:kms:dsse) is required", algorithm),
+	}, true
+}
+
+// dsseRemediation builds the remediation switching the default encryption of a bucket to DSSE-KMS, with the
+// KMS key of its SSE-KMS encryption, or the AWS managed key aws/s3 otherwise. DSSE-KMS has no S3 Bucket Key,
+// every object request calls KMS, and only the new objects are encrypted with it.
+func dsseRemediation(b s3Bucket, region string) remediation {
+	byDefault := &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryptionAwsKmsDsse}
+	description := "switch the default encryption to DSSE-KMS with the AWS managed key aws/s3"
+	if key := encryptionKeyID(b); key != "" && encryptionAlgorithm(b) == string(types.ServerSideEncryptionAwsKms) {
+		byDefault.KMSMasterKeyID = aws.String(key)
+		description = fmt.Sprintf("switch the default encryption to DSSE-KMS with the KMS key %s", key)
+	}
+
+	return remediation{
+		bucket:      b.name,
+		region:      region,
+		name:        "enable-dsse",
+		description: description + "; the S3 Bucket Key is disabled and only the new objects are re-encrypted",
+		input: &s3.PutBucketEncryptionInput{
+			Bucket: aws.String(b.name),
+			ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{
+				Rules: []types.ServerSideEncryptionRule{{ApplyServerSideEncryptionByDefault: byDefault, BucketKeyEnabled: aws.Bool(false)}},
+			},
+		},
+	}
+}
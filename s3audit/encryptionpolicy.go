@@ -0,0 +1,167 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"gopkg.in/yaml.v3"
+	"os"
+	"strings"
+	"sync"
+)
+
+// encryptionAlgorithms are the default encryption algorithms an encryption policy may require
+var encryptionAlgorithms = map[string]bool{"AES256": true, "aws:kms": true, "aws:kms:dsse": true}
+
+// encryptionRequirement defines the default encryption the buckets of an environment must have: one of the
+// algorithms, the S3 Bucket Key when BucketKey is set, and a KMS key among the aliases of Keys when set.
+type encryptionRequirement struct {
+	Algorithms []string `yaml:"algorithms"`
+	BucketKey  bool     `yaml:"bucketKey"`
+	Keys       []string `yaml:"keys"`
+}
+
+// encryptionPolicy defines the encryption requirements of each environment, the value of the Tag of the
+// buckets. The requirement of the "*" environment applies to the buckets of the other environments and to
+// the buckets without the tag.
+type encryptionPolicy struct {
+	Tag          string                           `yaml:"tag"`
+	Environments map[string]encryptionRequirement `yaml:"environments"`
+}
+
+// loadEncryptionPolicy reads an encryption policy file. The algorithms are AES256, aws:kms and aws:kms:dsse,
+// the keys are alias names, e.g. alias/prod-data.
+func loadEncryptionPolicy(file string) (*encryptionPolicy, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var policy encryptionPolicy
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, err
+	}
+	if policy.Tag == "" || len(policy.Environments) == 0 {
+		return nil, fmt.Errorf("tag and environments are required")
+	}
+	for environment, requirement := range policy.Environments {
+		for _, algorithm := range requirement.Algorithms {
+			if !encryptionAlgorithms[algorithm] {
+				return nil, fmt.Errorf("environment %s: invalid algorithm %q, expected one of: AES256, aws:kms, aws:kms:dsse", environment, algorithm)
+			}
+		}
+		for _, key := range requirement.Keys {
+			if !strings.HasPrefix(key, "alias/") {
+				return nil, fmt.Errorf("environment %s: invalid key %q, expected an alias name, e.g. alias/data", environment, key)
+			}
+		}
+	}
+	return &policy, nil
+}
+
+// requirement returns the encryption requirement of a bucket from its environment tag, and whether one applies.
+func (p *encryptionPolicy) requirement(tags map[string]string) (string, encryptionRequirement, bool) {
+	if p == nil {
+		return "", encryptionRequirement{}, false
+	}
+	if value, ok := tags[p.Tag]; ok {
+		for environment, requirement := range p.Environments {
+			if strings.EqualFold(environment, value) {
+				return environment, requirement, true
+			}
+		}
+	}
+	requirement, ok := p.Environments["*"]
+	return "*", requirement, ok
+}
+
+// kmsAliasCache holds the aliases of the KMS keys already resolved, by region and key, since many buckets
+// share a key.
+type kmsAliasCache struct {
+	mutex   sync.Mutex
+	aliases map[string][]string
+}
+
+// keyAliases returns the alias names of a KMS key given as configured on a bucket: an alias name or ARN is its
+// own alias, the aliases of a key ID or ARN are listed in the region of the key.
+func (a *Auditor) keyAliases(c context.Context, region string, key string) ([]string, error) {
+	if strings.HasPrefix(key, "alias/") {
+		return []string{key}, nil
+	}
+	if i := strings.Index(key, ":alias/"); i >= 0 {
+		return []string{key[i+1:]}, nil
+	}
+
+	region = kmsKeyRegion(key, region)
+	cached := region + "/" + key
+	a.aliases.mutex.Lock()
+	aliases, ok := a.aliases.aliases[cached]
+	a.aliases.mutex.Unlock()
+	if ok {
+		return aliases, nil
+	}
+
+	output, err := ListAliases(c, newKMSClient(a.cfg, region), &kms.ListAliasesInput{KeyId: aws.String(key), Limit: aws.Int32(100)})
+	if err != nil {
+		return nil, err
+	}
+	aliases = []string{}
+	for _, alias := range output.Aliases {
+		aliases = append(aliases, aws.ToString(alias.AliasName))
+	}
+	a.aliases.mutex.Lock()
+	a.aliases.aliases[cached] = aliases
+	a.aliases.mutex.Unlock()
+	return aliases, nil
+}
+
+// encryptionPolicyFindings checks the default encryption of a bucket against the requirement of its
+// environment: the algorithm, the S3 Bucket Key and the aliases of the KMS key. The buckets without default
+// encryption or whose encryption could not be read are left to the encryption check.
+func (a *Auditor) encryptionPolicyFindings(c context.Context, b s3Bucket, region string) ([]finding, error) {
+	environment, requirement, ok := a.encryptionPolicy.requirement(b.tags)
+	algorithm := encryptionAlgorithm(b)
+	if !ok || !a.checks.enabled("encryption") || b.encryptionState != encryptionConfigured || algorithm == "" {
+		return nil, nil
+	}
+	newFinding := func(sev severity, message string) finding {
+		return finding{bucket: b.name, check: "encryption", severity: sev, message: message}
+	}
+	if environment == "*" {
+		environment = "default"
+	}
+
+	var findings []finding
+	allowed := len(requirement.Algorithms) == 0
+	for _, want := range requirement.Algorithms {
+		allowed = allowed || want == algorithm
+	}
+	if !allowed {
+		findings = append(findings, newFinding(severityMedium, fmt.Sprintf("encryption: %s, the %s environment requires %s",
+			algorithm, environment, strings.Join(requirement.Algorithms, " or "))))
+	}
+
+	rule := b.encryption.ServerSideEncryptionConfiguration.Rules[0]
+	if requirement.BucketKey && strings.HasPrefix(algorithm, "aws:kms") && !aws.ToBool(rule.BucketKeyEnabled) {
+		findings = append(findings, newFinding(severityLow, fmt.Sprintf("S3 Bucket Key is not enabled, the %s environment requires it", environment)))
+	}
+
+	if key, ok := bucketKMSKey(b); ok && len(requirement.Keys) > 0 {
+		aliases, err := a.keyAliases(c, region, key)
+		if err != nil {
+			return findings, err
+		}
+		matched := false
+		for _, alias := range aliases {
+			for _, want := range requirement.Keys {
+				matched = matched || alias == want
+			}
+		}
+		if !matched {
+			findings = append(findings, newFinding(severityMedium, fmt.Sprintf("KMS key %s is not one of the keys of the %s environment: %s",
+				key, environment, strings.Join(requirement.Keys, ", "))))
+		}
+	}
+	return findings, nil
+}
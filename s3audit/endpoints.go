@@ -0,0 +1,30 @@
+package s3audit
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// withEndpointOptions makes the clients created from cfg call the FIPS and, or, the dual-stack endpoints of
+// the services, as GovCloud and IPv6-only networks require. The options set in cfg, e.g. by the
+// AWS_USE_FIPS_ENDPOINT environment variable, are kept when the flags are not set.
+func withEndpointOptions(cfg aws.Config, fips, dualStack bool) (aws.Config, error) {
+	if !fips && !dualStack {
+		return cfg, nil
+	}
+	if cfg.BaseEndpoint != nil && fips {
+		return cfg, fmt.Errorf("the FIPS endpoints cannot be used with the custom endpoint %s", *cfg.BaseEndpoint)
+	}
+
+	options := config.LoadOptions{}
+	if fips {
+		options.UseFIPSEndpoint = aws.FIPSEndpointStateEnabled
+	}
+	if dualStack {
+		options.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+	}
+	// the first source of the options wins when the clients resolve their endpoint
+	cfg.ConfigSources = append([]interface{}{options}, cfg.ConfigSources...)
+	return cfg, nil
+}
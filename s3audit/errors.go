@@ -0,0 +1,79 @@
+package s3audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// The kinds of the errors of the audit. The errors returned by the library wrap one of them when the cause is
+// known, test for them with errors.Is.
+var (
+	// ErrAccessDenied is the cause of an error when the credentials are not allowed to read a setting.
+	ErrAccessDenied = errors.New("access denied")
+	// ErrNoSuchConfiguration is the cause of an error when a setting is not configured on the bucket.
+	ErrNoSuchConfiguration = errors.New("no such configuration")
+	// ErrThrottled is the cause of an error when AWS throttled the request and the retries ran out.
+	ErrThrottled = errors.New("throttled")
+	// ErrBudgetExceeded is the cause of an error when the call was refused because the API call budget is spent.
+	ErrBudgetExceeded = errors.New("API call budget exceeded")
+)
+
+// classifyError wraps an error of an AWS call with its kind, from the error code of the API.
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	code := apiErrorCode(err)
+	switch {
+	case code == "AccessDenied" || code == "AccessDeniedException" || code == "AllAccessDisabled" || code == "Forbidden":
+		return fmt.Errorf("%w: %w", ErrAccessDenied, err)
+	case strings.HasPrefix(code, "NoSuch") || strings.HasSuffix(code, "NotFoundError") || code == "NotFound":
+		return fmt.Errorf("%w: %w", ErrNoSuchConfiguration, err)
+	case code == "Throttling" || code == "ThrottlingException" || code == "SlowDown" ||
+		code == "RequestLimitExceeded" || code == "TooManyRequestsException":
+		return fmt.Errorf("%w: %w", ErrThrottled, err)
+	}
+	return err
+}
+
+// errorKind names the kind of an error for the reports.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrAccessDenied):
+		return "access denied"
+	case errors.Is(err, ErrNoSuchConfiguration):
+		return "not configured"
+	case errors.Is(err, ErrThrottled):
+		return "throttled"
+	case errors.Is(err, ErrBudgetExceeded):
+		return "budget exceeded"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timed out"
+	default:
+		return "error"
+	}
+}
+
+// ReadError is an error reading a setting of a bucket. The checks of the setting are skipped, so the report
+// shows the setting as unchecked rather than compliant.
+type ReadError struct {
+	Bucket  string
+	Setting string
+	Err     error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("retrieving %s of bucket %s: %v", e.Setting, e.Bucket, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// newReadError returns the error reading a setting of a bucket, classified by its kind.
+func newReadError(bucket string, setting string, err error) *ReadError {
+	return &ReadError{Bucket: bucket, Setting: setting, Err: classifyError(err)}
+}
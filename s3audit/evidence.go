@@ -0,0 +1,269 @@
+package s3audit
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// evidenceTransport keeps the last response of the calls made through it, body and all, so the response of
+// each call of the export is saved exactly as S3 returned it. The calls are made one at a time.
+type evidenceTransport struct {
+	next aws.HTTPClient
+
+	mutex    sync.Mutex
+	status   int
+	date     string
+	json     bool
+	response []byte
+}
+
+func (t *evidenceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.status, t.date, t.response = resp.StatusCode, resp.Header.Get("Date"), data
+	t.json = strings.Contains(resp.Header.Get("Content-Type"), "json")
+	return resp, nil
+}
+
+// evidenceFile is an API response of the bundle, listed in its manifest. Status is the HTTP status of the
+// response: an error, e.g. a NoSuchBucketPolicy, is evidence as well. Date is the time of the response given
+// by AWS.
+type evidenceFile struct {
+	Path      string `json:"path"`
+	Bucket    string `json:"bucket,omitempty"`
+	Operation string `json:"operation"`
+	Status    int    `json:"status"`
+	Date      string `json:"date"`
+	Size      int    `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// evidenceManifest lists the files of the bundle with their SHA256 hashes, the manifest is what is signed.
+type evidenceManifest struct {
+	Generated time.Time      `json:"generated"`
+	Account   string         `json:"account"`
+	Caller    string         `json:"caller"`
+	Files     []evidenceFile `json:"files"`
+}
+
+// evidenceCall is an API call whose response is kept for each bucket.
+type evidenceCall struct {
+	operation string
+	call      func(c context.Context, client S3ClientAPI, bucket string) error
+}
+
+// evidenceCalls are the calls returning the access and encryption settings of a bucket.
+var evidenceCalls = []evidenceCall{
+	{"GetBucketPolicy", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketPolicy(c, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetBucketPolicyStatus", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketPolicyStatus(c, &s3.GetBucketPolicyStatusInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetBucketAcl", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketAcl(c, &s3.GetBucketAclInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetBucketOwnershipControls", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketOwnershipControls(c, &s3.GetBucketOwnershipControlsInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetPublicAccessBlock", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetPublicAccessBlock(c, &s3.GetPublicAccessBlockInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetBucketEncryption", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketEncryption(c, &s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetBucketVersioning", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketVersioning(c, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+	{"GetBucketLogging", func(c context.Context, client S3ClientAPI, bucket string) error {
+		_, err := client.GetBucketLogging(c, &s3.GetBucketLoggingInput{Bucket: aws.String(bucket)})
+		return err
+	}},
+}
+
+// evidenceBundle collects the responses of the export and their manifest.
+type evidenceBundle struct {
+	transport *evidenceTransport
+	manifest  evidenceManifest
+	contents  map[string][]byte
+}
+
+// capture makes a call and keeps its response, when there was one: a call failing before reaching AWS leaves
+// nothing to keep.
+func (b *evidenceBundle) capture(bucket string, operation string, call func() error) {
+	t := b.transport
+	t.mutex.Lock()
+	t.status, t.response = 0, nil
+	t.mutex.Unlock()
+	err := call()
+	t.mutex.Lock()
+	status, date, response, isJSON := t.status, t.date, t.response, t.json
+	t.mutex.Unlock()
+	if status == 0 {
+		log.Printf("Got an error retrieving %v of bucket %v, left out of the evidence: %v", operation, bucket, err)
+		return
+	}
+
+	dir := bucket
+	if dir == "" {
+		dir = "account"
+	}
+	extension := ".xml"
+	if isJSON {
+		extension = ".json"
+	}
+	path := dir + "/" + operation + extension
+	sum := sha256.Sum256(response)
+	b.contents[path] = response
+	b.manifest.Files = append(b.manifest.Files, evidenceFile{
+		Path:      path,
+		Bucket:    bucket,
+		Operation: operation,
+		Status:    status,
+		Date:      date,
+		Size:      len(response),
+		SHA256:    hex.EncodeToString(sum[:]),
+	})
+}
+
+// writeTarFile adds a read-only file to a tarball.
+func writeTarFile(tw *tar.Writer, name string, content []byte, modified time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0444, Size: int64(len(content)), ModTime: modified}); err != nil {
+		return err
+	}
+	_, err := tw.Write(content)
+	return err
+}
+
+// write writes the bundle as a gzipped tarball: the manifest, its signature, the public key verifying it, then
+// the responses.
+func (b *evidenceBundle) write(c context.Context, w io.Writer, s signer) error {
+	manifest, err := json.MarshalIndent(b.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	sig, err := s.sign(c, manifest)
+	if err != nil {
+		return fmt.Errorf("signing the manifest: %v", err)
+	}
+	signatureFile, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	publicKey, err := s.publicKey(c)
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	files := []string{"manifest.json", "manifest.json.sig", "public-key.pem"}
+	contents := map[string][]byte{"manifest.json": manifest, "manifest.json.sig": signatureFile, "public-key.pem": publicKey}
+	for _, file := range b.manifest.Files {
+		files = append(files, file.Path)
+		contents[file.Path] = b.contents[file.Path]
+	}
+	for _, name := range files {
+		if err := writeTarFile(tw, name, contents[name], b.manifest.Generated); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// ExportEvidence saves the raw responses of the calls returning the policies, ACLs, Block Public Access and
+// encryption settings of the buckets matching the comma separated glob patterns, all when empty, into a
+// gzipped tarball for external auditors. The manifest lists the SHA256 hash of every response and is signed
+// with signKey, a PEM file of a private key or kms:<key> for a KMS asymmetric key, so the bundle is
+// point-in-time evidence nobody altered since. The bundle is written to output, or to
+// evidence-<account>-<time>.tar.gz when empty, and its path returned.
+func ExportEvidence(c context.Context, cfg aws.Config, buckets string, signKey string, output string) (string, error) {
+	s, err := newSigner(c, cfg, signKey)
+	if err != nil {
+		return "", err
+	}
+	identity, err := getCallerIdentity(c, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	next := cfg.HTTPClient
+	if next == nil {
+		next = http.DefaultClient
+	}
+	transport := &evidenceTransport{next: next}
+	cfg = cfg.Copy()
+	cfg.HTTPClient = &http.Client{Transport: transport}
+	bundle := &evidenceBundle{
+		transport: transport,
+		manifest:  evidenceManifest{Generated: time.Now().UTC(), Account: identity.accountID, Caller: identity.arn},
+		contents:  map[string][]byte{},
+	}
+
+	bundle.capture("", "GetPublicAccessBlock", func() error {
+		_, err := GetPublicAccessBlock(c, s3control.NewFromConfig(cfg), &s3control.GetPublicAccessBlockInput{AccountId: aws.String(identity.accountID)})
+		return err
+	})
+	matched, err := matchBuckets(c, cfg, buckets)
+	if err != nil {
+		return "", err
+	}
+	for _, bucket := range matched {
+		for _, call := range evidenceCalls {
+			bundle.capture(bucket.name, call.operation, func() error {
+				return call.call(c, bucket.client, bucket.name)
+			})
+		}
+	}
+
+	if output == "" {
+		output = fmt.Sprintf("evidence-%s-%s.tar.gz", identity.accountID, bundle.manifest.Generated.Format("20060102T150405Z"))
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return "", err
+	}
+	if err := bundle.write(c, file, s); err != nil {
+		file.Close()
+		os.Remove(output)
+		return "", err
+	}
+	return output, file.Close()
+}
@@ -0,0 +1,11 @@
+package s3audit
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ScanBucket exposes scanBucket to the benchmarks of package s3audit_test.
+func (a *Auditor) ScanBucket(c context.Context, bucket types.Bucket) (BucketResult, error) {
+	return a.scanBucket(c, bucket)
+}
@@ -0,0 +1,137 @@
+package s3audit
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// fieldFormats are the report formats whose content -fields projects, a row or an object per bucket
+var fieldFormats = map[string]bool{"csv": true, "json": true, "table": true}
+
+// bucketFields are the top-level fields of a bucket of the JSON report, the first element of a field path
+var bucketFields = map[string]bool{
+	"name": true, "region": true, "arn": true, "consoleUrl": true, "created": true, "sizeBytes": true,
+	"riskScore": true, "encryption": true, "versioning": true, "public": true, "tags": true, "unchecked": true,
+}
+
+// parseFields reads a comma separated list of dot paths into the buckets of the JSON report, e.g.
+// name,region,encryption.algorithm,tags.team.
+func parseFields(value string) ([]string, error) {
+	fields := splitList(value)
+	for _, field := range fields {
+		if !bucketFields[strings.SplitN(field, ".", 2)[0]] {
+			return nil, fmt.Errorf("invalid field %q, expected a path starting with one of: arn, consoleUrl, created, encryption, name, public, region, riskScore, sizeBytes, tags, unchecked, versioning", field)
+		}
+	}
+	return fields, nil
+}
+
+// project returns the value of each field path in a bucket, nil for the paths of no value, e.g. the tag of
+// a bucket without it.
+func project(b ReportBucket, fields []string) ([]interface{}, error) {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(data, &document); err != nil {
+		return nil, err
+	}
+
+	var values []interface{}
+	for _, field := range fields {
+		var value interface{} = document
+		for _, key := range strings.Split(field, ".") {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				value = nil
+				break
+			}
+			value = object[key]
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// formatField prints the value of a field in a CSV or table cell: lists are comma separated and objects are
+// written as JSON.
+func formatField(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		var items []string
+		for _, item := range v {
+			items = append(items, formatField(item))
+		}
+		return strings.Join(items, ",")
+	}
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// writeFields writes the fields of the buckets of a report in one of the fieldFormats: a CSV record or a table
+// row per bucket with a column per field, or a JSON array of an object per bucket keyed by the field paths.
+func writeFields(w io.Writer, format string, report *Report) error {
+	var rows [][]interface{}
+	for _, b := range report.Buckets {
+		values, err := project(b, report.fields)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, values)
+	}
+
+	switch format {
+	case "json":
+		objects := []map[string]interface{}{}
+		for _, values := range rows {
+			object := map[string]interface{}{}
+			for i, field := range report.fields {
+				object[field] = values[i]
+			}
+			objects = append(objects, object)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(objects)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(report.fields)
+		for _, values := range rows {
+			var record []string
+			for _, value := range values {
+				record = append(record, formatField(value))
+			}
+			writer.Write(record)
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		var columns []column
+		for _, field := range report.fields {
+			columns = append(columns, column{header: strings.ToUpper(field)})
+		}
+		t := newTable(false, columns...)
+		for _, values := range rows {
+			var cells []cell
+			for _, value := range values {
+				cells = append(cells, cell{text: formatField(value)})
+			}
+			t.add(cells...)
+		}
+		t.write(w)
+		return nil
+	}
+}
@@ -0,0 +1,71 @@
+package s3audit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// severity ranks how urgently a finding needs attention
+type severity int
+
+const (
+	severityLow severity = iota
+	severityMedium
+	severityHigh
+	severityCritical
+)
+
+// parseSeverity reads a severity name, case-insensitively.
+func parseSeverity(value string) (severity, error) {
+	for s := severityLow; s <= severityCritical; s++ {
+		if strings.EqualFold(value, s.String()) {
+			return s, nil
+		}
+	}
+	return severityLow, fmt.Errorf("unknown severity %q, expected one of: low, medium, high, critical", value)
+}
+
+func (s severity) String() string {
+	switch s {
+	case severityMedium:
+		return "MEDIUM"
+	case severityHigh:
+		return "HIGH"
+	case severityCritical:
+		return "CRITICAL"
+	default:
+		return "LOW"
+	}
+}
+
+// finding defines a problem detected on a bucket by one of the checks. suppressed holds the reason of the
+// suppression accepting the finding, if any.
+type finding struct {
+	bucket     string
+	check      string
+	severity   severity
+	message    string
+	suppressed string
+}
+
+// printFindings prints the findings section of the report.
+func printFindings(findings []finding, color bool) {
+	fmt.Println("\nFindings:")
+	if len(findings) == 0 {
+		fmt.Println("No findings")
+		return
+	}
+
+	t := newTable(color, column{header: "SEVERITY"}, column{header: "BUCKET"}, column{header: "CHECK"},
+		column{header: "MESSAGE", max: 120}, column{header: "SUPPRESSED", max: 60})
+	for _, f := range findings {
+		status := f.severity.String()
+		if f.suppressed != "" {
+			status = "SUPPRESSED " + status
+		}
+		t.add(cell{text: status, color: severityColor(f.severity, f.suppressed != "")}, cell{text: f.bucket},
+			cell{text: f.check}, cell{text: f.message}, cell{text: f.suppressed})
+	}
+	t.write(os.Stdout)
+}
@@ -0,0 +1,269 @@
+package s3audit
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fixtureAccountID replaces the account ID of the recording in the fixtures
+const fixtureAccountID = "000000000000"
+
+// fixtureSessionFile holds the region of the recording, the replay runs in the same region
+const fixtureSessionFile = "session.json"
+
+// sanitizedFields are the XML elements whose values identify the recording identity and are replaced in the
+// fixtures
+var sanitizedFields = regexp.MustCompile(`<(UserId|Arn|DisplayName|EmailAddress)>[^<]*</(UserId|Arn|DisplayName|EmailAddress)>`)
+
+// sanitizedJSONFields are the JSON fields identifying a principal, e.g. in the CloudTrail events, replaced in
+// the fixtures
+var sanitizedJSONFields = regexp.MustCompile(`"(arn|principalId|userName)"(\s*:\s*)"[^"\\]*"`)
+
+// sanitizedEscapedJSONFields are the same fields in a JSON document held in a JSON string, as LookupEvents
+// returns the CloudTrail events
+var sanitizedEscapedJSONFields = regexp.MustCompile(`\\"(arn|principalId|userName)\\"(\s*:\s*)\\"[^"\\]*\\"`)
+
+// canonicalIDs are the canonical user IDs of the owners and grantees of the buckets and objects, 64 hex
+// digits unlike the IDs of the lifecycle and replication rules. They are replaced by a hash rather than a
+// constant, so the grants of the owner stay apart from the grants of others.
+var canonicalIDs = regexp.MustCompile(`<ID>([0-9a-f]{64})</ID>`)
+
+// recordedAccountID finds the account ID in the GetCallerIdentity response
+var recordedAccountID = regexp.MustCompile(`<Account>(\d{12})</Account>`)
+
+// droppedHeaders are the response headers not kept in the fixtures, they vary from call to call
+var droppedHeaders = []string{"Date", "Set-Cookie", "X-Amz-Id-2", "X-Amz-Request-Id", "X-Amzn-Requestid", "X-Amz-Cf-Id"}
+
+// fixture is a recorded API response. The request is kept to make the fixtures readable.
+type fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   string      `json:"body"`
+}
+
+// fixtureSession holds the settings of the recording the replay needs
+type fixtureSession struct {
+	Region string `json:"region"`
+}
+
+// fixtureTransport records the API responses into a directory of fixtures, or replays them from it without
+// calling AWS. The responses are keyed by the request, its method, URL and a hash of its body, the replay
+// falls back on the method and URL when the body changed, e.g. with the time range of a metrics query.
+type fixtureTransport struct {
+	dir    string
+	replay bool
+	// next makes the requests of a recording
+	next aws.HTTPClient
+
+	mutex     sync.Mutex
+	accountID string
+	exact     map[string]fixture
+	loose     map[string]fixture
+}
+
+// fixtureKeys returns the exact and loose keys of a request.
+func fixtureKeys(method, url string, body []byte) (exact string, loose string) {
+	loose = method + " " + url
+	sum := sha256.Sum256(body)
+	return loose + " " + hex.EncodeToString(sum[:]), loose
+}
+
+// fixtureFile returns the file of a fixture key.
+func fixtureFile(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16]) + ".json"
+}
+
+// newRecorder returns a transport recording the responses of AWS into dir.
+func newRecorder(dir string, cfg aws.Config) (*fixtureTransport, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	session, err := json.MarshalIndent(fixtureSession{Region: cfg.Region}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, fixtureSessionFile), session, 0644); err != nil {
+		return nil, err
+	}
+	next := cfg.HTTPClient
+	if next == nil {
+		next = http.DefaultClient
+	}
+	return &fixtureTransport{dir: dir, next: next}, nil
+}
+
+// newReplayer returns a transport replaying the fixtures of dir, and the region they were recorded in.
+func newReplayer(dir string) (*fixtureTransport, string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fixtureSessionFile))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading the recording: %v", err)
+	}
+	var session fixtureSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, "", fmt.Errorf("parsing %v: %v", fixtureSessionFile, err)
+	}
+
+	t := &fixtureTransport{dir: dir, replay: true, exact: map[string]fixture{}, loose: map[string]fixture{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if filepath.Base(file) == fixtureSessionFile {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, "", err
+		}
+		var recorded struct {
+			fixture
+			Key string `json:"key"`
+		}
+		if err := json.Unmarshal(data, &recorded); err != nil {
+			return nil, "", fmt.Errorf("parsing fixture %v: %v", file, err)
+		}
+		t.exact[recorded.Key] = recorded.fixture
+		t.loose[recorded.Method+" "+recorded.URL] = recorded.fixture
+	}
+	return t, session.Region, nil
+}
+
+// sanitize replaces the account ID of the recording and the identity fields in a text.
+func (t *fixtureTransport) sanitize(text string) string {
+	t.mutex.Lock()
+	accountID := t.accountID
+	t.mutex.Unlock()
+
+	if accountID != "" {
+		text = strings.ReplaceAll(text, accountID, fixtureAccountID)
+	}
+	text = sanitizedFields.ReplaceAllString(text, "<$1>redacted</$2>")
+	text = sanitizedJSONFields.ReplaceAllString(text, `"$1"$2"redacted"`)
+	text = sanitizedEscapedJSONFields.ReplaceAllString(text, `\"$1\"$2\"redacted\"`)
+	return canonicalIDs.ReplaceAllStringFunc(text, func(element string) string {
+		sum := sha256.Sum256([]byte(canonicalIDs.FindStringSubmatch(element)[1]))
+		return "<ID>" + hex.EncodeToString(sum[:]) + "</ID>"
+	})
+}
+
+func (t *fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	if t.replay {
+		exact, loose := fixtureKeys(req.Method, req.URL.String(), body)
+		f, ok := t.exact[exact]
+		if !ok {
+			if f, ok = t.loose[loose]; !ok {
+				return nil, fmt.Errorf("no fixture recorded for %s %s", req.Method, req.URL)
+			}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+			StatusCode:    f.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        f.Header.Clone(),
+			Body:          io.NopCloser(strings.NewReader(f.Body)),
+			ContentLength: int64(len(f.Body)),
+			Request:       req,
+		}, nil
+	}
+
+	resp, err := t.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+
+	// the account ID is learnt from the GetCallerIdentity response, the first call of the audit
+	if match := recordedAccountID.FindSubmatch(data); match != nil {
+		t.mutex.Lock()
+		t.accountID = string(match[1])
+		t.mutex.Unlock()
+	}
+	if err := t.record(req, body, resp, data); err != nil {
+		return nil, fmt.Errorf("recording the response of %s %s: %v", req.Method, req.URL, err)
+	}
+	return resp, nil
+}
+
+// record writes the fixture of a response, with the request and the response sanitized.
+func (t *fixtureTransport) record(req *http.Request, body []byte, resp *http.Response, data []byte) error {
+	url := t.sanitize(req.URL.String())
+	exact, _ := fixtureKeys(req.Method, url, []byte(t.sanitize(string(body))))
+	header := resp.Header.Clone()
+	for _, name := range droppedHeaders {
+		header.Del(name)
+	}
+
+	recorded := struct {
+		fixture
+		Key string `json:"key"`
+	}{
+		fixture: fixture{Method: req.Method, URL: url, Status: resp.StatusCode, Header: header, Body: t.sanitize(string(data))},
+		Key:     exact,
+	}
+	content, err := json.MarshalIndent(recorded, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(t.dir, fixtureFile(exact)), content, 0644)
+}
+
+// withFixtures records or replays the API calls of cfg. Replaying needs no credentials, the requests are
+// signed with placeholder ones.
+func withFixtures(cfg aws.Config, record, replay string) (aws.Config, error) {
+	switch {
+	case record != "" && replay != "":
+		return cfg, fmt.Errorf("record and replay are exclusive")
+	case record != "":
+		t, err := newRecorder(record, cfg)
+		if err != nil {
+			return cfg, fmt.Errorf("opening the recording %v: %v", record, err)
+		}
+		cfg = cfg.Copy()
+		cfg.HTTPClient = &http.Client{Transport: t}
+	case replay != "":
+		t, region, err := newReplayer(replay)
+		if err != nil {
+			return cfg, fmt.Errorf("opening the recording %v: %v", replay, err)
+		}
+		cfg = cfg.Copy()
+		cfg.HTTPClient = &http.Client{Transport: t}
+		cfg.Region = region
+		cfg.Credentials = credentials.NewStaticCredentialsProvider("AKIDREPLAY", "replay", "")
+	}
+	return cfg, nil
+}
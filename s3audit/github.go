@@ -0,0 +1,105 @@
+package s3audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// githubReportWriter writes a GitHub Actions workflow command per unsuppressed finding, an annotation of the
+// job without a file, and appends a markdown summary of the report to the job summary when the
+// GITHUB_STEP_SUMMARY environment variable names its file.
+type githubReportWriter struct{}
+
+func (githubReportWriter) WriteReport(w io.Writer, report *Report) error {
+	regions := report.bucketRegions()
+	for _, f := range report.Findings {
+		if f.Suppressed != "" {
+			continue
+		}
+		title := fmt.Sprintf("%s: %s", f.Check, f.Bucket)
+		if region := regions[f.Bucket]; region != "" {
+			title += " (" + region + ")"
+		}
+		fmt.Fprintf(w, "::%s title=%s::%s\n", githubAnnotationLevel(f.Severity), escapeGitHubProperty(title),
+			escapeGitHubData(fmt.Sprintf("[%s] %s", f.Severity, f.Message)))
+	}
+
+	path := os.Getenv("GITHUB_STEP_SUMMARY")
+	if path == "" {
+		return nil
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("opening the job summary: %v", err)
+	}
+	writeGitHubSummary(file, report)
+	return file.Close()
+}
+
+// githubAnnotationLevel returns the workflow command of a severity: error for high and critical findings,
+// warning for medium ones and notice otherwise.
+func githubAnnotationLevel(severity string) string {
+	switch severity {
+	case severityCritical.String(), severityHigh.String():
+		return "error"
+	case severityMedium.String():
+		return "warning"
+	default:
+		return "notice"
+	}
+}
+
+// escapeGitHubData escapes the message of a workflow command.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a property of a workflow command, which also ends at : and ,.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// writeGitHubSummary writes the report as the markdown of a job summary: the counts of unsuppressed findings
+// by severity, then a table of them.
+func writeGitHubSummary(w io.Writer, report *Report) {
+	counts := map[string]int{}
+	var active []Finding
+	for _, f := range report.Findings {
+		if f.Suppressed == "" {
+			counts[f.Severity]++
+			active = append(active, f)
+		}
+	}
+
+	fmt.Fprintf(w, "## S3 audit of account %s\n\n", report.accountName())
+	fmt.Fprintf(w, "Audited as `%s`, scan started %s\n\n", report.CallerARN, report.ScanTime.Format(time.RFC3339))
+	fmt.Fprintf(w, "%d bucket(s) audited, %d finding(s)", len(report.Buckets), len(active))
+	for s := severityCritical; s >= severityLow; s-- {
+		if counts[s.String()] > 0 {
+			fmt.Fprintf(w, ", %d %s", counts[s.String()], strings.ToLower(s.String()))
+		}
+	}
+	fmt.Fprint(w, "\n\n")
+	s := report.Statistics
+	fmt.Fprintf(w, "Encrypted %s, versioned %s, %d public, %d with failures; regions: %s\n\n",
+		formatPercent(s.EncryptedPercent), formatPercent(s.VersionedPercent), s.Public, s.Failures, s.formatRegions())
+	if len(active) == 0 {
+		return
+	}
+
+	escape := strings.NewReplacer("|", "\\|", "\n", " ")
+	buckets := report.bucketsByName()
+	fmt.Fprint(w, "| Severity | Bucket | Check | Message |\n| --- | --- | --- | --- |\n")
+	for _, f := range active {
+		// the bucket links to its permissions in the AWS console
+		bucket := escape.Replace(f.Bucket)
+		if url := buckets[f.Bucket].ConsoleURL; url != "" {
+			bucket = fmt.Sprintf("[%s](%s)", bucket, url)
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s |\n", f.Severity, bucket, f.Check, escape.Replace(f.Message))
+	}
+	fmt.Fprintln(w)
+}
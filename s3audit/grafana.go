@@ -0,0 +1,128 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// grafanaMetrics are the metrics served to Grafana, the counts of the buckets of each scan
+var grafanaMetrics = map[string]func(p trendPoint) int{
+	"buckets":     func(p trendPoint) int { return p.buckets },
+	"unencrypted": func(p trendPoint) int { return p.unencrypted },
+	"public":      func(p trendPoint) int { return p.public },
+	"unversioned": func(p trendPoint) int { return p.unversioned },
+}
+
+// grafanaMetric defines a metric listed by the /metrics endpoint
+type grafanaMetric struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+// grafanaQuery defines the body of a /query request. The payload of a target may set teamTag to chart a
+// series per team instead of per account.
+type grafanaQuery struct {
+	Range struct {
+		From time.Time `json:"from"`
+		To   time.Time `json:"to"`
+	} `json:"range"`
+	Targets []struct {
+		Target  string `json:"target"`
+		Payload struct {
+			TeamTag string `json:"teamTag"`
+		} `json:"payload"`
+	} `json:"targets"`
+}
+
+// grafanaSeries defines a time series of a /query response, datapoints are [value, epoch milliseconds] pairs
+type grafanaSeries struct {
+	Target     string       `json:"target"`
+	Datapoints [][2]float64 `json:"datapoints"`
+}
+
+// NewGrafanaHandler serves the scan history, e.g. dynamodb://table or postgres://host/database, with the
+// endpoints of the Grafana JSON datasource, also readable by the Infinity datasource: / for the health
+// check, /metrics for the metric names and /query for their series per account over the time range.
+func NewGrafanaHandler(c context.Context, cfg aws.Config, location string) (http.Handler, error) {
+	history, err := openHistory(c, cfg, location)
+	if err != nil {
+		return nil, fmt.Errorf("opening the history: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		var metrics []grafanaMetric
+		for name := range grafanaMetrics {
+			metrics = append(metrics, grafanaMetric{Label: name, Value: name})
+		}
+		sort.Slice(metrics, func(i, j int) bool { return metrics[i].Value < metrics[j].Value })
+		writeJSON(w, metrics)
+	})
+	mux.HandleFunc("/query", func(w http.ResponseWriter, r *http.Request) {
+		var query grafanaQuery
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			http.Error(w, fmt.Sprintf("invalid query: %v", err), http.StatusBadRequest)
+			return
+		}
+		series, err := grafanaSeriesOf(r.Context(), history, query)
+		if err != nil {
+			log.Printf("Got an error reading the history: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, series)
+	})
+	return mux, nil
+}
+
+// grafanaSeriesOf returns the series of the targets of a query, one per account, or per account and team
+// when the target sets a team tag. The history is read once for all the targets.
+func grafanaSeriesOf(c context.Context, history historyStore, query grafanaQuery) ([]grafanaSeries, error) {
+	snapshots, err := history.since(c, query.Range.From)
+	if err != nil {
+		return nil, err
+	}
+	var inRange []BucketSnapshot
+	for _, s := range snapshots {
+		if query.Range.To.IsZero() || !s.ScanTime.After(query.Range.To) {
+			inRange = append(inRange, s)
+		}
+	}
+
+	series := []grafanaSeries{}
+	for _, target := range query.Targets {
+		metric, ok := grafanaMetrics[target.Target]
+		if !ok {
+			continue
+		}
+		points := trendPoints(inRange, target.Payload.TeamTag)
+		for _, key := range sortedTrendKeys(points) {
+			s := grafanaSeries{Target: target.Target + " " + key.accountID, Datapoints: [][2]float64{}}
+			if target.Payload.TeamTag != "" {
+				s.Target += " " + key.team
+			}
+			for _, p := range points[key] {
+				s.Datapoints = append(s.Datapoints, [2]float64{float64(metric(p)), float64(p.scanTime.UnixMilli())})
+			}
+			series = append(series, s)
+		}
+	}
+	return series, nil
+}
+
+// writeJSON writes a value as the JSON body of a response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Got an error writing the response: %v", err)
+	}
+}
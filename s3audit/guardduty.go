@@ -0,0 +1,260 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/guardduty"
+	"github.com/aws/aws-sdk-go-v2/service/guardduty/types"
+	"sort"
+	"time"
+)
+
+// GuardDutyListDetectorsApi defines the interface for the ListDetectors function.
+// We use this interface to test the function using a mocked service.
+type GuardDutyListDetectorsApi interface {
+	ListDetectors(ctx context.Context,
+		params *guardduty.ListDetectorsInput,
+		optFns ...func(*guardduty.Options)) (*guardduty.ListDetectorsOutput, error)
+}
+
+// GuardDutyGetDetectorApi defines the interface for the GetDetector function.
+// We use this interface to test the function using a mocked service.
+type GuardDutyGetDetectorApi interface {
+	GetDetector(ctx context.Context,
+		params *guardduty.GetDetectorInput,
+		optFns ...func(*guardduty.Options)) (*guardduty.GetDetectorOutput, error)
+}
+
+// GuardDutyListFindingsApi defines the interface for the ListFindings function.
+// We use this interface to test the function using a mocked service.
+type GuardDutyListFindingsApi interface {
+	ListFindings(ctx context.Context,
+		params *guardduty.ListFindingsInput,
+		optFns ...func(*guardduty.Options)) (*guardduty.ListFindingsOutput, error)
+}
+
+// GuardDutyGetFindingsApi defines the interface for the GetFindings function.
+// We use this interface to test the function using a mocked service.
+type GuardDutyGetFindingsApi interface {
+	GetFindings(ctx context.Context,
+		params *guardduty.GetFindingsInput,
+		optFns ...func(*guardduty.Options)) (*guardduty.GetFindingsOutput, error)
+}
+
+// guardDutyApi groups the GuardDuty calls needed to read the S3 protection status and findings of a region.
+type guardDutyApi interface {
+	GuardDutyListDetectorsApi
+	GuardDutyGetDetectorApi
+	GuardDutyListFindingsApi
+	GuardDutyGetFindingsApi
+}
+
+// guardDutyLookback is how far back GuardDuty findings are considered recent
+const guardDutyLookback = 30 * 24 * time.Hour
+
+// guardDutyFinding defines a recent GuardDuty finding concerning a bucket
+type guardDutyFinding struct {
+	id          string
+	findingType string
+	title       string
+	severity    float64
+}
+
+// regionGuardDuty holds the GuardDuty state of a region. detector is empty when GuardDuty is not enabled in
+// the region, buckets holds the recent findings keyed by bucket name.
+type regionGuardDuty struct {
+	detector     string
+	s3Protection bool
+	buckets      map[string][]guardDutyFinding
+}
+
+// ListDetectors retrieves the GuardDuty detectors of a region.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListDetectorsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListDetectors.
+func ListDetectors(c context.Context, api GuardDutyListDetectorsApi, input *guardduty.ListDetectorsInput) (*guardduty.ListDetectorsOutput, error) {
+	return api.ListDetectors(c, input)
+}
+
+// GetDetector retrieves the status and protection plans of a GuardDuty detector.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetDetectorOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetDetector.
+func GetDetector(c context.Context, api GuardDutyGetDetectorApi, input *guardduty.GetDetectorInput) (*guardduty.GetDetectorOutput, error) {
+	return api.GetDetector(c, input)
+}
+
+// ListGuardDutyFindings retrieves the IDs of the GuardDuty findings matching a criteria.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListFindings.
+func ListGuardDutyFindings(c context.Context, api GuardDutyListFindingsApi, input *guardduty.ListFindingsInput) (*guardduty.ListFindingsOutput, error) {
+	return api.ListFindings(c, input)
+}
+
+// GetGuardDutyFindings retrieves the details of up to 50 GuardDuty findings.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetFindings.
+func GetGuardDutyFindings(c context.Context, api GuardDutyGetFindingsApi, input *guardduty.GetFindingsInput) (*guardduty.GetFindingsOutput, error) {
+	return api.GetFindings(c, input)
+}
+
+// getRegionGuardDuty reads whether S3 protection is enabled on the detector of a region and collects the
+// unarchived S3 findings it updated within guardDutyLookback.
+func getRegionGuardDuty(c context.Context, api guardDutyApi) (regionGuardDuty, error) {
+	state := regionGuardDuty{buckets: map[string][]guardDutyFinding{}}
+
+	detectors, err := ListDetectors(c, api, &guardduty.ListDetectorsInput{})
+	if err != nil {
+		return state, err
+	}
+	if len(detectors.DetectorIds) == 0 {
+		return state, nil
+	}
+	// a region has at most one detector per account
+	state.detector = detectors.DetectorIds[0]
+
+	detector, err := GetDetector(c, api, &guardduty.GetDetectorInput{DetectorId: aws.String(state.detector)})
+	if err != nil {
+		return state, err
+	}
+	state.s3Protection = s3ProtectionEnabled(detector)
+
+	input := &guardduty.ListFindingsInput{
+		DetectorId: aws.String(state.detector),
+		FindingCriteria: &types.FindingCriteria{Criterion: map[string]types.Condition{
+			"resource.resourceType": {Equals: []string{"S3Bucket"}},
+			"service.archived":      {Equals: []string{"false"}},
+			"updatedAt":             {GreaterThanOrEqual: aws.Int64(time.Now().Add(-guardDutyLookback).UnixMilli())},
+		}},
+		// GetFindings accepts at most 50 IDs, one page of IDs is fetched with a single call
+		MaxResults: aws.Int32(50),
+	}
+	for {
+		list, err := ListGuardDutyFindings(c, api, input)
+		if err != nil {
+			return state, err
+		}
+
+		if len(list.FindingIds) > 0 {
+			details, err := GetGuardDutyFindings(c, api, &guardduty.GetFindingsInput{
+				DetectorId: aws.String(state.detector),
+				FindingIds: list.FindingIds,
+			})
+			if err != nil {
+				return state, err
+			}
+			for _, f := range details.Findings {
+				if f.Resource == nil {
+					continue
+				}
+				for _, bucket := range f.Resource.S3BucketDetails {
+					name := aws.ToString(bucket.Name)
+					state.buckets[name] = append(state.buckets[name], guardDutyFinding{
+						id:          aws.ToString(f.Id),
+						findingType: aws.ToString(f.Type),
+						title:       aws.ToString(f.Title),
+						severity:    aws.ToFloat64(f.Severity),
+					})
+				}
+			}
+		}
+
+		if aws.ToString(list.NextToken) == "" {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+
+	return state, nil
+}
+
+// s3ProtectionEnabled reports whether a detector monitors S3 data events, through the S3_DATA_EVENTS
+// protection plan or, for detectors that predate protection plans, the S3 logs data source.
+func s3ProtectionEnabled(detector *guardduty.GetDetectorOutput) bool {
+	if detector.Status != types.DetectorStatusEnabled {
+		return false
+	}
+	for _, feature := range detector.Features {
+		if feature.Name == types.DetectorFeatureResultS3DataEvents {
+			return feature.Status == types.FeatureStatusEnabled
+		}
+	}
+	return detector.DataSources != nil && detector.DataSources.S3Logs != nil && detector.DataSources.S3Logs.Status == types.DataSourceStatusEnabled
+}
+
+// guardDutySeverity maps the numeric GuardDuty severity to the severity of the audit findings.
+func guardDutySeverity(value float64) severity {
+	switch {
+	case value >= 9:
+		return severityCritical
+	case value >= 7:
+		return severityHigh
+	case value >= 4:
+		return severityMedium
+	default:
+		return severityLow
+	}
+}
+
+// guardDutyFindings surfaces the recent GuardDuty findings of a bucket as audit findings.
+func guardDutyFindings(b s3Bucket) []finding {
+	var findings []finding
+	for _, f := range b.guardDuty {
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "guardduty",
+			severity: guardDutySeverity(f.severity),
+			message:  fmt.Sprintf("%s: %s", f.findingType, f.title),
+		})
+	}
+	return findings
+}
+
+// printGuardDutyFindings prints the recent GuardDuty findings of a bucket below its report line.
+func printGuardDutyFindings(b s3Bucket) {
+	for _, f := range b.guardDuty {
+		fmt.Printf("\tGuardDuty: %s\t Severity: %.1f\t %s\n", f.id, f.severity, f.findingType)
+	}
+}
+
+// printGuardDuty prints the GuardDuty S3 protection section of the report, one line per scanned region.
+func printGuardDuty(regions map[string]regionGuardDuty) {
+	fmt.Println("\nGuardDuty S3 protection:")
+
+	var names []string
+	for region := range regions {
+		names = append(names, region)
+	}
+	sort.Strings(names)
+
+	for _, region := range names {
+		state := regions[region]
+		switch {
+		case state.detector == "":
+			fmt.Printf("Region: %s\t GuardDuty not enabled\n", region)
+		case !state.s3Protection:
+			fmt.Printf("Region: %s\t Detector: %s\t S3 protection: disabled\n", region, state.detector)
+		default:
+			fmt.Printf("Region: %s\t Detector: %s\t S3 protection: enabled\n", region, state.detector)
+		}
+	}
+}
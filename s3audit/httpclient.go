@@ -0,0 +1,119 @@
+package s3audit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// HTTPOptions configures the HTTP client of the AWS API calls, e.g. to go through a corporate network that
+// intercepts TLS or to reuse the connections of a parallel scan through a NAT gateway. The HTTPS_PROXY and AWS_CA_BUNDLE environment variables apply when the options are empty.
+type HTTPOptions struct {
+	// Proxy is the URL of the proxy of the requests, e.g. http://proxy.example.com:3128
+	Proxy string
+	// CABundle is a PEM file of the certificate authorities trusted in addition to the ones of the system
+	CABundle string
+	// MaxIdleConns is the number of idle connections kept open to each endpoint, the SDK default when 0. It
+	// should be at least the concurrency, so the parallel requests reuse their connections.
+	MaxIdleConns int
+	// IdleConnTimeout is how long an idle connection is kept open, the SDK default when 0
+	IdleConnTimeout time.Duration
+	// Timeout is the deadline of each request, including reading the response body; no deadline when 0
+	Timeout time.Duration
+	// KeepAlive is the interval of the TCP keep-alive probes of the connections, the SDK default when 0 and
+	// disabled when negative
+	KeepAlive time.Duration
+	// DisableHTTP2 makes the requests use HTTP/1.1 only
+	DisableHTTP2 bool
+}
+
+// withHTTPOptions returns cfg with an HTTP client configured with the options. The client of cfg, which
+// already trusts the AWS_CA_BUNDLE of the environment, is the base of the new one.
+func withHTTPOptions(cfg aws.Config, options HTTPOptions) (aws.Config, error) {
+	var transportOptions []func(*http.Transport)
+	if options.Proxy != "" {
+		proxy, err := url.Parse(options.Proxy)
+		if err != nil || proxy.Host == "" {
+			return cfg, fmt.Errorf("invalid proxy URL %q", options.Proxy)
+		}
+		transportOptions = append(transportOptions, func(t *http.Transport) {
+			t.Proxy = http.ProxyURL(proxy)
+		})
+	}
+	if options.CABundle != "" {
+		pem, err := os.ReadFile(options.CABundle)
+		if err != nil {
+			return cfg, fmt.Errorf("reading the CA bundle: %v", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(pem) {
+			return cfg, fmt.Errorf("no certificate found in the CA bundle %s", options.CABundle)
+		}
+		transportOptions = append(transportOptions, func(t *http.Transport) {
+			if t.TLSClientConfig == nil {
+				t.TLSClientConfig = &tls.Config{}
+			}
+			if t.TLSClientConfig.RootCAs == nil {
+				t.TLSClientConfig.RootCAs, _ = x509.SystemCertPool()
+			}
+			if t.TLSClientConfig.RootCAs == nil {
+				t.TLSClientConfig.RootCAs = x509.NewCertPool()
+			}
+			t.TLSClientConfig.RootCAs.AppendCertsFromPEM(pem)
+		})
+	}
+	if options.MaxIdleConns < 0 {
+		return cfg, fmt.Errorf("invalid number of idle connections %d", options.MaxIdleConns)
+	}
+	if options.MaxIdleConns > 0 {
+		transportOptions = append(transportOptions, func(t *http.Transport) {
+			t.MaxIdleConnsPerHost = options.MaxIdleConns
+			if t.MaxIdleConns != 0 && t.MaxIdleConns < options.MaxIdleConns {
+				t.MaxIdleConns = options.MaxIdleConns
+			}
+		})
+	}
+	if options.IdleConnTimeout > 0 {
+		transportOptions = append(transportOptions, func(t *http.Transport) {
+			t.IdleConnTimeout = options.IdleConnTimeout
+		})
+	}
+	if options.DisableHTTP2 {
+		transportOptions = append(transportOptions, func(t *http.Transport) {
+			// a non-nil empty map turns off the HTTP/2 upgrade of the TLS connections
+			t.ForceAttemptHTTP2 = false
+			t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		})
+	}
+	var dialerOptions []func(*net.Dialer)
+	if options.KeepAlive != 0 {
+		dialerOptions = append(dialerOptions, func(d *net.Dialer) {
+			d.KeepAlive = options.KeepAlive
+		})
+	}
+	if len(transportOptions) == 0 && len(dialerOptions) == 0 && options.Timeout <= 0 {
+		return cfg, nil
+	}
+
+	client, ok := cfg.HTTPClient.(*awshttp.BuildableClient)
+	if !ok {
+		client = awshttp.NewBuildableClient()
+	}
+	if len(transportOptions) > 0 {
+		client = client.WithTransportOptions(transportOptions...)
+	}
+	if len(dialerOptions) > 0 {
+		client = client.WithDialerOptions(dialerOptions...)
+	}
+	if options.Timeout > 0 {
+		client = client.WithTimeout(options.Timeout)
+	}
+	cfg.HTTPClient = client
+	return cfg, nil
+}
@@ -0,0 +1,359 @@
+package s3audit
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// iamPolicy defines an IAM policy document
+type iamPolicy struct {
+	Version   string         `json:"Version"`
+	Statement []iamStatement `json:"Statement"`
+}
+
+// iamStatement defines a statement of an IAM policy document
+type iamStatement struct {
+	Sid      string   `json:"Sid"`
+	Effect   string   `json:"Effect"`
+	Action   []string `json:"Action"`
+	Resource []string `json:"Resource"`
+}
+
+// permission defines IAM actions the audit needs when enabled returns true for its options, grouped in the
+// statement sid. bucketLevel actions apply to the buckets and are scoped to the bucket patterns, resource
+// returns the ARN of the others when they apply to a single resource, they need every resource otherwise.
+type permission struct {
+	sid         string
+	actions     []string
+	bucketLevel bool
+	resource    func(options Options) string
+	enabled     func(options Options) bool
+}
+
+// always enables the permissions every audit needs
+func always(Options) bool { return true }
+
+// auditPermissions holds the IAM actions of every call the audit and the remediations make
+var auditPermissions = []permission{
+	{
+		sid: "ReadAccount",
+		actions: []string{"s3:ListAllMyBuckets", "s3:GetAccountPublicAccessBlock", "s3express:ListAllMyDirectoryBuckets",
+			"s3express:GetEncryptionConfiguration", "s3express:GetBucketPolicy", "account:ListRegions",
+			"iam:ListAccountAliases"},
+		enabled: always,
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketLocation", "s3:GetBucketTagging", "s3:GetBucketRequestPayment", "s3:GetAccelerateConfiguration"},
+		bucketLevel: true,
+		enabled:     always,
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketAcl"},
+		bucketLevel: true,
+		enabled:     checksEnabled("ownership", "owner"),
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketOwnershipControls"},
+		bucketLevel: true,
+		enabled:     checksEnabled("ownership"),
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetEncryptionConfiguration"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return checksEnabled("encryption", "risk", "drift", "bucket-key")(options) || options.ConfigRules
+		},
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketPolicyStatus"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return checksEnabled("bucket-policy", "access-analyzer", "risk")(options) || options.ConfigRules ||
+				options.CloudFront && checksEnabled("cloudfront")(options)
+		},
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketPolicy"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return checksEnabled("cross-account")(options) || checksEnabled("vpc-endpoint")(options) && options.VPCEndpoints != "" ||
+				options.CloudFront && checksEnabled("cloudfront")(options)
+		},
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"s3:ListAccessPoints", "s3:GetAccessPointPolicy", "s3:GetAccessPointPolicyStatus"},
+		enabled: checksEnabled("access-point", "risk"),
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetLifecycleConfiguration", "s3:GetIntelligentTieringConfiguration"},
+		bucketLevel: true,
+		enabled:     checksEnabled("intelligent-tiering"),
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"cloudwatch:GetMetricData"},
+		enabled: func(options Options) bool {
+			return checksEnabled("intelligent-tiering", "bucket-key")(options) || options.Sort == "size" || options.StorageLens ||
+				options.CostExplorerTag != "" ||
+				options.StaleDays > 0 && checksEnabled("stale")(options)
+		},
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketNotification"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return checksEnabled("notification")(options) || options.Diagram != ""
+		},
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"lambda:GetFunction"},
+		enabled: func(options Options) bool {
+			return checksEnabled("notification")(options) || options.Diagram != ""
+		},
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetBucketVersioning"},
+		bucketLevel: true,
+		enabled:     checksEnabled("drift"),
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"access-analyzer:ListAnalyzers", "access-analyzer:ListFindings"},
+		enabled: checksEnabled("access-analyzer", "bucket-policy", "risk"),
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"cloudtrail:DescribeTrails", "cloudtrail:GetTrailStatus", "cloudtrail:GetEventSelectors"},
+		enabled: checksEnabled("data-events"),
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"ce:GetCostAndUsage"},
+		enabled: func(options Options) bool { return options.CostExplorerTag != "" },
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"cloudtrail:LookupEvents"},
+		enabled: func(options Options) bool { return options.Creators && options.CreatorsTable == "" },
+	},
+	{
+		// the query of the CloudTrail table, which reads the logs and writes the results to S3
+		sid: "QueryCloudTrail",
+		actions: []string{"athena:StartQueryExecution", "athena:GetQueryExecution", "athena:GetQueryResults",
+			"glue:GetDatabase", "glue:GetTable", "s3:GetObject", "s3:ListBucket", "s3:GetBucketLocation", "s3:PutObject"},
+		enabled: func(options Options) bool { return options.Creators && options.CreatorsTable != "" },
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"macie2:GetMacieSession", "macie2:ListFindings", "macie2:GetFindings"},
+		enabled: checksEnabled("access-analyzer", "access-point", "bucket-policy", "encryption", "risk"),
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"guardduty:ListDetectors", "guardduty:GetDetector", "guardduty:ListFindings", "guardduty:GetFindings"},
+		enabled: checksEnabled("guardduty"),
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:GetReplicationConfiguration", "s3:GetBucketLogging", "s3:GetInventoryConfiguration"},
+		bucketLevel: true,
+		enabled:     func(options Options) bool { return options.Diagram != "" },
+	},
+	{
+		// HeadBucket with the expected owner, and to find the region of the buckets whose location is denied
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:ListBucket"},
+		bucketLevel: true,
+		enabled:     func(options Options) bool { return options.ExpectedOwner != "" },
+	},
+	{
+		// the objects, to sample their last modification for the stale check, to scan them, or to find a key the
+		// anonymous probe reads
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:ListBucket"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return options.ScanObjects || options.StaleDays > 0 && checksEnabled("stale")(options) || options.ActiveProbes
+		},
+	},
+	{
+		sid:         "ReadBuckets",
+		actions:     []string{"s3:ListBucketVersions"},
+		bucketLevel: true,
+		enabled:     checksEnabled("empty"),
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"cloudfront:ListDistributions", "route53:ListHostedZones", "route53:ListResourceRecordSets"},
+		enabled: func(options Options) bool { return options.CloudFront && checksEnabled("cloudfront")(options) },
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"s3:ListStorageLensConfigurations", "s3:GetStorageLensConfiguration"},
+		enabled: func(options Options) bool { return options.StorageLens },
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"kms:ListAliases"},
+		enabled: func(options Options) bool {
+			return checksEnabled("encryption")(options) && options.EncryptionPolicy != ""
+		},
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"kms:DescribeKey", "kms:GetKeyRotationStatus", "kms:GetKeyPolicy"},
+		enabled: func(options Options) bool { return options.KMSMatrix },
+	},
+	{
+		sid:     "ReadAccount",
+		actions: []string{"config:DescribeConfigRules", "config:GetComplianceDetailsByConfigRule"},
+		enabled: func(options Options) bool { return options.ConfigRules },
+	},
+	{
+		sid:     "History",
+		actions: []string{"dynamodb:BatchWriteItem", "dynamodb:Query"},
+		enabled: func(options Options) bool { return strings.HasPrefix(options.History, "dynamodb://") },
+	},
+	{
+		sid:     "SendReport",
+		actions: []string{"ses:SendEmail"},
+		enabled: func(options Options) bool { return options.Email != "" },
+	},
+	{
+		sid:     "SignReport",
+		actions: []string{"kms:GetPublicKey", "kms:Sign"},
+		enabled: func(options Options) bool { return strings.HasPrefix(options.SignKey, kmsKeyPrefix) },
+	},
+	{
+		sid:     "Export",
+		actions: []string{"securityhub:BatchImportFindings", "securityhub:GetFindings", "securityhub:BatchUpdateFindings"},
+		enabled: func(options Options) bool { return options.Export == "securityhub" && !options.DryRun },
+	},
+	{
+		sid:     "ReadTerraformState",
+		actions: []string{"s3:GetObject"},
+		resource: func(options Options) string {
+			return bucketArn(options.Partition, strings.TrimPrefix(options.TerraformState, "s3://"))
+		},
+		enabled: func(options Options) bool { return strings.HasPrefix(options.TerraformState, "s3://") },
+	},
+	{
+		sid:         "Remediate",
+		actions:     []string{"s3:PutBucketTagging"},
+		bucketLevel: true,
+		enabled:     func(options Options) bool { return remediationEnabled(options, "cost-tags") },
+	},
+	{
+		sid:         "Remediate",
+		actions:     []string{"s3:PutIntelligentTieringConfiguration"},
+		bucketLevel: true,
+		enabled:     func(options Options) bool { return remediationEnabled(options, "intelligent-tiering") },
+	},
+	{
+		sid:         "Remediate",
+		actions:     []string{"s3:PutBucketOwnershipControls"},
+		bucketLevel: true,
+		enabled:     func(options Options) bool { return remediationEnabled(options, "enforce-bucket-owner") },
+	},
+	{
+		sid:         "Remediate",
+		actions:     []string{"s3:PutEncryptionConfiguration"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return remediationEnabled(options, "enable-bucket-key") || remediationEnabled(options, "enable-dsse")
+		},
+	},
+	{
+		// the bucket is listed again before it is deleted
+		sid:         "Remediate",
+		actions:     []string{"s3:DeleteBucket", "s3:ListBucketVersions"},
+		bucketLevel: true,
+		enabled: func(options Options) bool {
+			return remediationEnabled(options, "delete-empty")
+		},
+	},
+}
+
+// checksEnabled enables permissions when any of the checks runs with the options.
+func checksEnabled(checks ...string) func(options Options) bool {
+	return func(options Options) bool {
+		selection, err := newCheckSelection(options.Checks, options.SkipChecks)
+		return err != nil || selection.enabled(checks...)
+	}
+}
+
+// remediationEnabled reports whether the options apply a remediation: it is selected with Fix, and neither
+// printed with DryRun nor written to a Plan.
+func remediationEnabled(options Options, name string) bool {
+	return parseFixes(options.Fix)[name] && !options.DryRun && options.Plan == ""
+}
+
+// generatePolicy builds the least-privilege policy of an audit with the options. The bucket-level actions are
+// scoped to the bucket patterns, and the Terraform state object to its ARN, in the partition of the options.
+func generatePolicy(options Options) iamPolicy {
+	bucketResources := []string{bucketArn(options.Partition, "*")}
+	if patterns := splitList(options.Buckets); len(patterns) > 0 {
+		bucketResources = nil
+		for _, pattern := range patterns {
+			bucketResources = append(bucketResources, bucketArn(options.Partition, pattern))
+		}
+	}
+
+	statements := map[string]*iamStatement{}
+	var sids []string
+	add := func(sid string, resources []string, actions []string) {
+		statement, ok := statements[sid]
+		if !ok {
+			statement = &iamStatement{Sid: sid, Effect: "Allow", Resource: resources}
+			statements[sid] = statement
+			sids = append(sids, sid)
+		}
+		statement.Action = append(statement.Action, actions...)
+	}
+
+	for _, p := range auditPermissions {
+		if !p.enabled(options) {
+			continue
+		}
+		switch {
+		case p.resource != nil:
+			add(p.sid, []string{p.resource(options)}, p.actions)
+		case p.bucketLevel:
+			add(p.sid, bucketResources, p.actions)
+		default:
+			add(p.sid, []string{"*"}, p.actions)
+		}
+	}
+
+	policy := iamPolicy{Version: "2012-10-17"}
+	for _, sid := range sids {
+		statement := statements[sid]
+		sort.Strings(statement.Action)
+		policy.Statement = append(policy.Statement, *statement)
+	}
+	return policy
+}
+
+// WritePolicy writes the least-privilege IAM policy an audit with the options needs, for the audit role to be
+// provisioned before the first run. The custom checks registered with Register are not covered.
+func WritePolicy(w io.Writer, options Options) error {
+	if _, err := newCheckSelection(options.Checks, options.SkipChecks); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(generatePolicy(options))
+}
@@ -0,0 +1,250 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"os"
+	"sort"
+	"strings"
+)
+
+// auditBucket audits one bucket of the account with every check.
+func auditBucket(c context.Context, cfg aws.Config, options Options, bucket string) (*Auditor, *BucketResult, error) {
+	options.Buckets = bucket
+	options.Checks = ""
+	options.SkipChecks = ""
+	options.Concurrency = 1
+	options.AdaptiveConcurrency = false
+	a, err := New(c, cfg, options)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the audit stops when an error returns before the channels are drained
+	c, cancel := context.WithCancel(c)
+	defer cancel()
+	var result *BucketResult
+	results, errs := a.Stream(c)
+	for results != nil || errs != nil {
+		select {
+		case r, ok := <-results:
+			if !ok {
+				results = nil
+				continue
+			}
+			result = &r
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			return nil, nil, err
+		}
+	}
+	if result == nil {
+		return nil, nil, fmt.Errorf("bucket %s not found in account %s", bucket, a.accountID)
+	}
+	return a, result, nil
+}
+
+// Inspect audits one bucket with every check and prints a dossier of its settings: the ACL grants, the policy
+// document, the lifecycle rules, the replication rules and the notifications, then its findings. It is meant
+// for investigating a bucket during an incident, the options select the account and the endpoints as for an
+// audit.
+func Inspect(c context.Context, cfg aws.Config, options Options, bucket string) error {
+	a, result, err := auditBucket(c, cfg, options, bucket)
+	if err != nil {
+		return err
+	}
+
+	client := a.s3Client(result.Region)
+	policy, err := getBucketPolicy(c, client, bucket)
+	if err != nil {
+		result.Errors = append(result.Errors, *newReadError(bucket, "policy", err))
+	}
+	replication, err := client.GetBucketReplication(c, &s3.GetBucketReplicationInput{Bucket: aws.String(bucket)})
+	if err != nil && apiErrorCode(err) != "ReplicationConfigurationNotFoundError" {
+		result.Errors = append(result.Errors, *newReadError(bucket, "replication", err))
+	}
+
+	b := result.bucket
+	fmt.Printf("\nBucket %s\n", b.name)
+	fmt.Printf("\tRegion: %s\n", result.Region)
+	fmt.Printf("\tARN: %s\n", bucketArn(partitionOf(result.Region), b.name))
+	if url := bucketConsoleURL(result.Region, b.name); url != "" {
+		fmt.Printf("\tConsole: %s\n", url)
+	}
+	fmt.Printf("\tCreated: %s\n", formatCreationDate(b.creationDate))
+	fmt.Printf("\tOwner: %s\n", formatOwner(b.acl.Owner))
+	fmt.Printf("\tObject ownership: %s\n", orNone(string(b.objectOwnership)))
+	fmt.Printf("\tEncryption: %s\n", formatEncryption(b))
+	fmt.Printf("\tVersioning: %s\n", orNone(string(b.versioning)))
+	fmt.Printf("\tRisk score: %d\n", result.score)
+
+	fmt.Println("\nTags:")
+	if len(b.tags) == 0 {
+		fmt.Println("\tnone")
+	} else {
+		t := newTable(false, column{header: "KEY"}, column{header: "VALUE"})
+		var keys []string
+		for key := range b.tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			t.add(cell{text: key}, cell{text: b.tags[key]})
+		}
+		t.write(os.Stdout)
+	}
+
+	fmt.Println("\nACL grants:")
+	printGrants(b.acl.Grants)
+
+	fmt.Println("\nBucket policy:")
+	printPolicy(policy)
+	printExternalAccess(b)
+	printAccessPoints(b.accessPoints)
+
+	fmt.Println("\nLifecycle rules:")
+	printLifecycleRules(b.lifecycle)
+	printIntelligentTiering(b.intelligentTiering)
+
+	fmt.Println("\nReplication:")
+	if replication == nil || replication.ReplicationConfiguration == nil {
+		fmt.Println("\tnone")
+	} else {
+		printReplicationRules(replication.ReplicationConfiguration)
+	}
+
+	fmt.Println("\nNotifications:")
+	if len(b.notifications) == 0 {
+		fmt.Println("\tnone")
+	}
+	printNotificationTargets(b.notifications)
+
+	printDataEventTrails(b.dataEventTrails)
+	printSensitiveData(b)
+	printGuardDutyFindings(b)
+
+	fmt.Println("\nFindings:")
+	if len(result.findings) == 0 {
+		fmt.Println("\tnone")
+	} else {
+		t := newTable(a.color, column{header: "SEVERITY"}, column{header: "CHECK"}, column{header: "MESSAGE"}, column{header: "SUPPRESSED"})
+		for _, f := range result.findings {
+			t.add(cell{text: f.severity.String(), color: severityColor(f.severity, f.suppressed != "")}, cell{text: f.check},
+				cell{text: f.message}, cell{text: f.suppressed})
+		}
+		t.write(os.Stdout)
+	}
+
+	if len(result.Errors) > 0 {
+		fmt.Println("\nUnchecked:")
+		for _, unchecked := range uncheckedSettings(result.Errors) {
+			fmt.Printf("\t%s\n", unchecked)
+		}
+	}
+	return nil
+}
+
+// orNone returns a setting, or none when it is empty.
+func orNone(value string) string {
+	if value == "" {
+		return "none"
+	}
+	return value
+}
+
+// printGrants prints the grants of an ACL as a table.
+func printGrants(grants []types.Grant) {
+	if len(grants) == 0 {
+		fmt.Println("\tnone")
+		return
+	}
+	t := newTable(false, column{header: "GRANTEE"}, column{header: "TYPE"}, column{header: "PERMISSION"})
+	for _, grant := range grants {
+		if grant.Grantee == nil {
+			continue
+		}
+		grantee := aws.ToString(grant.Grantee.URI)
+		switch {
+		case grant.Grantee.DisplayName != nil:
+			grantee = fmt.Sprintf("%s (%s)", aws.ToString(grant.Grantee.DisplayName), aws.ToString(grant.Grantee.ID))
+		case grant.Grantee.ID != nil:
+			grantee = aws.ToString(grant.Grantee.ID)
+		case grant.Grantee.EmailAddress != nil:
+			grantee = aws.ToString(grant.Grantee.EmailAddress)
+		}
+		t.add(cell{text: grantee}, cell{text: string(grant.Grantee.Type)}, cell{text: string(grant.Permission)})
+	}
+	t.write(os.Stdout)
+}
+
+// printPolicy prints a policy document indented, as is when it is not valid JSON.
+func printPolicy(policy string) {
+	if policy == "" {
+		fmt.Println("\tnone")
+		return
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, []byte(policy), "\t", "  "); err != nil {
+		fmt.Printf("\t%s\n", policy)
+		return
+	}
+	fmt.Printf("\t%s\n", indented.String())
+}
+
+// printLifecycleRules prints the lifecycle rules of a bucket as a table.
+func printLifecycleRules(rules []types.LifecycleRule) {
+	if len(rules) == 0 {
+		fmt.Println("\tnone")
+		return
+	}
+	t := newTable(false, column{header: "ID"}, column{header: "STATUS"}, column{header: "PREFIX"},
+		column{header: "TRANSITIONS"}, column{header: "EXPIRATION"})
+	for _, rule := range rules {
+		prefix := aws.ToString(rule.Prefix)
+		if filter := rule.Filter; filter != nil {
+			if filter.Prefix != nil {
+				prefix = aws.ToString(filter.Prefix)
+			}
+			if filter.And != nil && filter.And.Prefix != nil {
+				prefix = aws.ToString(filter.And.Prefix)
+			}
+		}
+		var transitions []string
+		for _, transition := range rule.Transitions {
+			transitions = append(transitions, fmt.Sprintf("%s after %dd", transition.StorageClass, aws.ToInt32(transition.Days)))
+		}
+		expiration := ""
+		if rule.Expiration != nil && rule.Expiration.Days != nil {
+			expiration = fmt.Sprintf("%dd", aws.ToInt32(rule.Expiration.Days))
+		}
+		t.add(cell{text: aws.ToString(rule.ID)}, cell{text: string(rule.Status)}, cell{text: prefix},
+			cell{text: strings.Join(transitions, ", ")}, cell{text: expiration})
+	}
+	t.write(os.Stdout)
+}
+
+// printReplicationRules prints the role and the rules of a replication configuration as a table.
+func printReplicationRules(configuration *types.ReplicationConfiguration) {
+	fmt.Printf("\tRole: %s\n", aws.ToString(configuration.Role))
+	t := newTable(false, column{header: "ID"}, column{header: "STATUS"}, column{header: "DESTINATION"},
+		column{header: "STORAGE CLASS"}, column{header: "ACCOUNT"})
+	for _, rule := range configuration.Rules {
+		var destination, storageClass, account string
+		if rule.Destination != nil {
+			destination = aws.ToString(rule.Destination.Bucket)
+			storageClass = string(rule.Destination.StorageClass)
+			account = aws.ToString(rule.Destination.Account)
+		}
+		t.add(cell{text: aws.ToString(rule.ID)}, cell{text: string(rule.Status)}, cell{text: destination},
+			cell{text: storageClass}, cell{text: account})
+	}
+	t.write(os.Stdout)
+}
@@ -0,0 +1,273 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// inventoryManifest defines the manifest.json of an S3 Inventory report, the files of the report and the
+// fields of its records.
+type inventoryManifest struct {
+	SourceBucket string `json:"sourceBucket"`
+	FileFormat   string `json:"fileFormat"`
+	FileSchema   string `json:"fileSchema"`
+	Files        []struct {
+		Key  string `json:"key"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+
+	// bucket is the destination bucket of the report, created is the date of its folder
+	bucket  string
+	created string
+}
+
+// InventoryQuery defines a query over the latest S3 Inventory report of a bucket. Query is an S3 Select
+// expression over the records, FROM s3object s, naming the fields of the inventory as s.Field, e.g.
+// s.EncryptionStatus. Without Query, the objects matching Unencrypted and OlderThan are counted.
+type InventoryQuery struct {
+	Bucket string
+	// Configuration is the ID of the inventory configuration of the bucket, the first one when empty
+	Configuration string
+	Query         string
+	Unencrypted   bool
+	OlderThan     time.Duration
+}
+
+// inventoryFieldPattern matches the fields of the records in an S3 Select expression
+var inventoryFieldPattern = regexp.MustCompile(`\bs\.([A-Za-z]+)\b`)
+
+// inventoryDestination returns the inventory configuration of a bucket with the ID, the first one when empty.
+func inventoryDestination(c context.Context, api BucketSettingsAPI, bucket string, id string) (types.InventoryConfiguration, error) {
+	input := &s3.ListBucketInventoryConfigurationsInput{Bucket: aws.String(bucket)}
+	var ids []string
+	for {
+		inventories, err := api.ListBucketInventoryConfigurations(c, input)
+		if err != nil {
+			return types.InventoryConfiguration{}, err
+		}
+		for _, inventory := range inventories.InventoryConfigurationList {
+			if inventory.Destination == nil || inventory.Destination.S3BucketDestination == nil {
+				continue
+			}
+			if id == "" || aws.ToString(inventory.Id) == id {
+				return inventory, nil
+			}
+			ids = append(ids, aws.ToString(inventory.Id))
+		}
+		if !aws.ToBool(inventories.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = inventories.NextContinuationToken
+	}
+	if id == "" {
+		return types.InventoryConfiguration{}, fmt.Errorf("bucket %s has no S3 Inventory configured", bucket)
+	}
+	return types.InventoryConfiguration{}, fmt.Errorf("bucket %s has no inventory configuration %q, expected one of: %s", bucket, id, strings.Join(ids, ", "))
+}
+
+// latestInventoryManifest reads the manifest of the latest report of an inventory configuration. The reports
+// are written to <prefix>/<source bucket>/<configuration ID>/<date>/ in the destination bucket.
+func latestInventoryManifest(c context.Context, api S3ClientAPI, bucket string, inventory types.InventoryConfiguration) (*inventoryManifest, error) {
+	destination := inventory.Destination.S3BucketDestination
+	destinationBucket := bucketFromArn(aws.ToString(destination.Bucket))
+	prefix := bucket + "/" + aws.ToString(inventory.Id) + "/"
+	if p := strings.TrimSuffix(aws.ToString(destination.Prefix), "/"); p != "" {
+		prefix = p + "/" + prefix
+	}
+
+	var dates []string
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(destinationBucket), Prefix: aws.String(prefix), Delimiter: aws.String("/")}
+	for {
+		page, err := api.ListObjectsV2(c, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range page.CommonPrefixes {
+			// the data/ and hive/ folders hold the files of every report
+			if folder := aws.ToString(p.Prefix); folder != prefix+"data/" && folder != prefix+"hive/" {
+				dates = append(dates, folder)
+			}
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(dates)))
+
+	// a report still being written has no manifest yet
+	for _, date := range dates {
+		object, err := api.GetObject(c, &s3.GetObjectInput{Bucket: aws.String(destinationBucket), Key: aws.String(date + "manifest.json")})
+		if apiErrorCode(err) == "NoSuchKey" {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var manifest inventoryManifest
+		err = json.NewDecoder(object.Body).Decode(&manifest)
+		object.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("reading the manifest %s: %v", date+"manifest.json", err)
+		}
+		manifest.bucket = destinationBucket
+		manifest.created = strings.TrimSuffix(strings.TrimPrefix(date, prefix), "/")
+		return &manifest, nil
+	}
+	return nil, fmt.Errorf("no inventory report of bucket %s in s3://%s/%s yet", bucket, destinationBucket, prefix)
+}
+
+// fields returns the fields of the records of a report, in the order of the CSV columns.
+func (m *inventoryManifest) fields() []string {
+	var fields []string
+	for _, field := range strings.Split(m.FileSchema, ",") {
+		fields = append(fields, strings.TrimSpace(field))
+	}
+	return fields
+}
+
+// expression rewrites the fields of an S3 Select expression for the format of the report: the CSV files have
+// no header, their fields are the columns s._1, s._2 and so on.
+func (m *inventoryManifest) expression(query string) (string, error) {
+	fields := m.fields()
+	var unknown []string
+	rewritten := inventoryFieldPattern.ReplaceAllStringFunc(query, func(match string) string {
+		name := match[len("s."):]
+		for i, field := range fields {
+			if strings.EqualFold(field, name) {
+				if m.FileFormat == "CSV" {
+					return "s._" + strconv.Itoa(i+1)
+				}
+				return "s." + field
+			}
+		}
+		unknown = append(unknown, name)
+		return match
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown inventory field %s, expected one of: %s", strings.Join(unknown, ", "), strings.Join(fields, ", "))
+	}
+	return rewritten, nil
+}
+
+// selectInventoryFile runs an S3 Select expression over a file of a report and returns the CSV records.
+func selectInventoryFile(c context.Context, api ObjectReaderAPI, m *inventoryManifest, key string, expression string) ([]byte, error) {
+	input := &s3.SelectObjectContentInput{
+		Bucket:              aws.String(m.bucket),
+		Key:                 aws.String(key),
+		Expression:          aws.String(expression),
+		ExpressionType:      types.ExpressionTypeSql,
+		OutputSerialization: &types.OutputSerialization{CSV: &types.CSVOutput{}},
+	}
+	switch m.FileFormat {
+	case "CSV":
+		input.InputSerialization = &types.InputSerialization{
+			CSV:             &types.CSVInput{FileHeaderInfo: types.FileHeaderInfoNone},
+			CompressionType: types.CompressionTypeGzip,
+		}
+	case "Parquet":
+		input.InputSerialization = &types.InputSerialization{Parquet: &types.ParquetInput{}}
+	default:
+		return nil, fmt.Errorf("S3 Select cannot read the %s inventory reports, expected CSV or Parquet", m.FileFormat)
+	}
+
+	output, err := api.SelectObjectContent(c, input)
+	if err != nil {
+		return nil, err
+	}
+	stream := output.GetStream()
+	defer stream.Close()
+	var records bytes.Buffer
+	for event := range stream.Events() {
+		if r, ok := event.(*types.SelectObjectContentEventStreamMemberRecords); ok {
+			records.Write(r.Value.Payload)
+		}
+	}
+	return records.Bytes(), stream.Err()
+}
+
+// countExpression builds the expression counting the objects, and summing their size, matching the filters
+// of a query.
+func (q InventoryQuery) countExpression(now time.Time) string {
+	var conditions []string
+	if q.Unencrypted {
+		conditions = append(conditions, "s.EncryptionStatus = 'NOT-SSE'")
+	}
+	if q.OlderThan > 0 {
+		conditions = append(conditions, fmt.Sprintf("CAST(s.LastModifiedDate AS TIMESTAMP) < CAST('%s' AS TIMESTAMP)",
+			now.Add(-q.OlderThan).UTC().Format(time.RFC3339)))
+	}
+	expression := "SELECT COUNT(*), SUM(CAST(s.Size AS INT)) FROM s3object s"
+	if len(conditions) > 0 {
+		expression += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return expression
+}
+
+// QueryInventory runs a query over the files of the latest S3 Inventory report of a bucket with S3 Select, so
+// only the matching records are downloaded. The records of a custom query are written as S3 Select returns
+// them, file by file; the counts of the filters are summed over the files.
+func QueryInventory(c context.Context, cfg aws.Config, q InventoryQuery, w io.Writer) error {
+	// the destination of an inventory is in the region of its bucket
+	client, _, err := newBucketClient(c, cfg, q.Bucket, "")
+	if err != nil {
+		return err
+	}
+
+	inventory, err := inventoryDestination(c, client, q.Bucket, q.Configuration)
+	if err != nil {
+		return err
+	}
+	manifest, err := latestInventoryManifest(c, client, q.Bucket, inventory)
+	if err != nil {
+		return err
+	}
+
+	query := q.Query
+	if query == "" {
+		query = q.countExpression(time.Now())
+	}
+	expression, err := manifest.expression(query)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Inventory %s of bucket %s, report of %s (%s, %d files)\n", aws.ToString(inventory.Id), q.Bucket, manifest.created,
+		manifest.FileFormat, len(manifest.Files))
+
+	var objects, size int64
+	for _, file := range manifest.Files {
+		records, err := selectInventoryFile(c, client, manifest, file.Key, expression)
+		if err != nil {
+			return fmt.Errorf("querying %s: %v", file.Key, err)
+		}
+		if q.Query != "" {
+			w.Write(records)
+			continue
+		}
+		rows, err := csv.NewReader(bytes.NewReader(records)).ReadAll()
+		if err != nil || len(rows) != 1 || len(rows[0]) != 2 {
+			return fmt.Errorf("querying %s: unexpected result %q", file.Key, records)
+		}
+		count, _ := strconv.ParseInt(rows[0][0], 10, 64)
+		// the sum is empty when no object matches
+		matched, _ := strconv.ParseInt(rows[0][1], 10, 64)
+		objects += count
+		size += matched
+	}
+	if q.Query == "" {
+		fmt.Fprintf(w, "%d matching objects, %.1f GB\n", objects, float64(size)/(1<<30))
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// jiraLabel marks the issues opened by the audit, each issue also carries the label of its finding
+const jiraLabel = "s3audit"
+
+// jiraIssueType is the type of the issues opened by the audit
+const jiraIssueType = "Task"
+
+// remediationInstructions tells how to fix the findings of a check, in the description of their Jira issues
+var remediationInstructions = map[string]string{
+	"access-analyzer":  "Review the external access reported by IAM Access Analyzer, then remove the bucket policy statements or ACL grants that allow it, or archive the Access Analyzer finding if the access is intended.",
+	"access-point":     "Enable Block Public Access on the access point, or remove the public statements from its policy.",
+	"anonymous-access": "Block the public access of the bucket now: enable Block Public Access, then remove the public statements of the bucket policy and the ACL grants to everyone; review the access logs for what was read.",
+	"bucket-key":       "Enable the S3 Bucket Key of the default encryption, or run the audit with -fix enable-bucket-key; the objects written before keep calling KMS until they are copied over.",
+	"bucket-policy":    "Remove the statements of the bucket policy granting access to * principals, or add a condition restricting them, then enable Block Public Access on the bucket.",
+	"cloudfront":       "Run cloudfront oac -bucket <bucket> to switch the distribution to an Origin Access Control on the REST endpoint of the bucket, grant it read access in the bucket policy, then block the public access of the bucket.",
+	"cross-account":    "Confirm the access granted to the external account with its owner, then add the account to -trusted-accounts, or remove it from the bucket policy.",
+	"empty":            "Confirm nothing writes to the bucket anymore, then delete it, or run the audit with -fix delete-empty; add it to -keep-buckets if it is filled on demand.",
+	"encryption":       "Enable default encryption on the bucket, SSE-KMS for sensitive or production data: aws s3api put-bucket-encryption --bucket <bucket> --server-side-encryption-configuration ...",
+	"guardduty":        "Investigate the GuardDuty finding of the bucket, rotate the credentials involved and restrict the bucket policy if data was accessed.",
+	"stale":            "Confirm with the owner of the bucket that its data is no longer used, then archive it to Glacier Deep Archive with a lifecycle rule, or empty and delete the bucket.",
+	"vpc-endpoint":     "Add a statement to the bucket policy denying s3:* to every principal unless aws:SourceVpce or aws:SourceVpc is one of the allowed endpoints or VPCs, and remove the other endpoints from its conditions.",
+	"risk":             "Remove the public access of the bucket first, then enable default encryption; the bucket holds sensitive data.",
+}
+
+// jiraTicket defines the Jira issue of a finding. Its label identifies the finding across the scans.
+type jiraTicket struct {
+	label   string
+	finding finding
+}
+
+// jiraFindingLabel returns the label identifying the issue of a check on a bucket.
+func jiraFindingLabel(check, bucket string) string {
+	return jiraLabel + "-" + check + "-" + bucket
+}
+
+// jiraTickets returns the tickets of the unsuppressed findings that open a Jira issue: the critical ones, and
+// the unencrypted buckets carrying a production tag.
+func jiraTickets(results []BucketResult, findings []finding, production tagMatcher) []jiraTicket {
+	tagged := map[string]bool{}
+	for _, result := range results {
+		if _, ok := production.match(result.bucket.tags); ok {
+			tagged[result.Name] = true
+		}
+	}
+
+	var tickets []jiraTicket
+	seen := map[string]bool{}
+	for _, f := range findings {
+		if f.suppressed != "" || (f.severity < severityCritical && !(f.check == "encryption" && tagged[f.bucket])) {
+			continue
+		}
+		label := jiraFindingLabel(f.check, f.bucket)
+		if !seen[label] {
+			seen[label] = true
+			tickets = append(tickets, jiraTicket{label: label, finding: f})
+		}
+	}
+	return tickets
+}
+
+// jiraClient calls the Jira REST API with basic authentication, a user and an API token
+type jiraClient struct {
+	baseURL string
+	user    string
+	token   string
+	http    *http.Client
+}
+
+// newJiraClient returns a client of the Jira site at baseURL, authenticated with the JIRA_USER and
+// JIRA_API_TOKEN environment variables.
+func newJiraClient(baseURL string) (*jiraClient, error) {
+	user, token := os.Getenv("JIRA_USER"), os.Getenv("JIRA_API_TOKEN")
+	if user == "" || token == "" {
+		return nil, fmt.Errorf("missing the JIRA_USER and JIRA_API_TOKEN environment variables")
+	}
+	return &jiraClient{baseURL: strings.TrimSuffix(baseURL, "/"), user: user, token: token, http: http.DefaultClient}, nil
+}
+
+// do sends a request with a JSON body, when not nil, and decodes the JSON response into out, when not nil.
+func (j *jiraClient) do(c context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(c, method, j.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(j.user, j.token)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := j.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// openIssues returns the keys of the unresolved issues of the project opened by the audit, by the label of
+// their finding.
+func (j *jiraClient) openIssues(c context.Context, project string) (map[string]string, error) {
+	jql := fmt.Sprintf(`project = "%s" AND labels = %s AND statusCategory != Done`, project, jiraLabel)
+	issues := map[string]string{}
+	for start := 0; ; {
+		var page struct {
+			Total  int `json:"total"`
+			Issues []struct {
+				Key    string `json:"key"`
+				Fields struct {
+					Labels []string `json:"labels"`
+				} `json:"fields"`
+			} `json:"issues"`
+		}
+		query := url.Values{"jql": {jql}, "fields": {"labels"}, "startAt": {fmt.Sprint(start)}, "maxResults": {"100"}}
+		if err := j.do(c, http.MethodGet, "/rest/api/2/search?"+query.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		for _, issue := range page.Issues {
+			for _, label := range issue.Fields.Labels {
+				if strings.HasPrefix(label, jiraLabel+"-") {
+					issues[label] = issue.Key
+				}
+			}
+		}
+		start += len(page.Issues)
+		if len(page.Issues) == 0 || start >= page.Total {
+			return issues, nil
+		}
+	}
+}
+
+// createIssue opens the issue of a ticket and returns its key.
+func (j *jiraClient) createIssue(c context.Context, project string, ticket jiraTicket) (string, error) {
+	f := ticket.finding
+	instructions, ok := remediationInstructions[f.check]
+	if !ok {
+		instructions = "Fix the configuration of the bucket reported by the finding, then run the audit again."
+	}
+	description := fmt.Sprintf("The S3 audit reported a %s finding of the %s check on bucket %s:\n\n%s\n\nh3. Remediation\n%s\n\n"+
+		"This issue is closed automatically once the finding disappears.", f.severity, f.check, f.bucket, f.message, instructions)
+
+	body := map[string]interface{}{
+		"fields": map[string]interface{}{
+			"project":     map[string]string{"key": project},
+			"issuetype":   map[string]string{"name": jiraIssueType},
+			"summary":     fmt.Sprintf("S3 bucket %s: %s", f.bucket, f.message),
+			"description": description,
+			"labels":      []string{jiraLabel, ticket.label},
+		},
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	if err := j.do(c, http.MethodPost, "/rest/api/2/issue", body, &created); err != nil {
+		return "", err
+	}
+	return created.Key, nil
+}
+
+// closeIssue moves an issue to the first transition into a done status, with a comment.
+func (j *jiraClient) closeIssue(c context.Context, key string) error {
+	var transitions struct {
+		Transitions []struct {
+			ID string `json:"id"`
+			To struct {
+				StatusCategory struct {
+					Key string `json:"key"`
+				} `json:"statusCategory"`
+			} `json:"to"`
+		} `json:"transitions"`
+	}
+	if err := j.do(c, http.MethodGet, "/rest/api/2/issue/"+key+"/transitions", nil, &transitions); err != nil {
+		return err
+	}
+	for _, t := range transitions.Transitions {
+		if t.To.StatusCategory.Key != "done" {
+			continue
+		}
+		body := map[string]interface{}{
+			"transition": map[string]string{"id": t.ID},
+			"update": map[string]interface{}{
+				"comment": []interface{}{map[string]interface{}{"add": map[string]string{"body": "The S3 audit no longer reports this finding."}}},
+			},
+		}
+		return j.do(c, http.MethodPost, "/rest/api/2/issue/"+key+"/transitions", body, nil)
+	}
+	return fmt.Errorf("no transition of issue %s leads to a done status", key)
+}
+
+// syncJira opens an issue for each ticket without an open issue, and closes the open issues of the findings
+// that disappeared. Only the issues of the labels in covered, the findings the scan could report, are closed,
+// so the issues of the buckets left out of a scan stay open. With dryRun the changes are only printed.
+func syncJira(c context.Context, j *jiraClient, project string, tickets []jiraTicket, covered map[string]bool, dryRun bool) error {
+	open, err := j.openIssues(c, project)
+	if err != nil {
+		return fmt.Errorf("searching the open issues: %v", err)
+	}
+
+	current := map[string]bool{}
+	var created, closed int
+	for _, ticket := range tickets {
+		current[ticket.label] = true
+		if key, ok := open[ticket.label]; ok {
+			fmt.Printf("Jira issue %s already tracks %s on bucket %s\n", key, ticket.finding.check, ticket.finding.bucket)
+			continue
+		}
+		if dryRun {
+			fmt.Printf("Would open a Jira issue for %s on bucket %s\n", ticket.finding.check, ticket.finding.bucket)
+			continue
+		}
+		key, err := j.createIssue(c, project, ticket)
+		if err != nil {
+			return fmt.Errorf("opening the issue of %s on bucket %s: %v", ticket.finding.check, ticket.finding.bucket, err)
+		}
+		fmt.Printf("Opened Jira issue %s for %s on bucket %s\n", key, ticket.finding.check, ticket.finding.bucket)
+		created++
+	}
+	for label, key := range open {
+		if current[label] || !covered[label] {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("Would close Jira issue %s, its finding disappeared\n", key)
+			continue
+		}
+		if err := j.closeIssue(c, key); err != nil {
+			return fmt.Errorf("closing issue %s: %v", key, err)
+		}
+		fmt.Printf("Closed Jira issue %s, its finding disappeared\n", key)
+		closed++
+	}
+
+	fmt.Printf("%d issue(s) opened, %d closed\n", created, closed)
+	return nil
+}
@@ -0,0 +1,256 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KMSDescribeKeyApi defines the interface for the DescribeKey function.
+// We use this interface to test the function using a mocked service.
+type KMSDescribeKeyApi interface {
+	DescribeKey(ctx context.Context,
+		params *kms.DescribeKeyInput,
+		optFns ...func(*kms.Options)) (*kms.DescribeKeyOutput, error)
+}
+
+// KMSGetKeyRotationStatusApi defines the interface for the GetKeyRotationStatus function.
+// We use this interface to test the function using a mocked service.
+type KMSGetKeyRotationStatusApi interface {
+	GetKeyRotationStatus(ctx context.Context,
+		params *kms.GetKeyRotationStatusInput,
+		optFns ...func(*kms.Options)) (*kms.GetKeyRotationStatusOutput, error)
+}
+
+// KMSGetKeyPolicyApi defines the interface for the GetKeyPolicy function.
+// We use this interface to test the function using a mocked service.
+type KMSGetKeyPolicyApi interface {
+	GetKeyPolicy(ctx context.Context,
+		params *kms.GetKeyPolicyInput,
+		optFns ...func(*kms.Options)) (*kms.GetKeyPolicyOutput, error)
+}
+
+// KMSListAliasesApi defines the interface for the ListAliases function.
+// We use this interface to test the function using a mocked service.
+type KMSListAliasesApi interface {
+	ListAliases(ctx context.Context,
+		params *kms.ListAliasesInput,
+		optFns ...func(*kms.Options)) (*kms.ListAliasesOutput, error)
+}
+
+// kmsKeyApi groups the KMS calls of the key-usage matrix.
+type kmsKeyApi interface {
+	KMSDescribeKeyApi
+	KMSGetKeyRotationStatusApi
+	KMSGetKeyPolicyApi
+}
+
+// DescribeKey returns the metadata of a KMS key, given as a key ID, a key ARN, an alias or an alias ARN.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a DescribeKeyOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to DescribeKey.
+func DescribeKey(c context.Context, api KMSDescribeKeyApi, input *kms.DescribeKeyInput) (*kms.DescribeKeyOutput, error) {
+	return api.DescribeKey(c, input)
+}
+
+// GetKeyRotationStatus returns whether the automatic rotation of a KMS key is enabled.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetKeyRotationStatusOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetKeyRotationStatus.
+func GetKeyRotationStatus(c context.Context, api KMSGetKeyRotationStatusApi, input *kms.GetKeyRotationStatusInput) (*kms.GetKeyRotationStatusOutput, error) {
+	return api.GetKeyRotationStatus(c, input)
+}
+
+// GetKeyPolicy returns a policy of a KMS key, a key only has the default one.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetKeyPolicyOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetKeyPolicy.
+func GetKeyPolicy(c context.Context, api KMSGetKeyPolicyApi, input *kms.GetKeyPolicyInput) (*kms.GetKeyPolicyOutput, error) {
+	return api.GetKeyPolicy(c, input)
+}
+
+// ListAliases returns the aliases of the account and region, or the ones of a key when the input names it.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListAliasesOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListAliases.
+func ListAliases(c context.Context, api KMSListAliasesApi, input *kms.ListAliasesInput) (*kms.ListAliasesOutput, error) {
+	return api.ListAliases(c, input)
+}
+
+// newKMSClient returns a KMS client for a region.
+func newKMSClient(cfg aws.Config, region string) *kms.Client {
+	return kms.NewFromConfig(cfg, func(options *kms.Options) {
+		options.Region = region
+	})
+}
+
+// ReportKMSKey is a KMS key of the key-usage matrix, with the buckets encrypted with it by default.
+type ReportKMSKey struct {
+	// Key is the ARN of the key, or the key as configured on the buckets when it could not be described
+	Key    string `json:"key"`
+	Region string `json:"region"`
+	// Manager is AWS for the AWS managed keys, e.g. aws/s3, and CUSTOMER for the customer managed keys
+	Manager string   `json:"manager,omitempty"`
+	Buckets []string `json:"buckets"`
+	// Rotation is true when the automatic rotation of the key is enabled, absent when it could not be read
+	Rotation *bool `json:"rotation,omitempty"`
+	// Principals is the number of principals the key policy grants access to, absent when it could not be
+	// read
+	Principals *int `json:"principals,omitempty"`
+	// Error describes the calls that failed, e.g. "policy: access denied"
+	Error string `json:"error,omitempty"`
+}
+
+// bucketKMSKey returns the KMS key a bucket encrypts with by default, as configured, and whether it uses
+// KMS. The AWS managed key aws/s3 is used when the configuration names none.
+func bucketKMSKey(b s3Bucket) (string, bool) {
+	if b.encryptionState != encryptionConfigured || !strings.HasPrefix(encryptionAlgorithm(b), "aws:kms") {
+		return "", false
+	}
+	if key := encryptionKeyID(b); key != "" {
+		return key, true
+	}
+	return "alias/aws/s3", true
+}
+
+// kmsKeyRegion returns the region of a key given as an ARN, or region for a key ID or an alias name.
+func kmsKeyRegion(key string, region string) string {
+	if parts := strings.Split(key, ":"); strings.HasPrefix(key, "arn:") && len(parts) > 3 {
+		return parts[3]
+	}
+	return region
+}
+
+// kmsKeyMatrix pivots the buckets by their default KMS key: the keys, configured as ARNs, IDs or aliases,
+// are described to group the buckets by key ARN, then the rotation and the policy of each key are read.
+// The buckets restored from a checkpoint are left out, their encryption was not kept. newClient returns the
+// KMS client of a region.
+func kmsKeyMatrix(c context.Context, results []BucketResult, newClient func(region string) kmsKeyApi) []ReportKMSKey {
+	keys := map[string]*ReportKMSKey{}
+	// described holds the ARN of the keys already described by their region and configured value
+	described := map[string]string{}
+	for _, result := range results {
+		if result.restored {
+			continue
+		}
+		configured, ok := bucketKMSKey(result.bucket)
+		if !ok {
+			continue
+		}
+		region := kmsKeyRegion(configured, result.Region)
+		lookup := region + "/" + configured
+
+		arn, ok := described[lookup]
+		if !ok {
+			arn = configured
+			output, err := DescribeKey(c, newClient(region), &kms.DescribeKeyInput{KeyId: aws.String(configured)})
+			if err == nil && output.KeyMetadata != nil {
+				arn = aws.ToString(output.KeyMetadata.Arn)
+				if keys[arn] == nil {
+					keys[arn] = &ReportKMSKey{Key: arn, Region: region, Manager: string(output.KeyMetadata.KeyManager)}
+				}
+			} else if keys[arn] == nil {
+				keys[arn] = &ReportKMSKey{Key: arn, Region: region, Error: fmt.Sprintf("key: %s", errorKind(classifyError(err)))}
+			}
+			described[lookup] = arn
+		}
+		keys[arn].Buckets = append(keys[arn].Buckets, result.Name)
+	}
+
+	var matrix []ReportKMSKey
+	for _, key := range keys {
+		if key.Error == "" {
+			var failures []string
+			api := newClient(key.Region)
+			rotation, err := GetKeyRotationStatus(c, api, &kms.GetKeyRotationStatusInput{KeyId: aws.String(key.Key)})
+			if err != nil {
+				failures = append(failures, "rotation: "+errorKind(classifyError(err)))
+			} else {
+				key.Rotation = aws.Bool(rotation.KeyRotationEnabled)
+			}
+			policy, err := GetKeyPolicy(c, api, &kms.GetKeyPolicyInput{KeyId: aws.String(key.Key), PolicyName: aws.String("default")})
+			if err == nil {
+				var document *policyDocument
+				if document, err = parsePolicy(aws.ToString(policy.Policy)); err == nil {
+					count := policyPrincipalCount(document)
+					key.Principals = &count
+				}
+			}
+			if err != nil {
+				failures = append(failures, "policy: "+errorKind(classifyError(err)))
+			}
+			key.Error = strings.Join(failures, ", ")
+		}
+		sort.Strings(key.Buckets)
+		matrix = append(matrix, *key)
+	}
+	// the keys shared by the most buckets first
+	sort.Slice(matrix, func(i, j int) bool {
+		if len(matrix[i].Buckets) != len(matrix[j].Buckets) {
+			return len(matrix[i].Buckets) > len(matrix[j].Buckets)
+		}
+		return matrix[i].Key < matrix[j].Key
+	})
+	return matrix
+}
+
+// policyPrincipalCount returns the number of distinct principals the Allow statements of a policy grant
+// access to.
+func policyPrincipalCount(document *policyDocument) int {
+	principals := map[string]bool{}
+	for _, statement := range document.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for principalType, values := range statement.principals() {
+			for _, value := range values {
+				principals[principalType+"/"+value] = true
+			}
+		}
+	}
+	return len(principals)
+}
+
+// printKMSKeyMatrix prints the KMS keys with the buckets encrypted with each of them.
+func printKMSKeyMatrix(matrix []ReportKMSKey) {
+	fmt.Println("\nKMS keys:")
+	if len(matrix) == 0 {
+		fmt.Println("\tno bucket is encrypted with KMS by default")
+		return
+	}
+	t := newTable(false, column{header: "KEY"}, column{header: "MANAGER"}, column{header: "ROTATION"}, column{header: "PRINCIPALS"},
+		column{header: "BUCKETS"}, column{header: "NAMES", max: 60}, column{header: "ERROR"})
+	for _, key := range matrix {
+		rotation, principals := "unknown", "unknown"
+		if key.Rotation != nil {
+			rotation = strconv.FormatBool(*key.Rotation)
+		}
+		if key.Principals != nil {
+			principals = strconv.Itoa(*key.Principals)
+		}
+		t.add(cell{text: key.Key}, cell{text: key.Manager}, cell{text: rotation}, cell{text: principals},
+			cell{text: strconv.Itoa(len(key.Buckets))}, cell{text: strings.Join(key.Buckets, ", ")}, cell{text: key.Error})
+	}
+	t.write(os.Stdout)
+}
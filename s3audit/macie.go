@@ -0,0 +1,175 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/macie2"
+	"github.com/aws/aws-sdk-go-v2/service/macie2/types"
+	"sort"
+	"strings"
+)
+
+// Macie2GetMacieSessionApi defines the interface for the GetMacieSession function.
+// We use this interface to test the function using a mocked service.
+type Macie2GetMacieSessionApi interface {
+	GetMacieSession(ctx context.Context,
+		params *macie2.GetMacieSessionInput,
+		optFns ...func(*macie2.Options)) (*macie2.GetMacieSessionOutput, error)
+}
+
+// Macie2ListFindingsApi defines the interface for the ListFindings function.
+// We use this interface to test the function using a mocked service.
+type Macie2ListFindingsApi interface {
+	ListFindings(ctx context.Context,
+		params *macie2.ListFindingsInput,
+		optFns ...func(*macie2.Options)) (*macie2.ListFindingsOutput, error)
+}
+
+// Macie2GetFindingsApi defines the interface for the GetFindings function.
+// We use this interface to test the function using a mocked service.
+type Macie2GetFindingsApi interface {
+	GetFindings(ctx context.Context,
+		params *macie2.GetFindingsInput,
+		optFns ...func(*macie2.Options)) (*macie2.GetFindingsOutput, error)
+}
+
+// macieApi groups the Macie calls needed to read the sensitive data discovered in the buckets of a region.
+type macieApi interface {
+	Macie2GetMacieSessionApi
+	Macie2ListFindingsApi
+	Macie2GetFindingsApi
+}
+
+// GetMacieSession retrieves the status and configuration of Macie in a region.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetMacieSessionOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetMacieSession.
+func GetMacieSession(c context.Context, api Macie2GetMacieSessionApi, input *macie2.GetMacieSessionInput) (*macie2.GetMacieSessionOutput, error) {
+	return api.GetMacieSession(c, input)
+}
+
+// ListMacieFindings retrieves the IDs of the Macie findings matching a criteria.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListFindings.
+func ListMacieFindings(c context.Context, api Macie2ListFindingsApi, input *macie2.ListFindingsInput) (*macie2.ListFindingsOutput, error) {
+	return api.ListFindings(c, input)
+}
+
+// GetMacieFindings retrieves the details of up to 50 Macie findings.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetFindings.
+func GetMacieFindings(c context.Context, api Macie2GetFindingsApi, input *macie2.GetFindingsInput) (*macie2.GetFindingsOutput, error) {
+	return api.GetFindings(c, input)
+}
+
+// getSensitiveData reads the unarchived classification findings of Macie in a region and returns, keyed by
+// bucket name, the number of occurrences of each category of sensitive data detected in the bucket. A nil map
+// is returned when Macie is not enabled in the region.
+func getSensitiveData(c context.Context, api macieApi) (map[string]map[string]int64, error) {
+	session, err := GetMacieSession(c, api, &macie2.GetMacieSessionInput{})
+	if apiErrorCode(err) == "AccessDeniedException" {
+		// Macie answers AccessDenied in the regions where it is not enabled
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != types.MacieStatusEnabled {
+		return nil, nil
+	}
+
+	detected := map[string]map[string]int64{}
+	input := &macie2.ListFindingsInput{
+		FindingCriteria: &types.FindingCriteria{Criterion: map[string]types.CriterionAdditionalProperties{
+			"category": {Eq: []string{string(types.FindingCategoryClassification)}},
+			"archived": {Eq: []string{"false"}},
+		}},
+		// GetFindings accepts at most 50 IDs, one page of IDs is fetched with a single call
+		MaxResults: aws.Int32(50),
+	}
+	for {
+		list, err := ListMacieFindings(c, api, input)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(list.FindingIds) > 0 {
+			details, err := GetMacieFindings(c, api, &macie2.GetFindingsInput{FindingIds: list.FindingIds})
+			if err != nil {
+				return nil, err
+			}
+			for _, f := range details.Findings {
+				if f.ResourcesAffected == nil || f.ResourcesAffected.S3Bucket == nil || f.ClassificationDetails == nil || f.ClassificationDetails.Result == nil {
+					continue
+				}
+				bucket := aws.ToString(f.ResourcesAffected.S3Bucket.Name)
+				if detected[bucket] == nil {
+					detected[bucket] = map[string]int64{}
+				}
+				for _, item := range f.ClassificationDetails.Result.SensitiveData {
+					detected[bucket][string(item.Category)] += aws.ToInt64(item.TotalCount)
+				}
+			}
+		}
+
+		if list.NextToken == nil {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+
+	return detected, nil
+}
+
+// sensitiveCategories returns the sorted categories of sensitive data detected in a bucket.
+func sensitiveCategories(b s3Bucket) []string {
+	var categories []string
+	for category := range b.sensitiveData {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// raiseSensitiveFindings raises by one level the severity of the public exposure and encryption findings of a
+// bucket in which Macie detected sensitive data.
+func raiseSensitiveFindings(findings []finding, b s3Bucket) {
+	if len(b.sensitiveData) == 0 {
+		return
+	}
+	categories := strings.Join(sensitiveCategories(b), ",")
+
+	for i, f := range findings {
+		switch f.check {
+		case "bucket-policy", "access-analyzer", "access-point", "encryption":
+		default:
+			continue
+		}
+		if f.severity < severityCritical {
+			findings[i].severity++
+		}
+		findings[i].message = fmt.Sprintf("%s; Macie detected %s in the bucket", f.message, categories)
+	}
+}
+
+// printSensitiveData prints the sensitive data Macie detected in a bucket below its report line.
+func printSensitiveData(b s3Bucket) {
+	for _, category := range sensitiveCategories(b) {
+		fmt.Printf("\tSensitive data: %s\t Occurrences: %d\n", category, b.sensitiveData[category])
+	}
+}
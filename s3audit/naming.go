@@ -0,0 +1,75 @@
+package s3audit
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// namingRules defines the governance rules every bucket must follow: a name pattern and required tags.
+// A nil pattern and an empty tag matcher disable the respective rule.
+type namingRules struct {
+	pattern      *regexp.Regexp
+	requiredTags tagMatcher
+}
+
+// parseRequiredTags reads a comma separated list of tags every bucket must carry. An entry is either a key,
+// which any value satisfies, or a key=value pair requiring that value.
+func parseRequiredTags(value string) (tagMatcher, error) {
+	var pairs []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "=") {
+			entry += "=*"
+		}
+		pairs = append(pairs, entry)
+	}
+	return parseTagMatcher(strings.Join(pairs, ","))
+}
+
+// missingTags returns the sorted required tags of m a bucket does not carry, formatted as key or key=value.
+func (m tagMatcher) missingTags(tags map[string]string) []string {
+	var missing []string
+	for key, want := range m {
+		value, ok := tags[key]
+		if ok && (want == "*" || strings.EqualFold(value, want)) {
+			continue
+		}
+		if want == "*" {
+			missing = append(missing, key)
+		} else {
+			missing = append(missing, key+"="+want)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// namingFindings flags a bucket whose name does not match the naming pattern or that lacks required tags. The
+// tags are only checked when they could be read, tagsRead.
+func namingFindings(b s3Bucket, rules namingRules, tagsRead bool) []finding {
+	var findings []finding
+
+	if rules.pattern != nil && !rules.pattern.MatchString(b.name) {
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "naming",
+			severity: severityLow,
+			message:  fmt.Sprintf("bucket name does not match %s", rules.pattern),
+		})
+	}
+
+	if missing := rules.requiredTags.missingTags(b.tags); tagsRead && len(missing) > 0 {
+		findings = append(findings, finding{
+			bucket:   b.name,
+			check:    "required-tags",
+			severity: severityLow,
+			message:  fmt.Sprintf("bucket is missing required tag(s) %s", strings.Join(missing, ",")),
+		})
+	}
+
+	return findings
+}
@@ -0,0 +1,143 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"strings"
+)
+
+// LambdaGetFunctionApi defines the interface for the GetFunction function.
+// We use this interface to test the function using a mocked service.
+type LambdaGetFunctionApi interface {
+	GetFunction(ctx context.Context,
+		params *lambda.GetFunctionInput,
+		optFns ...func(*lambda.Options)) (*lambda.GetFunctionOutput, error)
+}
+
+// notificationTarget defines a destination a bucket sends event notifications to
+type notificationTarget struct {
+	service      string
+	arn          string
+	events       []string
+	crossAccount bool
+	missing      bool
+}
+
+// GetFunction returns information about a Lambda function.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetFunctionOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetFunction.
+func GetFunction(c context.Context, api LambdaGetFunctionApi, input *lambda.GetFunctionInput) (*lambda.GetFunctionOutput, error) {
+	return api.GetFunction(c, input)
+}
+
+// getNotificationTargets lists the Lambda functions, SQS queues, SNS topics and EventBridge bus a bucket
+// sends its event notifications to, and marks the targets owned by an account other than accountID.
+func getNotificationTargets(c context.Context, api BucketSettingsAPI, accountID string, bucket string) ([]notificationTarget, error) {
+	notifications, err := api.GetBucketNotificationConfiguration(c, &s3.GetBucketNotificationConfigurationInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var targets []notificationTarget
+	for _, n := range notifications.LambdaFunctionConfigurations {
+		targets = append(targets, newNotificationTarget("lambda", aws.ToString(n.LambdaFunctionArn), n.Events, accountID))
+	}
+	for _, n := range notifications.QueueConfigurations {
+		targets = append(targets, newNotificationTarget("sqs", aws.ToString(n.QueueArn), n.Events, accountID))
+	}
+	for _, n := range notifications.TopicConfigurations {
+		targets = append(targets, newNotificationTarget("sns", aws.ToString(n.TopicArn), n.Events, accountID))
+	}
+	if notifications.EventBridgeConfiguration != nil {
+		targets = append(targets, notificationTarget{service: "eventbridge", arn: "default event bus", events: []string{"*"}})
+	}
+
+	return targets, nil
+}
+
+// newNotificationTarget builds a notificationTarget, comparing the account of its ARN with accountID.
+func newNotificationTarget(service string, targetArn string, events []types.Event, accountID string) notificationTarget {
+	t := notificationTarget{service: service, arn: targetArn}
+	for _, event := range events {
+		t.events = append(t.events, string(event))
+	}
+	if parsed, err := arn.Parse(targetArn); err == nil {
+		t.crossAccount = parsed.AccountID != accountID
+	}
+	return t
+}
+
+// checkLambdaTargets looks up the Lambda functions of the account the bucket fires to and marks those that
+// no longer exist. Functions of other accounts cannot be looked up and are left as they are.
+func checkLambdaTargets(c context.Context, cfg aws.Config, targets []notificationTarget) error {
+	for i, t := range targets {
+		if t.service != "lambda" || t.crossAccount {
+			continue
+		}
+		parsed, err := arn.Parse(t.arn)
+		if err != nil {
+			continue
+		}
+
+		client := lambda.NewFromConfig(cfg, func(options *lambda.Options) {
+			options.Region = parsed.Region
+		})
+		_, err = GetFunction(c, client, &lambda.GetFunctionInput{FunctionName: aws.String(t.arn)})
+		if apiErrorCode(err) == "ResourceNotFoundException" {
+			targets[i].missing = true
+		} else if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notificationFindings flags notification targets in other accounts and Lambda functions that were deleted.
+func notificationFindings(bucket string, targets []notificationTarget) []finding {
+	var findings []finding
+	for _, t := range targets {
+		if t.missing {
+			findings = append(findings, finding{
+				bucket:   bucket,
+				check:    "notification",
+				severity: severityMedium,
+				message:  fmt.Sprintf("notifications fire to deleted Lambda function %s", t.arn),
+			})
+		}
+		if t.crossAccount {
+			findings = append(findings, finding{
+				bucket:   bucket,
+				check:    "notification",
+				severity: severityMedium,
+				message:  fmt.Sprintf("notifications send object events to %s %s in another account", t.service, t.arn),
+			})
+		}
+	}
+	return findings
+}
+
+// printNotificationTargets prints the notification targets of a bucket below its report line.
+func printNotificationTargets(targets []notificationTarget) {
+	for _, t := range targets {
+		var flags string
+		if t.crossAccount {
+			flags += " [cross-account]"
+		}
+		if t.missing {
+			flags += " [deleted]"
+		}
+		fmt.Printf("\tNotification: %s -> %s\t Events: %s%s\n", t.service, t.arn, strings.Join(t.events, ","), flags)
+	}
+}
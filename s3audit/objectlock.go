@@ -0,0 +1,217 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// objectVersion is an object version listed for the Object Lock sweep.
+type objectVersion struct {
+	key       string
+	versionID string
+	size      int64
+}
+
+// objectLockSummary sums the locked object versions of a bucket. The counts are the ones of the versions read,
+// when only a sample of them is read the locked bytes are extrapolated from the sample to every version.
+type objectLockSummary struct {
+	bucket string
+	region string
+	// defaultRetention describes the default retention of the bucket, e.g. COMPLIANCE 365d, or none
+	defaultRetention string
+	versions         int
+	bytes            int64
+	sampled          int
+	locked           int
+	lockedBytes      int64
+	legalHolds       int
+	// until holds the bytes locked until each quarter, e.g. 2027-Q1, by retention or legal hold
+	until map[string]int64
+	// latest is the latest retain-until date of the sampled versions
+	latest time.Time
+}
+
+// formatDefaultRetention describes the default retention of an Object Lock configuration.
+func formatDefaultRetention(configuration *types.ObjectLockConfiguration) string {
+	if configuration == nil || configuration.Rule == nil || configuration.Rule.DefaultRetention == nil {
+		return "none"
+	}
+	retention := configuration.Rule.DefaultRetention
+	if retention.Years != nil {
+		return fmt.Sprintf("%s %dy", retention.Mode, aws.ToInt32(retention.Years))
+	}
+	return fmt.Sprintf("%s %dd", retention.Mode, aws.ToInt32(retention.Days))
+}
+
+// listObjectVersions lists every version of a bucket, the delete markers aside since they hold no data.
+func listObjectVersions(c context.Context, api ObjectReaderAPI, bucket string) ([]objectVersion, error) {
+	var versions []objectVersion
+	input := &s3.ListObjectVersionsInput{Bucket: aws.String(bucket)}
+	for {
+		page, err := api.ListObjectVersions(c, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range page.Versions {
+			versions = append(versions, objectVersion{key: aws.ToString(v.Key), versionID: aws.ToString(v.VersionId), size: aws.ToInt64(v.Size)})
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		input.KeyMarker, input.VersionIdMarker = page.NextKeyMarker, page.NextVersionIdMarker
+	}
+	return versions, nil
+}
+
+// quarter names the quarter of a date, e.g. 2027-Q1.
+func quarter(t time.Time) string {
+	return fmt.Sprintf("%d-Q%d", t.Year(), (int(t.Month())-1)/3+1)
+}
+
+// sweepObjectLock reads the retention and the legal hold of the versions of a bucket, every version or an
+// evenly spaced sample of them. A version under a legal hold without retention is locked "until released".
+func sweepObjectLock(c context.Context, api ObjectReaderAPI, summary *objectLockSummary, versions []objectVersion, sample int, now time.Time) {
+	step := 1
+	if sample > 0 && len(versions) > sample {
+		step = (len(versions) + sample - 1) / sample
+	}
+	var sampledBytes, lockedBytes int64
+	until := map[string]int64{}
+	for i := 0; i < len(versions); i += step {
+		v := versions[i]
+		head, err := api.HeadObject(c, &s3.HeadObjectInput{Bucket: aws.String(summary.bucket), Key: aws.String(v.key), VersionId: aws.String(v.versionID)})
+		if err != nil {
+			log.Printf("Got an error reading the lock of object %v in bucket %v: %v", v.key, summary.bucket, err)
+			continue
+		}
+		summary.sampled++
+		sampledBytes += v.size
+
+		retainUntil := aws.ToTime(head.ObjectLockRetainUntilDate)
+		retained := head.ObjectLockMode != "" && retainUntil.After(now)
+		held := head.ObjectLockLegalHoldStatus == types.ObjectLockLegalHoldStatusOn
+		if held {
+			summary.legalHolds++
+		}
+		if !retained && !held {
+			continue
+		}
+		summary.locked++
+		lockedBytes += v.size
+		if held {
+			until["until released"] += v.size
+		} else {
+			until[quarter(retainUntil)] += v.size
+		}
+		if retained && retainUntil.After(summary.latest) {
+			summary.latest = retainUntil
+		}
+	}
+
+	// the sample stands for every version, in proportion of the bytes read
+	scale := 1.0
+	if sampledBytes > 0 && summary.sampled < len(versions) {
+		scale = float64(summary.bytes) / float64(sampledBytes)
+	}
+	summary.lockedBytes = int64(float64(lockedBytes) * scale)
+	for q, bytes := range until {
+		summary.until[q] += int64(float64(bytes) * scale)
+	}
+}
+
+// ObjectLockSweep lists the Object Lock buckets matching the bucket patterns, all of them when empty, and writes
+// how much of their data is locked by retention or legal hold and until when. With sample, only that many
+// object versions per bucket are read and the totals are extrapolated from them, as reading every version
+// costs a request per version.
+func ObjectLockSweep(c context.Context, cfg aws.Config, buckets string, sample int, w io.Writer) error {
+	matched, err := matchBuckets(c, cfg, buckets)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var summaries []*objectLockSummary
+	for _, bucket := range matched {
+		lock, err := bucket.client.GetObjectLockConfiguration(c, &s3.GetObjectLockConfigurationInput{Bucket: aws.String(bucket.name)})
+		if apiErrorCode(err) == "ObjectLockConfigurationNotFoundError" {
+			continue
+		}
+		if err != nil {
+			log.Printf("Got an error retrieving the Object Lock configuration of bucket %v: %v", bucket.name, err)
+			continue
+		}
+
+		versions, err := listObjectVersions(c, bucket.client, bucket.name)
+		if err != nil {
+			log.Printf("Got an error listing the objects of bucket %v: %v", bucket.name, err)
+			continue
+		}
+		summary := &objectLockSummary{bucket: bucket.name, region: bucket.region, defaultRetention: formatDefaultRetention(lock.ObjectLockConfiguration),
+			versions: len(versions), until: map[string]int64{}}
+		for _, v := range versions {
+			summary.bytes += v.size
+		}
+		sweepObjectLock(c, bucket.client, summary, versions, sample, now)
+		summaries = append(summaries, summary)
+	}
+
+	writeObjectLockSweep(w, summaries, now)
+	return nil
+}
+
+// writeObjectLockSweep writes the locked data of each Object Lock bucket, then the locked data of every bucket
+// by the quarter it is locked until.
+func writeObjectLockSweep(w io.Writer, summaries []*objectLockSummary, now time.Time) {
+	fmt.Fprintf(w, "Object Lock sweep of %s\n\n", now.Format("2006-01-02"))
+	if len(summaries) == 0 {
+		fmt.Fprintln(w, "No Object Lock bucket")
+		return
+	}
+
+	t := newTable(false, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "DEFAULT RETENTION"}, column{header: "VERSIONS"},
+		column{header: "READ"}, column{header: "LOCKED"}, column{header: "LOCKED GB"}, column{header: "LEGAL HOLDS"}, column{header: "LOCKED UNTIL"})
+	total := map[string]int64{}
+	estimated := false
+	for _, s := range summaries {
+		latest := "-"
+		if !s.latest.IsZero() {
+			latest = s.latest.Format("2006-01-02")
+		}
+		read := strconv.Itoa(s.sampled)
+		if s.sampled < s.versions {
+			read += " (sample)"
+			estimated = true
+		}
+		t.add(cell{text: s.bucket}, cell{text: s.region}, cell{text: s.defaultRetention}, cell{text: strconv.Itoa(s.versions)},
+			cell{text: read}, cell{text: strconv.Itoa(s.locked)}, cell{text: fmt.Sprintf("%.1f", float64(s.lockedBytes)/(1<<30))},
+			cell{text: strconv.Itoa(s.legalHolds)}, cell{text: latest})
+		for q, bytes := range s.until {
+			total[q] += bytes
+		}
+	}
+	t.write(w)
+
+	fmt.Fprintln(w, "\nLocked data by quarter of release:")
+	var quarters []string
+	for q := range total {
+		quarters = append(quarters, q)
+	}
+	// "until released" sorts after the quarters
+	sort.Strings(quarters)
+	byQuarter := newTable(false, column{header: "UNTIL"}, column{header: "GB"})
+	for _, name := range quarters {
+		byQuarter.add(cell{text: name}, cell{text: fmt.Sprintf("%.1f", float64(total[name])/(1<<30))})
+	}
+	byQuarter.write(w)
+	if estimated {
+		fmt.Fprintln(w, "\nThe locked data of the sampled buckets is extrapolated from the versions read")
+	}
+}
@@ -0,0 +1,126 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"sort"
+	"time"
+)
+
+// maxScannedObjects is the number of objects listed per bucket at most by the object scan
+const maxScannedObjects = 1000000
+
+// coldStandardAge is the age from which the Standard objects are counted as cold, they could have
+// transitioned to Standard-IA or Glacier
+const coldStandardAge = 90 * 24 * time.Hour
+
+// storageClassUsage sums the objects of a storage class. coldBytes are the bytes of the Standard objects
+// not modified for coldStandardAge.
+type storageClassUsage struct {
+	objects   int
+	bytes     int64
+	coldBytes int64
+}
+
+// largeObject is one of the largest objects of a bucket.
+type largeObject struct {
+	key          string
+	size         int64
+	storageClass string
+	lastModified time.Time
+}
+
+// objectStats is the breakdown of the objects of a bucket read by the object scan, by storage class, with its
+// largest objects. truncated is true when the bucket holds more than maxScannedObjects.
+type objectStats struct {
+	classes   map[string]*storageClassUsage
+	largest   []largeObject
+	truncated bool
+}
+
+// scanObjects lists the objects of a bucket for their storage class breakdown and the top largest of them.
+func scanObjects(c context.Context, api ObjectReaderAPI, bucket string, top int, now time.Time) (*objectStats, error) {
+	stats := &objectStats{classes: map[string]*storageClassUsage{}}
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket)}
+	listed := 0
+	for {
+		page, err := api.ListObjectsV2(c, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			listed++
+			class := string(object.StorageClass)
+			if class == "" {
+				class = string(types.ObjectStorageClassStandard)
+			}
+			usage, ok := stats.classes[class]
+			if !ok {
+				usage = &storageClassUsage{}
+				stats.classes[class] = usage
+			}
+			size := aws.ToInt64(object.Size)
+			modified := aws.ToTime(object.LastModified)
+			usage.objects++
+			usage.bytes += size
+			if class == string(types.ObjectStorageClassStandard) && now.Sub(modified) > coldStandardAge {
+				usage.coldBytes += size
+			}
+			stats.addLargest(largeObject{key: aws.ToString(object.Key), size: size, storageClass: class, lastModified: modified}, top)
+		}
+		if listed >= maxScannedObjects {
+			stats.truncated = aws.ToBool(page.IsTruncated)
+			return stats, nil
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			return stats, nil
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+}
+
+// addLargest keeps an object among the top largest ones, largest first.
+func (stats *objectStats) addLargest(object largeObject, top int) {
+	if top <= 0 || len(stats.largest) == top && object.size <= stats.largest[top-1].size {
+		return
+	}
+	i := sort.Search(len(stats.largest), func(i int) bool { return stats.largest[i].size < object.size })
+	stats.largest = append(stats.largest, largeObject{})
+	copy(stats.largest[i+1:], stats.largest[i:])
+	stats.largest[i] = object
+	if len(stats.largest) > top {
+		stats.largest = stats.largest[:top]
+	}
+}
+
+// printObjectStats prints the storage class breakdown and the largest objects of a bucket below its report
+// line, with the Standard data that could have transitioned to a colder class.
+func printObjectStats(b s3Bucket) {
+	stats := b.objects
+	if stats == nil {
+		return
+	}
+	var classes []string
+	for class := range stats.classes {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		usage := stats.classes[class]
+		fmt.Printf("\tStorage class: %s\t Objects: %d\t GB: %.1f", class, usage.objects, float64(usage.bytes)/(1<<30))
+		if usage.coldBytes > 0 {
+			fmt.Printf("\t Not modified for 90 days: %.1f GB, candidate for Standard-IA or Glacier", float64(usage.coldBytes)/(1<<30))
+		}
+		fmt.Println()
+	}
+	for _, object := range stats.largest {
+		fmt.Printf("\tLarge object: %s\t GB: %.2f\t Class: %s\t Modified: %s\n", object.key, float64(object.size)/(1<<30),
+			object.storageClass, object.lastModified.Format("2006-01-02"))
+	}
+	if stats.truncated {
+		fmt.Printf("\tOnly the first %d objects were scanned\n", maxScannedObjects)
+	}
+}
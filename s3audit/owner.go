@@ -0,0 +1,97 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go/middleware"
+	"reflect"
+	"regexp"
+)
+
+// accountIDPattern matches a 12-digit AWS account ID, as opposed to a canonical user ID or a display name
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// ownedByAccount reports whether a bucket belongs to an account. S3 refuses a request whose ExpectedBucketOwner
+// differs from the owner of the bucket with a 403, the same answer as for a missing s3:ListBucket or a policy
+// denying the caller: the bucket is only not owned when the same request without the expected owner is accepted.
+// A request denied either way returns the error, the owner is unknown. The request without the expected owner
+// goes through unowned, a client that does not set one, e.g. the -account-id of the audit.
+func ownedByAccount(c context.Context, api BucketListerAPI, unowned BucketListerAPI, bucket string, accountID string) (bool, error) {
+	_, err := api.HeadBucket(c, &s3.HeadBucketInput{Bucket: aws.String(bucket), ExpectedBucketOwner: aws.String(accountID)})
+	if code := apiErrorCode(err); code != "AccessDenied" && code != "Forbidden" {
+		return err == nil, err
+	}
+	if _, err := unowned.HeadBucket(c, &s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// withExpectedBucketOwner sets the ExpectedBucketOwner of every request of an S3 client that has one and does
+// not set it already, so S3 refuses the request when a bucket name was recycled by another account.
+func withExpectedBucketOwner(accountID string) func(*s3.Options) {
+	return func(options *s3.Options) {
+		if accountID == "" {
+			return
+		}
+		options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ExpectedBucketOwner",
+				func(c context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+					setExpectedBucketOwner(in.Parameters, accountID)
+					return next.HandleInitialize(c, in)
+				}), middleware.Before)
+		})
+	}
+}
+
+// setExpectedBucketOwner sets the ExpectedBucketOwner field of the input of an S3 call when it has one.
+func setExpectedBucketOwner(input interface{}, accountID string) {
+	v := reflect.ValueOf(input)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	field := v.Elem().FieldByName("ExpectedBucketOwner")
+	if field.IsValid() && field.CanSet() && field.Type() == reflect.TypeOf((*string)(nil)) && field.IsNil() {
+		field.Set(reflect.ValueOf(aws.String(accountID)))
+	}
+}
+
+// formatOwner formats an owner as its display name and canonical ID. Display names are only returned in some
+// regions, the canonical ID is always there.
+func formatOwner(owner *types.Owner) string {
+	if owner == nil {
+		return "<unknown>"
+	}
+	if name := aws.ToString(owner.DisplayName); name != "" {
+		return fmt.Sprintf("%s (%s)", name, aws.ToString(owner.ID))
+	}
+	return aws.ToString(owner.ID)
+}
+
+// ownerFinding flags a bucket not owned by the expected owner: an account ID, checked by S3, or the canonical
+// ID or display name of the owner in the bucket ACL.
+func ownerFinding(b s3Bucket, expected string) (finding, bool) {
+	if expected == "" {
+		return finding{}, false
+	}
+
+	f := finding{bucket: b.name, check: "owner", severity: severityHigh}
+	if accountIDPattern.MatchString(expected) {
+		if !b.notOwnedByAccount {
+			return finding{}, false
+		}
+		f.message = fmt.Sprintf("bucket is not owned by the expected account %s", expected)
+		return f, true
+	}
+
+	// an ACL that could not be read has no owner, the bucket is reported as unchecked
+	owner := b.acl.Owner
+	if owner == nil || aws.ToString(owner.ID) == expected || aws.ToString(owner.DisplayName) == expected {
+		return finding{}, false
+	}
+	f.message = fmt.Sprintf("bucket owner %s differs from the expected owner %s", formatOwner(owner), expected)
+	return f, true
+}
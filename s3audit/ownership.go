@@ -0,0 +1,83 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// getObjectOwnership returns the Object Ownership setting of a bucket. Buckets that never had ownership
+// controls configured behave as ObjectWriter.
+func getObjectOwnership(c context.Context, api BucketSettingsAPI, bucket string) (types.ObjectOwnership, error) {
+	controls, err := api.GetBucketOwnershipControls(c, &s3.GetBucketOwnershipControlsInput{Bucket: aws.String(bucket)})
+	if apiErrorCode(err) == "OwnershipControlsNotFoundError" {
+		return types.ObjectOwnershipObjectWriter, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if controls.OwnershipControls == nil || len(controls.OwnershipControls.Rules) == 0 {
+		return types.ObjectOwnershipObjectWriter, nil
+	}
+	return controls.OwnershipControls.Rules[0].ObjectOwnership, nil
+}
+
+// foreignGrants counts the ACL grants given to anyone other than the bucket owner. They stop applying once
+// ACLs are disabled, so they have to be migrated to the bucket policy first.
+func foreignGrants(acl s3.GetBucketAclOutput) int {
+	var count int
+	for _, grant := range acl.Grants {
+		if grant.Grantee == nil {
+			continue
+		}
+		if grant.Grantee.Type == types.TypeCanonicalUser && acl.Owner != nil && aws.ToString(grant.Grantee.ID) == aws.ToString(acl.Owner.ID) {
+			continue
+		}
+		count++
+	}
+	return count
+}
+
+// ownershipFinding flags a bucket that still evaluates ACLs, i.e. whose Object Ownership is not BucketOwnerEnforced.
+func ownershipFinding(b s3Bucket) (finding, bool) {
+	if b.objectOwnership == "" || b.objectOwnership == types.ObjectOwnershipBucketOwnerEnforced {
+		return finding{}, false
+	}
+
+	message := fmt.Sprintf("ACLs are enabled (Object Ownership: %s)", b.objectOwnership)
+	if grants := foreignGrants(b.acl); grants > 0 {
+		message += fmt.Sprintf(", %d ACL grant(s) to other principals", grants)
+	}
+	return finding{
+		bucket:   b.name,
+		check:    "ownership",
+		severity: severityMedium,
+		message:  message,
+	}, true
+}
+
+// ownershipRemediation builds the remediation disabling ACLs on a bucket by enforcing bucket-owner ownership.
+func ownershipRemediation(b s3Bucket, region string) remediation {
+	description := "disable ACLs by setting Object Ownership to BucketOwnerEnforced"
+	if grants := foreignGrants(b.acl); grants > 0 {
+		description += fmt.Sprintf("; move the %d ACL grant(s) to other principals into the bucket policy first or they stop applying", grants)
+	}
+
+	return remediation{
+		bucket:      b.name,
+		region:      region,
+		name:        "enforce-bucket-owner",
+		description: description,
+		input: &s3.PutBucketOwnershipControlsInput{
+			Bucket: aws.String(b.name),
+			OwnershipControls: &types.OwnershipControls{
+				Rules: []types.OwnershipControlsRule{
+					{ObjectOwnership: types.ObjectOwnershipBucketOwnerEnforced},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,154 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// pagerDutyEventsURL is the endpoint of the PagerDuty Events API v2
+const pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+
+// regressionWindow is how far back the history is read for the previous state of the buckets
+const regressionWindow = 90 * 24 * time.Hour
+
+// regression defines a bucket whose posture got worse since the previous scan: kind is public when it
+// became public, unencrypted when it lost its default encryption.
+type regression struct {
+	snapshot BucketSnapshot
+	kind     string
+	message  string
+}
+
+// pagerDutyEvent defines the body of an Events API v2 request
+type pagerDutyEvent struct {
+	RoutingKey  string           `json:"routing_key"`
+	EventAction string           `json:"event_action"`
+	DedupKey    string           `json:"dedup_key"`
+	Payload     pagerDutyPayload `json:"payload"`
+}
+
+// pagerDutyPayload defines the alert of a PagerDuty event
+type pagerDutyPayload struct {
+	Summary       string            `json:"summary"`
+	Source        string            `json:"source"`
+	Severity      string            `json:"severity"`
+	Component     string            `json:"component"`
+	Group         string            `json:"group"`
+	Class         string            `json:"class"`
+	CustomDetails map[string]string `json:"custom_details"`
+}
+
+// keepLatest keeps a snapshot in latest, keyed by account and bucket, when it is the latest snapshot of its
+// bucket taken before a scan time.
+func keepLatest(latest map[string]BucketSnapshot, s BucketSnapshot, scanTime time.Time) {
+	key := s.AccountID + "/" + s.Bucket
+	if previous, ok := latest[key]; s.ScanTime.Before(scanTime) && (!ok || s.ScanTime.After(previous.ScanTime)) {
+		latest[key] = s
+	}
+}
+
+// findRegressions compares the snapshots of a scan with the previous snapshot of each bucket, and returns the
+// buckets that became public or lost their default encryption. The buckets without a previous snapshot are not
+// compared, nor is the encryption or the public access of a bucket that could not be read at either scan.
+func findRegressions(previous map[string]BucketSnapshot, current []BucketSnapshot) []regression {
+	var regressions []regression
+	for _, s := range current {
+		before, ok := previous[s.AccountID+"/"+s.Bucket]
+		if !ok || !before.ScanTime.Before(s.ScanTime) {
+			continue
+		}
+		if s.Public && !before.Public && !before.PublicUnknown {
+			regressions = append(regressions, regression{snapshot: s, kind: "public",
+				message: fmt.Sprintf("bucket %s became public since the scan of %s", s.Bucket, before.ScanTime.Format(time.RFC3339))})
+		}
+		if s.Encryption == "none" && before.Encryption != "none" && before.Encryption != "unknown" {
+			regressions = append(regressions, regression{snapshot: s, kind: "unencrypted",
+				message: fmt.Sprintf("bucket %s lost its default encryption (%s) since the scan of %s", s.Bucket, before.Encryption, before.ScanTime.Format(time.RFC3339))})
+		}
+	}
+	return regressions
+}
+
+// pagerDutyRoutingKey returns the integration key of the PagerDuty service the regressions page, from the
+// PAGERDUTY_ROUTING_KEY environment variable.
+func pagerDutyRoutingKey() (string, error) {
+	key := os.Getenv("PAGERDUTY_ROUTING_KEY")
+	if key == "" {
+		return "", fmt.Errorf("missing the PAGERDUTY_ROUTING_KEY environment variable")
+	}
+	return key, nil
+}
+
+// triggerPagerDuty pages on-call for a regression. The deduplication key only depends on the account, the
+// bucket and the kind of regression, so the next scans reporting it again update the same alert.
+func triggerPagerDuty(c context.Context, routingKey string, r regression) error {
+	s := r.snapshot
+	event := pagerDutyEvent{
+		RoutingKey:  routingKey,
+		EventAction: "trigger",
+		DedupKey:    fmt.Sprintf("s3audit/%s/%s/%s", s.AccountID, s.Bucket, r.kind),
+		Payload: pagerDutyPayload{
+			Summary:   "S3 audit: " + r.message,
+			Source:    bucketArn(partitionOf(s.Region), s.Bucket),
+			Severity:  "critical",
+			Component: s.Bucket,
+			Group:     s.AccountID,
+			Class:     r.kind,
+			CustomDetails: map[string]string{
+				"account":    s.AccountID,
+				"region":     s.Region,
+				"encryption": s.Encryption,
+				"scan_time":  s.ScanTime.Format(time.RFC3339),
+			},
+		},
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(c, http.MethodPost, pagerDutyEventsURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// previousSnapshots reads the snapshots of the buckets at their previous scan from the first history, the
+// latest one of each bucket within the regressionWindow.
+func (a *Auditor) previousSnapshots(c context.Context, scanTime time.Time) (map[string]BucketSnapshot, error) {
+	return a.histories[0].latest(c, scanTime.Add(-regressionWindow), scanTime)
+}
+
+// pageRegressions pages on-call for the regressions. With DryRun the events are only printed.
+func (a *Auditor) pageRegressions(c context.Context, regressions []regression) {
+	for _, r := range regressions {
+		if a.options.DryRun {
+			fmt.Printf("Would page PagerDuty: %s\n", r.message)
+			continue
+		}
+		if err := triggerPagerDuty(c, a.pagerDutyKey, r); err != nil {
+			log.Printf("Got an error paging PagerDuty for bucket %v: %v", r.snapshot.Bucket, err)
+			continue
+		}
+		fmt.Printf("Paged PagerDuty: %s\n", r.message)
+	}
+}
@@ -0,0 +1,91 @@
+package s3audit
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"net/url"
+	"strings"
+)
+
+// partitions maps the prefixes of the region names to their partition, the regions of no prefix are in aws.
+var partitions = []struct {
+	prefix    string
+	partition string
+	// defaultRegion is the region of the buckets of an empty location constraint
+	defaultRegion string
+	// globalRegion is the region signing the calls of the global services, e.g. CloudFront and Route 53
+	globalRegion string
+	// console is the host of the AWS console of the partition, empty for the isolated partitions
+	console string
+}{
+	{prefix: "us-gov-", partition: "aws-us-gov", defaultRegion: "us-gov-west-1", globalRegion: "us-gov-west-1", console: "console.amazonaws-us-gov.com"},
+	{prefix: "cn-", partition: "aws-cn", defaultRegion: "cn-north-1", globalRegion: "cn-northwest-1", console: "console.amazonaws.cn"},
+	{prefix: "us-isob-", partition: "aws-iso-b", defaultRegion: "us-isob-east-1", globalRegion: "us-isob-east-1"},
+	{prefix: "us-iso-", partition: "aws-iso", defaultRegion: "us-iso-east-1", globalRegion: "us-iso-east-1"},
+}
+
+// partitionOf returns the partition of a region, e.g. aws-us-gov for us-gov-west-1.
+func partitionOf(region string) string {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.partition
+		}
+	}
+	return "aws"
+}
+
+// globalRegion returns the region of the global services in the partition of a region, us-east-1 in aws.
+func globalRegion(region string) string {
+	for _, p := range partitions {
+		if strings.HasPrefix(region, p.prefix) {
+			return p.globalRegion
+		}
+	}
+	return "us-east-1"
+}
+
+// locationRegion returns the region of a bucket from its location constraint, as returned by the S3 endpoint
+// of clientRegion: the constraint is empty for the buckets of the default region of the partition, us-east-1
+// in aws, and EU for the oldest buckets of eu-west-1.
+func locationRegion(constraint types.BucketLocationConstraint, clientRegion string) string {
+	switch constraint {
+	case "":
+		partition := partitionOf(clientRegion)
+		for _, p := range partitions {
+			if p.partition == partition {
+				return p.defaultRegion
+			}
+		}
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	}
+	return string(constraint)
+}
+
+// bucketArn returns the ARN of a bucket in a partition, e.g. arn:aws-cn:s3:::name. The partition defaults to aws.
+func bucketArn(partition string, bucket string) string {
+	if partition == "" {
+		partition = "aws"
+	}
+	return "arn:" + partition + ":s3:::" + bucket
+}
+
+// bucketConsoleURL returns the link to the permissions tab of a bucket in the AWS console of the partition of
+// its region, e.g. https://s3.console.aws.amazon.com/s3/buckets/name?region=us-east-1&tab=permissions. It is
+// empty for the partitions of no public console.
+func bucketConsoleURL(region string, bucket string) string {
+	host := "s3.console.aws.amazon.com"
+	if partition := partitionOf(region); partition != "aws" {
+		host = ""
+		for _, p := range partitions {
+			if p.partition == partition {
+				host = p.console
+			}
+		}
+		if host == "" {
+			return ""
+		}
+	}
+	query := url.Values{"region": {region}, "tab": {"permissions"}}
+	return "https://" + host + "/s3/buckets/" + url.PathEscape(bucket) + "?" + query.Encode()
+}
@@ -0,0 +1,104 @@
+package s3audit
+
+import (
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"testing"
+)
+
+func TestPartitionOf(t *testing.T) {
+	tests := []struct {
+		region    string
+		partition string
+	}{
+		{region: "us-east-1", partition: "aws"},
+		{region: "eu-west-1", partition: "aws"},
+		{region: "us-gov-west-1", partition: "aws-us-gov"},
+		{region: "cn-north-1", partition: "aws-cn"},
+		{region: "cn-northwest-1", partition: "aws-cn"},
+		{region: "us-iso-east-1", partition: "aws-iso"},
+		{region: "us-isob-east-1", partition: "aws-iso-b"},
+		{region: "", partition: "aws"},
+	}
+	for _, test := range tests {
+		if partition := partitionOf(test.region); partition != test.partition {
+			t.Errorf("partitionOf(%q) = %q, want %q", test.region, partition, test.partition)
+		}
+	}
+}
+
+func TestGlobalRegion(t *testing.T) {
+	tests := []struct {
+		region string
+		global string
+	}{
+		{region: "eu-west-1", global: "us-east-1"},
+		{region: "us-gov-east-1", global: "us-gov-west-1"},
+		{region: "cn-north-1", global: "cn-northwest-1"},
+		{region: "cn-northwest-1", global: "cn-northwest-1"},
+		{region: "us-iso-west-1", global: "us-iso-east-1"},
+	}
+	for _, test := range tests {
+		if global := globalRegion(test.region); global != test.global {
+			t.Errorf("globalRegion(%q) = %q, want %q", test.region, global, test.global)
+		}
+	}
+}
+
+func TestLocationRegion(t *testing.T) {
+	tests := []struct {
+		constraint   types.BucketLocationConstraint
+		clientRegion string
+		region       string
+	}{
+		{constraint: "", clientRegion: "us-west-2", region: "us-east-1"},
+		{constraint: "", clientRegion: "us-gov-west-1", region: "us-gov-west-1"},
+		{constraint: "", clientRegion: "us-gov-east-1", region: "us-gov-west-1"},
+		{constraint: "", clientRegion: "cn-north-1", region: "cn-north-1"},
+		{constraint: "", clientRegion: "cn-northwest-1", region: "cn-north-1"},
+		{constraint: "", clientRegion: "us-iso-east-1", region: "us-iso-east-1"},
+		{constraint: types.BucketLocationConstraintEu, clientRegion: "us-east-1", region: "eu-west-1"},
+		{constraint: "cn-northwest-1", clientRegion: "cn-north-1", region: "cn-northwest-1"},
+		{constraint: "us-gov-east-1", clientRegion: "us-gov-west-1", region: "us-gov-east-1"},
+	}
+	for _, test := range tests {
+		if region := locationRegion(test.constraint, test.clientRegion); region != test.region {
+			t.Errorf("locationRegion(%q, %q) = %q, want %q", test.constraint, test.clientRegion, region, test.region)
+		}
+	}
+}
+
+func TestBucketArn(t *testing.T) {
+	tests := []struct {
+		partition string
+		arn       string
+	}{
+		{partition: "", arn: "arn:aws:s3:::logs"},
+		{partition: "aws", arn: "arn:aws:s3:::logs"},
+		{partition: "aws-us-gov", arn: "arn:aws-us-gov:s3:::logs"},
+		{partition: "aws-cn", arn: "arn:aws-cn:s3:::logs"},
+		{partition: "aws-iso", arn: "arn:aws-iso:s3:::logs"},
+	}
+	for _, test := range tests {
+		if arn := bucketArn(test.partition, "logs"); arn != test.arn {
+			t.Errorf("bucketArn(%q, logs) = %q, want %q", test.partition, arn, test.arn)
+		}
+	}
+}
+
+func TestBucketConsoleURL(t *testing.T) {
+	tests := []struct {
+		region string
+		url    string
+	}{
+		{region: "us-east-1", url: "https://s3.console.aws.amazon.com/s3/buckets/logs?region=us-east-1&tab=permissions"},
+		{region: "us-gov-west-1", url: "https://console.amazonaws-us-gov.com/s3/buckets/logs?region=us-gov-west-1&tab=permissions"},
+		{region: "cn-north-1", url: "https://console.amazonaws.cn/s3/buckets/logs?region=cn-north-1&tab=permissions"},
+		{region: "cn-northwest-1", url: "https://console.amazonaws.cn/s3/buckets/logs?region=cn-northwest-1&tab=permissions"},
+		{region: "us-iso-east-1", url: ""},
+	}
+	for _, test := range tests {
+		if url := bucketConsoleURL(test.region, "logs"); url != test.url {
+			t.Errorf("bucketConsoleURL(%q, logs) = %q, want %q", test.region, url, test.url)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package s3audit
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// settingActions holds the IAM actions needed to read each setting of a bucket
+var settingActions = map[string]string{
+	"location":                           "s3:GetBucketLocation",
+	"acl":                                "s3:GetBucketAcl",
+	"encryption":                         "s3:GetEncryptionConfiguration",
+	"access points":                      "s3:ListAccessPoints",
+	"lifecycle configuration":            "s3:GetLifecycleConfiguration",
+	"Intelligent-Tiering configurations": "s3:GetIntelligentTieringConfiguration",
+	"notification configuration":         "s3:GetBucketNotification",
+	"notification targets":               "lambda:GetFunction",
+	"ownership controls":                 "s3:GetBucketOwnershipControls",
+	"policy status":                      "s3:GetBucketPolicyStatus",
+	"tags":                               "s3:GetBucketTagging",
+	"versioning":                         "s3:GetBucketVersioning",
+	"replication, logging and inventory destinations": "s3:GetReplicationConfiguration, s3:GetBucketLogging, s3:GetInventoryConfiguration",
+	"owner account":    "s3:ListBucket",
+	"size":             "cloudwatch:GetMetricData",
+	"billing settings": "s3:GetBucketRequestPayment, s3:GetAccelerateConfiguration",
+	"policy":           "s3:GetBucketPolicy",
+	"object versions":  "s3:ListBucketVersions",
+	"objects":          "s3:ListBucket",
+	"activity":         "cloudwatch:GetMetricData, s3:ListBucket",
+	"anonymous probe":  "none, the probe requests are unauthenticated",
+	"KMS key aliases":  "kms:ListAliases",
+}
+
+// printMissingPermissions prints, for every setting that could not be read for lack of permission, how many
+// buckets it is missing for and the IAM action to grant.
+func printMissingPermissions(results []BucketResult) {
+	denied := map[string]int{}
+	for _, result := range results {
+		for _, err := range result.Errors {
+			if errors.Is(err.Err, ErrAccessDenied) {
+				denied[err.Setting]++
+			}
+		}
+	}
+	if len(denied) == 0 {
+		return
+	}
+
+	var settings []string
+	for setting := range denied {
+		settings = append(settings, setting)
+	}
+	sort.Strings(settings)
+
+	fmt.Println("\nMissing permissions:")
+	for _, setting := range settings {
+		fmt.Printf("Setting: %s\t Buckets: %d\t Action: %s\n", setting, denied[setting], settingActions[setting])
+	}
+}
@@ -0,0 +1,166 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"os"
+	"time"
+)
+
+// plan defines the remediations written with -plan, to be reviewed and applied later with -apply.
+type plan struct {
+	Created      time.Time        `json:"created"`
+	Remediations []plannedRequest `json:"remediations"`
+}
+
+// plannedRequest defines one S3 call of a plan. Input is the request exactly as it is sent.
+type plannedRequest struct {
+	Bucket      string          `json:"bucket"`
+	Region      string          `json:"region"`
+	Fix         string          `json:"fix"`
+	Description string          `json:"description"`
+	Operation   string          `json:"operation"`
+	Input       json.RawMessage `json:"input"`
+}
+
+// operation returns the name of the S3 call that applies a remediation.
+func (r remediation) operation() string {
+	switch r.input.(type) {
+	case *s3.PutBucketIntelligentTieringConfigurationInput:
+		return "PutBucketIntelligentTieringConfiguration"
+	case *s3.PutBucketOwnershipControlsInput:
+		return "PutBucketOwnershipControls"
+	case *s3.PutBucketEncryptionInput:
+		return "PutBucketEncryption"
+	case *s3.PutBucketTaggingInput:
+		return "PutBucketTagging"
+	case *s3.DeleteBucketInput:
+		return "DeleteBucket"
+	default:
+		return fmt.Sprintf("%T", r.input)
+	}
+}
+
+// newRemediationInput returns an empty request of the S3 call of a plan, for its input to be decoded into.
+func newRemediationInput(operation string) (interface{}, error) {
+	switch operation {
+	case "PutBucketIntelligentTieringConfiguration":
+		return &s3.PutBucketIntelligentTieringConfigurationInput{}, nil
+	case "PutBucketOwnershipControls":
+		return &s3.PutBucketOwnershipControlsInput{}, nil
+	case "PutBucketEncryption":
+		return &s3.PutBucketEncryptionInput{}, nil
+	case "PutBucketTagging":
+		return &s3.PutBucketTaggingInput{}, nil
+	case "DeleteBucket":
+		return &s3.DeleteBucketInput{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported operation %q", operation)
+	}
+}
+
+// printDryRun prints the call a mutating operation would make and its payload, instead of making it.
+func printDryRun(operation string, region string, input interface{}) {
+	payload, err := json.MarshalIndent(input, "\t", "  ")
+	if err != nil {
+		payload = []byte(fmt.Sprintf("%+v", input))
+	}
+	fmt.Printf("\tDry run: %s in %s\n\t%s\n", operation, region, payload)
+}
+
+// savePlan writes the remediations to a plan file.
+func savePlan(path string, remediations []remediation) error {
+	p := plan{Created: time.Now().UTC()}
+	for _, r := range remediations {
+		planned, err := newPlannedRequest(r)
+		if err != nil {
+			return err
+		}
+		p.Remediations = append(p.Remediations, planned)
+	}
+
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadPlan reads the remediations of a plan file.
+func loadPlan(path string) ([]remediation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p plan
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+
+	var remediations []remediation
+	for _, planned := range p.Remediations {
+		r, err := planned.remediation()
+		if err != nil {
+			return nil, err
+		}
+		remediations = append(remediations, r)
+	}
+	return remediations, nil
+}
+
+// newPlannedRequest records a remediation as the S3 call applying it.
+func newPlannedRequest(r remediation) (plannedRequest, error) {
+	input, err := json.Marshal(r.input)
+	if err != nil {
+		return plannedRequest{}, fmt.Errorf("remediation %s of bucket %s: %v", r.name, r.bucket, err)
+	}
+	return plannedRequest{
+		Bucket:      r.bucket,
+		Region:      r.region,
+		Fix:         r.name,
+		Description: r.description,
+		Operation:   r.operation(),
+		Input:       input,
+	}, nil
+}
+
+// remediation rebuilds the remediation of a recorded S3 call.
+func (planned plannedRequest) remediation() (remediation, error) {
+	input, err := newRemediationInput(planned.Operation)
+	if err != nil {
+		return remediation{}, fmt.Errorf("remediation %s of bucket %s: %v", planned.Fix, planned.Bucket, err)
+	}
+	if err := json.Unmarshal(planned.Input, input); err != nil {
+		return remediation{}, fmt.Errorf("remediation %s of bucket %s: %v", planned.Fix, planned.Bucket, err)
+	}
+	return remediation{
+		bucket:      planned.Bucket,
+		region:      planned.Region,
+		name:        planned.Fix,
+		description: planned.Description,
+		input:       input,
+	}, nil
+}
+
+// ApplyPlan applies the remediations of a plan file written by a previous audit, without auditing the buckets
+// again. With dryRun, the calls are printed instead of made. When accountID is set, the calls carry it as the
+// expected bucket owner, so a bucket that changed hands since the plan was written is not changed or deleted.
+func ApplyPlan(c context.Context, cfg aws.Config, path string, accountID string, dryRun bool) error {
+	if accountID != "" && !accountIDPattern.MatchString(accountID) {
+		return fmt.Errorf("invalid account ID %q, expected 12 digits", accountID)
+	}
+	remediations, err := loadPlan(path)
+	if err != nil {
+		return fmt.Errorf("reading the plan %v: %v", path, err)
+	}
+
+	selected := fixes{}
+	for _, r := range remediations {
+		selected[r.name] = true
+	}
+	runRemediations(c, cfg, accountID, remediations, selected, dryRun)
+	return nil
+}
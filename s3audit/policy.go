@@ -0,0 +1,113 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// policyDocument defines the parts of an IAM resource policy the checks look at
+type policyDocument struct {
+	Version   string
+	Statement []policyStatement
+}
+
+// policyStatement defines a single statement of a resource policy. Principal is kept raw because it is
+// either the string "*" or an object mapping principal types to a string or a list of strings; Action is a
+// string or a list of strings, as are the values of Condition, keyed by operator then by condition key.
+type policyStatement struct {
+	Sid       string
+	Effect    string
+	Principal json.RawMessage
+	Action    json.RawMessage
+	Condition map[string]map[string]json.RawMessage
+}
+
+// getBucketPolicy returns the policy document of a bucket, or "" if the bucket has no policy.
+func getBucketPolicy(c context.Context, api BucketSettingsAPI, bucket string) (string, error) {
+	policy, err := api.GetBucketPolicy(c, &s3.GetBucketPolicyInput{Bucket: aws.String(bucket)})
+	if apiErrorCode(err) == "NoSuchBucketPolicy" {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(policy.Policy), nil
+}
+
+// isPolicyPublic reports whether the policy of a bucket grants public access. A bucket without a policy is not public.
+func isPolicyPublic(c context.Context, api BucketSettingsAPI, bucket string) (bool, error) {
+	status, err := api.GetBucketPolicyStatus(c, &s3.GetBucketPolicyStatusInput{Bucket: aws.String(bucket)})
+	if apiErrorCode(err) == "NoSuchBucketPolicy" {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return status.PolicyStatus != nil && aws.ToBool(status.PolicyStatus.IsPublic), nil
+}
+
+// parsePolicy decodes a policy document as returned by the Get*Policy APIs.
+func parsePolicy(policy string) (*policyDocument, error) {
+	var doc policyDocument
+	if err := json.Unmarshal([]byte(policy), &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// principals returns the principals of the statement keyed by type ("AWS", "Service", ...). An anonymous
+// principal ("Principal": "*") is returned under the "*" key.
+func (s policyStatement) principals() map[string][]string {
+	principals := map[string][]string{}
+	if len(s.Principal) == 0 {
+		return principals
+	}
+
+	var anonymous string
+	if err := json.Unmarshal(s.Principal, &anonymous); err == nil {
+		principals["*"] = []string{anonymous}
+		return principals
+	}
+
+	var byType map[string]json.RawMessage
+	if err := json.Unmarshal(s.Principal, &byType); err != nil {
+		return principals
+	}
+	for principalType, raw := range byType {
+		principals[principalType] = stringOrList(raw)
+	}
+	return principals
+}
+
+// hasWildcardPrincipal reports whether any Allow statement grants access to every principal, i.e. "*" either
+// as the whole principal or as an AWS principal.
+func (d *policyDocument) hasWildcardPrincipal() bool {
+	for _, statement := range d.Statement {
+		if statement.Effect != "Allow" {
+			continue
+		}
+		for _, values := range statement.principals() {
+			for _, value := range values {
+				if value == "*" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// stringOrList decodes a policy value that may be a single string or a list of strings.
+func stringOrList(raw json.RawMessage) []string {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	return nil
+}
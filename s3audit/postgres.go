@@ -0,0 +1,218 @@
+package s3audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	_ "github.com/lib/pq"
+	"time"
+)
+
+// postgresSchema creates the normalized tables of the scan history: a row per scan, per audited bucket, per
+// tag of a bucket and per finding, the findings referencing the checks by name.
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS scans (
+	id         BIGSERIAL PRIMARY KEY,
+	account_id TEXT NOT NULL,
+	scanned_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS buckets (
+	scan_id    BIGINT NOT NULL REFERENCES scans (id) ON DELETE CASCADE,
+	name       TEXT NOT NULL,
+	region     TEXT NOT NULL,
+	encryption TEXT NOT NULL,
+	public     BOOLEAN NOT NULL,
+	versioning TEXT NOT NULL,
+	risk_score INTEGER NOT NULL,
+	PRIMARY KEY (scan_id, name)
+);
+ALTER TABLE buckets ADD COLUMN IF NOT EXISTS public_unknown BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE TABLE IF NOT EXISTS bucket_tags (
+	scan_id BIGINT NOT NULL,
+	bucket  TEXT NOT NULL,
+	key     TEXT NOT NULL,
+	value   TEXT NOT NULL,
+	PRIMARY KEY (scan_id, bucket, key),
+	FOREIGN KEY (scan_id, bucket) REFERENCES buckets (scan_id, name) ON DELETE CASCADE
+);
+CREATE TABLE IF NOT EXISTS checks (
+	name TEXT PRIMARY KEY
+);
+CREATE TABLE IF NOT EXISTS findings (
+	id         BIGSERIAL PRIMARY KEY,
+	scan_id    BIGINT NOT NULL,
+	bucket     TEXT NOT NULL,
+	check_name TEXT NOT NULL REFERENCES checks (name),
+	severity   TEXT NOT NULL,
+	message    TEXT NOT NULL,
+	suppressed TEXT,
+	FOREIGN KEY (scan_id, bucket) REFERENCES buckets (scan_id, name) ON DELETE CASCADE
+);
+`
+
+// postgresHistory keeps the scan history in normalized PostgreSQL tables, for BI tooling to query the
+// compliance posture over time with SQL.
+type postgresHistory struct {
+	db *sql.DB
+}
+
+// newPostgresHistory connects to the database of a postgres:// URL and creates the tables if needed.
+func newPostgresHistory(c context.Context, location string) (*postgresHistory, error) {
+	db, err := sql.Open("postgres", location)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(c, postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating the tables: %v", err)
+	}
+	return &postgresHistory{db: db}, nil
+}
+
+// save records the snapshots of a scan in one transaction. The snapshots of a scan share their account and
+// scan time, a scan row is added for each pair.
+func (h *postgresHistory) save(c context.Context, snapshots []BucketSnapshot) error {
+	tx, err := h.db.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	scans := map[string]int64{}
+	for _, snapshot := range snapshots {
+		key := snapshot.AccountID + "/" + snapshot.ScanTime.String()
+		scanID, ok := scans[key]
+		if !ok {
+			err := tx.QueryRowContext(c, `INSERT INTO scans (account_id, scanned_at) VALUES ($1, $2) RETURNING id`,
+				snapshot.AccountID, snapshot.ScanTime).Scan(&scanID)
+			if err != nil {
+				return err
+			}
+			scans[key] = scanID
+		}
+
+		_, err := tx.ExecContext(c, `INSERT INTO buckets (scan_id, name, region, encryption, public, public_unknown, versioning, risk_score)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+			scanID, snapshot.Bucket, snapshot.Region, snapshot.Encryption, snapshot.Public, snapshot.PublicUnknown, snapshot.Versioning, snapshot.RiskScore)
+		if err != nil {
+			return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+		}
+		for key, value := range snapshot.Tags {
+			_, err := tx.ExecContext(c, `INSERT INTO bucket_tags (scan_id, bucket, key, value) VALUES ($1, $2, $3, $4)`,
+				scanID, snapshot.Bucket, key, value)
+			if err != nil {
+				return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+			}
+		}
+		for _, f := range snapshot.Findings {
+			if _, err := tx.ExecContext(c, `INSERT INTO checks (name) VALUES ($1) ON CONFLICT DO NOTHING`, f.Check); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(c, `INSERT INTO findings (scan_id, bucket, check_name, severity, message, suppressed)
+				VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))`,
+				scanID, snapshot.Bucket, f.Check, f.Severity, f.Message, f.Suppressed)
+			if err != nil {
+				return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// since returns the snapshots of the scans at or after a time, oldest first.
+func (h *postgresHistory) since(c context.Context, t time.Time) ([]BucketSnapshot, error) {
+	rows, err := h.db.QueryContext(c, `SELECT s.id, s.account_id, s.scanned_at, b.name, b.region, b.encryption, b.public, b.public_unknown, b.versioning, b.risk_score
+		FROM scans s JOIN buckets b ON b.scan_id = s.id
+		WHERE s.scanned_at >= $1
+		ORDER BY s.scanned_at, b.name`, t)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type bucketKey struct {
+		scanID int64
+		bucket string
+	}
+	var snapshots []BucketSnapshot
+	index := map[bucketKey]int{}
+	for rows.Next() {
+		var scanID int64
+		var s BucketSnapshot
+		if err := rows.Scan(&scanID, &s.AccountID, &s.ScanTime, &s.Bucket, &s.Region, &s.Encryption, &s.Public, &s.PublicUnknown, &s.Versioning, &s.RiskScore); err != nil {
+			return nil, err
+		}
+		index[bucketKey{scanID, s.Bucket}] = len(snapshots)
+		snapshots = append(snapshots, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tags, err := h.db.QueryContext(c, `SELECT t.scan_id, t.bucket, t.key, t.value
+		FROM bucket_tags t JOIN scans s ON s.id = t.scan_id WHERE s.scanned_at >= $1`, t)
+	if err != nil {
+		return nil, err
+	}
+	defer tags.Close()
+	for tags.Next() {
+		var key bucketKey
+		var tag, value string
+		if err := tags.Scan(&key.scanID, &key.bucket, &tag, &value); err != nil {
+			return nil, err
+		}
+		if i, ok := index[key]; ok {
+			if snapshots[i].Tags == nil {
+				snapshots[i].Tags = map[string]string{}
+			}
+			snapshots[i].Tags[tag] = value
+		}
+	}
+	if err := tags.Err(); err != nil {
+		return nil, err
+	}
+
+	findings, err := h.db.QueryContext(c, `SELECT f.scan_id, f.bucket, f.check_name, f.severity, f.message, COALESCE(f.suppressed, '')
+		FROM findings f JOIN scans s ON s.id = f.scan_id WHERE s.scanned_at >= $1 ORDER BY f.id`, t)
+	if err != nil {
+		return nil, err
+	}
+	defer findings.Close()
+	for findings.Next() {
+		var key bucketKey
+		var f Finding
+		if err := findings.Scan(&key.scanID, &key.bucket, &f.Check, &f.Severity, &f.Message, &f.Suppressed); err != nil {
+			return nil, err
+		}
+		f.Bucket = key.bucket
+		if i, ok := index[key]; ok {
+			snapshots[i].Findings = append(snapshots[i].Findings, f)
+		}
+	}
+	return snapshots, findings.Err()
+}
+
+// latest returns the latest snapshot of each bucket taken at or after from and before to, by account and
+// bucket, without its tags and findings.
+func (h *postgresHistory) latest(c context.Context, from time.Time, to time.Time) (map[string]BucketSnapshot, error) {
+	rows, err := h.db.QueryContext(c, `SELECT DISTINCT ON (s.account_id, b.name) s.account_id, s.scanned_at, b.name, b.region, b.encryption,
+		b.public, b.public_unknown, b.versioning, b.risk_score
+		FROM scans s JOIN buckets b ON b.scan_id = s.id
+		WHERE s.scanned_at >= $1 AND s.scanned_at < $2
+		ORDER BY s.account_id, b.name, s.scanned_at DESC`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := map[string]BucketSnapshot{}
+	for rows.Next() {
+		var s BucketSnapshot
+		if err := rows.Scan(&s.AccountID, &s.ScanTime, &s.Bucket, &s.Region, &s.Encryption, &s.Public, &s.PublicUnknown, &s.Versioning, &s.RiskScore); err != nil {
+			return nil, err
+		}
+		keepLatest(latest, s, to)
+	}
+	return latest, rows.Err()
+}
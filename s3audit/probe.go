@@ -0,0 +1,148 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"strings"
+)
+
+// allUsersGroup is the grantee of the ACL grants to everyone, authenticatedUsersGroup of the grants to any AWS
+// account
+const (
+	allUsersGroup           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	authenticatedUsersGroup = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+)
+
+// probeResult is the answer of S3 to an unauthenticated request: allowed, denied, or missing for a sentinel
+// key that does not exist and that anonymous requests may list.
+type probeResult string
+
+const (
+	probeAllowed probeResult = "allowed"
+	probeDenied  probeResult = "denied"
+	probeMissing probeResult = "missing"
+)
+
+// anonymousProbe is the outcome of the unauthenticated requests sent to a bucket flagged as public. exists is
+// set when the key read is known to exist, without it a denied read may only be a missing key.
+type anonymousProbe struct {
+	list   probeResult
+	get    probeResult
+	key    string
+	exists bool
+}
+
+// leaks reports whether the unauthenticated requests could list or read the bucket.
+func (p *anonymousProbe) leaks() bool {
+	return p != nil && (p.list == probeAllowed || p.get == probeAllowed || p.get == probeMissing)
+}
+
+// aclPublic reports whether the ACL of a bucket grants any permission to everyone, or to any AWS account.
+func aclPublic(acl s3.GetBucketAclOutput) bool {
+	for _, grant := range acl.Grants {
+		if grant.Grantee == nil || grant.Grantee.Type != types.TypeGroup {
+			continue
+		}
+		if uri := aws.ToString(grant.Grantee.URI); uri == allUsersGroup || uri == authenticatedUsersGroup {
+			return true
+		}
+	}
+	return false
+}
+
+// probeOutcome reads the answer to an unauthenticated request, the errors other than a denial or a missing key
+// meaning the probe could not conclude.
+func probeOutcome(err error) (probeResult, error) {
+	switch code := apiErrorCode(err); {
+	case err == nil:
+		return probeAllowed, nil
+	case code == "AccessDenied" || code == "AllAccessDisabled" || code == "Forbidden":
+		return probeDenied, nil
+	case code == "NoSuchKey" || code == "NotFound":
+		return probeMissing, nil
+	default:
+		return "", err
+	}
+}
+
+// probeKey returns the key the probe reads, with the authenticated client of the audit: the sentinel key when
+// the bucket holds it, otherwise the first key of the bucket, since S3 denies the read of a missing key to the
+// requests that may not list the bucket. The sentinel key is returned, not known to exist, when the bucket is
+// empty or cannot be listed.
+func probeKey(c context.Context, api ObjectReaderAPI, bucket string, key string) (string, bool) {
+	sentinel, err := api.ListObjectsV2(c, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(key), MaxKeys: aws.Int32(1)})
+	if err != nil {
+		return key, false
+	}
+	if len(sentinel.Contents) > 0 && aws.ToString(sentinel.Contents[0].Key) == key {
+		return key, true
+	}
+	first, err := api.ListObjectsV2(c, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), MaxKeys: aws.Int32(1)})
+	if err != nil || len(first.Contents) == 0 {
+		return key, false
+	}
+	return aws.ToString(first.Contents[0].Key), true
+}
+
+// probeAnonymousAccess sends unauthenticated HTTPS requests to a bucket, a ListObjectsV2 of one key and a
+// GetObject of the first byte of the key of probeKey, to confirm from the outside whether it leaks. S3 answers
+// NoSuchKey rather than AccessDenied for a missing key only when anonymous requests may list the bucket. api is
+// the authenticated client of the region.
+func probeAnonymousAccess(c context.Context, cfg aws.Config, api ObjectReaderAPI, region string, bucket string, key string) (*anonymousProbe, error) {
+	client := newS3Client(cfg, region, "", func(options *s3.Options) {
+		options.Credentials = aws.AnonymousCredentials{}
+	})
+	probe := &anonymousProbe{}
+	probe.key, probe.exists = probeKey(c, api, bucket, key)
+
+	_, err := client.ListObjectsV2(c, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), MaxKeys: aws.Int32(1)})
+	if probe.list, err = probeOutcome(err); err != nil {
+		return nil, err
+	}
+	object, err := client.GetObject(c, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(probe.key), Range: aws.String("bytes=0-0")})
+	if err == nil {
+		object.Body.Close()
+	}
+	if probe.get, err = probeOutcome(err); err != nil {
+		return nil, err
+	}
+	return probe, nil
+}
+
+// anonymousAccessFinding flags a bucket the unauthenticated requests could list or read.
+func anonymousAccessFinding(b s3Bucket) (finding, bool) {
+	if !b.probe.leaks() {
+		return finding{}, false
+	}
+	var leaks []string
+	if b.probe.list == probeAllowed {
+		leaks = append(leaks, "anonymous requests can list the objects")
+	}
+	switch b.probe.get {
+	case probeAllowed:
+		leaks = append(leaks, fmt.Sprintf("anonymous requests can read %s", b.probe.key))
+	case probeMissing:
+		leaks = append(leaks, fmt.Sprintf("anonymous requests learn %s does not exist", b.probe.key))
+	}
+	return finding{
+		bucket:   b.name,
+		check:    "anonymous-access",
+		severity: severityCritical,
+		message:  "confirmed by an unauthenticated probe: " + strings.Join(leaks, ", "),
+	}, true
+}
+
+// printAnonymousProbe prints the outcome of the unauthenticated requests below the report line of a bucket.
+func printAnonymousProbe(b s3Bucket) {
+	if b.probe == nil {
+		return
+	}
+	get := string(b.probe.get)
+	if b.probe.get == probeDenied && !b.probe.exists {
+		get += " (inconclusive, the key may not exist)"
+	}
+	fmt.Printf("\tAnonymous probe: list %s\t get %s %s\n", b.probe.list, b.probe.key, get)
+}
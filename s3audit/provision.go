@@ -0,0 +1,289 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// bucketTemplate defines the settings of the buckets created with create-bucket. Every bucket gets Block
+// Public Access and the BucketOwnerEnforced object ownership; the other settings are those of the template.
+type bucketTemplate struct {
+	Region     string `yaml:"region"`
+	Encryption struct {
+		// Algorithm is AES256, aws:kms or aws:kms:dsse
+		Algorithm string `yaml:"algorithm"`
+		KMSKey    string `yaml:"kmsKey"`
+		BucketKey bool   `yaml:"bucketKey"`
+	} `yaml:"encryption"`
+	Versioning bool `yaml:"versioning"`
+	Lifecycle  struct {
+		NoncurrentDays      int32 `yaml:"noncurrentDays"`
+		AbortIncompleteDays int32 `yaml:"abortIncompleteDays"`
+		IntelligentTiering  int32 `yaml:"intelligentTieringDays"`
+	} `yaml:"lifecycle"`
+	Logging struct {
+		Bucket string `yaml:"bucket"`
+		// Prefix is prepended to the name of the bucket to form the prefix of its logs
+		Prefix string `yaml:"prefix"`
+	} `yaml:"logging"`
+	Tags map[string]string `yaml:"tags"`
+}
+
+// loadBucketTemplate reads a bucket template file.
+func loadBucketTemplate(path string) (*bucketTemplate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var template bucketTemplate
+	if err := yaml.Unmarshal(data, &template); err != nil {
+		return nil, err
+	}
+	switch template.Encryption.Algorithm {
+	case "":
+		template.Encryption.Algorithm = string(types.ServerSideEncryptionAes256)
+	case string(types.ServerSideEncryptionAes256), string(types.ServerSideEncryptionAwsKms), string(types.ServerSideEncryptionAwsKmsDsse):
+	default:
+		return nil, fmt.Errorf("unknown encryption algorithm %q, expected one of: AES256, aws:kms, aws:kms:dsse", template.Encryption.Algorithm)
+	}
+	return &template, nil
+}
+
+// provisioningStep is a call configuring a new bucket, its name and its request.
+type provisioningStep struct {
+	operation string
+	input     interface{}
+}
+
+// provisioningSteps returns the calls creating a bucket from a template, CreateBucket first.
+func (t *bucketTemplate) provisioningSteps(bucket string, region string, tags map[string]string) []provisioningStep {
+	create := &s3.CreateBucketInput{Bucket: aws.String(bucket), ObjectOwnership: types.ObjectOwnershipBucketOwnerEnforced}
+	// us-east-1 is the default location, it is not accepted as a constraint
+	if region != "us-east-1" {
+		create.CreateBucketConfiguration = &types.CreateBucketConfiguration{LocationConstraint: types.BucketLocationConstraint(region)}
+	}
+	steps := []provisioningStep{
+		{"CreateBucket", create},
+		{"PutPublicAccessBlock", &s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+			PublicAccessBlockConfiguration: &types.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(true),
+				IgnorePublicAcls:      aws.Bool(true),
+				BlockPublicPolicy:     aws.Bool(true),
+				RestrictPublicBuckets: aws.Bool(true),
+			},
+		}},
+	}
+
+	rule := types.ServerSideEncryptionRule{
+		ApplyServerSideEncryptionByDefault: &types.ServerSideEncryptionByDefault{SSEAlgorithm: types.ServerSideEncryption(t.Encryption.Algorithm)},
+	}
+	if t.Encryption.KMSKey != "" {
+		rule.ApplyServerSideEncryptionByDefault.KMSMasterKeyID = aws.String(t.Encryption.KMSKey)
+	}
+	if t.Encryption.BucketKey {
+		rule.BucketKeyEnabled = aws.Bool(true)
+	}
+	steps = append(steps, provisioningStep{"PutBucketEncryption", &s3.PutBucketEncryptionInput{
+		Bucket:                            aws.String(bucket),
+		ServerSideEncryptionConfiguration: &types.ServerSideEncryptionConfiguration{Rules: []types.ServerSideEncryptionRule{rule}},
+	}})
+
+	if t.Versioning {
+		steps = append(steps, provisioningStep{"PutBucketVersioning", &s3.PutBucketVersioningInput{
+			Bucket:                  aws.String(bucket),
+			VersioningConfiguration: &types.VersioningConfiguration{Status: types.BucketVersioningStatusEnabled},
+		}})
+	}
+
+	var rules []types.LifecycleRule
+	if days := t.Lifecycle.AbortIncompleteDays; days > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID: aws.String("abort-incomplete-multipart-uploads"), Status: types.ExpirationStatusEnabled,
+			Filter:                         &types.LifecycleRuleFilter{Prefix: aws.String("")},
+			AbortIncompleteMultipartUpload: &types.AbortIncompleteMultipartUpload{DaysAfterInitiation: aws.Int32(days)},
+		})
+	}
+	if days := t.Lifecycle.NoncurrentDays; days > 0 && t.Versioning {
+		rules = append(rules, types.LifecycleRule{
+			ID: aws.String("expire-noncurrent-versions"), Status: types.ExpirationStatusEnabled,
+			Filter:                      &types.LifecycleRuleFilter{Prefix: aws.String("")},
+			NoncurrentVersionExpiration: &types.NoncurrentVersionExpiration{NoncurrentDays: aws.Int32(days)},
+		})
+	}
+	if days := t.Lifecycle.IntelligentTiering; days > 0 {
+		rules = append(rules, types.LifecycleRule{
+			ID: aws.String("intelligent-tiering"), Status: types.ExpirationStatusEnabled,
+			Filter:      &types.LifecycleRuleFilter{Prefix: aws.String("")},
+			Transitions: []types.Transition{{Days: aws.Int32(days), StorageClass: types.TransitionStorageClassIntelligentTiering}},
+		})
+	}
+	if len(rules) > 0 {
+		steps = append(steps, provisioningStep{"PutBucketLifecycleConfiguration", &s3.PutBucketLifecycleConfigurationInput{
+			Bucket:                 aws.String(bucket),
+			LifecycleConfiguration: &types.BucketLifecycleConfiguration{Rules: rules},
+		}})
+	}
+
+	if t.Logging.Bucket != "" {
+		steps = append(steps, provisioningStep{"PutBucketLogging", &s3.PutBucketLoggingInput{
+			Bucket: aws.String(bucket),
+			BucketLoggingStatus: &types.BucketLoggingStatus{LoggingEnabled: &types.LoggingEnabled{
+				TargetBucket: aws.String(t.Logging.Bucket),
+				TargetPrefix: aws.String(t.Logging.Prefix + bucket + "/"),
+			}},
+		}})
+	}
+
+	if len(tags) > 0 {
+		var keys []string
+		for key := range tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		var tagSet []types.Tag
+		for _, key := range keys {
+			tagSet = append(tagSet, types.Tag{Key: aws.String(key), Value: aws.String(tags[key])})
+		}
+		steps = append(steps, provisioningStep{"PutBucketTagging", &s3.PutBucketTaggingInput{
+			Bucket:  aws.String(bucket),
+			Tagging: &types.Tagging{TagSet: tagSet},
+		}})
+	}
+	return steps
+}
+
+// applyProvisioningStep makes the call of a provisioning step.
+func applyProvisioningStep(c context.Context, client S3ClientAPI, step provisioningStep) error {
+	var err error
+	switch input := step.input.(type) {
+	case *s3.CreateBucketInput:
+		_, err = client.CreateBucket(c, input)
+	case *s3.PutPublicAccessBlockInput:
+		_, err = client.PutPublicAccessBlock(c, input)
+	case *s3.PutBucketEncryptionInput:
+		_, err = client.PutBucketEncryption(c, input)
+	case *s3.PutBucketVersioningInput:
+		_, err = client.PutBucketVersioning(c, input)
+	case *s3.PutBucketLifecycleConfigurationInput:
+		_, err = client.PutBucketLifecycleConfiguration(c, input)
+	case *s3.PutBucketLoggingInput:
+		_, err = client.PutBucketLogging(c, input)
+	case *s3.PutBucketTaggingInput:
+		_, err = client.PutBucketTagging(c, input)
+	default:
+		err = fmt.Errorf("unsupported request %T", step.input)
+	}
+	return err
+}
+
+// BucketProvisioning defines a bucket created with create-bucket: its name, the template file of its settings,
+// the region overriding the one of the template, and a comma separated list of key=value tags added to those
+// of the template. DryRun prints the calls instead of making them.
+type BucketProvisioning struct {
+	Bucket   string
+	Template string
+	Region   string
+	Tags     string
+	DryRun   bool
+}
+
+// CreateBucketFromTemplate creates a bucket configured to pass the checks: Block Public Access, the
+// BucketOwnerEnforced ownership, then the encryption, versioning, lifecycle, logging and tags of a template.
+// The name pattern and the required tags of the options are checked before the bucket is created, and the
+// bucket is audited once created. A bucket whose configuration fails is deleted, it is still empty.
+func CreateBucketFromTemplate(c context.Context, cfg aws.Config, options Options, p BucketProvisioning, w io.Writer) error {
+	template, err := loadBucketTemplate(p.Template)
+	if err != nil {
+		return fmt.Errorf("reading the template %v: %v", p.Template, err)
+	}
+	region := p.Region
+	if region == "" {
+		region = template.Region
+	}
+	if region == "" {
+		region = cfg.Region
+	}
+	extraTags, err := parseTagMatcher(p.Tags)
+	if err != nil {
+		return err
+	}
+	tags := map[string]string{}
+	for key, value := range template.Tags {
+		tags[key] = value
+	}
+	for key, value := range extraTags {
+		tags[key] = value
+	}
+
+	if options.NamePattern != "" {
+		pattern, err := regexp.Compile(options.NamePattern)
+		if err != nil {
+			return fmt.Errorf("invalid name pattern: %v", err)
+		}
+		if !pattern.MatchString(p.Bucket) {
+			return fmt.Errorf("bucket name %s does not match %s", p.Bucket, pattern)
+		}
+	}
+	required, err := parseRequiredTags(options.RequiredTags)
+	if err != nil {
+		return fmt.Errorf("invalid required tags: %v", err)
+	}
+	if missing := required.missingTags(tags); len(missing) > 0 {
+		return fmt.Errorf("missing required tag(s) %s, add them to the template or with -tag", strings.Join(missing, ","))
+	}
+
+	steps := template.provisioningSteps(p.Bucket, region, tags)
+	if p.DryRun {
+		for _, step := range steps {
+			printDryRun(step.operation, region, step.input)
+		}
+		return nil
+	}
+
+	client := newS3Client(cfg, region, "")
+	for i, step := range steps {
+		if err := applyProvisioningStep(c, client, step); err != nil {
+			if i > 0 {
+				if _, deleteErr := client.DeleteBucket(c, &s3.DeleteBucketInput{Bucket: aws.String(p.Bucket)}); deleteErr != nil {
+					log.Printf("Got an error deleting the incomplete bucket %v, delete it by hand: %v", p.Bucket, deleteErr)
+				}
+			}
+			return fmt.Errorf("%s: %v", step.operation, err)
+		}
+		fmt.Fprintf(w, "%s: done\n", step.operation)
+	}
+	fmt.Fprintf(w, "Bucket %s created in %s\n", p.Bucket, region)
+
+	a, result, err := auditBucket(c, cfg, options, p.Bucket)
+	if err != nil {
+		return fmt.Errorf("auditing the new bucket: %v", err)
+	}
+	var remaining []finding
+	for _, f := range result.findings {
+		if f.suppressed == "" {
+			remaining = append(remaining, f)
+		}
+	}
+	if len(remaining) == 0 {
+		fmt.Fprintln(w, "The bucket passes every check")
+		return nil
+	}
+	t := newTable(a.color, column{header: "SEVERITY"}, column{header: "CHECK"}, column{header: "MESSAGE"})
+	for _, f := range remaining {
+		t.add(cell{text: f.severity.String(), color: severityColor(f.severity, false)}, cell{text: f.check}, cell{text: f.message})
+	}
+	fmt.Fprintln(w, "Findings of the new bucket, to address in the template:")
+	t.write(w)
+	return nil
+}
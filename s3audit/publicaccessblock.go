@@ -0,0 +1,121 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"sort"
+	"strings"
+)
+
+// S3ControlGetPublicAccessBlockApi defines the interface for the GetPublicAccessBlock function.
+// We use this interface to test the function using a mocked service.
+type S3ControlGetPublicAccessBlockApi interface {
+	GetPublicAccessBlock(ctx context.Context,
+		params *s3control.GetPublicAccessBlockInput,
+		optFns ...func(*s3control.Options)) (*s3control.GetPublicAccessBlockOutput, error)
+}
+
+// accountPublicAccessBlock defines the account-level Block Public Access settings, which apply to every
+// bucket of the account on top of their own settings
+type accountPublicAccessBlock struct {
+	blockPublicAcls       bool
+	ignorePublicAcls      bool
+	blockPublicPolicy     bool
+	restrictPublicBuckets bool
+}
+
+// GetPublicAccessBlock returns the account-level Block Public Access configuration.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetPublicAccessBlockOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetPublicAccessBlock.
+func GetPublicAccessBlock(c context.Context, api S3ControlGetPublicAccessBlockApi, input *s3control.GetPublicAccessBlockInput) (*s3control.GetPublicAccessBlockOutput, error) {
+	return api.GetPublicAccessBlock(c, input)
+}
+
+// getAccountPublicAccessBlock returns the account-level Block Public Access settings. An account without a
+// configuration has every setting off.
+func getAccountPublicAccessBlock(c context.Context, api S3ControlGetPublicAccessBlockApi, accountID string) (accountPublicAccessBlock, error) {
+	output, err := GetPublicAccessBlock(c, api, &s3control.GetPublicAccessBlockInput{AccountId: aws.String(accountID)})
+	if apiErrorCode(err) == "NoSuchPublicAccessBlockConfiguration" {
+		return accountPublicAccessBlock{}, nil
+	}
+	if err != nil {
+		return accountPublicAccessBlock{}, err
+	}
+
+	configuration := output.PublicAccessBlockConfiguration
+	if configuration == nil {
+		return accountPublicAccessBlock{}, nil
+	}
+	return accountPublicAccessBlock{
+		blockPublicAcls:       aws.ToBool(configuration.BlockPublicAcls),
+		ignorePublicAcls:      aws.ToBool(configuration.IgnorePublicAcls),
+		blockPublicPolicy:     aws.ToBool(configuration.BlockPublicPolicy),
+		restrictPublicBuckets: aws.ToBool(configuration.RestrictPublicBuckets),
+	}, nil
+}
+
+// enabled reports whether every setting of the block is on.
+func (p accountPublicAccessBlock) enabled() bool {
+	return p.blockPublicAcls && p.ignorePublicAcls && p.blockPublicPolicy && p.restrictPublicBuckets
+}
+
+// disabledSettings returns the names of the settings of the block that are off.
+func (p accountPublicAccessBlock) disabledSettings() []string {
+	var disabled []string
+	for name, on := range map[string]bool{
+		"BlockPublicAcls":       p.blockPublicAcls,
+		"IgnorePublicAcls":      p.ignorePublicAcls,
+		"BlockPublicPolicy":     p.blockPublicPolicy,
+		"RestrictPublicBuckets": p.restrictPublicBuckets,
+	} {
+		if !on {
+			disabled = append(disabled, name)
+		}
+	}
+	sort.Strings(disabled)
+	return disabled
+}
+
+// accountPublicAccessBlockFinding flags an account whose Block Public Access is not fully enabled, leaving
+// every bucket only as protected as its own settings.
+func accountPublicAccessBlockFinding(p accountPublicAccessBlock, accountID string) (finding, bool) {
+	if p.enabled() {
+		return finding{}, false
+	}
+	return finding{
+		bucket:   "account " + accountID,
+		check:    "account-public-access-block",
+		severity: severityHigh,
+		message:  fmt.Sprintf("account-level Block Public Access is off for %s", strings.Join(p.disabledSettings(), ",")),
+	}, true
+}
+
+// applyAccountPublicAccessBlock lowers the public bucket policy findings to LOW when RestrictPublicBuckets is
+// on for the account, since S3 then ignores the public grants of bucket policies.
+func applyAccountPublicAccessBlock(findings []finding, p accountPublicAccessBlock) {
+	if !p.restrictPublicBuckets {
+		return
+	}
+	for i, f := range findings {
+		if f.check == "bucket-policy" {
+			findings[i].severity = severityLow
+			findings[i].message = f.message + "; moot while the account restricts public buckets"
+		}
+	}
+}
+
+// printAccountPublicAccessBlock prints the account-level Block Public Access at the top of the report.
+func printAccountPublicAccessBlock(p accountPublicAccessBlock) {
+	if p.enabled() {
+		fmt.Print("Account Block Public Access: ENABLED\n\n")
+		return
+	}
+	fmt.Printf("Account Block Public Access: NOT FULLY ENABLED (off: %s)\n\n", strings.Join(p.disabledSettings(), ","))
+}
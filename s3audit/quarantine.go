@@ -0,0 +1,134 @@
+package s3audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// quarantineThreshold is the number of buckets in a row whose reads all failed that quarantines their region
+const quarantineThreshold = 3
+
+// regionQuarantine isolates the regions where every call fails, e.g. during an endpoint outage or under an
+// SCP denying the region: once quarantineThreshold buckets in a row failed in a region, its remaining buckets
+// are deferred, and audited again once the other regions are done.
+type regionQuarantine struct {
+	mutex       sync.Mutex
+	failures    map[string]int
+	quarantined map[string]bool
+	lifted      bool
+}
+
+// newRegionQuarantine returns a quarantine of no region.
+func newRegionQuarantine() *regionQuarantine {
+	return &regionQuarantine{failures: map[string]int{}, quarantined: map[string]bool{}}
+}
+
+// regionFailure reports whether the audit of a bucket failed for its region rather than for the bucket: one
+// of its reads failed with an error of the region, see regionalError. The errors of the bucket itself, e.g. a
+// bucket policy denying the reads or a missing configuration, do not count.
+func regionFailure(result BucketResult) bool {
+	for _, err := range result.Errors {
+		if regionalError(err.Err) {
+			return true
+		}
+	}
+	return false
+}
+
+// regionalError reports whether an error comes from the region: the endpoint cannot be resolved or reached,
+// the service is throttling or failing with a 5xx status, or a service control policy denies the call. The
+// deadline of a bucket is not one, a large bucket exceeds it on its own.
+func regionalError(err error) bool {
+	if err == nil || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, ErrThrottled) {
+		return true
+	}
+	if errors.Is(err, ErrAccessDenied) {
+		return strings.Contains(err.Error(), "explicit deny in a service control policy")
+	}
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.HTTPStatusCode() >= 500
+	}
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	return errors.As(err, &dnsErr) || errors.As(err, &netErr)
+}
+
+// observe records the outcome of the audit of a bucket of a region.
+func (q *regionQuarantine) observe(region string, failed bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !failed {
+		q.failures[region] = 0
+		return
+	}
+	q.failures[region]++
+	if q.failures[region] >= quarantineThreshold && !q.quarantined[region] {
+		q.quarantined[region] = true
+		fmt.Printf("Quarantined region %s after %d failed bucket(s), its buckets are retried at the end of the scan\n",
+			region, q.failures[region])
+	}
+}
+
+// isQuarantined reports whether the buckets of a region are deferred.
+func (q *regionQuarantine) isQuarantined(region string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return !q.lifted && q.quarantined[region]
+}
+
+// lift lets the deferred buckets be audited again.
+func (q *regionQuarantine) lift() {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.lifted = true
+}
+
+// regions returns the quarantined regions.
+func (q *regionQuarantine) regions() []string {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	var regions []string
+	for region := range q.quarantined {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// printQuarantine prints the quarantined regions and the outcome of the retry of their buckets.
+func printQuarantine(results []BucketResult, q *regionQuarantine) {
+	regions := q.regions()
+	if len(regions) == 0 {
+		return
+	}
+	recovered := map[string]int{}
+	failing := map[string]int{}
+	for _, result := range results {
+		if !result.Retried {
+			continue
+		}
+		if regionFailure(result) {
+			failing[result.Region]++
+		} else {
+			recovered[result.Region]++
+		}
+	}
+
+	fmt.Println("\nQuarantined regions:")
+	for _, region := range regions {
+		fmt.Printf("Region: %s\t Retried: %d bucket(s)\t Recovered: %d\t Still failing: %d\n",
+			region, recovered[region]+failing[region], recovered[region], failing[region])
+	}
+}
@@ -0,0 +1,142 @@
+package s3audit
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// redactedKMSKeys matches the KMS key and alias ARNs and the bare key IDs in the messages of the findings
+var redactedKMSKeys = regexp.MustCompile(`arn:aws[a-z-]*:kms:[a-z0-9-]*:[0-9]{12}:(key|alias)/[A-Za-z0-9/_-]+|\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+
+// redactedAccountIDs matches the account IDs left in the messages, e.g. in the principals of a policy
+var redactedAccountIDs = regexp.MustCompile(`\b[0-9]{12}\b`)
+
+// redactKeyVariable is the environment variable holding the key of the bucket name hashes
+const redactKeyVariable = "S3AUDIT_REDACT_KEY"
+
+// redactor removes the names of the buckets, the KMS keys and the account IDs from the reports, so they can
+// be shared outside the organization. A bucket name is replaced by an HMAC of it, so the names cannot be
+// guessed back by hashing candidate names. The key is random for each scan unless S3AUDIT_REDACT_KEY sets
+// it: only then are the hashes the same from scan to scan, so the buckets of two redacted reports can be
+// compared.
+type redactor struct {
+	mutex sync.Mutex
+	key   []byte
+	// names holds the hash of every bucket name seen so far
+	names map[string]string
+}
+
+// newRedactor returns a redactor, or nil when the reports are not redacted.
+func newRedactor(enabled bool) (*redactor, error) {
+	if !enabled {
+		return nil, nil
+	}
+	key := []byte(os.Getenv(redactKeyVariable))
+	if len(key) == 0 {
+		key = make([]byte, sha256.Size)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &redactor{key: key, names: map[string]string{}}, nil
+}
+
+// bucket returns the redacted name of a bucket, e.g. bucket-5d41402abc4b2a76.
+func (r *redactor) bucket(name string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if hashed, ok := r.names[name]; ok {
+		return hashed
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write([]byte(name))
+	hashed := "bucket-" + hex.EncodeToString(mac.Sum(nil)[:8])
+	r.names[name] = hashed
+	return hashed
+}
+
+// text redacts a free text, e.g. the message of a finding: the names of the buckets seen so far, then the KMS
+// keys and the account IDs.
+func (r *redactor) text(s string) string {
+	r.mutex.Lock()
+	var names []string
+	for name := range r.names {
+		names = append(names, name)
+	}
+	// the longest names first, so a name is not partly replaced by a shorter one it contains
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	var pairs []string
+	for _, name := range names {
+		pairs = append(pairs, name, r.names[name])
+	}
+	r.mutex.Unlock()
+
+	if len(pairs) > 0 {
+		s = strings.NewReplacer(pairs...).Replace(s)
+	}
+	s = redactedKMSKeys.ReplaceAllString(s, "<kms-key>")
+	return redactedAccountIDs.ReplaceAllString(s, "<account>")
+}
+
+// reportBucket redacts a bucket of a report. The console link and the KMS key are dropped, the ARN is the
+// one of the redacted name, the values of the tags are redacted as text and the creator is dropped, its ARN
+// naming a person of the organization.
+func (r *redactor) reportBucket(b ReportBucket) ReportBucket {
+	b.Name = r.bucket(b.Name)
+	b.ARN = bucketArn(partitionOf(b.Region), b.Name)
+	b.ConsoleURL = ""
+	b.Encryption.KeyID = ""
+	b.Creator = nil
+	if b.Cost != nil {
+		cost := *b.Cost
+		cost.Value = r.text(cost.Value)
+		b.Cost = &cost
+	}
+	if b.Tags != nil {
+		tags := map[string]string{}
+		for key, value := range b.Tags {
+			tags[key] = r.text(value)
+		}
+		b.Tags = tags
+	}
+	return b
+}
+
+// findings redacts findings, once the names of their buckets are known to the redactor.
+func (r *redactor) findings(findings []Finding) []Finding {
+	var redacted []Finding
+	for _, f := range findings {
+		f.Bucket = r.bucket(f.Bucket)
+		f.Message = r.text(f.Message)
+		f.Suppressed = r.text(f.Suppressed)
+		redacted = append(redacted, f)
+	}
+	return redacted
+}
+
+// report returns a redacted copy of a report, without the account and the caller.
+func (r *redactor) report(report *Report) *Report {
+	redacted := *report
+	redacted.AccountID = "<account>"
+	redacted.AccountAlias = ""
+	redacted.CallerARN = ""
+	// the KMS key matrix is nothing but keys and bucket names
+	redacted.KMSKeys = nil
+	redacted.Buckets = nil
+	for _, b := range report.Buckets {
+		redacted.Buckets = append(redacted.Buckets, r.reportBucket(b))
+	}
+	// the names of the buckets of the findings are registered before any message is redacted
+	for _, f := range report.Findings {
+		r.bucket(f.Bucket)
+	}
+	redacted.Findings = r.findings(report.Findings)
+	return &redacted
+}
@@ -0,0 +1,105 @@
+package s3audit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"os"
+	"strings"
+)
+
+// remediation defines a change that fixes a finding. input is the request of the S3 call that applies it.
+type remediation struct {
+	bucket      string
+	region      string
+	name        string
+	description string
+	input       interface{}
+}
+
+// fixes holds the names of the remediations selected with -fix
+type fixes map[string]bool
+
+// parseFixes reads a comma separated list of remediation names.
+func parseFixes(value string) fixes {
+	selected := fixes{}
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+	return selected
+}
+
+// applyRemediation calls the S3 API that carries out the remediation, in the region of the bucket. When
+// accountID is set, S3 refuses the call if the bucket is no longer owned by that account.
+func applyRemediation(c context.Context, cfg aws.Config, accountID string, r remediation) error {
+	client := newS3Client(cfg, r.region, accountID)
+
+	switch input := r.input.(type) {
+	case *s3.PutBucketIntelligentTieringConfigurationInput:
+		_, err := client.PutBucketIntelligentTieringConfiguration(c, input)
+		return err
+	case *s3.PutBucketOwnershipControlsInput:
+		_, err := client.PutBucketOwnershipControls(c, input)
+		return err
+	case *s3.PutBucketEncryptionInput:
+		_, err := client.PutBucketEncryption(c, input)
+		return err
+	case *s3.PutBucketTaggingInput:
+		_, err := client.PutBucketTagging(c, input)
+		return err
+	case *s3.DeleteBucketInput:
+		empty, err := bucketEmpty(c, client, aws.ToString(input.Bucket))
+		if err != nil {
+			return err
+		}
+		if !empty {
+			return fmt.Errorf("the bucket is no longer empty")
+		}
+		_, err = client.DeleteBucket(c, input)
+		return err
+	default:
+		return fmt.Errorf("remediation %s: unsupported request %T", r.name, r.input)
+	}
+}
+
+// runRemediations applies the remediations selected with -fix and prints the others as suggestions. With
+// dryRun, the calls of the selected remediations are printed instead of made. The destructive remediations
+// are only applied once confirmed on the terminal. The calls carry accountID, when set, as the expected bucket
+// owner.
+func runRemediations(c context.Context, cfg aws.Config, accountID string, remediations []remediation, selected fixes, dryRun bool) {
+	in := bufio.NewReader(os.Stdin)
+	fmt.Println("\nRemediations:")
+	if len(remediations) == 0 {
+		fmt.Println("No remediations")
+		return
+	}
+
+	for _, r := range remediations {
+		if !selected[r.name] {
+			fmt.Printf("Bucket: %s\t Fix: %s\t %s\n", r.bucket, r.name, r.description)
+			continue
+		}
+
+		if dryRun {
+			fmt.Printf("Bucket: %s\t Fix: %s\t not applied (dry run)\n", r.bucket, r.name)
+			printDryRun(r.operation(), r.region, r.input)
+			continue
+		}
+		if r.destructive() && !confirmRemediation(in, os.Stdout, r) {
+			fmt.Printf("Bucket: %s\t Fix: %s\t not applied (declined)\n", r.bucket, r.name)
+			continue
+		}
+		if err := applyRemediation(c, cfg, accountID, r); err != nil {
+			fmt.Printf("Bucket: %s\t Fix: %s\t failed: %v\n", r.bucket, r.name, err)
+			continue
+		}
+		fmt.Printf("Bucket: %s\t Fix: %s\t applied\n", r.bucket, r.name)
+	}
+	if len(selected) == 0 {
+		fmt.Println("Run with -fix <name>[,<name>] to apply")
+	}
+}
@@ -0,0 +1,535 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Report is the outcome of an audit, as written by the report writers.
+type Report struct {
+	// SchemaVersion is the version of the layout of the JSON report, see WriteSchema
+	SchemaVersion int    `json:"schema_version"`
+	AccountID     string `json:"accountId"`
+	// AccountAlias is the IAM alias of the account, absent when it has none or it could not be read
+	AccountAlias string `json:"accountAlias,omitempty"`
+	// CallerARN is the principal the audit ran as
+	CallerARN string `json:"callerArn"`
+	// ScanTime is when the scan started, Generated when the report was written at its end
+	ScanTime  time.Time      `json:"scanTime"`
+	Generated time.Time      `json:"generated"`
+	Buckets   []ReportBucket `json:"buckets"`
+	Findings  []Finding      `json:"findings"`
+	// Statistics aggregates every audited bucket, the buckets and the findings above may be limited by -top
+	Statistics ReportStatistics `json:"statistics"`
+	// KMSKeys pivots the buckets by their default KMS key, with -kms-matrix
+	KMSKeys []ReportKMSKey `json:"kmsKeys,omitempty"`
+
+	// fields are the paths of the bucket fields the csv, json and table formats write instead of their
+	// usual content, when set
+	fields []string
+}
+
+// ReportBucket is an audited bucket of a report.
+type ReportBucket struct {
+	Name   string `json:"name"`
+	Region string `json:"region"`
+	// ARN is the ARN of the bucket in the partition of its region
+	ARN string `json:"arn"`
+	// ConsoleURL links to the permissions tab of the bucket in the AWS console, empty in the partitions of no
+	// public console
+	ConsoleURL string           `json:"consoleUrl,omitempty"`
+	Created    time.Time        `json:"created"`
+	SizeBytes  float64          `json:"sizeBytes,omitempty"`
+	RiskScore  int              `json:"riskScore"`
+	Encryption ReportEncryption `json:"encryption"`
+	// Versioning is the versioning status, empty when versioning was never enabled or was not read
+	Versioning string            `json:"versioning,omitempty"`
+	Public     bool              `json:"public"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	// Unchecked lists the settings that could not be read and why, e.g. "encryption: access denied"
+	Unchecked []string `json:"unchecked,omitempty"`
+	// Creator is the identity that created the bucket, only looked up with Creators
+	Creator *ReportCreator `json:"creator,omitempty"`
+	// Cost is the billed cost of the CostExplorerTag value of the bucket, only read with CostExplorerTag
+	Cost *ReportCost `json:"cost,omitempty"`
+}
+
+// ReportCost is the billed S3 cost of the value of a cost allocation tag over a period, from Cost Explorer.
+type ReportCost struct {
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+	// Start and End are the first and the last day of the period
+	Start  string  `json:"start"`
+	End    string  `json:"end"`
+	Amount float64 `json:"amount"`
+	Unit   string  `json:"unit"`
+	// SharedBy is the number of audited buckets carrying the value, the amount is their cost together
+	SharedBy int `json:"sharedBy"`
+}
+
+// ReportCreator is the identity that created a bucket, from its CreateBucket event.
+type ReportCreator struct {
+	Principal string    `json:"principal"`
+	Created   time.Time `json:"created"`
+	// Source is where the event was found: cloudtrail for the event history, athena for a CloudTrail table
+	Source string `json:"source"`
+}
+
+// ReportEncryption is the default encryption of a bucket.
+type ReportEncryption struct {
+	// Algorithm is the default encryption algorithm, e.g. aws:kms, none or unknown when it could not be read
+	Algorithm string `json:"algorithm"`
+	// KeyID is the KMS key of aws:kms encryption
+	KeyID string `json:"keyId,omitempty"`
+}
+
+// ReportWriter writes a report in one format, e.g. JSON for machines or a table for humans.
+type ReportWriter interface {
+	WriteReport(w io.Writer, report *Report) error
+}
+
+// reportWriters holds the report writers by the name of their format
+var reportWriters = map[string]ReportWriter{
+	"json":   jsonReportWriter{},
+	"csv":    csvReportWriter{},
+	"github": githubReportWriter{},
+	"html":   htmlReportWriter{},
+	"sarif":  sarifReportWriter{},
+	"table":  tableReportWriter{},
+}
+
+// reportOutput defines a report written in a format to a file, - for the standard output.
+type reportOutput struct {
+	format string
+	path   string
+	// writer is the writer of the outputs configured by a file, e.g. a template; the writer of the format
+	// otherwise
+	writer ReportWriter
+}
+
+// parseOutputs reads a comma separated list of format=file outputs, e.g. json=report.json,table=-. A format
+// without a file, e.g. github, is written to the standard output. The template format takes the template
+// file first, template=check.tmpl for the standard output or template=check.tmpl=check.txt.
+func parseOutputs(value string) ([]reportOutput, error) {
+	var outputs []reportOutput
+	for _, item := range splitList(value) {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "-")
+		}
+		if parts[1] == "" {
+			return nil, fmt.Errorf("invalid output %q, expected format=file", item)
+		}
+		if parts[0] == "template" {
+			if parts[1] == "-" {
+				return nil, fmt.Errorf("invalid output %q, expected template=file.tmpl or template=file.tmpl=output", item)
+			}
+			files := strings.SplitN(parts[1], "=", 2)
+			if len(files) == 1 {
+				files = append(files, "-")
+			}
+			writer, err := newTemplateReportWriter(files[0])
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, reportOutput{format: parts[0], path: files[1], writer: writer})
+			continue
+		}
+		if _, ok := reportWriters[parts[0]]; !ok && !streamingFormats[parts[0]] {
+			return nil, fmt.Errorf("invalid output %q: unknown format %q, expected one of: csv, github, html, json, jsonl, sarif, table, template", item, parts[0])
+		}
+		outputs = append(outputs, reportOutput{format: parts[0], path: parts[1], writer: reportWriters[parts[0]]})
+	}
+	return outputs, nil
+}
+
+// signedFormats are the formats of the reports signed with a signing key, when written to a file
+var signedFormats = map[string]bool{"html": true, "json": true}
+
+// writeReports writes the report to every output, and signs the json and html reports with s when set.
+func writeReports(c context.Context, outputs []reportOutput, report *Report, s signer) {
+	for _, output := range outputs {
+		if streamingFormats[output.format] {
+			continue
+		}
+		if err := writeReport(output, report); err != nil {
+			log.Printf("Got an error writing the %v report to %v: %v", output.format, output.path, err)
+			continue
+		}
+		if s != nil && signedFormats[output.format] && output.path != "-" {
+			if err := signFile(c, s, output.path); err != nil {
+				log.Printf("Got an error signing the %v report %v: %v", output.format, output.path, err)
+			}
+		}
+	}
+}
+
+// writeReport writes the report to one output, only the selected fields of the buckets when the report has
+// fields and the format supports them.
+func writeReport(output reportOutput, report *Report) error {
+	write := output.writer.WriteReport
+	if len(report.fields) > 0 && fieldFormats[output.format] {
+		write = func(w io.Writer, report *Report) error {
+			return writeFields(w, output.format, report)
+		}
+	}
+	if output.path == "-" {
+		fmt.Println()
+		return write(os.Stdout, report)
+	}
+
+	file, err := os.Create(output.path)
+	if err != nil {
+		return err
+	}
+	if err := write(file, report); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// uncheckedSettings describes the settings of a bucket that could not be read and why.
+func uncheckedSettings(errs []ReadError) []string {
+	var unchecked []string
+	for _, err := range errs {
+		unchecked = append(unchecked, fmt.Sprintf("%s: %s", err.Setting, errorKind(err.Err)))
+	}
+	return unchecked
+}
+
+// newReportBucket returns the report entry of an audited bucket.
+func newReportBucket(result BucketResult) ReportBucket {
+	return ReportBucket{
+		Name:       result.Name,
+		Region:     result.Region,
+		ARN:        bucketArn(partitionOf(result.Region), result.Name),
+		ConsoleURL: bucketConsoleURL(result.Region, result.Name),
+		Created:    result.Created,
+		SizeBytes:  result.bucket.sizeBytes,
+		RiskScore:  result.score,
+		Encryption: reportEncryption(result.bucket),
+		Versioning: string(result.bucket.versioning),
+		Public:     result.public,
+		Tags:       result.bucket.tags,
+		Unchecked:  uncheckedSettings(result.Errors),
+		Creator:    reportCreator(result.creator),
+		Cost:       reportCost(result.cost),
+	}
+}
+
+// reportCost returns the billed cost of a bucket, nil when unknown.
+func reportCost(cost *bucketCost) *ReportCost {
+	if cost == nil {
+		return nil
+	}
+	return &ReportCost{
+		Tag:      cost.costs.tag,
+		Value:    cost.value,
+		Start:    cost.costs.start.Format("2006-01-02"),
+		End:      cost.costs.end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Amount:   cost.amount,
+		Unit:     cost.costs.unit,
+		SharedBy: cost.buckets,
+	}
+}
+
+// reportCreator returns the creator of a bucket, nil when unknown.
+func reportCreator(creator *bucketCreator) *ReportCreator {
+	if creator == nil {
+		return nil
+	}
+	return &ReportCreator{Principal: creator.principal, Created: creator.created, Source: creator.source}
+}
+
+// reportEncryption returns the default encryption of a bucket.
+func reportEncryption(b s3Bucket) ReportEncryption {
+	switch b.encryptionState {
+	case encryptionNone:
+		return ReportEncryption{Algorithm: "none"}
+	case encryptionUnknown:
+		return ReportEncryption{Algorithm: "unknown"}
+	}
+	return ReportEncryption{Algorithm: encryptionAlgorithm(b), KeyID: encryptionKeyID(b)}
+}
+
+// bucketRegions returns the region of each bucket of a report.
+func (r *Report) bucketRegions() map[string]string {
+	regions := map[string]string{}
+	for _, b := range r.Buckets {
+		regions[b.Name] = b.Region
+	}
+	return regions
+}
+
+// accountName names the account of a report, its ID followed by its alias when it has one.
+func (r *Report) accountName() string {
+	if r.AccountAlias == "" {
+		return r.AccountID
+	}
+	return fmt.Sprintf("%s (%s)", r.AccountID, r.AccountAlias)
+}
+
+// bucketsByName returns the buckets of a report by their name.
+func (r *Report) bucketsByName() map[string]ReportBucket {
+	buckets := map[string]ReportBucket{}
+	for _, b := range r.Buckets {
+		buckets[b.Name] = b
+	}
+	return buckets
+}
+
+// jsonReportWriter writes the report as a JSON document.
+type jsonReportWriter struct{}
+
+func (jsonReportWriter) WriteReport(w io.Writer, report *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// csvReportWriter writes one CSV record per finding.
+type csvReportWriter struct{}
+
+func (csvReportWriter) WriteReport(w io.Writer, report *Report) error {
+	buckets := report.bucketsByName()
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"bucket", "region", "check", "severity", "message", "suppressed", "arn", "console_url"})
+	for _, f := range report.Findings {
+		b := buckets[f.Bucket]
+		writer.Write([]string{f.Bucket, b.Region, f.Check, f.Severity, f.Message, f.Suppressed, b.ARN, b.ConsoleURL})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// tableReportWriter writes the account of the scan, the findings as an aligned text table, then the ARN and
+// the console link of the buckets.
+type tableReportWriter struct{}
+
+func (tableReportWriter) WriteReport(w io.Writer, report *Report) error {
+	fmt.Fprintf(w, "Account %s, audited as %s, scan started %s\n\n", report.accountName(), report.CallerARN,
+		report.ScanTime.Format(time.RFC3339))
+	regions := report.bucketRegions()
+	t := newTable(false, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "CHECK"},
+		column{header: "SEVERITY"}, column{header: "MESSAGE"}, column{header: "SUPPRESSED"})
+	for _, f := range report.Findings {
+		t.add(cell{text: f.Bucket}, cell{text: regions[f.Bucket]}, cell{text: f.Check}, cell{text: f.Severity},
+			cell{text: f.Message}, cell{text: f.Suppressed})
+	}
+	t.write(w)
+
+	fmt.Fprintln(w)
+	links := newTable(false, column{header: "BUCKET"}, column{header: "ARN"}, column{header: "CONSOLE"})
+	for _, b := range report.Buckets {
+		links.add(cell{text: b.Name}, cell{text: b.ARN}, cell{text: b.ConsoleURL})
+	}
+	links.write(w)
+
+	fmt.Fprintln(w)
+	writeStatistics(w, report.Statistics)
+	return nil
+}
+
+// htmlReport is the page of the HTML report
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>S3 audit of account {{.AccountName}}</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.CRITICAL { background: #f8d0d0; }
+.HIGH { background: #fbe3c8; }
+.MEDIUM { background: #fdf5c8; }
+.suppressed { color: #888; }
+</style>
+</head>
+<body>
+<h1>S3 audit of account {{.AccountName}}</h1>
+<p>Audited as {{.CallerARN}}, scan started {{.ScanTime.Format "2006-01-02 15:04:05 MST"}}</p>
+<p>Generated {{.Generated.Format "2006-01-02 15:04:05 MST"}}, {{len .Buckets}} bucket(s), {{len .Findings}} finding(s)</p>
+<h2>Statistics</h2>
+<table>
+<tr><th>Buckets</th><td>{{.Statistics.Buckets}}</td></tr>
+<tr><th>Regions</th><td>{{.Regions}}</td></tr>
+<tr><th>Encrypted</th><td>{{.Encrypted}}</td></tr>
+<tr><th>Versioned</th><td>{{.Versioned}}</td></tr>
+<tr><th>Public</th><td>{{.Statistics.Public}}</td></tr>
+<tr><th>Failures</th><td>{{.Statistics.Failures}}</td></tr>
+<tr><th>Findings</th><td>{{.FindingCounts}}</td></tr>
+</table>
+<h2>Buckets</h2>
+<table>
+<tr><th>Bucket</th><th>Region</th><th>ARN</th><th>Risk score</th><th>Unchecked</th></tr>
+{{range .Buckets}}<tr><td>{{if .ConsoleURL}}<a href="{{.ConsoleURL}}">{{.Name}}</a>{{else}}{{.Name}}{{end}}</td><td>{{.Region}}</td><td>{{.ARN}}</td><td>{{.RiskScore}}</td><td>{{range .Unchecked}}{{.}}<br>{{end}}</td></tr>
+{{end}}</table>
+<h2>Findings</h2>
+<table>
+<tr><th>Bucket</th><th>Check</th><th>Severity</th><th>Message</th><th>Suppressed</th></tr>
+{{range .Findings}}<tr class="{{if .Suppressed}}suppressed{{else}}{{.Severity}}{{end}}"><td>{{$bucket := .Bucket}}{{with index $.Links .Bucket}}<a href="{{.}}">{{$bucket}}</a>{{else}}{{$bucket}}{{end}}</td><td>{{.Check}}</td><td>{{.Severity}}</td><td>{{.Message}}</td><td>{{.Suppressed}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// htmlReportWriter writes the report as a standalone HTML page, the buckets linking to the AWS console.
+type htmlReportWriter struct{}
+
+func (htmlReportWriter) WriteReport(w io.Writer, report *Report) error {
+	links := map[string]string{}
+	for _, b := range report.Buckets {
+		links[b.Name] = b.ConsoleURL
+	}
+	return htmlReport.Execute(w, struct {
+		*Report
+		// Links holds the console URL of each bucket, for the findings
+		Links       map[string]string
+		AccountName string
+		// the statistics printed as text
+		Regions, Encrypted, Versioned, FindingCounts string
+	}{report, links, report.accountName(), report.Statistics.formatRegions(), formatPercent(report.Statistics.EncryptedPercent),
+		formatPercent(report.Statistics.VersionedPercent), report.Statistics.formatFindings()})
+}
+
+// sarifLog and the types below define the subset of SARIF 2.1.0 the report uses, with the checks as rules
+// and the buckets as logical locations.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool           `json:"tool"`
+	Results    []sarifResult       `json:"results"`
+	Properties *sarifRunProperties `json:"properties,omitempty"`
+}
+
+// sarifRunProperties holds the properties of a run SARIF does not define
+type sarifRunProperties struct {
+	AccountID    string           `json:"accountId"`
+	AccountAlias string           `json:"accountAlias,omitempty"`
+	CallerARN    string           `json:"callerArn"`
+	ScanTime     time.Time        `json:"scanTime"`
+	Statistics   ReportStatistics `json:"statistics"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name  string      `json:"name"`
+	Rules []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID       string             `json:"ruleId"`
+	Level        string             `json:"level"`
+	Message      sarifMessage       `json:"message"`
+	Locations    []sarifLocation    `json:"locations"`
+	Suppressions []sarifSuppression `json:"suppressions,omitempty"`
+	Properties   *sarifProperties   `json:"properties,omitempty"`
+}
+
+// sarifProperties holds the properties of a result SARIF does not define
+type sarifProperties struct {
+	ConsoleURL string `json:"consoleUrl"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	Name               string `json:"name"`
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification"`
+}
+
+// sarifLevel maps the severity of a finding to a SARIF level.
+func sarifLevel(s string) string {
+	switch s {
+	case severityCritical.String(), severityHigh.String():
+		return "error"
+	case severityMedium.String():
+		return "warning"
+	default:
+		return "note"
+	}
+}
+
+// sarifReportWriter writes the findings as a SARIF log, for code-scanning dashboards.
+type sarifReportWriter struct{}
+
+func (sarifReportWriter) WriteReport(w io.Writer, report *Report) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: "s3audit"}},
+		Results: []sarifResult{},
+		Properties: &sarifRunProperties{
+			AccountID:    report.AccountID,
+			AccountAlias: report.AccountAlias,
+			CallerARN:    report.CallerARN,
+			ScanTime:     report.ScanTime,
+			Statistics:   report.Statistics,
+		},
+	}
+	rules := map[string]bool{}
+	buckets := report.bucketsByName()
+	for _, f := range report.Findings {
+		if !rules[f.Check] {
+			rules[f.Check] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: f.Check})
+		}
+
+		result := sarifResult{
+			RuleID:  f.Check,
+			Level:   sarifLevel(f.Severity),
+			Message: sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{{LogicalLocations: []sarifLogicalLocation{{
+				Name:               f.Bucket,
+				FullyQualifiedName: bucketArn(partitionOf(buckets[f.Bucket].Region), f.Bucket),
+				Kind:               "resource",
+			}}}},
+		}
+		if url := buckets[f.Bucket].ConsoleURL; url != "" {
+			result.Properties = &sarifProperties{ConsoleURL: url}
+		}
+		if f.Suppressed != "" {
+			result.Suppressions = []sarifSuppression{{Kind: "external", Justification: f.Suppressed}}
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
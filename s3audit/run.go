@@ -0,0 +1,397 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/service/account"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Run audits the buckets of the account and prints the report, then exports the findings and applies the
+// remediations selected by the options. failed is true when an unsuppressed finding at or above the FailOn
+// severity remains.
+func (a *Auditor) Run(c context.Context) (failed bool, err error) {
+	var buckets []s3Bucket
+	var findings []finding
+	var remediations []remediation
+	// risk score of each bucket, used to prioritize the findings
+	scores := map[string]int{}
+	var configAgree, configDisagree int
+	// the statistics count every bucket, whether its result is kept or not
+	counter := a.newStatisticsCounter()
+
+	if a.publicAccessErr != nil {
+		log.Printf("Got an error retrieving the account Block Public Access: %v", a.publicAccessErr)
+	} else {
+		printAccountPublicAccessBlock(a.publicAccessBlock)
+		if f, ok := accountPublicAccessBlockFinding(a.publicAccessBlock, a.accountID); ok {
+			findings = a.enabledFindings([]finding{f})
+			applySuppressions(findings, a.suppressions, time.Now())
+			counter.addFindings(findings)
+		}
+	}
+
+	scanTime := time.Now().UTC()
+	sinks, err := a.openSinks(c, scanTime)
+	if err != nil {
+		return false, err
+	}
+
+	fmt.Printf("\nAccount %s", a.accountID)
+	if a.accountAlias != "" {
+		fmt.Printf(" (%s)", a.accountAlias)
+	}
+	fmt.Printf(", audited as %s, scan started %s\n\n", a.callerArn, scanTime.Format(time.RFC3339))
+
+	fmt.Print("Buckets:\n\n")
+
+	// the buckets are printed and handed to the sinks as they complete, then only their compact result is
+	// kept for the summary sections, which list them in the -sort order. With jsonl and the history as the
+	// only outputs, only the first -top of them are kept, see Options.Output.
+	var results []BucketResult
+	keepAll := a.keepsResults()
+	kept := &topResults{n: a.options.Top, key: a.options.Sort}
+	collect := func(result BucketResult) {
+		counter.addResult(result)
+		counter.addFindings(result.findings)
+		if keepAll {
+			results = append(results, result)
+		} else {
+			kept.add(result)
+		}
+	}
+	// the buckets left out of the checkpoint and the errors that stopped the audit of buckets make the scan
+	// incomplete
+	var unrecorded, auditErrors int
+	resultsChan, errsChan := a.Stream(c)
+	for resultsChan != nil || errsChan != nil {
+		select {
+		case result, ok := <-resultsChan:
+			if !ok {
+				resultsChan = nil
+				continue
+			}
+			if result.unrecorded {
+				unrecorded++
+			}
+			agree, disagree := result.print()
+			configAgree += agree
+			configDisagree += disagree
+			for _, sink := range sinks {
+				if err := sink.write(c, result); err != nil {
+					log.Printf("Got an error writing bucket %v: %v", result.Name, err)
+				}
+			}
+			collect(a.compact(result))
+		case err, ok := <-errsChan:
+			if !ok {
+				errsChan = nil
+				continue
+			}
+			auditErrors++
+			fmt.Printf("Got an error auditing buckets: %v\n", err)
+		}
+	}
+	if a.listOwner != nil {
+		fmt.Printf("\nBuckets listed for account %s, owner %s\n", a.accountID, formatOwner(a.listOwner))
+	}
+
+	// the buckets completed by a previous run are only part of the summary, with the findings recorded then
+	if a.options.Resume {
+		for name, completed := range a.checkpoint.Completed {
+			collect(restoredResult(name, completed))
+		}
+		fmt.Printf("\nResumed from %s: %d bucket(s) audited by the previous scan are only part of the summary\n",
+			a.options.Checkpoint, len(a.checkpoint.Completed))
+	}
+	if !keepAll {
+		results = kept.results
+		fmt.Printf("\nOnly the jsonl output and the history hold every bucket, the summary sections cover the first %d in the -sort order\n",
+			len(results))
+	}
+	// the summary sections list the buckets in the -sort order, the first -top of them when set
+	sortResults(results, a.options.Sort)
+	audited := map[string]bool{}
+	listed := map[string]bool{}
+	for i, result := range results {
+		audited[result.Name] = true
+		if a.options.Top == 0 || i < a.options.Top {
+			listed[result.Name] = true
+		}
+		if !result.restored {
+			buckets = append(buckets, result.bucket)
+		}
+		findings = append(findings, result.findings...)
+		remediations = append(remediations, result.remediations...)
+		scores[result.Name] = result.score
+	}
+	top := results
+	if a.options.Top > 0 && len(top) > a.options.Top {
+		top = top[:a.options.Top]
+	}
+	printSummary(top, a.color)
+	printMissingPermissions(results)
+	printSlowBuckets(results, a.color)
+	printQuarantine(results, a.quarantine)
+	if a.checks.enabled("cross-account") {
+		printPolicyPrincipals(results, a.accountID, a.trusted, a.color)
+	}
+	if a.options.StaleDays > 0 && a.checks.enabled("stale") {
+		printStaleBuckets(results, a.options.StaleDays, time.Now())
+	}
+	if a.options.Creators {
+		// top shares the results, the report lists the creators as well
+		creators, err := a.findCreators(c, results)
+		if err != nil {
+			log.Printf("Got an error looking up the creators of the buckets: %v", err)
+		}
+		for i := range results {
+			if creator, ok := creators[results[i].Name]; ok {
+				results[i].creator = &creator
+			}
+		}
+		printProbableOwners(results, a.naming.requiredTags)
+	}
+	if a.options.CostExplorerTag != "" {
+		costs, err := getTagCosts(c, newCostExplorerClient(a.cfg), a.options.CostExplorerTag, time.Now().UTC())
+		if err != nil {
+			log.Printf("Got an error reading the billed costs from Cost Explorer: %v", err)
+		} else {
+			joinTagCosts(results, costs)
+			printTagCosts(results, costs)
+		}
+	}
+	if a.costTagDefaults != nil {
+		for _, result := range results {
+			if r, ok := costTagRemediation(result, a.costTags, a.costTagDefaults); ok {
+				remediations = append(remediations, r)
+			}
+		}
+	}
+
+	// directory buckets are not returned by ListBuckets, they are listed region by region
+	regions, err := getEnabledRegions(c, account.NewFromConfig(a.cfg))
+	if err != nil {
+		log.Printf("Got an error listing the enabled regions, only scanning the regions of the buckets for directory buckets: %v", err)
+		regions = nil
+		for region := range a.regions {
+			regions = append(regions, region)
+		}
+	}
+	found, errs := scanDirectoryBuckets(c, a.cfg, regions)
+	for region, err := range errs {
+		log.Printf("Got an error listing directory buckets in region %v: %v", region, err)
+	}
+	var directoryBuckets []directoryBucket
+	for _, b := range found {
+		if a.selected(b.name) {
+			directoryBuckets = append(directoryBuckets, b)
+		}
+	}
+	// the findings of the buckets are already adjusted to the account and the suppressions, the findings
+	// added from here on are adjusted before the report is printed
+	var extra []finding
+	for _, b := range directoryBuckets {
+		extra = append(extra, directoryBucketFindings(b)...)
+	}
+	printDirectoryBuckets(directoryBuckets)
+
+	if a.options.StorageLens {
+		dashboards, err := getStorageLensDashboards(c, a.cfg, a.accountID)
+		if err != nil {
+			return false, fmt.Errorf("retrieving Storage Lens dashboards: %v", err)
+		}
+		printStorageLensDashboards(dashboards)
+	}
+
+	for _, name := range missingDeclaredBuckets(a.declared, buckets) {
+		if !a.selected(name) || audited[name] {
+			continue
+		}
+		extra = append(extra, finding{
+			bucket:   name,
+			check:    "drift",
+			severity: severityMedium,
+			message:  "bucket is declared in the Terraform state but does not exist",
+		})
+	}
+
+	var kmsKeys []ReportKMSKey
+	if a.options.KMSMatrix {
+		kmsKeys = kmsKeyMatrix(c, results, func(region string) kmsKeyApi { return newKMSClient(a.cfg, region) })
+		printKMSKeyMatrix(kmsKeys)
+	}
+
+	if a.checks.enabled("billing") {
+		printBilling(buckets)
+	}
+	if a.options.Diagram != "" {
+		if err := saveDiagram(a.options.Diagram, buckets); err != nil {
+			log.Printf("Got an error writing the data-flow diagram to %v: %v", a.options.Diagram, err)
+		}
+	}
+	if a.options.TerraformImport != "" {
+		if err := saveTerraformImports(a.options.TerraformImport, buckets, a.managed, a.declared); err != nil {
+			log.Printf("Got an error writing Terraform imports to %v: %v", a.options.TerraformImport, err)
+		}
+	}
+	guardDutyRegions := map[string]regionGuardDuty{}
+	for region, state := range a.regions {
+		guardDutyRegions[region] = state.guardDuty
+	}
+	printGuardDuty(guardDutyRegions)
+	if a.options.ConfigRules {
+		fmt.Printf("\nAWS Config: %d rule result(s) agree with the audit, %d disagree\n", configAgree, configDisagree)
+	}
+	extra = a.enabledFindings(extra)
+	if a.publicAccessErr == nil {
+		applyAccountPublicAccessBlock(extra, a.publicAccessBlock)
+	}
+	applySuppressions(extra, a.suppressions, time.Now())
+	counter.addFindings(extra)
+	findings = append(findings, extra...)
+	printFindings(topFindings(findings, audited, listed), a.color)
+	printPriorities(findings, scores, a.options.TopFindings, a.color)
+	stats := counter.statistics()
+
+	emails := splitList(a.options.Email)
+	if len(a.outputs) > 0 || len(emails) > 0 || a.splitKey != "" {
+		report := &Report{
+			SchemaVersion: ReportSchemaVersion,
+			AccountID:     a.accountID,
+			AccountAlias:  a.accountAlias,
+			CallerARN:     a.callerArn,
+			ScanTime:      scanTime,
+			Generated:     time.Now().UTC(),
+			Findings:      exportFindings(topFindings(findings, audited, listed)),
+			Statistics:    stats,
+			KMSKeys:       kmsKeys,
+			fields:        a.fields,
+		}
+		for _, result := range top {
+			report.Buckets = append(report.Buckets, newReportBucket(result))
+		}
+		shared := report
+		if a.redactor != nil {
+			shared = a.redactor.report(report)
+		}
+		writeReports(c, a.outputs, shared, a.signer)
+		if a.splitKey != "" {
+			a.writeTeamReports(c, a.splitReport(report, a.splitKey, results, top, findings, topFindings(findings, audited, listed)))
+		}
+		if len(emails) > 0 {
+			if err := emailReport(c, sesv2.NewFromConfig(a.cfg), a.options.EmailFrom, emails, shared); err != nil {
+				log.Printf("Got an error sending the report to %v: %v", a.options.Email, err)
+			} else {
+				fmt.Printf("\nSent the report to %s\n", strings.Join(emails, ", "))
+			}
+		}
+	}
+
+	for _, sink := range sinks {
+		if sink, ok := sink.(statisticsSink); ok {
+			if err := sink.writeStatistics(c, stats); err != nil {
+				log.Printf("Got an error writing the statistics: %v", err)
+			}
+		}
+		if err := sink.close(c); err != nil {
+			log.Printf("Got an error closing an output: %v", err)
+		}
+	}
+
+	switch a.options.Export {
+	case "":
+	case "securityhub":
+		region := a.options.SecurityHubRegion
+		if region == "" {
+			region = a.cfg.Region
+		}
+		if a.options.DryRun {
+			fmt.Println("\nSecurity Hub export:")
+			for _, input := range securityHubBatches(securityHubFindings(findings, nil, nil, a.accountID, region, time.Now())) {
+				printDryRun("BatchImportFindings", region, input)
+			}
+			break
+		}
+		// the findings of the previous exports are only archived for the buckets whose settings could all be read
+		covered := map[string]bool{}
+		for _, result := range results {
+			if result.restored || len(result.Errors) > 0 {
+				continue
+			}
+			for _, check := range builtinChecks {
+				if a.checks.enabled(check) {
+					covered[securityHubID(result.Name, check)] = true
+				}
+			}
+		}
+		imported, archived, err := exportSecurityHub(c, newSecurityHubClient(a.cfg, region), findings, covered, a.accountID, region)
+		if err != nil {
+			log.Printf("Got an error exporting findings to Security Hub in region %v: %v", region, err)
+		}
+		fmt.Printf("\nExported %d finding(s) to Security Hub in %s, %d of them archived as gone\n", imported, region, archived)
+	}
+
+	if a.jira != nil {
+		// the issues of a bucket are only closed when all its settings could be read
+		covered := map[string]bool{}
+		for _, result := range results {
+			if result.restored || len(result.Errors) > 0 {
+				continue
+			}
+			for _, check := range builtinChecks {
+				if a.checks.enabled(check) {
+					covered[jiraFindingLabel(check, result.Name)] = true
+				}
+			}
+		}
+		fmt.Println("\nJira:")
+		tickets := jiraTickets(results, findings, a.production)
+		if err := syncJira(c, a.jira, a.options.JiraProject, tickets, covered, a.options.DryRun); err != nil {
+			log.Printf("Got an error synchronizing the Jira issues: %v", err)
+		}
+	}
+
+	selected := parseFixes(a.options.Fix)
+	if a.options.Plan != "" {
+		var planned []remediation
+		for _, r := range remediations {
+			if len(selected) == 0 || selected[r.name] {
+				planned = append(planned, r)
+			}
+		}
+		if err := savePlan(a.options.Plan, planned); err != nil {
+			log.Printf("Got an error writing the plan to %v: %v", a.options.Plan, err)
+		} else {
+			fmt.Printf("\nWrote %d remediation(s) to the plan %s, review it and apply it with -apply %s\n",
+				len(planned), a.options.Plan, a.options.Plan)
+		}
+		// the planned remediations are only suggested, they are applied from the plan
+		selected = fixes{}
+	}
+	runRemediations(c, a.cfg, a.options.AccountID, remediations, selected, a.options.DryRun)
+
+	a.calls.print()
+	a.limiter.print()
+
+	// the checkpoint is kept for the buckets left out of it, which a resumed scan audits
+	if unrecorded == 0 && auditErrors == 0 && !a.calls.exceeded() {
+		if err := a.checkpoint.remove(); err != nil {
+			log.Printf("Got an error removing the checkpoint %v: %v", a.options.Checkpoint, err)
+		}
+	} else {
+		fmt.Printf("\nScan incomplete: %d bucket(s) cut short or not recorded, %d error(s) auditing buckets\n", unrecorded, auditErrors)
+		if a.options.Checkpoint != "" {
+			fmt.Printf("The checkpoint %s is kept, run again with -resume to audit the rest\n", a.options.Checkpoint)
+		}
+	}
+
+	fmt.Println("\nStatistics:")
+	writeStatistics(os.Stdout, stats)
+
+	return a.options.FailOn != "" && counter.failing > 0, nil
+}
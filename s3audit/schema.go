@@ -0,0 +1,128 @@
+package s3audit
+
+import (
+	"io"
+)
+
+// ReportSchemaVersion is the version of the layout of the JSON report. It is raised whenever a field is
+// renamed, removed or changes meaning; new fields do not change it.
+const ReportSchemaVersion = 2
+
+// reportSchema is the JSON Schema of the JSON report of the current version
+const reportSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "urn:s3audit:report:2",
+  "title": "S3 audit report",
+  "type": "object",
+  "required": ["schema_version", "accountId", "generated", "buckets", "findings"],
+  "properties": {
+    "schema_version": {"const": 2},
+    "accountId": {"type": "string"},
+    "accountAlias": {"type": "string"},
+    "callerArn": {"type": "string"},
+    "scanTime": {"type": "string", "format": "date-time"},
+    "generated": {"type": "string", "format": "date-time"},
+    "buckets": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["name", "region", "created", "riskScore"],
+        "properties": {
+          "name": {"type": "string"},
+          "region": {"type": "string"},
+          "arn": {"type": "string"},
+          "consoleUrl": {"type": "string", "format": "uri"},
+          "created": {"type": "string", "format": "date-time"},
+          "sizeBytes": {"type": "number", "minimum": 0},
+          "riskScore": {"type": "integer", "minimum": 0},
+          "encryption": {
+            "type": "object",
+            "required": ["algorithm"],
+            "properties": {
+              "algorithm": {"type": "string"},
+              "keyId": {"type": "string"}
+            }
+          },
+          "versioning": {"type": "string"},
+          "public": {"type": "boolean"},
+          "tags": {"type": "object", "additionalProperties": {"type": "string"}},
+          "unchecked": {"type": "array", "items": {"type": "string"}},
+          "creator": {
+            "type": "object",
+            "required": ["principal", "created", "source"],
+            "properties": {
+              "principal": {"type": "string"},
+              "created": {"type": "string", "format": "date-time"},
+              "source": {"enum": ["cloudtrail", "athena"]}
+            }
+          },
+          "cost": {
+            "type": "object",
+            "required": ["tag", "value", "start", "end", "amount", "unit", "sharedBy"],
+            "properties": {
+              "tag": {"type": "string"},
+              "value": {"type": "string"},
+              "start": {"type": "string", "format": "date"},
+              "end": {"type": "string", "format": "date"},
+              "amount": {"type": "number"},
+              "unit": {"type": "string"},
+              "sharedBy": {"type": "integer", "minimum": 1}
+            }
+          }
+        }
+      }
+    },
+    "statistics": {
+      "type": "object",
+      "required": ["buckets", "regions", "public", "failures", "findings"],
+      "properties": {
+        "buckets": {"type": "integer", "minimum": 0},
+        "regions": {"type": "object", "additionalProperties": {"type": "integer"}},
+        "encryptedPercent": {"type": "number", "minimum": 0, "maximum": 100},
+        "versionedPercent": {"type": "number", "minimum": 0, "maximum": 100},
+        "public": {"type": "integer", "minimum": 0},
+        "failures": {"type": "integer", "minimum": 0},
+        "findings": {"type": "object", "additionalProperties": {"type": "integer"}},
+        "costTagCoverage": {"type": "object", "additionalProperties": {"type": "number", "minimum": 0, "maximum": 100}},
+        "costTaggedPercent": {"type": "number", "minimum": 0, "maximum": 100}
+      }
+    },
+    "kmsKeys": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "required": ["key", "region", "buckets"],
+        "properties": {
+          "key": {"type": "string"},
+          "region": {"type": "string"},
+          "manager": {"enum": ["AWS", "CUSTOMER"]},
+          "buckets": {"type": "array", "items": {"type": "string"}},
+          "rotation": {"type": "boolean"},
+          "principals": {"type": "integer", "minimum": 0},
+          "error": {"type": "string"}
+        }
+      }
+    },
+    "findings": {
+      "type": ["array", "null"],
+      "items": {
+        "type": "object",
+        "required": ["bucket", "check", "severity", "message"],
+        "properties": {
+          "bucket": {"type": "string"},
+          "check": {"type": "string"},
+          "severity": {"enum": ["LOW", "MEDIUM", "HIGH", "CRITICAL"]},
+          "message": {"type": "string"},
+          "suppressed": {"type": "string"}
+        }
+      }
+    }
+  }
+}
+`
+
+// WriteSchema writes the JSON Schema of the JSON report, for the consumers of the report to validate it.
+func WriteSchema(w io.Writer) error {
+	_, err := io.WriteString(w, reportSchema)
+	return err
+}
@@ -0,0 +1,113 @@
+package s3audit
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The weights of the risk factors of a bucket. Exposure weighs most, then the sensitivity of the data, then
+// the lack of encryption at rest.
+const (
+	publicWeight      = 50
+	sensitiveWeight   = 30
+	unencryptedWeight = 20
+)
+
+// bucketRisk defines the risk factors of a bucket and the score they add up to
+type bucketRisk struct {
+	public      bool
+	sensitive   bool
+	unencrypted bool
+	score       int
+}
+
+// scoreBucket evaluates the risk factors of a bucket. A bucket is public when its policy looks public, its ACL
+// grants access to everyone or to any AWS account, Access Analyzer confirms public access or one of its access
+// points is public; it is sensitive when it carries a sensitive tag or Macie detected sensitive data in it.
+func scoreBucket(b s3Bucket, sensitive tagMatcher) bucketRisk {
+	var risk bucketRisk
+
+	risk.public = b.policyPublic || aclPublic(b.acl)
+	for _, access := range b.externalAccess {
+		risk.public = risk.public || access.public
+	}
+	for _, a := range b.accessPoints {
+		risk.public = risk.public || a.public
+	}
+	_, tagged := sensitive.match(b.tags)
+	risk.sensitive = tagged || len(b.sensitiveData) > 0
+	risk.unencrypted = b.encryptionState != encryptionUnknown && encryptionAlgorithm(b) == ""
+
+	if risk.public {
+		risk.score += publicWeight
+	}
+	if risk.sensitive {
+		risk.score += sensitiveWeight
+	}
+	if risk.unencrypted {
+		risk.score += unencryptedWeight
+	}
+	return risk
+}
+
+// riskFinding flags a bucket combining risk factors: all three make it critical, exposure or unencrypted
+// sensitive data make it high.
+func riskFinding(b s3Bucket, risk bucketRisk) (finding, bool) {
+	var factors []string
+	if risk.public {
+		factors = append(factors, "public")
+	}
+	if risk.unencrypted {
+		factors = append(factors, "unencrypted")
+	}
+	if risk.sensitive {
+		factors = append(factors, "sensitive")
+	}
+
+	f := finding{bucket: b.name, check: "risk", message: fmt.Sprintf("bucket is %s (risk score %d)", strings.Join(factors, ", "), risk.score)}
+	switch {
+	case risk.public && risk.sensitive && risk.unencrypted:
+		f.severity = severityCritical
+	case risk.sensitive && (risk.public || risk.unencrypted):
+		f.severity = severityHigh
+	default:
+		return finding{}, false
+	}
+	return f, true
+}
+
+// printPriorities prints the n findings to fix first: unsuppressed findings ordered by severity, then by the
+// risk score of their bucket.
+func printPriorities(findings []finding, scores map[string]int, n int, color bool) {
+	var active []finding
+	for _, f := range findings {
+		if f.suppressed == "" {
+			active = append(active, f)
+		}
+	}
+	sort.SliceStable(active, func(i, j int) bool {
+		if active[i].severity != active[j].severity {
+			return active[i].severity > active[j].severity
+		}
+		return scores[active[i].bucket] > scores[active[j].bucket]
+	})
+	if len(active) > n {
+		active = active[:n]
+	}
+
+	fmt.Printf("\nTop %d priorities:\n", n)
+	if len(active) == 0 {
+		fmt.Println("Nothing to fix")
+		return
+	}
+	t := newTable(color, column{header: "#"}, column{header: "SEVERITY"}, column{header: "BUCKET"},
+		column{header: "RISK"}, column{header: "CHECK"}, column{header: "MESSAGE", max: 120})
+	for i, f := range active {
+		t.add(cell{text: strconv.Itoa(i + 1)}, cell{text: f.severity.String(), color: severityColor(f.severity, false)},
+			cell{text: f.bucket}, cell{text: strconv.Itoa(scores[f.bucket])}, cell{text: f.check}, cell{text: f.message})
+	}
+	t.write(os.Stdout)
+}
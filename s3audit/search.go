@@ -0,0 +1,347 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// searchFields are the fields of the snapshots a search query compares, besides the tags, tag.<key>
+var searchFields = map[string]func(s BucketSnapshot) []string{
+	"name":       func(s BucketSnapshot) []string { return []string{s.Bucket} },
+	"bucket":     func(s BucketSnapshot) []string { return []string{s.Bucket} },
+	"account":    func(s BucketSnapshot) []string { return []string{s.AccountID} },
+	"region":     func(s BucketSnapshot) []string { return []string{s.Region} },
+	"encryption": func(s BucketSnapshot) []string { return []string{s.Encryption} },
+	"public":     func(s BucketSnapshot) []string { return []string{strconv.FormatBool(s.Public)} },
+	"versioning": func(s BucketSnapshot) []string { return []string{orNone(s.Versioning)} },
+	"risk":       func(s BucketSnapshot) []string { return []string{strconv.Itoa(s.RiskScore)} },
+	// a bucket matches check=... or severity=... when one of its unsuppressed findings does
+	"check": func(s BucketSnapshot) []string {
+		var checks []string
+		for _, f := range s.Findings {
+			if f.Suppressed == "" {
+				checks = append(checks, f.Check)
+			}
+		}
+		return checks
+	},
+	"severity": func(s BucketSnapshot) []string {
+		var severities []string
+		for _, f := range s.Findings {
+			if f.Suppressed == "" {
+				severities = append(severities, f.Severity)
+			}
+		}
+		return severities
+	},
+}
+
+// searchQuery is a parsed search expression, evaluated against the snapshot of a bucket.
+type searchQuery interface {
+	match(s BucketSnapshot) bool
+}
+
+type searchAnd struct{ left, right searchQuery }
+
+func (q searchAnd) match(s BucketSnapshot) bool { return q.left.match(s) && q.right.match(s) }
+
+type searchOr struct{ left, right searchQuery }
+
+func (q searchOr) match(s BucketSnapshot) bool { return q.left.match(s) || q.right.match(s) }
+
+type searchNot struct{ query searchQuery }
+
+func (q searchNot) match(s BucketSnapshot) bool { return !q.query.match(s) }
+
+// searchComparison compares a field with a value: = and != match a glob pattern, case insensitively, and
+// <, <=, > and >= compare numbers.
+type searchComparison struct {
+	field    string
+	operator string
+	value    string
+}
+
+func (q searchComparison) match(s BucketSnapshot) bool {
+	var values []string
+	if key := strings.TrimPrefix(q.field, "tag."); key != q.field {
+		if value, ok := s.Tags[key]; ok {
+			values = []string{value}
+		}
+	} else {
+		values = searchFields[q.field](s)
+	}
+
+	switch q.operator {
+	case "=", "!=":
+		matched := false
+		for _, value := range values {
+			if ok, _ := path.Match(strings.ToLower(q.value), strings.ToLower(value)); ok {
+				matched = true
+			}
+		}
+		return matched == (q.operator == "=")
+	}
+	limit, _ := strconv.ParseFloat(q.value, 64)
+	for _, value := range values {
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		switch {
+		case q.operator == "<" && n < limit, q.operator == "<=" && n <= limit,
+			q.operator == ">" && n > limit, q.operator == ">=" && n >= limit:
+			return true
+		}
+	}
+	return false
+}
+
+// searchOperators are the comparison operators, the two-character ones first
+var searchOperators = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// tokenizeSearch splits a search expression into words, quoted values, parentheses and operators.
+func tokenizeSearch(expression string) ([]string, error) {
+	var tokens []string
+	runes := []rune(expression)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			if end == len(runes) {
+				return nil, fmt.Errorf("unterminated quote at %d", i)
+			}
+			// the quotes are kept so a quoted AND is a value
+			tokens = append(tokens, string(runes[i:end+1]))
+			i = end + 1
+		default:
+			operator := ""
+			for _, op := range searchOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					operator = op
+					break
+				}
+			}
+			if operator != "" {
+				tokens = append(tokens, operator)
+				i += len([]rune(operator))
+				continue
+			}
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"=!<>`, runes[end]) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected %q at %d", r, i)
+			}
+			tokens = append(tokens, string(runes[i:end]))
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+// searchParser parses the tokens of a search expression: comparisons combined with NOT, AND and OR, in this
+// order of precedence, and grouped with parentheses.
+type searchParser struct {
+	tokens []string
+	next   int
+}
+
+// parseSearch parses a search expression, e.g. encryption=none AND tag.env=prod AND region=eu-*.
+func parseSearch(expression string) (searchQuery, error) {
+	tokens, err := tokenizeSearch(expression)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty expression")
+	}
+	p := &searchParser{tokens: tokens}
+	query, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.next < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q", p.tokens[p.next])
+	}
+	return query, nil
+}
+
+// peek returns the next token, "" at the end of the expression.
+func (p *searchParser) peek() string {
+	if p.next < len(p.tokens) {
+		return p.tokens[p.next]
+	}
+	return ""
+}
+
+// keyword reports whether the next token is a keyword, case insensitively, and consumes it if so.
+func (p *searchParser) keyword(keyword string) bool {
+	if strings.EqualFold(p.peek(), keyword) {
+		p.next++
+		return true
+	}
+	return false
+}
+
+func (p *searchParser) or() (searchQuery, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("OR") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = searchOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *searchParser) and() (searchQuery, error) {
+	left, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("AND") {
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		left = searchAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *searchParser) unary() (searchQuery, error) {
+	if p.keyword("NOT") {
+		query, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return searchNot{query}, nil
+	}
+	if p.peek() == "(" {
+		p.next++
+		query, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("missing )")
+		}
+		p.next++
+		return query, nil
+	}
+	return p.comparison()
+}
+
+func (p *searchParser) comparison() (searchQuery, error) {
+	if p.next+3 > len(p.tokens) {
+		return nil, fmt.Errorf("incomplete comparison at the end of the expression, expected field=value")
+	}
+	field, operator, value := p.tokens[p.next], p.tokens[p.next+1], p.tokens[p.next+2]
+	// the keys of the tags are case sensitive, the other fields are not
+	if !strings.HasPrefix(field, "tag.") {
+		field = strings.ToLower(field)
+	}
+	if _, ok := searchFields[field]; !ok && !strings.HasPrefix(field, "tag.") {
+		return nil, fmt.Errorf("unknown field %q, expected one of: account, bucket, check, encryption, name, public, region, risk, severity, tag.<key>, versioning", field)
+	}
+	known := false
+	for _, op := range searchOperators {
+		known = known || op == operator
+	}
+	if !known {
+		return nil, fmt.Errorf("expected an operator after %s, one of: %s", field, strings.Join(searchOperators, " "))
+	}
+	value = strings.Trim(value, `"`)
+	if operator != "=" && operator != "!=" {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%s %s %s compares numbers, %q is not one", field, operator, value, value)
+		}
+	}
+	p.next += 3
+	return searchComparison{field: field, operator: operator, value: value}, nil
+}
+
+// lastScans keeps the snapshots of the last scan of each account.
+func lastScans(snapshots []BucketSnapshot) []BucketSnapshot {
+	latest := map[string]time.Time{}
+	for _, s := range snapshots {
+		if s.ScanTime.After(latest[s.AccountID]) {
+			latest[s.AccountID] = s.ScanTime
+		}
+	}
+	var last []BucketSnapshot
+	for _, s := range snapshots {
+		if s.ScanTime.Equal(latest[s.AccountID]) {
+			last = append(last, s)
+		}
+	}
+	return last
+}
+
+// Search writes the buckets of a history, e.g. dynamodb://table or postgres://host/database, matching a search
+// expression such as encryption=none AND tag.env=prod AND region=eu-*. Only the last scan of each account in
+// the period is searched, unless all is set, then every scan of the period is.
+func Search(c context.Context, cfg aws.Config, location string, expression string, period time.Duration, all bool, w io.Writer) error {
+	query, err := parseSearch(expression)
+	if err != nil {
+		return fmt.Errorf("invalid expression %q: %v", expression, err)
+	}
+
+	history, err := openHistory(c, cfg, location)
+	if err != nil {
+		return fmt.Errorf("opening the history: %v", err)
+	}
+	snapshots, err := history.since(c, time.Now().Add(-period))
+	if err != nil {
+		return fmt.Errorf("reading the history: %v", err)
+	}
+	if !all {
+		snapshots = lastScans(snapshots)
+	}
+
+	var matched []BucketSnapshot
+	for _, s := range snapshots {
+		if query.match(s) {
+			matched = append(matched, s)
+		}
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		if matched[i].Bucket != matched[j].Bucket {
+			return matched[i].Bucket < matched[j].Bucket
+		}
+		return matched[i].ScanTime.Before(matched[j].ScanTime)
+	})
+
+	t := newTable(false, column{header: "BUCKET"}, column{header: "ACCOUNT"}, column{header: "REGION"}, column{header: "ENCRYPTION"},
+		column{header: "PUBLIC"}, column{header: "VERSIONING"}, column{header: "RISK"}, column{header: "SCAN"})
+	for _, s := range matched {
+		t.add(cell{text: s.Bucket}, cell{text: s.AccountID}, cell{text: s.Region}, cell{text: s.Encryption},
+			cell{text: strconv.FormatBool(s.Public)}, cell{text: orNone(s.Versioning)}, cell{text: strconv.Itoa(s.RiskScore)},
+			cell{text: s.ScanTime.Format("2006-01-02 15:04")})
+	}
+	t.write(w)
+	fmt.Fprintf(w, "\n%d of %d bucket snapshot(s) match\n", len(matched), len(snapshots))
+	return nil
+}
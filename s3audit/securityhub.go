@@ -0,0 +1,354 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub"
+	"github.com/aws/aws-sdk-go-v2/service/securityhub/types"
+	"log"
+	"sort"
+	"time"
+)
+
+// SecurityHubBatchImportFindingsApi defines the interface for the BatchImportFindings function.
+// We use this interface to test the function using a mocked service.
+type SecurityHubBatchImportFindingsApi interface {
+	BatchImportFindings(ctx context.Context,
+		params *securityhub.BatchImportFindingsInput,
+		optFns ...func(*securityhub.Options)) (*securityhub.BatchImportFindingsOutput, error)
+}
+
+// SecurityHubGetFindingsApi defines the interface for the GetFindings function.
+// We use this interface to test the function using a mocked service.
+type SecurityHubGetFindingsApi interface {
+	GetFindings(ctx context.Context,
+		params *securityhub.GetFindingsInput,
+		optFns ...func(*securityhub.Options)) (*securityhub.GetFindingsOutput, error)
+}
+
+// SecurityHubBatchUpdateFindingsApi defines the interface for the BatchUpdateFindings function.
+// We use this interface to test the function using a mocked service.
+type SecurityHubBatchUpdateFindingsApi interface {
+	BatchUpdateFindings(ctx context.Context,
+		params *securityhub.BatchUpdateFindingsInput,
+		optFns ...func(*securityhub.Options)) (*securityhub.BatchUpdateFindingsOutput, error)
+}
+
+// securityHubApi groups the Security Hub calls of the export.
+type securityHubApi interface {
+	SecurityHubBatchImportFindingsApi
+	SecurityHubGetFindingsApi
+	SecurityHubBatchUpdateFindingsApi
+}
+
+// securityHubBatchSize is the maximum number of findings BatchImportFindings and BatchUpdateFindings accept
+// per call
+const securityHubBatchSize = 100
+
+// securityHubNoteAuthor signs the notes of the findings the export suppresses, so it only lifts its own
+// suppressions.
+const securityHubNoteAuthor = "s3-audit"
+
+// BatchImportFindings imports findings in AWS Security Finding Format into Security Hub.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a BatchImportFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to BatchImportFindings.
+func BatchImportFindings(c context.Context, api SecurityHubBatchImportFindingsApi, input *securityhub.BatchImportFindingsInput) (*securityhub.BatchImportFindingsOutput, error) {
+	return api.BatchImportFindings(c, input)
+}
+
+// GetFindings returns the findings matching the filters, a page at a time.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetFindings.
+func GetFindings(c context.Context, api SecurityHubGetFindingsApi, input *securityhub.GetFindingsInput) (*securityhub.GetFindingsOutput, error) {
+	return api.GetFindings(c, input)
+}
+
+// BatchUpdateFindings updates the workflow status and the note of up to 100 findings, as a customer would.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a BatchUpdateFindingsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to BatchUpdateFindings.
+func BatchUpdateFindings(c context.Context, api SecurityHubBatchUpdateFindingsApi, input *securityhub.BatchUpdateFindingsInput) (*securityhub.BatchUpdateFindingsOutput, error) {
+	return api.BatchUpdateFindings(c, input)
+}
+
+// newSecurityHubClient returns a Security Hub client for a region.
+func newSecurityHubClient(cfg aws.Config, region string) *securityhub.Client {
+	return securityhub.NewFromConfig(cfg, func(options *securityhub.Options) {
+		options.Region = region
+	})
+}
+
+// securityHubID returns the ID of the finding of a check on a bucket. It only depends on the bucket and the
+// check, so exporting again updates the finding, with its latest message, instead of creating a duplicate.
+func securityHubID(bucket string, check string) string {
+	return fmt.Sprintf("s3-audit/%s/%s", bucket, check)
+}
+
+// securityHubProductArn returns the ARN of the default product of the account in region, the product of the
+// findings imported by the account itself.
+func securityHubProductArn(accountID string, region string) string {
+	return fmt.Sprintf("arn:%s:securityhub:%s:%s:product/%s/default", partitionOf(region), region, accountID, accountID)
+}
+
+// mergeSecurityHubFindings merges the findings of a check on a bucket into one, as they share their ID: the
+// highest severity and the messages joined. The merged finding is suppressed when all of them are.
+func mergeSecurityHubFindings(findings []finding) []finding {
+	var merged []finding
+	index := map[string]int{}
+	for _, f := range findings {
+		id := securityHubID(f.bucket, f.check)
+		i, ok := index[id]
+		if !ok {
+			index[id] = len(merged)
+			merged = append(merged, f)
+			continue
+		}
+		if f.severity > merged[i].severity {
+			merged[i].severity = f.severity
+		}
+		merged[i].message += "; " + f.message
+		if f.suppressed == "" {
+			merged[i].suppressed = ""
+		}
+	}
+	return merged
+}
+
+// toASFF converts a finding to the AWS Security Finding Format, as a finding of the default product of the
+// account in region, first seen at created. A suppressed finding is imported with the SUPPRESSED workflow
+// status, which Security Hub only takes from a new finding; securityHubWorkflowUpdates sets the one of an
+// existing finding.
+func toASFF(f finding, accountID string, region string, created time.Time, now time.Time) types.AwsSecurityFinding {
+	timestamp := now.UTC().Format(time.RFC3339)
+	asff := types.AwsSecurityFinding{
+		SchemaVersion:   aws.String("2018-10-08"),
+		Id:              aws.String(securityHubID(f.bucket, f.check)),
+		ProductArn:      aws.String(securityHubProductArn(accountID, region)),
+		GeneratorId:     aws.String("s3-audit/" + f.check),
+		AwsAccountId:    aws.String(accountID),
+		Types:           []string{"Software and Configuration Checks/AWS Security Best Practices"},
+		CreatedAt:       aws.String(created.UTC().Format(time.RFC3339)),
+		UpdatedAt:       aws.String(timestamp),
+		FirstObservedAt: aws.String(created.UTC().Format(time.RFC3339)),
+		LastObservedAt:  aws.String(timestamp),
+		Severity:        &types.Severity{Label: types.SeverityLabel(f.severity.String())},
+		Title:           aws.String(fmt.Sprintf("S3 audit %s check failed for bucket %s", f.check, f.bucket)),
+		Description:     aws.String(f.message),
+		Resources: []types.Resource{{
+			Type: aws.String("AwsS3Bucket"),
+			Id:   aws.String(bucketArn(partitionOf(region), f.bucket)),
+		}},
+		RecordState: types.RecordStateActive,
+	}
+	if f.suppressed != "" {
+		asff.Workflow = &types.Workflow{Status: types.WorkflowStatusSuppressed}
+		asff.Note = &types.Note{Text: aws.String(f.suppressed), UpdatedBy: aws.String(securityHubNoteAuthor), UpdatedAt: aws.String(timestamp)}
+	}
+	return asff
+}
+
+// archivedASFF returns a finding of a previous export that is gone, archived: Security Hub resolves the
+// workflow of an archived finding.
+func archivedASFF(existing types.AwsSecurityFinding, now time.Time) types.AwsSecurityFinding {
+	return types.AwsSecurityFinding{
+		SchemaVersion: existing.SchemaVersion,
+		Id:            existing.Id,
+		ProductArn:    existing.ProductArn,
+		GeneratorId:   existing.GeneratorId,
+		AwsAccountId:  existing.AwsAccountId,
+		Types:         existing.Types,
+		CreatedAt:     existing.CreatedAt,
+		UpdatedAt:     aws.String(now.UTC().Format(time.RFC3339)),
+		Severity:      existing.Severity,
+		Title:         existing.Title,
+		Description:   existing.Description,
+		Resources:     existing.Resources,
+		RecordState:   types.RecordStateArchived,
+	}
+}
+
+// getSecurityHubFindings returns the active findings of the previous exports of the account to the Security
+// Hub of region, by ID.
+func getSecurityHubFindings(c context.Context, api SecurityHubGetFindingsApi, accountID string, region string) (map[string]types.AwsSecurityFinding, error) {
+	existing := map[string]types.AwsSecurityFinding{}
+	input := &securityhub.GetFindingsInput{
+		Filters: &types.AwsSecurityFindingFilters{
+			ProductArn:  []types.StringFilter{{Comparison: types.StringFilterComparisonEquals, Value: aws.String(securityHubProductArn(accountID, region))}},
+			Id:          []types.StringFilter{{Comparison: types.StringFilterComparisonPrefix, Value: aws.String("s3-audit/")}},
+			RecordState: []types.StringFilter{{Comparison: types.StringFilterComparisonEquals, Value: aws.String(string(types.RecordStateActive))}},
+		},
+		MaxResults: aws.Int32(securityHubBatchSize),
+	}
+	for {
+		output, err := GetFindings(c, api, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range output.Findings {
+			existing[aws.ToString(f.Id)] = f
+		}
+		if output.NextToken == nil {
+			return existing, nil
+		}
+		input.NextToken = output.NextToken
+	}
+}
+
+// securityHubFindings returns the findings of an export in ASFF: the findings of the audit, keeping the
+// creation time of the ones already exported, then the active findings of the previous exports that are gone,
+// archived. Only the findings of covered, the IDs of the checks run on the buckets whose settings could all
+// be read, are archived, the others may only be missing from a partial audit.
+func securityHubFindings(findings []finding, existing map[string]types.AwsSecurityFinding, covered map[string]bool,
+	accountID string, region string, now time.Time) []types.AwsSecurityFinding {
+	var asff []types.AwsSecurityFinding
+	found := map[string]bool{}
+	for _, f := range mergeSecurityHubFindings(findings) {
+		id := securityHubID(f.bucket, f.check)
+		found[id] = true
+		created := now
+		if previous, ok := existing[id]; ok {
+			if t, err := time.Parse(time.RFC3339, aws.ToString(previous.CreatedAt)); err == nil {
+				created = t
+			}
+		}
+		asff = append(asff, toASFF(f, accountID, region, created, now))
+	}
+
+	var gone []string
+	for id := range existing {
+		if !found[id] && covered[id] {
+			gone = append(gone, id)
+		}
+	}
+	sort.Strings(gone)
+	for _, id := range gone {
+		asff = append(asff, archivedASFF(existing[id], now))
+	}
+	return asff
+}
+
+// securityHubBatches splits the findings into batches of the size BatchImportFindings accepts.
+func securityHubBatches(asff []types.AwsSecurityFinding) []*securityhub.BatchImportFindingsInput {
+	var batches []*securityhub.BatchImportFindingsInput
+	for start := 0; start < len(asff); start += securityHubBatchSize {
+		end := start + securityHubBatchSize
+		if end > len(asff) {
+			end = len(asff)
+		}
+		batches = append(batches, &securityhub.BatchImportFindingsInput{Findings: asff[start:end]})
+	}
+	return batches
+}
+
+// securityHubWorkflowUpdates returns the updates of the workflow of the findings already exported, which
+// BatchImportFindings leaves as is: the findings suppressed since are suppressed, with the reason as note, and
+// the findings whose suppression by the export ended are set back to NEW.
+func securityHubWorkflowUpdates(findings []finding, existing map[string]types.AwsSecurityFinding) []*securityhub.BatchUpdateFindingsInput {
+	type update struct {
+		status types.WorkflowStatus
+		note   string
+	}
+	identifiers := map[update][]types.AwsSecurityFindingIdentifier{}
+	var updates []update
+	for _, f := range mergeSecurityHubFindings(findings) {
+		previous, ok := existing[securityHubID(f.bucket, f.check)]
+		if !ok {
+			continue
+		}
+		status := types.WorkflowStatusNew
+		if previous.Workflow != nil {
+			status = previous.Workflow.Status
+		}
+		suppressedByExport := status == types.WorkflowStatusSuppressed && previous.Note != nil &&
+			aws.ToString(previous.Note.UpdatedBy) == securityHubNoteAuthor
+
+		var u update
+		switch {
+		case f.suppressed != "" && (status != types.WorkflowStatusSuppressed || suppressedByExport && aws.ToString(previous.Note.Text) != f.suppressed):
+			u = update{status: types.WorkflowStatusSuppressed, note: f.suppressed}
+		case f.suppressed == "" && suppressedByExport:
+			u = update{status: types.WorkflowStatusNew, note: "suppression ended"}
+		default:
+			continue
+		}
+		if _, ok := identifiers[u]; !ok {
+			updates = append(updates, u)
+		}
+		identifiers[u] = append(identifiers[u], types.AwsSecurityFindingIdentifier{Id: previous.Id, ProductArn: previous.ProductArn})
+	}
+
+	var inputs []*securityhub.BatchUpdateFindingsInput
+	for _, u := range updates {
+		ids := identifiers[u]
+		for start := 0; start < len(ids); start += securityHubBatchSize {
+			end := start + securityHubBatchSize
+			if end > len(ids) {
+				end = len(ids)
+			}
+			inputs = append(inputs, &securityhub.BatchUpdateFindingsInput{
+				FindingIdentifiers: ids[start:end],
+				Workflow:           &types.WorkflowUpdate{Status: u.status},
+				Note:               &types.NoteUpdate{Text: aws.String(u.note), UpdatedBy: aws.String(securityHubNoteAuthor)},
+			})
+		}
+	}
+	return inputs
+}
+
+// exportSecurityHub imports the findings into the Security Hub of region in batches of securityHubBatchSize,
+// archives the findings of the previous exports that are gone from covered, and updates the workflow of the
+// findings suppressed or unsuppressed since. It returns the number of findings imported, archived ones
+// included, and of findings archived; the findings Security Hub rejects are logged.
+func exportSecurityHub(c context.Context, api securityHubApi, findings []finding, covered map[string]bool, accountID string,
+	region string) (int, int, error) {
+	existing, err := getSecurityHubFindings(c, api, accountID, region)
+	if err != nil {
+		return 0, 0, fmt.Errorf("reading the findings of the previous exports: %v", err)
+	}
+	asff := securityHubFindings(findings, existing, covered, accountID, region, time.Now())
+	archived := 0
+	for _, f := range asff {
+		if f.RecordState == types.RecordStateArchived {
+			archived++
+		}
+	}
+
+	imported := 0
+	for _, input := range securityHubBatches(asff) {
+		output, err := BatchImportFindings(c, api, input)
+		if err != nil {
+			return imported, archived, err
+		}
+		imported += int(aws.ToInt32(output.SuccessCount))
+		for _, failed := range output.FailedFindings {
+			log.Printf("Security Hub rejected finding %v: %v %v", aws.ToString(failed.Id), aws.ToString(failed.ErrorCode), aws.ToString(failed.ErrorMessage))
+		}
+	}
+
+	for _, input := range securityHubWorkflowUpdates(findings, existing) {
+		output, err := BatchUpdateFindings(c, api, input)
+		if err != nil {
+			return imported, archived, err
+		}
+		for _, failed := range output.UnprocessedFindings {
+			log.Printf("Security Hub did not update the workflow of finding %v: %v %v", aws.ToString(failed.FindingIdentifier.Id),
+				aws.ToString(failed.ErrorCode), aws.ToString(failed.ErrorMessage))
+		}
+	}
+	return imported, archived, nil
+}
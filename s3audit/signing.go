@@ -0,0 +1,373 @@
+package s3audit
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	"github.com/aws/aws-sdk-go-v2/service/kms/types"
+	"os"
+	"strings"
+)
+
+// KMSSignApi defines the interface for the Sign function.
+// We use this interface to test the function using a mocked service.
+type KMSSignApi interface {
+	Sign(ctx context.Context,
+		params *kms.SignInput,
+		optFns ...func(*kms.Options)) (*kms.SignOutput, error)
+}
+
+// KMSGetPublicKeyApi defines the interface for the GetPublicKey function.
+// We use this interface to test the function using a mocked service.
+type KMSGetPublicKeyApi interface {
+	GetPublicKey(ctx context.Context,
+		params *kms.GetPublicKeyInput,
+		optFns ...func(*kms.Options)) (*kms.GetPublicKeyOutput, error)
+}
+
+// KMSVerifyApi defines the interface for the Verify function.
+// We use this interface to test the function using a mocked service.
+type KMSVerifyApi interface {
+	Verify(ctx context.Context,
+		params *kms.VerifyInput,
+		optFns ...func(*kms.Options)) (*kms.VerifyOutput, error)
+}
+
+// Sign signs a message or its digest with the private key of a KMS asymmetric key, which never leaves KMS.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a SignOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to Sign.
+func Sign(c context.Context, api KMSSignApi, input *kms.SignInput) (*kms.SignOutput, error) {
+	return api.Sign(c, input)
+}
+
+// GetPublicKey returns the public key of a KMS asymmetric key and the signing algorithms it supports.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetPublicKeyOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetPublicKey.
+func GetPublicKey(c context.Context, api KMSGetPublicKeyApi, input *kms.GetPublicKeyInput) (*kms.GetPublicKeyOutput, error) {
+	return api.GetPublicKey(c, input)
+}
+
+// Verify verifies a signature made with a KMS asymmetric key.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a VerifyOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to Verify, a KMSInvalidSignatureException for a bad signature.
+func Verify(c context.Context, api KMSVerifyApi, input *kms.VerifyInput) (*kms.VerifyOutput, error) {
+	return api.Verify(c, input)
+}
+
+// kmsKeyPrefix marks a signing key held in KMS, kms:<key ID, key ARN, alias or alias ARN>, rather than a file.
+const kmsKeyPrefix = "kms:"
+
+// signatureSuffix is appended to the path of a file to name its detached signature.
+const signatureSuffix = ".sig"
+
+// signature is the detached signature of a file, with the algorithm and the key it was made with. Key
+// identifies the key: the ARN of a KMS key, or the SHA256 fingerprint of a local public key.
+type signature struct {
+	Algorithm string `json:"algorithm"`
+	Key       string `json:"key"`
+	Signature string `json:"signature"`
+}
+
+// signer signs the content of a file.
+type signer interface {
+	sign(c context.Context, message []byte) (signature, error)
+	// publicKey returns the PEM encoded public key verifying the signatures.
+	publicKey(c context.Context) ([]byte, error)
+}
+
+// newSigner returns the signer of a -sign-key: a KMS asymmetric key when prefixed with kms:, or the private
+// key of a PEM file.
+func newSigner(c context.Context, cfg aws.Config, key string) (signer, error) {
+	if !strings.HasPrefix(key, kmsKeyPrefix) {
+		return loadLocalSigner(key)
+	}
+	return newKMSSigner(c, cfg, strings.TrimPrefix(key, kmsKeyPrefix))
+}
+
+// keyFingerprint returns the SHA256 fingerprint of a public key, identifying a local signing key.
+func keyFingerprint(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// localSigner signs with a private key read from a PEM file: Ed25519, ECDSA or RSA.
+type localSigner struct {
+	key crypto.Signer
+}
+
+// loadLocalSigner reads a PKCS #8, SEC 1 (EC) or PKCS #1 (RSA) private key from a PEM file.
+func loadLocalSigner(path string) (*localSigner, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM encoded key", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading the key of %s: %v", path, err)
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return &localSigner{key: key}, nil
+	case *ecdsa.PrivateKey:
+		return &localSigner{key: key}, nil
+	case *rsa.PrivateKey:
+		return &localSigner{key: key}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T in %s, expected Ed25519, ECDSA or RSA", key, path)
+}
+
+// algorithm returns the name of the signing algorithm of the key, the name KMS uses for ECDSA and RSA.
+func (s *localSigner) algorithm() string {
+	switch s.key.(type) {
+	case ed25519.PrivateKey:
+		return "ED25519"
+	case *ecdsa.PrivateKey:
+		return "ECDSA_SHA_256"
+	}
+	return "RSASSA_PSS_SHA_256"
+}
+
+func (s *localSigner) sign(c context.Context, message []byte) (signature, error) {
+	fingerprint, err := keyFingerprint(s.key.Public())
+	if err != nil {
+		return signature{}, err
+	}
+
+	var value []byte
+	switch s.key.(type) {
+	case ed25519.PrivateKey:
+		// Ed25519 hashes the message itself
+		value, err = s.key.Sign(rand.Reader, message, crypto.Hash(0))
+	case *rsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		value, err = s.key.Sign(rand.Reader, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256})
+	default:
+		digest := sha256.Sum256(message)
+		value, err = s.key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return signature{}, err
+	}
+	return signature{Algorithm: s.algorithm(), Key: fingerprint, Signature: base64.StdEncoding.EncodeToString(value)}, nil
+}
+
+func (s *localSigner) publicKey(c context.Context) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(s.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// kmsSigner signs with a KMS asymmetric key of key usage SIGN_VERIFY, an ECC or RSA key.
+type kmsSigner struct {
+	client    *kms.Client
+	key       string
+	algorithm string
+	public    []byte
+}
+
+// newKMSSigner returns the signer of a KMS key, in the region of its ARN or the configured one. The algorithm
+// is ECDSA_SHA_256 or RSASSA_PSS_SHA_256, the SHA-256 algorithm the key supports.
+func newKMSSigner(c context.Context, cfg aws.Config, key string) (*kmsSigner, error) {
+	client := newKMSClient(cfg, kmsKeyRegion(key, cfg.Region))
+	public, err := GetPublicKey(c, client, &kms.GetPublicKeyInput{KeyId: aws.String(key)})
+	if err != nil {
+		return nil, fmt.Errorf("reading the public key of %s: %v", key, err)
+	}
+	if public.KeyUsage != types.KeyUsageTypeSignVerify {
+		return nil, fmt.Errorf("KMS key %s is not a signing key", key)
+	}
+	for _, algorithm := range []types.SigningAlgorithmSpec{types.SigningAlgorithmSpecEcdsaSha256, types.SigningAlgorithmSpecRsassaPssSha256} {
+		for _, supported := range public.SigningAlgorithms {
+			if supported == algorithm {
+				return &kmsSigner{client: client, key: aws.ToString(public.KeyId), algorithm: string(algorithm), public: public.PublicKey}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("KMS key %s supports neither ECDSA_SHA_256 nor RSASSA_PSS_SHA_256", key)
+}
+
+func (s *kmsSigner) sign(c context.Context, message []byte) (signature, error) {
+	digest := sha256.Sum256(message)
+	output, err := Sign(c, s.client, &kms.SignInput{
+		KeyId:            aws.String(s.key),
+		Message:          digest[:],
+		MessageType:      types.MessageTypeDigest,
+		SigningAlgorithm: types.SigningAlgorithmSpec(s.algorithm),
+	})
+	if err != nil {
+		return signature{}, err
+	}
+	return signature{Algorithm: s.algorithm, Key: s.key, Signature: base64.StdEncoding.EncodeToString(output.Signature)}, nil
+}
+
+func (s *kmsSigner) publicKey(c context.Context) ([]byte, error) {
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: s.public}), nil
+}
+
+// signFile writes the detached signature of a file next to it, in <path>.sig.
+func signFile(c context.Context, s signer, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sig, err := s.sign(c, data)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(sig, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+signatureSuffix, content, 0644)
+}
+
+// verifySignature checks a signature of a message with a public key, for the algorithms of the signers.
+func verifySignature(public crypto.PublicKey, sig signature, message []byte) error {
+	value, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	digest := sha256.Sum256(message)
+	switch key := public.(type) {
+	case ed25519.PublicKey:
+		if sig.Algorithm == "ED25519" && ed25519.Verify(key, message, value) {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if sig.Algorithm == string(types.SigningAlgorithmSpecEcdsaSha256) && ecdsa.VerifyASN1(key, digest[:], value) {
+			return nil
+		}
+	case *rsa.PublicKey:
+		if sig.Algorithm == string(types.SigningAlgorithmSpecRsassaPssSha256) &&
+			rsa.VerifyPSS(key, crypto.SHA256, digest[:], value, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto}) == nil {
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", public)
+	}
+	return fmt.Errorf("the signature does not match, the file was modified or signed with another key")
+}
+
+// VerifyFileSignature checks the detached signature <path>.sig of a report. The signature is checked against
+// the public key of the PEM file publicKey, which works offline, or by KMS for a signature made with a KMS key
+// when publicKey is empty. A local key must match the fingerprint of the signature, a KMS key must be the
+// expected key, kms:<key ID, key ARN, alias or alias ARN>: the key named by the signature file proves nothing
+// on its own, anyone can sign with a key of their own account.
+func VerifyFileSignature(c context.Context, cfg aws.Config, path string, publicKey string, key string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(path + signatureSuffix)
+	if err != nil {
+		return fmt.Errorf("reading the signature: %v", err)
+	}
+	var sig signature
+	if err := json.Unmarshal(content, &sig); err != nil {
+		return fmt.Errorf("parsing %s%s: %v", path, signatureSuffix, err)
+	}
+
+	if publicKey != "" {
+		pemData, err := os.ReadFile(publicKey)
+		if err != nil {
+			return err
+		}
+		block, _ := pem.Decode(pemData)
+		if block == nil {
+			return fmt.Errorf("%s holds no PEM encoded key", publicKey)
+		}
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("reading the key of %s: %v", publicKey, err)
+		}
+		if strings.HasPrefix(sig.Key, "sha256:") {
+			if fingerprint, err := keyFingerprint(public); err != nil || fingerprint != sig.Key {
+				return fmt.Errorf("signed with key %s, not with the key of %s", sig.Key, publicKey)
+			}
+		}
+		return verifySignature(public, sig, data)
+	}
+
+	if !strings.HasPrefix(sig.Key, "arn:") {
+		return fmt.Errorf("signed with local key %s, verify it with its public key, -public-key", sig.Key)
+	}
+	signedBy, err := arn.Parse(sig.Key)
+	if err != nil || signedBy.Service != "kms" {
+		return fmt.Errorf("invalid KMS key %s in the signature", sig.Key)
+	}
+	if !strings.HasPrefix(key, kmsKeyPrefix) {
+		return fmt.Errorf("signed with KMS key %s, verify it with the expected key, -key kms:<key>", sig.Key)
+	}
+	expected := strings.TrimPrefix(key, kmsKeyPrefix)
+	described, err := DescribeKey(c, newKMSClient(cfg, kmsKeyRegion(expected, cfg.Region)), &kms.DescribeKeyInput{KeyId: aws.String(expected)})
+	if err != nil {
+		return fmt.Errorf("describing the key %s: %v", expected, err)
+	}
+	if aws.ToString(described.KeyMetadata.Arn) != sig.Key {
+		return fmt.Errorf("signed with key %s, not with %s", sig.Key, expected)
+	}
+	value, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %v", err)
+	}
+	digest := sha256.Sum256(data)
+	_, err = Verify(c, newKMSClient(cfg, signedBy.Region), &kms.VerifyInput{
+		KeyId:            aws.String(sig.Key),
+		Message:          digest[:],
+		MessageType:      types.MessageTypeDigest,
+		Signature:        value,
+		SigningAlgorithm: types.SigningAlgorithmSpec(sig.Algorithm),
+	})
+	var invalid *types.KMSInvalidSignatureException
+	if errors.As(err, &invalid) {
+		return fmt.Errorf("the signature does not match, the file was modified or signed with another key")
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// historyBatchSize is the number of snapshots saved to the history at a time during a scan
+const historyBatchSize = 100
+
+// streamingFormats are the output formats written bucket by bucket during the scan, instead of once at the
+// end like the formats of reportWriters
+var streamingFormats = map[string]bool{
+	"jsonl": true,
+}
+
+// resultSink consumes the result of each bucket as soon as it is audited, so the settings read for a bucket
+// need not be kept until the end of the scan.
+type resultSink interface {
+	write(c context.Context, result BucketResult) error
+	// close flushes what the sink still buffers
+	close(c context.Context) error
+}
+
+// statisticsSink is a resultSink that also records the statistics of the scan, before it is closed.
+type statisticsSink interface {
+	writeStatistics(c context.Context, stats ReportStatistics) error
+}
+
+// openSinks returns the sinks of the options: the histories, and the streaming outputs.
+func (a *Auditor) openSinks(c context.Context, scanTime time.Time) ([]resultSink, error) {
+	var sinks []resultSink
+	if len(a.histories) > 0 {
+		sink := &historySink{auditor: a, scanTime: scanTime}
+		if a.options.PagerDuty {
+			var err error
+			if sink.previous, err = a.previousSnapshots(c, scanTime); err != nil {
+				return nil, fmt.Errorf("reading the previous scan from the history: %v", err)
+			}
+		}
+		sinks = append(sinks, sink)
+	}
+	for _, output := range a.outputs {
+		if !streamingFormats[output.format] {
+			continue
+		}
+		sink, err := newJSONLinesSink(output.path, a.redactor)
+		if err != nil {
+			return nil, fmt.Errorf("opening the %v output %v: %v", output.format, output.path, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	return sinks, nil
+}
+
+// historySink saves the snapshots of the buckets to the histories by batches of historyBatchSize. When
+// previous holds the snapshots of the previous scan, the regressions of each batch page on-call first.
+type historySink struct {
+	auditor  *Auditor
+	scanTime time.Time
+	previous map[string]BucketSnapshot
+	batch    []BucketSnapshot
+	saved    int
+}
+
+func (s *historySink) write(c context.Context, result BucketResult) error {
+	s.batch = append(s.batch, s.auditor.snapshot(result, s.scanTime))
+	if len(s.batch) < historyBatchSize {
+		return nil
+	}
+	return s.flush(c)
+}
+
+// flush saves the snapshots of the batch to every history.
+func (s *historySink) flush(c context.Context) error {
+	if len(s.batch) == 0 {
+		return nil
+	}
+	if s.previous != nil {
+		s.auditor.pageRegressions(c, findRegressions(s.previous, s.batch))
+	}
+
+	var failed error
+	for _, history := range s.auditor.histories {
+		if err := history.save(c, s.batch); err != nil {
+			failed = fmt.Errorf("saving the scan to the history: %v", err)
+		}
+	}
+	if failed == nil {
+		s.saved += len(s.batch)
+	}
+	s.batch = nil
+	return failed
+}
+
+func (s *historySink) close(c context.Context) error {
+	err := s.flush(c)
+	fmt.Printf("\nSaved %d bucket snapshot(s) to the history\n", s.saved)
+	return err
+}
+
+// streamedBucket is a line of the jsonl output: a bucket of the report with its findings
+type streamedBucket struct {
+	ReportBucket
+	Findings []Finding `json:"findings"`
+}
+
+// jsonLinesSink writes a JSON document per bucket and per line, to a file or to the standard output for -.
+// The lines are redacted when redactor is set.
+type jsonLinesSink struct {
+	file     *os.File
+	encoder  *json.Encoder
+	redactor *redactor
+}
+
+// newJSONLinesSink creates the file of a jsonl output.
+func newJSONLinesSink(path string, redactor *redactor) (*jsonLinesSink, error) {
+	if path == "-" {
+		return &jsonLinesSink{encoder: json.NewEncoder(os.Stdout), redactor: redactor}, nil
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonLinesSink{file: file, encoder: json.NewEncoder(file), redactor: redactor}, nil
+}
+
+func (s *jsonLinesSink) write(c context.Context, result BucketResult) error {
+	line := streamedBucket{
+		ReportBucket: newReportBucket(result),
+		Findings:     result.Findings,
+	}
+	if s.redactor != nil {
+		line.ReportBucket = s.redactor.reportBucket(line.ReportBucket)
+		line.Findings = s.redactor.findings(line.Findings)
+	}
+	return s.encoder.Encode(line)
+}
+
+// writeStatistics ends the output with a line holding only the statistics, {"statistics":{...}}.
+func (s *jsonLinesSink) writeStatistics(c context.Context, stats ReportStatistics) error {
+	return s.encoder.Encode(struct {
+		Statistics ReportStatistics `json:"statistics"`
+	}{stats})
+}
+
+func (s *jsonLinesSink) close(c context.Context) error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
+
+// keepsResults reports whether the scan keeps the compact result of every bucket until its end: for the
+// summary sections of the default report, the report formats written at the end and the options working on
+// every bucket. With jsonl and the history as the only outputs, only the first -top results are kept.
+func (a *Auditor) keepsResults() bool {
+	if len(a.outputs) == 0 && len(a.histories) == 0 {
+		return true
+	}
+	for _, output := range a.outputs {
+		if !streamingFormats[output.format] {
+			return true
+		}
+	}
+	options := a.options
+	return options.Email != "" || a.splitKey != "" || options.Creators || options.CostExplorerTag != "" ||
+		a.costTagDefaults != nil || options.KMSMatrix || options.Diagram != "" || options.TerraformImport != "" ||
+		a.declared != nil || a.jira != nil || options.Export != "" || options.Fix != "" || options.Plan != ""
+}
+
+// compact drops the settings of an audited bucket once its findings are known and it went through the sinks,
+// keeping what the summary sections at the end of the scan use. The memory of a scan then grows with the
+// number of buckets and findings rather than with the configuration of the buckets, and not at all when only
+// the first -top results are kept, see keepsResults.
+func (a *Auditor) compact(result BucketResult) BucketResult {
+	b := result.bucket
+	kept := s3Bucket{
+		name:            b.name,
+		encryption:      b.encryption,
+		encryptionState: b.encryptionState,
+		creationDate:    b.creationDate,
+		billing:         b.billing,
+		tags:            b.tags,
+		versioning:      b.versioning,
+		sizeBytes:       b.sizeBytes,
+		activity:        b.activity,
+		// the principals are kept for the inventory of the policy principals
+		policyPrincipals: b.policyPrincipals,
+	}
+	if a.options.Diagram != "" {
+		kept.notifications = b.notifications
+		kept.dataFlows = b.dataFlows
+	}
+	result.bucket = kept
+	return result
+}
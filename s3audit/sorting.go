@@ -0,0 +1,113 @@
+package s3audit
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"sort"
+	"time"
+)
+
+// sortKeys holds the orders the buckets of the report can be sorted in
+var sortKeys = map[string]bool{"name": true, "size": true, "created": true, "risk": true}
+
+// getBucketSizeBytes reads the latest daily size of a bucket, summed over all its storage classes.
+func getBucketSizeBytes(c context.Context, api CloudWatchGetMetricDataApi, bucket string) (float64, error) {
+	end := time.Now().UTC()
+	output, err := GetMetricData(c, api, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(end.AddDate(0, 0, -3)),
+		EndTime:   aws.Time(end),
+		ScanBy:    cwtypes.ScanByTimestampDescending,
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			{
+				Id: aws.String("size"),
+				Expression: aws.String(fmt.Sprintf(
+					`SUM(SEARCH('{AWS/S3,BucketName,StorageType} MetricName="BucketSizeBytes" BucketName="%s"', 'Average', 86400))`,
+					bucket)),
+			},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, result := range output.MetricDataResults {
+		if len(result.Values) > 0 {
+			return result.Values[0], nil
+		}
+	}
+	return 0, nil
+}
+
+// sortResults orders the results by name, size, creation date or risk score. Everything but the name sorts
+// the largest, newest or riskiest buckets first, and ties are broken by name.
+func sortResults(results []BucketResult, key string) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return resultBefore(results[i], results[j], key)
+	})
+}
+
+// resultBefore reports whether a result comes before another in the order of a sort key, see sortResults.
+func resultBefore(a BucketResult, b BucketResult, key string) bool {
+	switch key {
+	case "size":
+		if a.bucket.sizeBytes != b.bucket.sizeBytes {
+			return a.bucket.sizeBytes > b.bucket.sizeBytes
+		}
+	case "created":
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+	case "risk":
+		if a.score != b.score {
+			return a.score > b.score
+		}
+	}
+	return a.Name < b.Name
+}
+
+// topResults keeps the first n results in the order of a sort key, in a heap whose root is the last of them:
+// a result coming before the root replaces it, so no more than n results are held whatever the number of
+// buckets. It implements heap.Interface.
+type topResults struct {
+	n       int
+	key     string
+	results []BucketResult
+}
+
+func (t *topResults) Len() int           { return len(t.results) }
+func (t *topResults) Less(i, j int) bool { return resultBefore(t.results[j], t.results[i], t.key) }
+func (t *topResults) Swap(i, j int)      { t.results[i], t.results[j] = t.results[j], t.results[i] }
+func (t *topResults) Push(x interface{}) { t.results = append(t.results, x.(BucketResult)) }
+func (t *topResults) Pop() interface{} {
+	last := t.results[len(t.results)-1]
+	t.results = t.results[:len(t.results)-1]
+	return last
+}
+
+// add keeps a result if it is among the first n so far.
+func (t *topResults) add(result BucketResult) {
+	if len(t.results) < t.n {
+		heap.Push(t, result)
+		return
+	}
+	if len(t.results) > 0 && resultBefore(result, t.results[0], t.key) {
+		t.results[0] = result
+		heap.Fix(t, 0)
+	}
+}
+
+// topFindings keeps the findings of the buckets listed in the report, and the findings not tied to an audited
+// bucket such as those of the account or of the directory buckets.
+func topFindings(findings []finding, audited map[string]bool, listed map[string]bool) []finding {
+	var kept []finding
+	for _, f := range findings {
+		if !audited[f.bucket] || listed[f.bucket] {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,161 @@
+package s3audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// untaggedTeam groups the buckets without the tag the reports are split by
+const untaggedTeam = "untagged"
+
+// defaultWebhook is the key of the team webhooks file receiving the reports of the teams it does not list
+const defaultWebhook = "*"
+
+// unsafeFileName matches the characters of a tag value not kept in the name of a report file
+var unsafeFileName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// parseSplitBy reads the -split-by option, tag:<key>, and returns the tag key.
+func parseSplitBy(value string) (string, error) {
+	key := strings.TrimPrefix(value, "tag:")
+	if key == value || key == "" {
+		return "", fmt.Errorf("invalid split %q, expected tag:<key>, e.g. tag:team", value)
+	}
+	return key, nil
+}
+
+// loadTeamWebhooks reads the YAML file mapping the tag values to the URL their report is posted to, with *
+// for the teams not listed.
+func loadTeamWebhooks(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	webhooks := map[string]string{}
+	if err := yaml.Unmarshal(data, &webhooks); err != nil {
+		return nil, err
+	}
+	for team, url := range webhooks {
+		if !strings.HasPrefix(url, "https://") && !strings.HasPrefix(url, "http://") {
+			return nil, fmt.Errorf("team %s: invalid webhook URL %q", team, url)
+		}
+	}
+	return webhooks, nil
+}
+
+// teamPath returns the path of the report of a team, its value inserted before the extension of the path of
+// the shared report, e.g. report-data.json.
+func teamPath(path string, team string) string {
+	extension := filepath.Ext(path)
+	return strings.TrimSuffix(path, extension) + "-" + unsafeFileName.ReplaceAllString(team, "_") + extension
+}
+
+// splitReport returns the report of each value of the tag key, with the buckets of results and top and the
+// findings carrying the value, and the statistics of those alone. The buckets without the tag are grouped
+// under untagged; the findings of no bucket, e.g. account-level ones, stay in the shared report only.
+func (a *Auditor) splitReport(report *Report, key string, results []BucketResult, top []BucketResult, findings []finding, reported []finding) map[string]*Report {
+	teams := map[string]string{}
+	teamResults := map[string][]BucketResult{}
+	for _, result := range results {
+		team := result.bucket.tags[key]
+		if team == "" {
+			team = untaggedTeam
+		}
+		teams[result.Name] = team
+		teamResults[team] = append(teamResults[team], result)
+	}
+	byTeam := func(findings []finding) map[string][]finding {
+		grouped := map[string][]finding{}
+		for _, f := range findings {
+			if team, ok := teams[f.bucket]; ok {
+				grouped[team] = append(grouped[team], f)
+			}
+		}
+		return grouped
+	}
+	teamFindings, teamReported := byTeam(findings), byTeam(reported)
+
+	reports := map[string]*Report{}
+	for team, results := range teamResults {
+		teamReport := *report
+		teamReport.Buckets = nil
+		teamReport.KMSKeys = nil
+		teamReport.Findings = exportFindings(teamReported[team])
+		teamReport.Statistics = a.statistics(results, teamFindings[team])
+		reports[team] = &teamReport
+	}
+	for _, result := range top {
+		teamReport := reports[teams[result.Name]]
+		teamReport.Buckets = append(teamReport.Buckets, newReportBucket(result))
+	}
+	return reports
+}
+
+// writeTeamReports writes the report of each team to the outputs written to a file, next to the shared report,
+// and posts it to the webhook of the team when there is one.
+func (a *Auditor) writeTeamReports(c context.Context, reports map[string]*Report) {
+	var teams []string
+	for team := range reports {
+		teams = append(teams, team)
+	}
+	sort.Strings(teams)
+
+	for _, team := range teams {
+		report := reports[team]
+		if a.redactor != nil {
+			report = a.redactor.report(report)
+		}
+		var outputs []reportOutput
+		for _, output := range a.outputs {
+			if output.path != "-" {
+				output.path = teamPath(output.path, team)
+				outputs = append(outputs, output)
+			}
+		}
+		writeReports(c, outputs, report, a.signer)
+
+		url, ok := a.teamWebhooks[team]
+		if !ok {
+			url, ok = a.teamWebhooks[defaultWebhook]
+		}
+		if !ok {
+			continue
+		}
+		if err := postReport(c, url, report); err != nil {
+			log.Printf("Got an error posting the report of %v %v to its webhook: %v", a.splitKey, team, err)
+		}
+	}
+	fmt.Printf("\nSplit the report by tag %s into %d report(s): %s\n", a.splitKey, len(teams), strings.Join(teams, ", "))
+}
+
+// postReport posts the JSON report to a webhook.
+func postReport(c context.Context, url string, report *Report) error {
+	var data bytes.Buffer
+	if err := (jsonReportWriter{}).WriteReport(&data, report); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(c, http.MethodPost, url, &data)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package s3audit
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	_ "github.com/mattn/go-sqlite3"
+	"time"
+)
+
+// sqliteSchema creates the table of the scan history: a row per bucket and scan, the tags and the findings
+// kept as JSON. The scan time is a scanTimeLayout string, compared as text.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS snapshots (
+	account_id     TEXT NOT NULL,
+	bucket         TEXT NOT NULL,
+	scan_time      TEXT NOT NULL,
+	region         TEXT NOT NULL,
+	encryption     TEXT NOT NULL,
+	public         INTEGER NOT NULL,
+	public_unknown INTEGER NOT NULL,
+	versioning     TEXT NOT NULL,
+	risk_score     INTEGER NOT NULL,
+	tags           TEXT,
+	findings       TEXT,
+	PRIMARY KEY (account_id, bucket, scan_time)
+);
+CREATE INDEX IF NOT EXISTS snapshots_scan_time ON snapshots (scan_time);
+`
+
+// sqliteHistory keeps the scan history in a SQLite file, for a scanner run from a workstation or a cron job
+// without a database server.
+type sqliteHistory struct {
+	db *sql.DB
+}
+
+// newSQLiteHistory opens the SQLite file of the history, creating it and its table if needed.
+func newSQLiteHistory(c context.Context, path string) (*sqliteHistory, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.ExecContext(c, sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating the table: %v", err)
+	}
+	return &sqliteHistory{db: db}, nil
+}
+
+// save records the snapshots of a scan in one transaction.
+func (h *sqliteHistory) save(c context.Context, snapshots []BucketSnapshot) error {
+	tx, err := h.db.BeginTx(c, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, snapshot := range snapshots {
+		tags, err := json.Marshal(snapshot.Tags)
+		if err != nil {
+			return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+		}
+		findings, err := json.Marshal(snapshot.Findings)
+		if err != nil {
+			return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+		}
+		_, err = tx.ExecContext(c, `INSERT OR REPLACE INTO snapshots (account_id, bucket, scan_time, region, encryption, public,
+			public_unknown, versioning, risk_score, tags, findings) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			snapshot.AccountID, snapshot.Bucket, snapshot.ScanTime.UTC().Format(scanTimeLayout), snapshot.Region,
+			snapshot.Encryption, snapshot.Public, snapshot.PublicUnknown, snapshot.Versioning, snapshot.RiskScore,
+			string(tags), string(findings))
+		if err != nil {
+			return fmt.Errorf("bucket %v: %v", snapshot.Bucket, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// since returns the snapshots of the scans at or after a time, oldest first.
+func (h *sqliteHistory) since(c context.Context, t time.Time) ([]BucketSnapshot, error) {
+	rows, err := h.db.QueryContext(c, `SELECT account_id, bucket, scan_time, region, encryption, public, public_unknown,
+		versioning, risk_score, tags, findings
+		FROM snapshots WHERE scan_time >= ? ORDER BY scan_time, bucket`, t.UTC().Format(scanTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var snapshots []BucketSnapshot
+	for rows.Next() {
+		var s BucketSnapshot
+		var scanTime string
+		var tags, findings sql.NullString
+		if err := rows.Scan(&s.AccountID, &s.Bucket, &scanTime, &s.Region, &s.Encryption, &s.Public, &s.PublicUnknown,
+			&s.Versioning, &s.RiskScore, &tags, &findings); err != nil {
+			return nil, err
+		}
+		if s.ScanTime, err = time.Parse(scanTimeLayout, scanTime); err != nil {
+			return nil, fmt.Errorf("bucket %v: %v", s.Bucket, err)
+		}
+		if tags.Valid {
+			if err := json.Unmarshal([]byte(tags.String), &s.Tags); err != nil {
+				return nil, fmt.Errorf("bucket %v: %v", s.Bucket, err)
+			}
+		}
+		if findings.Valid {
+			if err := json.Unmarshal([]byte(findings.String), &s.Findings); err != nil {
+				return nil, fmt.Errorf("bucket %v: %v", s.Bucket, err)
+			}
+		}
+		snapshots = append(snapshots, s)
+	}
+	return snapshots, rows.Err()
+}
+
+// latest returns the latest snapshot of each bucket taken at or after from and before to, by account and
+// bucket, without its tags and findings.
+func (h *sqliteHistory) latest(c context.Context, from time.Time, to time.Time) (map[string]BucketSnapshot, error) {
+	// with MAX, SQLite reads the other columns of the row holding the maximum
+	rows, err := h.db.QueryContext(c, `SELECT account_id, bucket, MAX(scan_time), region, encryption, public, public_unknown,
+		versioning, risk_score
+		FROM snapshots WHERE scan_time >= ? AND scan_time < ? GROUP BY account_id, bucket`,
+		from.UTC().Format(scanTimeLayout), to.UTC().Format(scanTimeLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	latest := map[string]BucketSnapshot{}
+	for rows.Next() {
+		var s BucketSnapshot
+		var scanTime string
+		if err := rows.Scan(&s.AccountID, &s.Bucket, &scanTime, &s.Region, &s.Encryption, &s.Public, &s.PublicUnknown,
+			&s.Versioning, &s.RiskScore); err != nil {
+			return nil, err
+		}
+		if s.ScanTime, err = time.Parse(scanTimeLayout, scanTime); err != nil {
+			return nil, fmt.Errorf("bucket %v: %v", s.Bucket, err)
+		}
+		keepLatest(latest, s, to)
+	}
+	return latest, rows.Err()
+}
@@ -0,0 +1,142 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"os"
+	"strconv"
+	"time"
+)
+
+// staleSampleSize is the number of objects whose modification date is sampled to find the stale buckets
+const staleSampleSize = 1000
+
+// bucketActivity is the recent activity of a bucket, read with StaleDays to find the buckets nobody uses.
+type bucketActivity struct {
+	// requests is the number of requests of the period, from the EntireBucket request metrics when metrics
+	// is true, i.e. the bucket publishes them
+	requests float64
+	metrics  bool
+	// lastModified is the latest modification of the sampled objects, zero for an empty bucket
+	lastModified time.Time
+	sampled      int
+}
+
+// getRequestCount sums the AllRequests metric of the EntireBucket filter of a bucket over a number of days,
+// and whether the bucket publishes it.
+func getRequestCount(c context.Context, api CloudWatchGetMetricDataApi, bucket string, days int) (float64, bool, error) {
+	end := time.Now().UTC()
+	output, err := GetMetricData(c, api, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(end.AddDate(0, 0, -days)),
+		EndTime:   aws.Time(end),
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			{
+				Id: aws.String("requests"),
+				Expression: aws.String(fmt.Sprintf(
+					`SUM(SEARCH('{AWS/S3,BucketName,FilterId} MetricName="AllRequests" BucketName="%s" FilterId="EntireBucket"', 'Sum', 86400))`,
+					bucket)),
+			},
+		},
+	})
+	if err != nil {
+		return 0, false, err
+	}
+
+	var requests float64
+	found := false
+	for _, result := range output.MetricDataResults {
+		for _, value := range result.Values {
+			requests += value
+			found = true
+		}
+	}
+	return requests, found, nil
+}
+
+// getBucketActivity reads the requests of a bucket over the period and samples the modification date of its
+// first objects. The sample misses a recent write among the other objects, which the request metrics catch
+// when the bucket publishes them.
+func getBucketActivity(c context.Context, cw CloudWatchGetMetricDataApi, api ObjectReaderAPI, bucket string, days int) (bucketActivity, error) {
+	var activity bucketActivity
+	var err error
+	if activity.requests, activity.metrics, err = getRequestCount(c, cw, bucket, days); err != nil {
+		return activity, err
+	}
+
+	objects, err := api.ListObjectsV2(c, &s3.ListObjectsV2Input{Bucket: aws.String(bucket), MaxKeys: aws.Int32(staleSampleSize)})
+	if err != nil {
+		return activity, err
+	}
+	for _, object := range objects.Contents {
+		activity.sampled++
+		if modified := aws.ToTime(object.LastModified); modified.After(activity.lastModified) {
+			activity.lastModified = modified
+		}
+	}
+	return activity, nil
+}
+
+// stale reports whether a bucket had no request and no sampled write for the number of days.
+func (activity bucketActivity) stale(days int, now time.Time) bool {
+	if activity.metrics && activity.requests > 0 {
+		return false
+	}
+	return activity.lastModified.Before(now.AddDate(0, 0, -days))
+}
+
+// formatLastModified prints the latest sampled modification, or empty for a bucket without objects.
+func (activity bucketActivity) formatLastModified() string {
+	if activity.sampled == 0 {
+		return "empty"
+	}
+	return activity.lastModified.Format("2006-01-02")
+}
+
+// staleFinding flags a bucket without activity for the number of days, a candidate for archival or deletion.
+func staleFinding(b s3Bucket, days int, now time.Time) (finding, bool) {
+	if b.activity == nil || !b.activity.stale(days, now) {
+		return finding{}, false
+	}
+	requests := "no request metrics"
+	if b.activity.metrics {
+		requests = "0 requests"
+	}
+	return finding{
+		bucket:   b.name,
+		check:    "stale",
+		severity: severityLow,
+		message: fmt.Sprintf("no activity for %d days: %s, last modified %s (%d objects sampled), candidate for archival or deletion",
+			days, requests, b.activity.formatLastModified(), b.activity.sampled),
+	}, true
+}
+
+// printStaleBuckets prints the buckets without activity for the number of days, the candidates for archival
+// or deletion of a cost cleanup, with their size.
+func printStaleBuckets(results []BucketResult, days int, now time.Time) {
+	fmt.Printf("\nStale buckets, no activity for %d days:\n", days)
+	t := newTable(false, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "REQUESTS"}, column{header: "LAST MODIFIED"},
+		column{header: "SIZE GB"}, column{header: "CREATED"})
+	candidates := 0
+	for _, result := range results {
+		activity := result.bucket.activity
+		if activity == nil || !activity.stale(days, now) {
+			continue
+		}
+		candidates++
+		requests := "n/a"
+		if activity.metrics {
+			requests = strconv.FormatFloat(activity.requests, 'f', 0, 64)
+		}
+		t.add(cell{text: result.Name}, cell{text: result.Region}, cell{text: requests}, cell{text: activity.formatLastModified()},
+			cell{text: fmt.Sprintf("%.1f", result.bucket.sizeBytes/(1<<30))}, cell{text: formatCreationDate(result.Created)})
+	}
+	if candidates == 0 {
+		fmt.Println("\tnone")
+		return
+	}
+	t.write(os.Stdout)
+}
@@ -0,0 +1,217 @@
+package s3audit
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ReportStatistics aggregates the buckets and the findings of a scan, for the dashboards that only consume a
+// summary. It covers every audited bucket, also the ones -top leaves out of the report.
+type ReportStatistics struct {
+	Buckets int `json:"buckets"`
+	// Regions holds the number of buckets of each region
+	Regions map[string]int `json:"regions"`
+	// EncryptedPercent is the share of the buckets with default encryption among the buckets whose encryption
+	// could be read, and VersionedPercent the one of the versioned buckets among the buckets whose versioning
+	// was read; absent when no bucket could be read
+	EncryptedPercent *float64 `json:"encryptedPercent,omitempty"`
+	VersionedPercent *float64 `json:"versionedPercent,omitempty"`
+	Public           int      `json:"public"`
+	// Failures is the number of buckets with settings that could not be read, including the ones timed out
+	Failures int `json:"failures"`
+	// Findings holds the number of unsuppressed findings of each severity
+	Findings map[string]int `json:"findings"`
+	// CostTagCoverage holds the share of the buckets carrying each CostTags tag, and CostTaggedPercent the
+	// share carrying all of them, among the buckets whose tags were read; absent without CostTags
+	CostTagCoverage   map[string]float64 `json:"costTagCoverage,omitempty"`
+	CostTaggedPercent *float64           `json:"costTaggedPercent,omitempty"`
+}
+
+// statistics aggregates the results of the scan and its findings. The buckets restored from a checkpoint are
+// counted, but their settings were not kept and are left out of the percentages.
+func (a *Auditor) statistics(results []BucketResult, findings []finding) ReportStatistics {
+	counter := a.newStatisticsCounter()
+	for _, result := range results {
+		counter.addResult(result)
+	}
+	counter.addFindings(findings)
+	return counter.statistics()
+}
+
+// statisticsCounter aggregates the statistics of a scan a result at a time, so they cover every bucket without
+// the results being kept.
+type statisticsCounter struct {
+	auditor *Auditor
+	stats   ReportStatistics
+	// encrypted counts the buckets with default encryption among the encryptionRead ones, versioned the
+	// versioned buckets among the versioningRead ones
+	encrypted, encryptionRead, versioned, versioningRead int
+	// tagsRead counts the buckets whose tags were read, costTagged the ones carrying each cost allocation tag
+	// and costTaggedAll the ones carrying all of them
+	tagsRead, costTaggedAll int
+	costTagged              map[string]int
+	// failing counts the unsuppressed findings at or above the FailOn severity
+	failing int
+}
+
+// newStatisticsCounter returns a counter of the statistics of a scan of the auditor.
+func (a *Auditor) newStatisticsCounter() *statisticsCounter {
+	return &statisticsCounter{auditor: a, stats: ReportStatistics{Regions: map[string]int{}, Findings: map[string]int{}},
+		costTagged: map[string]int{}}
+}
+
+// addResult counts an audited bucket. Its findings are counted apart, with addFindings.
+func (s *statisticsCounter) addResult(result BucketResult) {
+	s.stats.Buckets++
+	s.stats.Regions[result.Region]++
+	if result.public {
+		s.stats.Public++
+	}
+	if len(result.Errors) > 0 || result.TimedOut {
+		s.stats.Failures++
+	}
+	if result.restored {
+		return
+	}
+
+	if result.bucket.encryptionState != encryptionUnknown {
+		s.encryptionRead++
+		if result.bucket.encryptionState == encryptionConfigured {
+			s.encrypted++
+		}
+	}
+	if s.auditor.checks.enabled("drift") && !unreadSetting(result.Errors, "versioning") {
+		s.versioningRead++
+		if result.bucket.versioning == "Enabled" {
+			s.versioned++
+		}
+	}
+	if keys := s.auditor.costTags; len(keys) > 0 && !unreadSetting(result.Errors, "tags") {
+		s.tagsRead++
+		for _, key := range keys {
+			if result.bucket.tags[key] != "" {
+				s.costTagged[key]++
+			}
+		}
+		if len(missingCostTags(result.bucket.tags, keys)) == 0 {
+			s.costTaggedAll++
+		}
+	}
+}
+
+// addFindings counts the unsuppressed findings of each severity.
+func (s *statisticsCounter) addFindings(findings []finding) {
+	for _, f := range findings {
+		if f.suppressed == "" {
+			s.stats.Findings[f.severity.String()]++
+		}
+	}
+	s.failing += activeFindings(findings, s.auditor.failThreshold)
+}
+
+// statistics returns the statistics of the buckets and the findings counted.
+func (s *statisticsCounter) statistics() ReportStatistics {
+	stats := s.stats
+	stats.EncryptedPercent = percent(s.encrypted, s.encryptionRead)
+	stats.VersionedPercent = percent(s.versioned, s.versioningRead)
+	// the share of the buckets carrying the cost allocation tags, among the buckets whose tags were read
+	if len(s.auditor.costTags) > 0 && s.tagsRead > 0 {
+		stats.CostTagCoverage = map[string]float64{}
+		for _, key := range s.auditor.costTags {
+			stats.CostTagCoverage[key] = *percent(s.costTagged[key], s.tagsRead)
+		}
+		stats.CostTaggedPercent = percent(s.costTaggedAll, s.tagsRead)
+	}
+	return stats
+}
+
+// unreadSetting reports whether a setting is one of the settings that could not be read.
+func unreadSetting(errs []ReadError, setting string) bool {
+	for _, err := range errs {
+		if err.Setting == setting {
+			return true
+		}
+	}
+	return false
+}
+
+// percent returns n out of total as a percentage rounded to a tenth, nil when total is 0.
+func percent(n int, total int) *float64 {
+	if total == 0 {
+		return nil
+	}
+	p := math.Round(float64(n)*1000/float64(total)) / 10
+	return &p
+}
+
+// formatPercent prints a percentage, n/a when it is nil.
+func formatPercent(p *float64) string {
+	if p == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf("%.1f%%", *p)
+}
+
+// formatRegions prints the number of buckets of each region, ordered by region, e.g. eu-west-1 3, us-east-1 12.
+func (s ReportStatistics) formatRegions() string {
+	var regions []string
+	for region := range s.Regions {
+		regions = append(regions, region)
+	}
+	sort.Strings(regions)
+	var counts []string
+	for _, region := range regions {
+		counts = append(counts, fmt.Sprintf("%s %d", region, s.Regions[region]))
+	}
+	return strings.Join(counts, ", ")
+}
+
+// formatFindings prints the number of unsuppressed findings of each severity, highest first, e.g. 2 critical,
+// 5 high.
+func (s ReportStatistics) formatFindings() string {
+	var counts []string
+	for sev := severityCritical; sev >= severityLow; sev-- {
+		if n := s.Findings[sev.String()]; n > 0 {
+			counts = append(counts, fmt.Sprintf("%d %s", n, strings.ToLower(sev.String())))
+		}
+	}
+	if len(counts) == 0 {
+		return "none"
+	}
+	return strings.Join(counts, ", ")
+}
+
+// formatCostTagCoverage prints the share of the buckets carrying each cost allocation tag, ordered by tag,
+// e.g. cost-center 80.0%, team 95.5%.
+func (s ReportStatistics) formatCostTagCoverage() string {
+	var keys []string
+	for key := range s.CostTagCoverage {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var shares []string
+	for _, key := range keys {
+		shares = append(shares, fmt.Sprintf("%s %.1f%%", key, s.CostTagCoverage[key]))
+	}
+	return strings.Join(shares, ", ")
+}
+
+// writeStatistics writes the statistics as aligned lines of text.
+func writeStatistics(w io.Writer, s ReportStatistics) {
+	t := newTable(false, column{header: "STATISTIC"}, column{header: "VALUE"})
+	t.add(cell{text: "buckets"}, cell{text: fmt.Sprint(s.Buckets)})
+	t.add(cell{text: "regions"}, cell{text: s.formatRegions()})
+	t.add(cell{text: "encrypted"}, cell{text: formatPercent(s.EncryptedPercent)})
+	t.add(cell{text: "versioned"}, cell{text: formatPercent(s.VersionedPercent)})
+	t.add(cell{text: "public"}, cell{text: fmt.Sprint(s.Public)})
+	t.add(cell{text: "failures"}, cell{text: fmt.Sprint(s.Failures)})
+	t.add(cell{text: "findings"}, cell{text: s.formatFindings()})
+	if s.CostTagCoverage != nil {
+		t.add(cell{text: "cost tagged"}, cell{text: formatPercent(s.CostTaggedPercent)})
+		t.add(cell{text: "cost tags"}, cell{text: s.formatCostTagCoverage()})
+	}
+	t.write(w)
+}
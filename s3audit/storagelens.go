@@ -0,0 +1,214 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"time"
+)
+
+// storageLensTrendDays is how far back the fleet-level Storage Lens metrics are read.
+const storageLensTrendDays = 14
+
+// S3ControlListStorageLensConfigurationsApi defines the interface for the ListStorageLensConfigurations function.
+// We use this interface to test the function using a mocked service.
+type S3ControlListStorageLensConfigurationsApi interface {
+	ListStorageLensConfigurations(ctx context.Context,
+		params *s3control.ListStorageLensConfigurationsInput,
+		optFns ...func(*s3control.Options)) (*s3control.ListStorageLensConfigurationsOutput, error)
+}
+
+// S3ControlGetStorageLensConfigurationApi defines the interface for the GetStorageLensConfiguration function.
+// We use this interface to test the function using a mocked service.
+type S3ControlGetStorageLensConfigurationApi interface {
+	GetStorageLensConfiguration(ctx context.Context,
+		params *s3control.GetStorageLensConfigurationInput,
+		optFns ...func(*s3control.Options)) (*s3control.GetStorageLensConfigurationOutput, error)
+}
+
+// CloudWatchGetMetricDataApi defines the interface for the GetMetricData function.
+// We use this interface to test the function using a mocked service.
+type CloudWatchGetMetricDataApi interface {
+	GetMetricData(ctx context.Context,
+		params *cloudwatch.GetMetricDataInput,
+		optFns ...func(*cloudwatch.Options)) (*cloudwatch.GetMetricDataOutput, error)
+}
+
+// metricTrend holds the first and last daily value of a metric over a time window.
+type metricTrend struct {
+	start float64
+	end   float64
+}
+
+// change returns the relative change of the metric over the window, in percent.
+func (t metricTrend) change() float64 {
+	if t.start == 0 {
+		return 0
+	}
+	return (t.end - t.start) / t.start * 100
+}
+
+// storageLensDashboard defines a Storage Lens dashboard and the account-level metrics it publishes
+type storageLensDashboard struct {
+	id                string
+	homeRegion        string
+	enabled           bool
+	cloudWatchEnabled bool
+	storageBytes      *metricTrend
+	objectCount       *metricTrend
+}
+
+// ListStorageLensConfigurations retrieves the Amazon S3 Storage Lens dashboards of an account.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListStorageLensConfigurationsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListStorageLensConfigurations.
+func ListStorageLensConfigurations(c context.Context, api S3ControlListStorageLensConfigurationsApi, input *s3control.ListStorageLensConfigurationsInput) (*s3control.ListStorageLensConfigurationsOutput, error) {
+	return api.ListStorageLensConfigurations(c, input)
+}
+
+// GetStorageLensConfiguration returns the configuration of a Storage Lens dashboard.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetStorageLensConfigurationOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetStorageLensConfiguration.
+func GetStorageLensConfiguration(c context.Context, api S3ControlGetStorageLensConfigurationApi, input *s3control.GetStorageLensConfigurationInput) (*s3control.GetStorageLensConfigurationOutput, error) {
+	return api.GetStorageLensConfiguration(c, input)
+}
+
+// GetMetricData retrieves CloudWatch metric values.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a GetMetricDataOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to GetMetricData.
+func GetMetricData(c context.Context, api CloudWatchGetMetricDataApi, input *cloudwatch.GetMetricDataInput) (*cloudwatch.GetMetricDataOutput, error) {
+	return api.GetMetricData(c, input)
+}
+
+// getStorageLensDashboards lists the Storage Lens dashboards of the account and, for those publishing to
+// CloudWatch, reads the account-level storage trend from their home region.
+func getStorageLensDashboards(c context.Context, cfg aws.Config, accountID string) ([]storageLensDashboard, error) {
+	client := s3control.NewFromConfig(cfg)
+
+	var dashboards []storageLensDashboard
+	input := &s3control.ListStorageLensConfigurationsInput{AccountId: aws.String(accountID)}
+	for {
+		list, err := ListStorageLensConfigurations(c, client, input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range list.StorageLensConfigurationList {
+			d := storageLensDashboard{
+				id:         aws.ToString(entry.Id),
+				homeRegion: aws.ToString(entry.HomeRegion),
+				enabled:    entry.IsEnabled,
+			}
+
+			// the configuration is only available from the dashboard's home region
+			homeClient := s3control.NewFromConfig(cfg, func(options *s3control.Options) {
+				options.Region = d.homeRegion
+			})
+			conf, err := GetStorageLensConfiguration(c, homeClient, &s3control.GetStorageLensConfigurationInput{
+				AccountId: aws.String(accountID),
+				ConfigId:  entry.Id,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if export := conf.StorageLensConfiguration.DataExport; export != nil && export.CloudWatchMetrics != nil {
+				d.cloudWatchEnabled = export.CloudWatchMetrics.IsEnabled
+			}
+
+			if d.enabled && d.cloudWatchEnabled {
+				cw := cloudwatch.NewFromConfig(cfg, func(options *cloudwatch.Options) {
+					options.Region = d.homeRegion
+				})
+				d.storageBytes, d.objectCount, err = getStorageLensTrends(c, cw, d.id)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			dashboards = append(dashboards, d)
+		}
+
+		if list.NextToken == nil {
+			break
+		}
+		input.NextToken = list.NextToken
+	}
+
+	return dashboards, nil
+}
+
+// getStorageLensTrends reads the daily account-level StorageBytes and ObjectCount metrics that a Storage Lens
+// dashboard publishes to CloudWatch, summed across regions. A nil trend means no data points were published.
+func getStorageLensTrends(c context.Context, api CloudWatchGetMetricDataApi, configID string) (*metricTrend, *metricTrend, error) {
+	search := func(metric string) *string {
+		return aws.String(fmt.Sprintf(
+			`SUM(SEARCH('{AWS/S3/Storage-Lens,aws_account_number,aws_region,configuration_id,metrics_version,record_type} configuration_id="%s" record_type="ACCOUNT" MetricName="%s"', 'Average', 86400))`,
+			configID, metric))
+	}
+
+	end := time.Now().UTC().Truncate(24 * time.Hour)
+	output, err := GetMetricData(c, api, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(end.AddDate(0, 0, -storageLensTrendDays)),
+		EndTime:   aws.Time(end),
+		ScanBy:    cwtypes.ScanByTimestampAscending,
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			{Id: aws.String("bytes"), Expression: search("StorageBytes"), Period: aws.Int32(86400)},
+			{Id: aws.String("objects"), Expression: search("ObjectCount"), Period: aws.Int32(86400)},
+		},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var storageBytes, objectCount *metricTrend
+	for _, result := range output.MetricDataResults {
+		if len(result.Values) == 0 {
+			continue
+		}
+		trend := &metricTrend{start: result.Values[0], end: result.Values[len(result.Values)-1]}
+		switch aws.ToString(result.Id) {
+		case "bytes":
+			storageBytes = trend
+		case "objects":
+			objectCount = trend
+		}
+	}
+
+	return storageBytes, objectCount, nil
+}
+
+// printStorageLensDashboards prints the fleet-level section of the report.
+func printStorageLensDashboards(dashboards []storageLensDashboard) {
+	fmt.Println("\nStorage Lens:")
+	if len(dashboards) == 0 {
+		fmt.Println("No Storage Lens dashboards found")
+		return
+	}
+
+	for _, d := range dashboards {
+		fmt.Printf("Dashboard: %s\t Region: %s\t Enabled: %t\t CloudWatch: %t\n", d.id, d.homeRegion, d.enabled, d.cloudWatchEnabled)
+		if d.storageBytes != nil {
+			fmt.Printf("\tStorage: %.0f bytes (%+.1f%% over %d days)\n", d.storageBytes.end, d.storageBytes.change(), storageLensTrendDays)
+		}
+		if d.objectCount != nil {
+			fmt.Printf("\tObjects: %.0f (%+.1f%% over %d days)\n", d.objectCount.end, d.objectCount.change(), storageLensTrendDays)
+		}
+	}
+}
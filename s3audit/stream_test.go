@@ -0,0 +1,124 @@
+package s3audit_test
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang-playground/loadtest"
+	"golang-playground/s3audit"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+// benchmarks are the accounts the fake endpoint of package loadtest simulates for the benchmarks
+var benchmarks = []loadtest.Config{
+	{Buckets: 100},
+	{Buckets: 100, Latency: 5 * time.Millisecond},
+	{Buckets: 100, Latency: 5 * time.Millisecond, ErrorRate: 0.05},
+	{Buckets: 1000, Latency: 5 * time.Millisecond},
+}
+
+// benchmarkName names a benchmark after its account, e.g. buckets=100/latency=5ms/errors=0.05.
+func benchmarkName(cfg loadtest.Config) string {
+	return fmt.Sprintf("buckets=%d/latency=%s/errors=%g", cfg.Buckets, cfg.Latency, cfg.ErrorRate)
+}
+
+// newAuditor returns an auditor of the account of a fake endpoint, running the default checks of the load
+// tests on 4 buckets at a time.
+func newAuditor(b *testing.B, server *loadtest.Server) *s3audit.Auditor {
+	b.Helper()
+	c := context.Background()
+	cfg, err := server.AWSConfig(c)
+	if err != nil {
+		b.Fatal(err)
+	}
+	auditor, err := s3audit.New(c, cfg, s3audit.Options{Checks: loadtest.DefaultChecks, Concurrency: 4})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return auditor
+}
+
+// BenchmarkStream measures the audit of a whole account, from the listing of its buckets to the result of
+// the last one. Each iteration audits the account with a new auditor, so the regions are loaded again.
+func BenchmarkStream(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	for _, cfg := range benchmarks {
+		b.Run(benchmarkName(cfg), func(b *testing.B) {
+			server := loadtest.NewServer(cfg)
+			defer server.Close()
+
+			failed := 0
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				auditor := newAuditor(b, server)
+				b.StartTimer()
+
+				results, errs := auditor.Stream(context.Background())
+				audited := 0
+				for results != nil || errs != nil {
+					select {
+					case _, ok := <-results:
+						if !ok {
+							results = nil
+							continue
+						}
+						audited++
+					case _, ok := <-errs:
+						if !ok {
+							errs = nil
+							continue
+						}
+						failed++
+					}
+				}
+				if audited == 0 {
+					b.Fatal("no bucket audited")
+				}
+			}
+			requests, throttled := server.Requests()
+			b.ReportMetric(float64(cfg.Buckets*b.N)/b.Elapsed().Seconds(), "buckets/s")
+			b.ReportMetric(float64(requests)/float64(b.N), "requests/op")
+			b.ReportMetric(float64(throttled)/float64(b.N), "throttled/op")
+			b.ReportMetric(float64(failed)/float64(b.N), "errors/op")
+		})
+	}
+}
+
+// BenchmarkScanBucket measures the audit of a bucket alone, the buckets of the account in turn. The regions
+// are loaded by the first scans and shared by the next ones, as in a scan of the account.
+func BenchmarkScanBucket(b *testing.B) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	for _, cfg := range benchmarks {
+		b.Run(benchmarkName(cfg), func(b *testing.B) {
+			server := loadtest.NewServer(cfg)
+			defer server.Close()
+			auditor := newAuditor(b, server)
+			buckets := make([]types.Bucket, cfg.Buckets)
+			for i := range buckets {
+				buckets[i] = types.Bucket{Name: aws.String(loadtest.BucketName(i))}
+			}
+
+			c := context.Background()
+			failed := 0
+			startRequests, startThrottled := server.Requests()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := auditor.ScanBucket(c, buckets[i%len(buckets)]); err != nil {
+					failed++
+				}
+			}
+			b.StopTimer()
+			requests, throttled := server.Requests()
+			b.ReportMetric(float64(requests-startRequests)/float64(b.N), "requests/op")
+			b.ReportMetric(float64(throttled-startThrottled)/float64(b.N), "throttled/op")
+			b.ReportMetric(float64(failed)/float64(b.N), "errors/op")
+		})
+	}
+}
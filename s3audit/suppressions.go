@@ -0,0 +1,95 @@
+package s3audit
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// suppression defines an accepted exception: the findings of a check on the matching buckets are reported as
+// suppressed until the expiry date. Bucket is a glob pattern and a Rule of "*" matches every check.
+type suppression struct {
+	Bucket  string `yaml:"bucket"`
+	Rule    string `yaml:"rule"`
+	Expires string `yaml:"expires"`
+	Reason  string `yaml:"reason"`
+	expires time.Time
+}
+
+// suppressionFile defines the layout of the suppressions YAML file
+type suppressionFile struct {
+	Suppressions []suppression `yaml:"suppressions"`
+}
+
+// loadSuppressions reads a suppressions file. Every entry needs a bucket, a rule, a reason and an expiry date
+// (YYYY-MM-DD), so no exception is accepted forever or without an explanation.
+func loadSuppressions(file string) ([]suppression, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var content suppressionFile
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+
+	for i, s := range content.Suppressions {
+		if s.Bucket == "" || s.Rule == "" || s.Reason == "" || s.Expires == "" {
+			return nil, fmt.Errorf("suppression %d: bucket, rule, expires and reason are required", i+1)
+		}
+		if _, err := path.Match(s.Bucket, ""); err != nil {
+			return nil, fmt.Errorf("suppression %d: invalid bucket pattern %q", i+1, s.Bucket)
+		}
+		expires, err := time.Parse("2006-01-02", s.Expires)
+		if err != nil {
+			return nil, fmt.Errorf("suppression %d: invalid expiry date %q, expected YYYY-MM-DD", i+1, s.Expires)
+		}
+		// a suppression is valid through its whole expiry day
+		content.Suppressions[i].expires = expires.AddDate(0, 0, 1)
+	}
+
+	return content.Suppressions, nil
+}
+
+// matches reports whether the suppression covers a finding.
+func (s suppression) matches(f finding) bool {
+	if s.Rule != "*" && !strings.EqualFold(s.Rule, f.check) {
+		return false
+	}
+	matched, _ := path.Match(s.Bucket, f.bucket)
+	return matched
+}
+
+// applySuppressions marks the findings covered by a suppression that has not expired. Expired suppressions
+// that still match a finding are logged so they get reviewed.
+func applySuppressions(findings []finding, suppressions []suppression, now time.Time) {
+	for i, f := range findings {
+		for _, s := range suppressions {
+			if !s.matches(f) {
+				continue
+			}
+			if now.After(s.expires) {
+				log.Printf("Suppression of %v on bucket %v expired on %v", s.Rule, f.bucket, s.Expires)
+				continue
+			}
+			findings[i].suppressed = s.Reason
+			break
+		}
+	}
+}
+
+// activeFindings counts the findings that are not suppressed and at least as severe as threshold.
+func activeFindings(findings []finding, threshold severity) int {
+	count := 0
+	for _, f := range findings {
+		if f.suppressed == "" && f.severity >= threshold {
+			count++
+		}
+	}
+	return count
+}
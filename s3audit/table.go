@@ -0,0 +1,166 @@
+package s3audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ANSI colors of the table cells
+const (
+	colorNone   = ""
+	colorRed    = "\x1b[31m"
+	colorBold   = "\x1b[1;31m"
+	colorYellow = "\x1b[33m"
+	colorCyan   = "\x1b[36m"
+	colorGreen  = "\x1b[32m"
+	colorGray   = "\x1b[90m"
+	colorReset  = "\x1b[0m"
+)
+
+// column defines a column of a table. Values longer than max are truncated, max 0 never truncates.
+type column struct {
+	header string
+	max    int
+}
+
+// cell defines a value of a table and its color.
+type cell struct {
+	text  string
+	color string
+}
+
+// table renders rows in aligned columns, colored when color is true.
+type table struct {
+	columns []column
+	rows    [][]cell
+	color   bool
+}
+
+// newTable returns an empty table with the columns.
+func newTable(color bool, columns ...column) *table {
+	return &table{columns: columns, color: color}
+}
+
+// add appends a row, one cell per column.
+func (t *table) add(cells ...cell) {
+	t.rows = append(t.rows, cells)
+}
+
+// truncate shortens a value to max characters, the last one being an ellipsis.
+func truncate(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max-1]) + "…"
+}
+
+// write prints the header and the rows. The widths are computed on the text before it is colored, so the
+// escape codes do not break the alignment; the last column is not padded.
+func (t *table) write(w io.Writer) {
+	widths := make([]int, len(t.columns))
+	for i, c := range t.columns {
+		widths[i] = utf8.RuneCountInString(c.header)
+	}
+	for _, row := range t.rows {
+		for i := range row {
+			row[i].text = truncate(strings.ReplaceAll(row[i].text, "\n", " "), t.columns[i].max)
+			if n := utf8.RuneCountInString(row[i].text); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+
+	line := func(cells []cell) {
+		var b strings.Builder
+		for i, c := range cells {
+			text := c.text
+			if i < len(cells)-1 {
+				text += strings.Repeat(" ", widths[i]-utf8.RuneCountInString(c.text)+2)
+			}
+			if t.color && c.color != colorNone {
+				text = c.color + strings.TrimRight(text, " ") + colorReset + text[len(strings.TrimRight(text, " ")):]
+			}
+			b.WriteString(text)
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+	}
+
+	var header []cell
+	for _, c := range t.columns {
+		header = append(header, cell{text: c.header})
+	}
+	line(header)
+	for _, row := range t.rows {
+		line(row)
+	}
+}
+
+// severityColor returns the color of a severity, gray when the finding is suppressed.
+func severityColor(s severity, suppressed bool) string {
+	if suppressed {
+		return colorGray
+	}
+	switch s {
+	case severityCritical:
+		return colorBold
+	case severityHigh:
+		return colorRed
+	case severityMedium:
+		return colorYellow
+	default:
+		return colorCyan
+	}
+}
+
+// useColor reports whether the tables printed to the standard output are colored: not with noColor, when
+// the NO_COLOR environment variable is set or when the output is not a terminal.
+func useColor(noColor bool) bool {
+	if noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stdout.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// printSummary prints one line per audited bucket with its encryption and its compliance status: compliant
+// when no unsuppressed finding remains, otherwise the highest severity of its findings. The settings that
+// could not be read are listed apart, a bucket is only compliant for the checks that could run.
+func printSummary(results []BucketResult, color bool) {
+	fmt.Println("\nSummary:")
+	t := newTable(color, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "CREATED"}, column{header: "ENCRYPTION", max: 40},
+		column{header: "FINDINGS"}, column{header: "STATUS"}, column{header: "UNCHECKED", max: 60})
+	for _, result := range results {
+		active := 0
+		highest := severityLow
+		for _, f := range result.findings {
+			if f.suppressed != "" {
+				continue
+			}
+			active++
+			if f.severity > highest {
+				highest = f.severity
+			}
+		}
+
+		encryption := cell{text: formatEncryption(result.bucket)}
+		switch {
+		case result.restored:
+			encryption = cell{text: "(previous scan)"}
+		case result.bucket.encryptionState == encryptionNone:
+			encryption.color = colorRed
+		case result.bucket.encryptionState == encryptionUnknown:
+			encryption.color = colorGray
+		}
+		status := cell{text: "COMPLIANT", color: colorGreen}
+		if active > 0 {
+			status = cell{text: "NON-COMPLIANT " + highest.String(), color: severityColor(highest, false)}
+		}
+		t.add(cell{text: result.Name}, cell{text: result.Region}, cell{text: formatCreationDate(result.Created)}, encryption,
+			cell{text: strconv.Itoa(active)}, status, cell{text: strings.Join(uncheckedSettings(result.Errors), ", "), color: colorYellow})
+	}
+	t.write(os.Stdout)
+}
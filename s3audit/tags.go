@@ -0,0 +1,80 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"strings"
+)
+
+// getBucketTags returns the tags of a bucket as a map. A bucket without tags returns an empty map.
+func getBucketTags(c context.Context, api BucketSettingsAPI, bucket string) (map[string]string, error) {
+	tags := map[string]string{}
+
+	tagging, err := api.GetBucketTagging(c, &s3.GetBucketTaggingInput{Bucket: aws.String(bucket)})
+	if apiErrorCode(err) == "NoSuchTagSet" {
+		return tags, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range tagging.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return tags, nil
+}
+
+// readsTags reports whether the audit reads the tags of the buckets, a request per bucket: for the checks on
+// the tags, the options matching or grouping the buckets by tag, the custom checks and the reports and the
+// history, which keep the tags of every bucket.
+func (a *Auditor) readsTags() bool {
+	if a.checks.enabled("cost-tags", "drift", "naming", "required-tags") || len(a.costTags) > 0 {
+		return true
+	}
+	for _, check := range Checks() {
+		if a.checks.enabled(check.Name()) {
+			return true
+		}
+	}
+	options := a.options
+	return options.SensitiveTags != "" || options.ManagedTags != "" || options.TerraformImport != "" ||
+		options.EncryptionPolicy != "" || options.CostExplorerTag != "" || options.SplitBy != "" ||
+		options.Creators || options.Jira != "" || options.History != "" || options.Database != "" ||
+		options.Email != "" || len(a.outputs) > 0
+}
+
+// tagMatcher matches buckets on key=value tag pairs; a "*" value matches any value of the key
+type tagMatcher map[string]string
+
+// parseTagMatcher reads a comma separated list of key=value pairs.
+func parseTagMatcher(value string) (tagMatcher, error) {
+	matcher := tagMatcher{}
+	for _, pair := range strings.Split(value, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		matcher[kv[0]] = kv[1]
+	}
+	return matcher, nil
+}
+
+// match returns the first tag of tags matched by m, formatted as key=value, and whether one matched.
+// Values are compared case-insensitively.
+func (m tagMatcher) match(tags map[string]string) (string, bool) {
+	for key, want := range m {
+		value, ok := tags[key]
+		if !ok {
+			continue
+		}
+		if want == "*" || strings.EqualFold(value, want) {
+			return key + "=" + value, true
+		}
+	}
+	return "", false
+}
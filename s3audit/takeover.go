@@ -0,0 +1,273 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"io"
+	"log"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Route53ListHostedZonesApi defines the interface for the ListHostedZones function.
+// We use this interface to test the function using a mocked service.
+type Route53ListHostedZonesApi interface {
+	ListHostedZones(ctx context.Context,
+		params *route53.ListHostedZonesInput,
+		optFns ...func(*route53.Options)) (*route53.ListHostedZonesOutput, error)
+}
+
+// Route53ListResourceRecordSetsApi defines the interface for the ListResourceRecordSets function.
+// We use this interface to test the function using a mocked service.
+type Route53ListResourceRecordSetsApi interface {
+	ListResourceRecordSets(ctx context.Context,
+		params *route53.ListResourceRecordSetsInput,
+		optFns ...func(*route53.Options)) (*route53.ListResourceRecordSetsOutput, error)
+}
+
+// route53Api groups the Route 53 calls reading the DNS records of the account.
+type route53Api interface {
+	Route53ListHostedZonesApi
+	Route53ListResourceRecordSetsApi
+}
+
+// ListHostedZones returns a page of the public and private hosted zones of the account.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListHostedZonesOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListHostedZones.
+func ListHostedZones(c context.Context, api Route53ListHostedZonesApi, input *route53.ListHostedZonesInput) (*route53.ListHostedZonesOutput, error) {
+	return api.ListHostedZones(c, input)
+}
+
+// ListResourceRecordSets returns a page of the records of a hosted zone.
+// Inputs:
+//     c is the context of the method call.
+//     api is the interface that defines the method call.
+//     input defines the input arguments to the service call.
+// Output:
+//     If success, a ListResourceRecordSetsOutput object containing the result of the service call and nil.
+//     Otherwise, nil and an error from the call to ListResourceRecordSets.
+func ListResourceRecordSets(c context.Context, api Route53ListResourceRecordSetsApi, input *route53.ListResourceRecordSetsInput) (*route53.ListResourceRecordSetsOutput, error) {
+	return api.ListResourceRecordSets(c, input)
+}
+
+// newRoute53Client creates a Route 53 client, a global service of us-east-1 in aws, in the partition of the
+// configured region.
+func newRoute53Client(cfg aws.Config) *route53.Client {
+	return route53.NewFromConfig(cfg, func(options *route53.Options) {
+		options.Region = globalRegion(cfg.Region)
+	})
+}
+
+// s3EndpointPattern matches the S3 endpoints a DNS record may point at: the website endpoints,
+// <bucket>.s3-website-<region>.amazonaws.com or <bucket>.s3-website.<region>.amazonaws.com, and the REST
+// endpoints, <bucket>.s3.amazonaws.com or <bucket>.s3.<region>.amazonaws.com. The bucket is empty for the
+// alias records, whose bucket is the name of the record.
+var s3EndpointPattern = regexp.MustCompile(`^(?:(.+)\.)?s3(?:-website)?(?:[.-][a-z0-9-]+)?\.amazonaws\.com(?:\.cn)?\.?$`)
+
+// dnsRecord is a DNS name pointing at an S3 endpoint.
+type dnsRecord struct {
+	name   string
+	target string
+	bucket string
+}
+
+// takeoverRisk is a reference to a bucket that does not exist: anyone can create the bucket and serve the
+// DNS name or receive the logs or the replicated data.
+type takeoverRisk struct {
+	kind   string
+	source string
+	bucket string
+}
+
+// s3RecordBucket returns the bucket a DNS record points at, and whether its target is an S3 endpoint.
+func s3RecordBucket(name string, target string) (string, bool) {
+	match := s3EndpointPattern.FindStringSubmatch(strings.ToLower(target))
+	if match == nil {
+		return "", false
+	}
+	if match[1] != "" {
+		return match[1], true
+	}
+	return strings.TrimSuffix(strings.ToLower(name), "."), true
+}
+
+// route53Records returns the CNAME and alias records of the hosted zones of the account pointing at S3.
+func route53Records(c context.Context, api route53Api) ([]dnsRecord, error) {
+	all, err := listDNSRecords(c, api)
+	if err != nil {
+		return nil, err
+	}
+	var records []dnsRecord
+	for _, record := range all {
+		if bucket, ok := s3RecordBucket(record.name, record.target); ok {
+			record.bucket = bucket
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// listDNSRecords returns the CNAME and alias records of the hosted zones of the account, without their bucket.
+func listDNSRecords(c context.Context, api route53Api) ([]dnsRecord, error) {
+	var records []dnsRecord
+	zonesInput := &route53.ListHostedZonesInput{}
+	for {
+		zones, err := ListHostedZones(c, api, zonesInput)
+		if err != nil {
+			return nil, err
+		}
+		for _, zone := range zones.HostedZones {
+			input := &route53.ListResourceRecordSetsInput{HostedZoneId: zone.Id}
+			for {
+				page, err := ListResourceRecordSets(c, api, input)
+				if err != nil {
+					return nil, fmt.Errorf("zone %s: %v", aws.ToString(zone.Name), err)
+				}
+				for _, set := range page.ResourceRecordSets {
+					name := strings.ReplaceAll(aws.ToString(set.Name), `\052`, "*")
+					var targets []string
+					if set.AliasTarget != nil {
+						targets = append(targets, aws.ToString(set.AliasTarget.DNSName))
+					}
+					if set.Type == types.RRTypeCname {
+						for _, value := range set.ResourceRecords {
+							targets = append(targets, aws.ToString(value.Value))
+						}
+					}
+					for _, target := range targets {
+						records = append(records, dnsRecord{name: strings.TrimSuffix(name, "."), target: strings.TrimSuffix(target, ".")})
+					}
+				}
+				if !page.IsTruncated {
+					break
+				}
+				input.StartRecordName, input.StartRecordType, input.StartRecordIdentifier = page.NextRecordName, page.NextRecordType, page.NextRecordIdentifier
+			}
+		}
+		if !zones.IsTruncated {
+			break
+		}
+		zonesInput.Marker = zones.NextMarker
+	}
+	return records, nil
+}
+
+// domainRecords resolves the CNAME of the domains and returns the ones pointing at S3.
+func domainRecords(c context.Context, domains []string) []dnsRecord {
+	var records []dnsRecord
+	for _, domain := range domains {
+		target, err := net.DefaultResolver.LookupCNAME(c, domain)
+		if err != nil {
+			log.Printf("Got an error resolving %v: %v", domain, err)
+			continue
+		}
+		if bucket, ok := s3RecordBucket(domain, target); ok {
+			records = append(records, dnsRecord{name: domain, target: target, bucket: bucket})
+		}
+	}
+	return records
+}
+
+// bucketExists reports whether a bucket exists in any account: S3 answers 404 to a HEAD of a missing bucket
+// and denies or redirects the requests for the existing buckets of other accounts or regions.
+func bucketExists(c context.Context, api BucketListerAPI, bucket string) (bool, error) {
+	_, err := api.HeadBucket(c, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	switch code := apiErrorCode(err); {
+	case err == nil:
+		return true, nil
+	case code == "NotFound" || code == "NoSuchBucket":
+		return false, nil
+	case code != "":
+		return true, nil
+	default:
+		return false, err
+	}
+}
+
+// TakeoverScan lists the DNS names of the domains, and of the Route 53 zones of the account with route53, that
+// point at a missing bucket, and the logging, replication and inventory destinations of the buckets of the
+// account that do not exist: anyone creating these buckets takes over the name or the data.
+func TakeoverScan(c context.Context, cfg aws.Config, domains string, withRoute53 bool, w io.Writer) error {
+	records := domainRecords(c, splitList(domains))
+	if withRoute53 {
+		zoneRecords, err := route53Records(c, newRoute53Client(cfg))
+		if err != nil {
+			return fmt.Errorf("reading the Route 53 records: %v", err)
+		}
+		records = append(records, zoneRecords...)
+	}
+
+	client := newS3Client(cfg, "", "")
+	exists := map[string]bool{}
+	missing := func(bucket string) bool {
+		if found, ok := exists[bucket]; ok {
+			return !found
+		}
+		found, err := bucketExists(c, client, bucket)
+		if err != nil {
+			log.Printf("Got an error checking bucket %v exists: %v", bucket, err)
+			return false
+		}
+		exists[bucket] = found
+		return !found
+	}
+
+	var risks []takeoverRisk
+	for _, record := range records {
+		if missing(record.bucket) {
+			risks = append(risks, takeoverRisk{kind: "dns " + record.target, source: record.name, bucket: record.bucket})
+		}
+	}
+
+	buckets, err := matchBuckets(c, cfg, "")
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		flows, err := getDataFlows(c, bucket.client, bucket.name)
+		if err != nil {
+			log.Printf("Got an error reading the destinations of bucket %v: %v", bucket.name, err)
+			continue
+		}
+		for _, flow := range flows {
+			if missing(flow.target) {
+				risks = append(risks, takeoverRisk{kind: flow.kind + " destination", source: bucket.name, bucket: flow.target})
+			}
+		}
+	}
+
+	writeTakeoverRisks(w, risks, len(records))
+	return nil
+}
+
+// writeTakeoverRisks writes the references to missing buckets.
+func writeTakeoverRisks(w io.Writer, risks []takeoverRisk, records int) {
+	fmt.Fprintf(w, "Bucket takeover: %d DNS names pointing at S3 checked\n", records)
+	if len(risks) == 0 {
+		fmt.Fprintln(w, "No reference to a missing bucket")
+		return
+	}
+	sort.Slice(risks, func(i, j int) bool {
+		if risks[i].source != risks[j].source {
+			return risks[i].source < risks[j].source
+		}
+		return risks[i].bucket < risks[j].bucket
+	})
+	t := newTable(false, column{header: "SOURCE"}, column{header: "REFERENCE"}, column{header: "MISSING BUCKET"})
+	for _, risk := range risks {
+		t.add(cell{text: risk.source}, cell{text: risk.kind}, cell{text: risk.bucket})
+	}
+	t.write(w)
+	fmt.Fprintln(w, "\nCreate the missing buckets in the account, or remove the DNS records and the configurations referencing them")
+}
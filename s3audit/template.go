@@ -0,0 +1,67 @@
+package s3audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+)
+
+// templateFuncs are the functions the custom templates can call besides the builtin ones
+var templateFuncs = texttemplate.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+}
+
+// templateBucket is the context of a custom template for a bucket: the bucket of the report and its findings.
+type templateBucket struct {
+	ReportBucket
+	Findings []Finding
+}
+
+// templateReportWriter writes the report with a Go text/template, e.g. a Nagios check or a chat message. The
+// template is executed for every bucket, with the bucket and its findings as context. Its header and footer
+// templates, when defined with {{define "header"}}, are executed before and after the buckets with the
+// whole report as context.
+type templateReportWriter struct {
+	template *texttemplate.Template
+}
+
+// newTemplateReportWriter parses a template file.
+func newTemplateReportWriter(path string) (templateReportWriter, error) {
+	t, err := texttemplate.New(filepath.Base(path)).Funcs(templateFuncs).ParseFiles(path)
+	if err != nil {
+		return templateReportWriter{}, fmt.Errorf("parsing the template %v: %v", path, err)
+	}
+	return templateReportWriter{template: t}, nil
+}
+
+func (w templateReportWriter) WriteReport(out io.Writer, report *Report) error {
+	if header := w.template.Lookup("header"); header != nil {
+		if err := header.Execute(out, report); err != nil {
+			return err
+		}
+	}
+
+	findings := map[string][]Finding{}
+	for _, f := range report.Findings {
+		findings[f.Bucket] = append(findings[f.Bucket], f)
+	}
+	for _, b := range report.Buckets {
+		if err := w.template.Execute(out, templateBucket{ReportBucket: b, Findings: findings[b.Name]}); err != nil {
+			return err
+		}
+	}
+
+	if footer := w.template.Lookup("footer"); footer != nil {
+		return footer.Execute(out, report)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package s3audit
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// cloudFormationStackTag is the tag CloudFormation sets on the resources of its stacks
+const cloudFormationStackTag = "aws:cloudformation:stack-name"
+
+// invalidIdentifierChars matches the characters a bucket name can hold but a Terraform identifier cannot
+var invalidIdentifierChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// isManaged reports whether a bucket is managed as code, i.e. it is declared in the Terraform state, belongs
+// to a CloudFormation stack or carries one of the managed tags.
+func isManaged(b s3Bucket, managed tagMatcher, declared map[string]*declaredBucket) bool {
+	if _, ok := declared[b.name]; ok {
+		return true
+	}
+	if _, ok := b.tags[cloudFormationStackTag]; ok {
+		return true
+	}
+	_, ok := managed.match(b.tags)
+	return ok
+}
+
+// terraformIdentifier turns a bucket name into a Terraform resource name. Identifiers already taken are
+// suffixed with a counter, since different bucket names can map to the same identifier.
+func terraformIdentifier(bucket string, taken map[string]bool) string {
+	identifier := invalidIdentifierChars.ReplaceAllString(bucket, "_")
+	if identifier[0] >= '0' && identifier[0] <= '9' {
+		identifier = "bucket_" + identifier
+	}
+
+	unique := identifier
+	for i := 2; taken[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", identifier, i)
+	}
+	taken[unique] = true
+	return unique
+}
+
+// writeTerraformImports writes, for every bucket not managed as code, a Terraform import block and a minimal
+// aws_s3_bucket resource to complete before planning. It returns the number of buckets written.
+func writeTerraformImports(w io.Writer, buckets []s3Bucket, managed tagMatcher, declared map[string]*declaredBucket) (int, error) {
+	taken := map[string]bool{}
+	count := 0
+
+	for _, b := range buckets {
+		if isManaged(b, managed, declared) {
+			continue
+		}
+		identifier := terraformIdentifier(b.name, taken)
+
+		var hcl strings.Builder
+		fmt.Fprintf(&hcl, "import {\n  to = aws_s3_bucket.%s\n  id = %q\n}\n\n", identifier, b.name)
+		fmt.Fprintf(&hcl, "resource \"aws_s3_bucket\" %q {\n  bucket = %q\n", identifier, b.name)
+		if len(b.tags) > 0 {
+			var keys []string
+			for key := range b.tags {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			hcl.WriteString("\n  tags = {\n")
+			for _, key := range keys {
+				fmt.Fprintf(&hcl, "    %q = %q\n", key, b.tags[key])
+			}
+			hcl.WriteString("  }\n")
+		}
+		hcl.WriteString("}\n\n")
+
+		if _, err := io.WriteString(w, hcl.String()); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// saveTerraformImports writes the Terraform imports of the buckets not managed as code to a file.
+func saveTerraformImports(path string, buckets []s3Bucket, managed tagMatcher, declared map[string]*declaredBucket) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	count, err := writeTerraformImports(file, buckets, managed, declared)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\nWrote Terraform imports for %d unmanaged bucket(s) to %s\n", count, path)
+	return nil
+}
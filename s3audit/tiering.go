@@ -0,0 +1,139 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"time"
+)
+
+// us-east-1 list prices per GB-month, used for the cost-impact estimate of enabling archive tiers
+const (
+	priceArchiveInstantAccessGB = 0.004
+	priceDeepArchiveAccessGB    = 0.00099
+)
+
+// getIntelligentTieringConfigurations returns every Intelligent-Tiering configuration of a bucket.
+func getIntelligentTieringConfigurations(c context.Context, api BucketSettingsAPI, bucket string) ([]types.IntelligentTieringConfiguration, error) {
+	var configurations []types.IntelligentTieringConfiguration
+	input := &s3.ListBucketIntelligentTieringConfigurationsInput{Bucket: aws.String(bucket)}
+	for {
+		list, err := api.ListBucketIntelligentTieringConfigurations(c, input)
+		if err != nil {
+			return nil, err
+		}
+		configurations = append(configurations, list.IntelligentTieringConfigurationList...)
+
+		if !aws.ToBool(list.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = list.NextContinuationToken
+	}
+	return configurations, nil
+}
+
+// hasArchiveTiers reports whether an enabled Intelligent-Tiering configuration moves objects to an archive tier.
+func hasArchiveTiers(configurations []types.IntelligentTieringConfiguration) bool {
+	for _, configuration := range configurations {
+		if configuration.Status == types.IntelligentTieringStatusEnabled && len(configuration.Tierings) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionsToIntelligentTiering reports whether an enabled lifecycle rule moves objects to the
+// INTELLIGENT_TIERING storage class, the lifecycle's way of saying access to the data is infrequent or unknown.
+func transitionsToIntelligentTiering(rules []types.LifecycleRule) bool {
+	for _, rule := range rules {
+		if rule.Status != types.ExpirationStatusEnabled {
+			continue
+		}
+		for _, transition := range rule.Transitions {
+			if transition.StorageClass == types.TransitionStorageClassIntelligentTiering {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// getArchiveInstantAccessBytes reads the latest daily size of the Intelligent-Tiering Archive Instant Access
+// tier of a bucket, i.e. the objects that have not been accessed for 90 days.
+func getArchiveInstantAccessBytes(c context.Context, api CloudWatchGetMetricDataApi, bucket string) (float64, error) {
+	end := time.Now().UTC()
+	output, err := GetMetricData(c, api, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(end.AddDate(0, 0, -3)),
+		EndTime:   aws.Time(end),
+		ScanBy:    cwtypes.ScanByTimestampDescending,
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			{
+				Id: aws.String("aia"),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  aws.String("AWS/S3"),
+						MetricName: aws.String("BucketSizeBytes"),
+						Dimensions: []cwtypes.Dimension{
+							{Name: aws.String("BucketName"), Value: aws.String(bucket)},
+							{Name: aws.String("StorageType"), Value: aws.String("IntelligentTieringAIAStorage")},
+						},
+					},
+					Period: aws.Int32(86400),
+					Stat:   aws.String("Average"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, result := range output.MetricDataResults {
+		if len(result.Values) > 0 {
+			return result.Values[0], nil
+		}
+	}
+	return 0, nil
+}
+
+// intelligentTieringRemediation builds the remediation enabling the archive tiers of Intelligent-Tiering on a
+// bucket. The cost impact assumes the data in the Archive Instant Access tier moves to Deep Archive Access.
+func intelligentTieringRemediation(bucket string, region string, archiveInstantAccessBytes float64) remediation {
+	gb := archiveInstantAccessBytes / (1 << 30)
+	savings := gb * (priceArchiveInstantAccessGB - priceDeepArchiveAccessGB)
+
+	return remediation{
+		bucket: bucket,
+		region: region,
+		name:   "intelligent-tiering",
+		description: fmt.Sprintf("lifecycle moves objects to INTELLIGENT_TIERING without archive tiers; enabling Archive Access (90d) and Deep Archive Access (180d) saves up to $%.2f/month on %.1f GB (us-east-1 prices)",
+			savings, gb),
+		input: &s3.PutBucketIntelligentTieringConfigurationInput{
+			Bucket: aws.String(bucket),
+			Id:     aws.String("archive-tiers"),
+			IntelligentTieringConfiguration: &types.IntelligentTieringConfiguration{
+				Id:     aws.String("archive-tiers"),
+				Status: types.IntelligentTieringStatusEnabled,
+				Tierings: []types.Tiering{
+					{AccessTier: types.IntelligentTieringAccessTierArchiveAccess, Days: aws.Int32(90)},
+					{AccessTier: types.IntelligentTieringAccessTierDeepArchiveAccess, Days: aws.Int32(180)},
+				},
+			},
+		},
+	}
+}
+
+// printIntelligentTiering prints the Intelligent-Tiering configurations of a bucket below its report line.
+func printIntelligentTiering(configurations []types.IntelligentTieringConfiguration) {
+	for _, configuration := range configurations {
+		tiers := ""
+		for _, tiering := range configuration.Tierings {
+			tiers += fmt.Sprintf(" %s: %dd", tiering.AccessTier, aws.ToInt32(tiering.Days))
+		}
+		fmt.Printf("\tIntelligent-Tiering: %s\t Status: %s\t Tiers:%s\n", aws.ToString(configuration.Id), configuration.Status, tiers)
+	}
+}
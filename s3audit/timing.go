@@ -0,0 +1,61 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// slowBuckets is the number of buckets listed by printSlowBuckets
+const slowBuckets = 5
+
+// bucketContext returns the context of the audit of a bucket, cancelled after the BucketTimeout of the
+// options when set.
+func (a *Auditor) bucketContext(c context.Context) (context.Context, context.CancelFunc) {
+	if a.options.BucketTimeout <= 0 {
+		return context.WithCancel(c)
+	}
+	return context.WithTimeout(c, a.options.BucketTimeout)
+}
+
+// printSlowBuckets prints the buckets whose audit took longest, and every bucket whose audit timed out. The
+// buckets restored from a checkpoint were not timed.
+func printSlowBuckets(results []BucketResult, color bool) {
+	var timed, timedOut []BucketResult
+	for _, result := range results {
+		if result.restored {
+			continue
+		}
+		timed = append(timed, result)
+		if result.TimedOut {
+			timedOut = append(timedOut, result)
+		}
+	}
+	if len(timed) == 0 {
+		return
+	}
+	sort.SliceStable(timed, func(i, j int) bool { return timed[i].Duration > timed[j].Duration })
+	if len(timed) > slowBuckets {
+		timed = timed[:slowBuckets]
+	}
+
+	fmt.Println("\nSlowest buckets:")
+	t := newTable(color, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "DURATION"}, column{header: "STATUS"})
+	for _, result := range timed {
+		status := cell{text: "complete"}
+		if result.TimedOut {
+			status = cell{text: "timed out", color: colorRed}
+		}
+		t.add(cell{text: result.Name}, cell{text: result.Region}, cell{text: result.Duration.Round(time.Millisecond).String()}, status)
+	}
+	t.write(os.Stdout)
+
+	if len(timedOut) > 0 {
+		fmt.Printf("\n%d bucket(s) timed out, the settings not read in time are unchecked:\n", len(timedOut))
+		for _, result := range timedOut {
+			fmt.Printf("Bucket: %s\t Region: %s\t Unchecked: %d setting(s)\n", result.Name, result.Region, len(result.Errors))
+		}
+	}
+}
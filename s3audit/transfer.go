@@ -0,0 +1,306 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Transfer defines a cp or sync between a local path and an S3 URI, s3://bucket/key. Recursive copies the
+// files of a directory or the objects of a prefix; Sync also skips those whose copy is already up to date, the
+// same size and not older, so an interrupted transfer resumes where it stopped when run again. The transfers
+// are multipart, PartSize bytes and Concurrency parts at a time. An upload to a bucket with unsuppressed
+// findings at or above the FailOn severity of the options is refused, unless Force is set.
+type Transfer struct {
+	Source      string
+	Destination string
+	Recursive   bool
+	Sync        bool
+	Concurrency int
+	PartSize    int64
+	Force       bool
+}
+
+// transferFile is a file to copy: its local path, its key, its size and its last modification, local or in S3.
+type transferFile struct {
+	path     string
+	key      string
+	size     int64
+	modified time.Time
+}
+
+// parseS3URI splits an S3 URI into its bucket and key, and reports whether the path is an S3 URI.
+func parseS3URI(uri string) (string, string, bool) {
+	if !strings.HasPrefix(uri, "s3://") {
+		return "", "", false
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(uri, "s3://"), "/")
+	return bucket, key, bucket != ""
+}
+
+// blockingFindings returns the unsuppressed findings of a bucket at or above the threshold.
+func blockingFindings(result *BucketResult, threshold severity) []finding {
+	var blocking []finding
+	for _, f := range result.findings {
+		if f.suppressed == "" && f.severity >= threshold {
+			blocking = append(blocking, f)
+		}
+	}
+	return blocking
+}
+
+// uploadDefaults audits the destination bucket of an upload, refuses it when the bucket is not compliant and
+// returns the server-side encryption to request: AES256 when the bucket has no default encryption, so the
+// uploaded objects are never stored in clear.
+func uploadDefaults(c context.Context, cfg aws.Config, options Options, t Transfer, bucket string, w io.Writer) (types.ServerSideEncryption, error) {
+	a, result, err := auditBucket(c, cfg, options, bucket)
+	if err != nil {
+		if t.Force {
+			fmt.Fprintf(w, "Bucket %s could not be audited, uploading anyway (-force): %v\n", bucket, err)
+			return "", nil
+		}
+		return "", fmt.Errorf("auditing bucket %s: %v", bucket, err)
+	}
+	if blocking := blockingFindings(result, a.failThreshold); len(blocking) > 0 {
+		table := newTable(a.color, column{header: "SEVERITY"}, column{header: "CHECK"}, column{header: "MESSAGE"})
+		for _, f := range blocking {
+			table.add(cell{text: f.severity.String(), color: severityColor(f.severity, false)}, cell{text: f.check}, cell{text: f.message})
+		}
+		table.write(w)
+		if !t.Force {
+			return "", fmt.Errorf("bucket %s is not compliant, %d findings at or above %s; fix them or run with -force", bucket, len(blocking), a.failThreshold)
+		}
+		fmt.Fprintf(w, "Bucket %s is not compliant, uploading anyway (-force)\n", bucket)
+	}
+	if result.bucket.encryptionState == encryptionNone {
+		return types.ServerSideEncryptionAes256, nil
+	}
+	return "", nil
+}
+
+// localFiles lists the files under a local path, their key being the destination key joined with their path
+// relative to root. A file copied without Recursive keeps its name under a destination ending with /.
+func localFiles(root string, key string, recursive bool) ([]transferFile, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		if key == "" || strings.HasSuffix(key, "/") {
+			key += filepath.Base(root)
+		}
+		return []transferFile{{path: root, key: key, size: info.Size(), modified: info.ModTime()}}, nil
+	}
+	if !recursive {
+		return nil, fmt.Errorf("%s is a directory, copy it with -recursive", root)
+	}
+	var files []transferFile
+	err = filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, transferFile{path: p, key: path.Join(key, filepath.ToSlash(rel)), size: info.Size(), modified: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// localPath joins a key relative to the prefix to the destination of a download. A key such as ../../.bashrc
+// would write outside of the destination, the download of a bucket one does not control is refused.
+func localPath(destination string, key string) (string, error) {
+	p := filepath.Join(destination, filepath.FromSlash(key))
+	rel, err := filepath.Rel(destination, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("key %s would be written outside of %s", key, destination)
+	}
+	return p, nil
+}
+
+// remoteFiles lists the objects under a prefix, their local path being the destination joined with their key
+// relative to the prefix. Without Recursive, the object of the key is copied to the destination, or under it
+// when it is a directory. An empty destination only lists the keys, the local paths are left empty.
+func remoteFiles(c context.Context, api ObjectReaderAPI, bucket string, prefix string, destination string, recursive bool) ([]transferFile, error) {
+	if !recursive {
+		p := destination
+		if info, err := os.Stat(destination); err == nil && info.IsDir() {
+			if p, err = localPath(destination, path.Base(prefix)); err != nil {
+				return nil, err
+			}
+		}
+		return []transferFile{{path: p, key: prefix}}, nil
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	var files []transferFile
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(prefix)}
+	for {
+		page, err := api.ListObjectsV2(c, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range page.Contents {
+			key := aws.ToString(object.Key)
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			var p string
+			if destination != "" {
+				if p, err = localPath(destination, strings.TrimPrefix(key, prefix)); err != nil {
+					return nil, err
+				}
+			}
+			files = append(files, transferFile{
+				path:     p,
+				key:      key,
+				size:     aws.ToInt64(object.Size),
+				modified: aws.ToTime(object.LastModified),
+			})
+		}
+		if !aws.ToBool(page.IsTruncated) {
+			break
+		}
+		input.ContinuationToken = page.NextContinuationToken
+	}
+	return files, nil
+}
+
+// upToDate reports whether the copy of a file is the same size and not older, i.e. a sync can skip it.
+func upToDate(file transferFile, copied transferFile, found bool) bool {
+	return found && copied.size == file.size && !copied.modified.Before(file.modified)
+}
+
+// RunTransfer runs a cp or a sync between a local path and S3 with the transfer managers of the SDK. The options
+// select the account, the checks and the FailOn severity of the audit of the destination bucket of an upload.
+func RunTransfer(c context.Context, cfg aws.Config, options Options, t Transfer, w io.Writer) error {
+	sourceBucket, sourceKey, download := parseS3URI(t.Source)
+	destinationBucket, destinationKey, upload := parseS3URI(t.Destination)
+	if download == upload {
+		return fmt.Errorf("expected one local path and one S3 URI, s3://bucket/key")
+	}
+	bucket := destinationBucket
+	if download {
+		bucket = sourceBucket
+		if sourceKey == "" && !t.Recursive && !t.Sync {
+			return fmt.Errorf("s3://%s is a bucket, copy it with -recursive", bucket)
+		}
+	}
+
+	client, _, err := newBucketClient(c, cfg, bucket, "")
+	if err != nil {
+		return err
+	}
+
+	var transferred, skipped int
+	var total int64
+	if upload {
+		sse, err := uploadDefaults(c, cfg, options, t, bucket, w)
+		if err != nil {
+			return err
+		}
+		files, err := localFiles(t.Source, destinationKey, t.Recursive || t.Sync)
+		if err != nil {
+			return err
+		}
+		existing := map[string]transferFile{}
+		if t.Sync {
+			objects, err := remoteFiles(c, client, bucket, destinationKey, "", true)
+			if err != nil {
+				return err
+			}
+			for _, object := range objects {
+				existing[object.key] = object
+			}
+		}
+		uploader := manager.NewUploader(client, func(u *manager.Uploader) {
+			u.PartSize = t.PartSize
+			u.Concurrency = t.Concurrency
+		})
+		for _, file := range files {
+			if object, ok := existing[file.key]; t.Sync && upToDate(file, object, ok) {
+				skipped++
+				continue
+			}
+			if err := uploadFile(c, uploader, bucket, file, sse); err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "upload: %s to s3://%s/%s\n", file.path, bucket, file.key)
+			transferred++
+			total += file.size
+		}
+	} else {
+		files, err := remoteFiles(c, client, bucket, sourceKey, t.Destination, t.Recursive || t.Sync)
+		if err != nil {
+			return err
+		}
+		downloader := manager.NewDownloader(client, func(d *manager.Downloader) {
+			d.PartSize = t.PartSize
+			d.Concurrency = t.Concurrency
+		})
+		for _, file := range files {
+			if info, err := os.Stat(file.path); err == nil && t.Sync &&
+				upToDate(file, transferFile{size: info.Size(), modified: info.ModTime()}, true) {
+				skipped++
+				continue
+			}
+			size, err := downloadFile(c, downloader, bucket, file)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "download: s3://%s/%s to %s\n", bucket, file.key, file.path)
+			transferred++
+			total += size
+		}
+	}
+	fmt.Fprintf(w, "%d files transferred, %.1f MB, %d up to date\n", transferred, float64(total)/(1<<20), skipped)
+	return nil
+}
+
+// uploadFile uploads a file, in parts when it is larger than the part size.
+func uploadFile(c context.Context, uploader *manager.Uploader, bucket string, file transferFile, sse types.ServerSideEncryption) error {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	input := &s3.PutObjectInput{Bucket: aws.String(bucket), Key: aws.String(file.key), Body: f, ServerSideEncryption: sse}
+	if _, err := uploader.Upload(c, input); err != nil {
+		return fmt.Errorf("uploading %s: %v", file.path, err)
+	}
+	return nil
+}
+
+// downloadFile downloads an object to a .part file renamed once complete, so an interrupted download never
+// leaves a truncated file a sync would take for up to date.
+func downloadFile(c context.Context, downloader *manager.Downloader, bucket string, file transferFile) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(file.path), 0755); err != nil {
+		return 0, err
+	}
+	part := file.path + ".part"
+	f, err := os.Create(part)
+	if err != nil {
+		return 0, err
+	}
+	size, err := downloader.Download(c, f, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(file.key)})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(part)
+		return 0, fmt.Errorf("downloading s3://%s/%s: %v", bucket, file.key, err)
+	}
+	return size, os.Rename(part, file.path)
+}
@@ -0,0 +1,130 @@
+package s3audit
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sparkBars are the bars of the sparklines, from the lowest to the highest count
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// trendKey identifies the buckets of an account carrying a team tag value
+type trendKey struct {
+	accountID string
+	team      string
+}
+
+// trendPoint counts the buckets of a group at a scan
+type trendPoint struct {
+	scanTime    time.Time
+	buckets     int
+	unencrypted int
+	public      int
+	unversioned int
+}
+
+// trendPoints groups the snapshots per account and per value of the team tag, and counts the unencrypted,
+// public and unversioned buckets of each group at each scan, oldest first. The buckets without the team tag
+// are grouped under "-". Buckets whose encryption could not be read are not counted as unencrypted.
+func trendPoints(snapshots []BucketSnapshot, teamTag string) map[trendKey][]trendPoint {
+	points := map[trendKey][]trendPoint{}
+	for _, s := range snapshots {
+		key := trendKey{accountID: s.AccountID, team: "-"}
+		if team, ok := s.Tags[teamTag]; ok && team != "" {
+			key.team = team
+		}
+
+		series := points[key]
+		if len(series) == 0 || !series[len(series)-1].scanTime.Equal(s.ScanTime) {
+			series = append(series, trendPoint{scanTime: s.ScanTime})
+		}
+		p := &series[len(series)-1]
+		p.buckets++
+		if s.Encryption == "none" {
+			p.unencrypted++
+		}
+		if s.Public {
+			p.public++
+		}
+		if s.Versioning != "Enabled" {
+			p.unversioned++
+		}
+		points[key] = series
+	}
+	return points
+}
+
+// sortedTrendKeys returns the groups of the points ordered by account, then by team.
+func sortedTrendKeys(points map[trendKey][]trendPoint) []trendKey {
+	var keys []trendKey
+	for key := range points {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].accountID != keys[j].accountID {
+			return keys[i].accountID < keys[j].accountID
+		}
+		return keys[i].team < keys[j].team
+	})
+	return keys
+}
+
+// sparkline draws counts as bars scaled to the highest of them.
+func sparkline(counts []int) string {
+	highest := 0
+	for _, n := range counts {
+		if n > highest {
+			highest = n
+		}
+	}
+	line := make([]rune, len(counts))
+	for i, n := range counts {
+		line[i] = sparkBars[0]
+		if highest > 0 {
+			line[i] = sparkBars[n*(len(sparkBars)-1)/highest]
+		}
+	}
+	return string(line)
+}
+
+// WriteTrend writes how the counts of unencrypted, public and unversioned buckets changed over the scans of
+// the last period kept in a history, e.g. dynamodb://table or postgres://host/database, per account and per
+// value of the teamTag tag.
+func WriteTrend(c context.Context, cfg aws.Config, location string, period time.Duration, teamTag string, w io.Writer) error {
+	history, err := openHistory(c, cfg, location)
+	if err != nil {
+		return fmt.Errorf("opening the history: %v", err)
+	}
+	snapshots, err := history.since(c, time.Now().Add(-period))
+	if err != nil {
+		return fmt.Errorf("reading the history: %v", err)
+	}
+	points := trendPoints(snapshots, teamTag)
+	if len(points) == 0 {
+		fmt.Fprintf(w, "No scan in the history since %s\n", time.Now().Add(-period).Format("2006-01-02"))
+		return nil
+	}
+	for _, key := range sortedTrendKeys(points) {
+		series := points[key]
+		fmt.Fprintf(w, "\nAccount %s, %s %s:\n", key.accountID, teamTag, key.team)
+		t := newTable(false, column{header: "SCAN"}, column{header: "BUCKETS"}, column{header: "UNENCRYPTED"},
+			column{header: "PUBLIC"}, column{header: "UNVERSIONED"})
+		var unencrypted, public, unversioned []int
+		for _, p := range series {
+			t.add(cell{text: p.scanTime.Format("2006-01-02 15:04")}, cell{text: strconv.Itoa(p.buckets)},
+				cell{text: strconv.Itoa(p.unencrypted)}, cell{text: strconv.Itoa(p.public)}, cell{text: strconv.Itoa(p.unversioned)})
+			unencrypted = append(unencrypted, p.unencrypted)
+			public = append(public, p.public)
+			unversioned = append(unversioned, p.unversioned)
+		}
+		t.write(w)
+		fmt.Fprintf(w, "  unencrypted %s\n  public      %s\n  unversioned %s\n",
+			sparkline(unencrypted), sparkline(public), sparkline(unversioned))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package s3audit
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// verifyStatus is the outcome of the comparison of a local file with its object.
+type verifyStatus string
+
+const (
+	verifyOK           verifyStatus = "ok"
+	verifyMismatch     verifyStatus = "mismatch"
+	verifyMissing      verifyStatus = "missing"
+	verifyUnverifiable verifyStatus = "unverifiable"
+)
+
+// verification is the comparison of a local file with its object, and the checksum it relied on.
+type verification struct {
+	file   transferFile
+	method string
+	status verifyStatus
+	detail string
+}
+
+// objectChecksum is the checksum S3 stores with an object: the additional checksum it was uploaded with, or
+// its ETag. parts is the number of parts of a multipart object whose checksum is composite, the checksum of
+// the checksums of its parts, and 0 for a checksum of the whole object.
+type objectChecksum struct {
+	algorithm string
+	value     string
+	newHash   func() hash.Hash
+	encode    func([]byte) string
+	parts     int
+}
+
+// checksumOf returns the checksum of an object to compare the local file with, the strongest one it has.
+func checksumOf(head *s3.HeadObjectOutput) objectChecksum {
+	base64Encode := base64.StdEncoding.EncodeToString
+	candidates := []struct {
+		algorithm string
+		value     *string
+		newHash   func() hash.Hash
+	}{
+		{"SHA256", head.ChecksumSHA256, sha256.New},
+		{"CRC32C", head.ChecksumCRC32C, func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) }},
+		{"CRC32", head.ChecksumCRC32, func() hash.Hash { return crc32.NewIEEE() }},
+		{"SHA1", head.ChecksumSHA1, sha1.New},
+	}
+	for _, candidate := range candidates {
+		if value := aws.ToString(candidate.value); value != "" {
+			checksum := objectChecksum{algorithm: candidate.algorithm, value: value, newHash: candidate.newHash, encode: base64Encode}
+			checksum.parts = compositeParts(value)
+			return checksum
+		}
+	}
+	etag := strings.Trim(aws.ToString(head.ETag), `"`)
+	return objectChecksum{algorithm: "ETag", value: etag, newHash: md5.New, encode: hex.EncodeToString, parts: compositeParts(etag)}
+}
+
+// compositeParts returns the number of parts of a composite checksum, written <checksum>-<parts>.
+func compositeParts(value string) int {
+	i := strings.LastIndex(value, "-")
+	if i < 0 {
+		return 0
+	}
+	parts, err := strconv.Atoi(value[i+1:])
+	if err != nil {
+		return 0
+	}
+	return parts
+}
+
+// localChecksum computes the checksum of a file as S3 does for an object: of the whole file, or of the
+// checksums of its parts of partSize bytes for a composite checksum.
+func localChecksum(path string, checksum objectChecksum, partSize int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if checksum.parts == 0 {
+		h := checksum.newHash()
+		if _, err := io.Copy(h, f); err != nil {
+			return "", err
+		}
+		return checksum.encode(h.Sum(nil)), nil
+	}
+	var sums []byte
+	for part := 0; part < checksum.parts; part++ {
+		h := checksum.newHash()
+		if _, err := io.CopyN(h, f, partSize); err != nil && err != io.EOF {
+			return "", err
+		}
+		sums = append(sums, h.Sum(nil)...)
+	}
+	h := checksum.newHash()
+	h.Write(sums)
+	return fmt.Sprintf("%s-%d", checksum.encode(h.Sum(nil)), checksum.parts), nil
+}
+
+// verifyFile compares a local file with its object: their size, then their checksum. The part size of a
+// multipart object is the size of its first part, S3 keeping no record of the part size used by the upload.
+func verifyFile(c context.Context, api ObjectReaderAPI, bucket string, file transferFile) verification {
+	v := verification{file: file}
+	head, err := api.HeadObject(c, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(file.key), ChecksumMode: types.ChecksumModeEnabled})
+	if code := apiErrorCode(err); code == "NotFound" || code == "NoSuchKey" {
+		v.status = verifyMissing
+		return v
+	}
+	if err != nil {
+		v.status, v.detail = verifyUnverifiable, err.Error()
+		return v
+	}
+	if size := aws.ToInt64(head.ContentLength); size != file.size {
+		v.status, v.detail = verifyMismatch, fmt.Sprintf("size %d, object size %d", file.size, size)
+		return v
+	}
+
+	checksum := checksumOf(head)
+	v.method = checksum.algorithm
+	// the ETag of an object encrypted with KMS is not the MD5 of its data
+	if checksum.algorithm == "ETag" && (head.ServerSideEncryption == types.ServerSideEncryptionAwsKms ||
+		head.ServerSideEncryption == types.ServerSideEncryptionAwsKmsDsse) {
+		v.status, v.detail = verifyUnverifiable, "KMS encrypted object without an additional checksum"
+		return v
+	}
+	var partSize int64
+	if checksum.parts > 0 {
+		first, err := api.HeadObject(c, &s3.HeadObjectInput{Bucket: aws.String(bucket), Key: aws.String(file.key), PartNumber: aws.Int32(1)})
+		if err != nil {
+			v.status, v.detail = verifyUnverifiable, fmt.Sprintf("reading the first part: %v", err)
+			return v
+		}
+		partSize = aws.ToInt64(first.ContentLength)
+	}
+	local, err := localChecksum(file.path, checksum, partSize)
+	if err != nil {
+		v.status, v.detail = verifyUnverifiable, err.Error()
+		return v
+	}
+	if local != checksum.value {
+		v.status, v.detail = verifyMismatch, fmt.Sprintf("%s %s, object %s", checksum.algorithm, local, checksum.value)
+		return v
+	}
+	v.status = verifyOK
+	return v
+}
+
+// VerifyObjects compares the local files under a path with the objects they were uploaded to under an S3 URI,
+// s3://bucket/prefix, with the SHA256, CRC32C, CRC32 or SHA1 checksum of the objects, or their ETag, e.g. to
+// validate a backup. It returns false when a file is missing from S3 or differs from its object.
+func VerifyObjects(c context.Context, cfg aws.Config, local string, uri string, w io.Writer) (bool, error) {
+	bucket, prefix, ok := parseS3URI(uri)
+	if !ok {
+		return false, fmt.Errorf("invalid S3 URI %q, expected s3://bucket/prefix", uri)
+	}
+	files, err := localFiles(local, prefix, true)
+	if err != nil {
+		return false, err
+	}
+	client, _, err := newBucketClient(c, cfg, bucket, "")
+	if err != nil {
+		return false, err
+	}
+
+	counts := map[verifyStatus]int{}
+	t := newTable(false, column{header: "FILE"}, column{header: "OBJECT"}, column{header: "CHECKSUM"}, column{header: "STATUS"}, column{header: "DETAIL"})
+	for _, file := range files {
+		v := verifyFile(c, client, bucket, file)
+		counts[v.status]++
+		if v.status != verifyOK {
+			t.add(cell{text: file.path}, cell{text: "s3://" + bucket + "/" + file.key}, cell{text: v.method}, cell{text: string(v.status)}, cell{text: v.detail})
+		}
+	}
+	if counts[verifyOK] < len(files) {
+		t.write(w)
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "%d files verified: %d ok, %d mismatched, %d missing, %d unverifiable\n", len(files),
+		counts[verifyOK], counts[verifyMismatch], counts[verifyMissing], counts[verifyUnverifiable])
+	return counts[verifyMismatch] == 0 && counts[verifyMissing] == 0, nil
+}
@@ -0,0 +1,17 @@
+package s3audit
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// getBucketVersioning returns the versioning status of a bucket, "" if versioning was never enabled.
+func getBucketVersioning(c context.Context, api BucketSettingsAPI, bucket string) (types.BucketVersioningStatus, error) {
+	versioning, err := api.GetBucketVersioning(c, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", err
+	}
+	return versioning.Status, nil
+}
@@ -0,0 +1,162 @@
+package s3audit
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// vpcOnlyBucket defines the buckets that must only be reachable through VPC endpoints: their policy must deny
+// the requests that come from neither one of the endpoints nor one of the VPCs. Bucket is a glob pattern.
+type vpcOnlyBucket struct {
+	Bucket    string   `yaml:"bucket"`
+	Endpoints []string `yaml:"endpoints"`
+	VPCs      []string `yaml:"vpcs"`
+}
+
+// vpcEndpointFile defines the layout of the VPC endpoints YAML file
+type vpcEndpointFile struct {
+	Buckets []vpcOnlyBucket `yaml:"buckets"`
+}
+
+// vpcConditionKeys are the condition keys, lower case, restricting the requests to VPC endpoints or VPCs
+var vpcConditionKeys = map[string]bool{"aws:sourcevpce": true, "aws:sourcevpc": true}
+
+// loadVPCEndpoints reads a VPC endpoints file. Every entry needs a bucket pattern and at least one endpoint
+// (vpce-...) or VPC (vpc-...).
+func loadVPCEndpoints(file string) ([]vpcOnlyBucket, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var content vpcEndpointFile
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return nil, err
+	}
+
+	for i, b := range content.Buckets {
+		if b.Bucket == "" || len(b.Endpoints)+len(b.VPCs) == 0 {
+			return nil, fmt.Errorf("bucket %d: bucket and endpoints or vpcs are required", i+1)
+		}
+		if _, err := path.Match(b.Bucket, ""); err != nil {
+			return nil, fmt.Errorf("bucket %d: invalid bucket pattern %q", i+1, b.Bucket)
+		}
+		for _, endpoint := range b.Endpoints {
+			if !strings.HasPrefix(endpoint, "vpce-") {
+				return nil, fmt.Errorf("bucket %d: invalid endpoint %q, expected vpce-...", i+1, endpoint)
+			}
+		}
+		for _, vpc := range b.VPCs {
+			if !strings.HasPrefix(vpc, "vpc-") {
+				return nil, fmt.Errorf("bucket %d: invalid VPC %q, expected vpc-...", i+1, vpc)
+			}
+		}
+	}
+	return content.Buckets, nil
+}
+
+// vpcOnlyRule returns the first entry of the VPC endpoints file matching a bucket, and whether one does.
+func vpcOnlyRule(rules []vpcOnlyBucket, bucket string) (vpcOnlyBucket, bool) {
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Bucket, bucket); ok {
+			return rule, true
+		}
+	}
+	return vpcOnlyBucket{}, false
+}
+
+// vpcConditionValues returns the endpoints and VPCs of the VPC conditions of a statement whose operator starts
+// with one of the prefixes, e.g. StringNotEquals.
+func (s policyStatement) vpcConditionValues(prefixes ...string) []string {
+	var values []string
+	for operator, conditions := range s.Condition {
+		matched := false
+		for _, prefix := range prefixes {
+			matched = matched || strings.HasPrefix(operator, prefix)
+		}
+		if !matched {
+			continue
+		}
+		for key, raw := range conditions {
+			if vpcConditionKeys[strings.ToLower(key)] {
+				values = append(values, stringOrList(raw)...)
+			}
+		}
+	}
+	return values
+}
+
+// deniesEveryone reports whether a statement denies every S3 action to every principal.
+func (s policyStatement) deniesEveryone() bool {
+	if s.Effect != "Deny" {
+		return false
+	}
+	everyone := false
+	for _, values := range s.principals() {
+		for _, value := range values {
+			everyone = everyone || value == "*"
+		}
+	}
+	allActions := false
+	for _, action := range stringOrList(s.Action) {
+		allActions = allActions || action == "*" || strings.EqualFold(action, "s3:*")
+	}
+	return everyone && allActions
+}
+
+// vpcEndpointFindings checks the policy of a VPC-only bucket: it must deny every request from outside the
+// allowed endpoints and VPCs, and neither its Deny nor its Allow statements may let another endpoint or VPC in.
+func vpcEndpointFindings(bucket string, policy string, rule vpcOnlyBucket) ([]finding, error) {
+	allowed := map[string]bool{}
+	for _, id := range append(append([]string{}, rule.Endpoints...), rule.VPCs...) {
+		allowed[strings.ToLower(id)] = true
+	}
+	newFinding := func(message string) finding {
+		return finding{bucket: bucket, check: "vpc-endpoint", severity: severityHigh, message: message}
+	}
+	expected := strings.Join(append(append([]string{}, rule.Endpoints...), rule.VPCs...), ", ")
+
+	if policy == "" {
+		return []finding{newFinding(fmt.Sprintf("bucket is VPC-only but has no bucket policy, it is reachable outside %s", expected))}, nil
+	}
+	document, err := parsePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	restricted := false
+	unexpected := map[string]bool{}
+	for _, statement := range document.Statement {
+		var values []string
+		switch {
+		case statement.deniesEveryone():
+			values = statement.vpcConditionValues("StringNotEquals", "StringNotLike")
+			restricted = restricted || len(values) > 0
+		case statement.Effect == "Allow":
+			values = statement.vpcConditionValues("StringEquals", "StringLike")
+		}
+		for _, value := range values {
+			if !allowed[strings.ToLower(value)] {
+				unexpected[value] = true
+			}
+		}
+	}
+
+	var findings []finding
+	if !restricted {
+		findings = append(findings, newFinding(fmt.Sprintf("bucket policy does not deny the requests from outside %s", expected)))
+	}
+	var others []string
+	for value := range unexpected {
+		others = append(others, value)
+	}
+	sort.Strings(others)
+	for _, value := range others {
+		findings = append(findings, newFinding(fmt.Sprintf("bucket policy lets in %s, not an allowed endpoint or VPC", value)))
+	}
+	return findings, nil
+}
@@ -0,0 +1,297 @@
+package s3audit
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cwtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// us-east-1 list prices per GB-month, used for the spend a lifecycle moving the data out of Standard avoids
+const (
+	priceStandardGB             = 0.023
+	priceGlacierInstantAccessGB = 0.004
+)
+
+// wasteHistoryDays is the number of days of daily sizes the growth of a bucket is fitted over
+const wasteHistoryDays = 90
+
+// WasteAnalysis defines the projected waste report: the buckets matching the comma separated glob patterns
+// of Buckets, all of them when empty, projected over Months.
+type WasteAnalysis struct {
+	Buckets string
+	Months  int
+	// Format is the format the report is written in: table, csv or json
+	Format string
+}
+
+// bucketWaste is the projected waste of a bucket. The growth is the one of its Standard storage, the data a
+// lifecycle would move to a cheaper storage class.
+type bucketWaste struct {
+	Bucket        string   `json:"bucket"`
+	Region        string   `json:"region"`
+	SizeGB        float64  `json:"sizeGB"`
+	StandardGB    float64  `json:"standardGB"`
+	GrowthGBMonth float64  `json:"growthGBPerMonth"`
+	Gaps          []string `json:"lifecycleGaps"`
+	// ProjectedWaste is the Standard storage spend over the months of the analysis a lifecycle tiering the
+	// data to Glacier Instant Retrieval avoids, 0 when the bucket already tiers or expires its data
+	ProjectedWaste float64 `json:"projectedWasteUSD"`
+}
+
+// getDailySizes reads the daily sizes of a bucket over the last days, oldest first: the sum over all its
+// storage classes, and the Standard storage alone with the timestamps of its sizes.
+func getDailySizes(c context.Context, api CloudWatchGetMetricDataApi, bucket string, days int) (total []float64, timestamps []time.Time, standard []float64, err error) {
+	end := time.Now().UTC()
+	output, err := GetMetricData(c, api, &cloudwatch.GetMetricDataInput{
+		StartTime: aws.Time(end.AddDate(0, 0, -days)),
+		EndTime:   aws.Time(end),
+		ScanBy:    cwtypes.ScanByTimestampAscending,
+		MetricDataQueries: []cwtypes.MetricDataQuery{
+			{
+				Id: aws.String("total"),
+				Expression: aws.String(fmt.Sprintf(
+					`SUM(SEARCH('{AWS/S3,BucketName,StorageType} MetricName="BucketSizeBytes" BucketName="%s"', 'Average', 86400))`,
+					bucket)),
+			},
+			{
+				Id: aws.String("standard"),
+				MetricStat: &cwtypes.MetricStat{
+					Metric: &cwtypes.Metric{
+						Namespace:  aws.String("AWS/S3"),
+						MetricName: aws.String("BucketSizeBytes"),
+						Dimensions: []cwtypes.Dimension{
+							{Name: aws.String("BucketName"), Value: aws.String(bucket)},
+							{Name: aws.String("StorageType"), Value: aws.String("StandardStorage")},
+						},
+					},
+					Period: aws.Int32(86400),
+					Stat:   aws.String("Average"),
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	for _, result := range output.MetricDataResults {
+		switch aws.ToString(result.Id) {
+		case "total":
+			total = result.Values
+		case "standard":
+			timestamps, standard = result.Timestamps, result.Values
+		}
+	}
+	return total, timestamps, standard, nil
+}
+
+// growthPerMonth fits a line through the daily sizes by least squares and returns its slope, in bytes per
+// 30 days. Fewer than two sizes give no growth.
+func growthPerMonth(timestamps []time.Time, values []float64) float64 {
+	n := len(values)
+	if len(timestamps) < n {
+		n = len(timestamps)
+	}
+	if n < 2 {
+		return 0
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i := 0; i < n; i++ {
+		x := timestamps[i].Sub(timestamps[0]).Hours() / 24
+		sumX += x
+		sumY += values[i]
+		sumXY += x * values[i]
+		sumXX += x * x
+	}
+	denominator := float64(n)*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (float64(n)*sumXY - sumX*sumY) / denominator * 30
+}
+
+// lifecycleGaps returns what the enabled lifecycle rules of a bucket leave out, and whether a rule moves its
+// current objects out of Standard storage, by transitioning or expiring them.
+func lifecycleGaps(rules []types.LifecycleRule, versioned bool) ([]string, bool) {
+	var tiers, noncurrent, uploads, enabled bool
+	for _, rule := range rules {
+		if rule.Status != types.ExpirationStatusEnabled {
+			continue
+		}
+		enabled = true
+		if len(rule.Transitions) > 0 || rule.Expiration != nil {
+			tiers = true
+		}
+		if rule.NoncurrentVersionExpiration != nil || len(rule.NoncurrentVersionTransitions) > 0 {
+			noncurrent = true
+		}
+		if rule.AbortIncompleteMultipartUpload != nil {
+			uploads = true
+		}
+	}
+	if !enabled {
+		return []string{"no lifecycle"}, false
+	}
+
+	var gaps []string
+	if !tiers {
+		gaps = append(gaps, "no transition or expiration")
+	}
+	if versioned && !noncurrent {
+		gaps = append(gaps, "no noncurrent version expiration")
+	}
+	if !uploads {
+		gaps = append(gaps, "no incomplete upload cleanup")
+	}
+	return gaps, tiers
+}
+
+// projectedWaste returns the Standard storage spend a lifecycle tiering the data avoids over the months, the
+// size projected from its current value and its monthly growth, never below zero.
+func projectedWaste(standardBytes float64, growth float64, months int) float64 {
+	var waste float64
+	for month := 1; month <= months; month++ {
+		projected := standardBytes + growth*float64(month)
+		if projected > 0 {
+			waste += projected / (1 << 30) * (priceStandardGB - priceGlacierInstantAccessGB)
+		}
+	}
+	return waste
+}
+
+// analyzeWaste reads the sizes, the lifecycle rules and the versioning of a bucket and projects its waste.
+func analyzeWaste(c context.Context, cfg aws.Config, bucket regionalBucket, months int) (bucketWaste, error) {
+	cw := cloudwatch.NewFromConfig(cfg, func(options *cloudwatch.Options) {
+		options.Region = bucket.region
+	})
+	total, timestamps, standard, err := getDailySizes(c, cw, bucket.name, wasteHistoryDays)
+	if err != nil {
+		return bucketWaste{}, fmt.Errorf("reading its size: %v", err)
+	}
+
+	lifecycle, err := bucket.client.GetBucketLifecycleConfiguration(c, &s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket.name)})
+	if err != nil && apiErrorCode(err) != "NoSuchLifecycleConfiguration" {
+		return bucketWaste{}, fmt.Errorf("reading its lifecycle configuration: %v", err)
+	}
+	var rules []types.LifecycleRule
+	if lifecycle != nil {
+		rules = lifecycle.Rules
+	}
+	versioning, err := bucket.client.GetBucketVersioning(c, &s3.GetBucketVersioningInput{Bucket: aws.String(bucket.name)})
+	if err != nil {
+		return bucketWaste{}, fmt.Errorf("reading its versioning: %v", err)
+	}
+
+	waste := bucketWaste{Bucket: bucket.name, Region: bucket.region}
+	// the values are ordered oldest first, the last is the current size
+	if len(total) > 0 {
+		waste.SizeGB = total[len(total)-1] / (1 << 30)
+	}
+	var standardBytes float64
+	if len(standard) > 0 {
+		standardBytes = standard[len(standard)-1]
+	}
+	growth := growthPerMonth(timestamps, standard)
+	waste.StandardGB = standardBytes / (1 << 30)
+	waste.GrowthGBMonth = growth / (1 << 30)
+	gaps, tiers := lifecycleGaps(rules, versioning.Status != "")
+	waste.Gaps = gaps
+	if !tiers {
+		waste.ProjectedWaste = projectedWaste(standardBytes, growth, months)
+	}
+	return waste, nil
+}
+
+// WriteWasteReport writes the projected waste report of the quarterly FinOps review: the buckets ranked by
+// the Standard storage spend a lifecycle would avoid over the months, their size growth fitted over the last
+// 90 days of CloudWatch daily sizes, with the gaps of their lifecycle rules. The prices are the us-east-1
+// list prices.
+func WriteWasteReport(c context.Context, cfg aws.Config, analysis WasteAnalysis, w io.Writer) error {
+	if analysis.Months < 1 {
+		return fmt.Errorf("invalid months %d, expected 1 or more", analysis.Months)
+	}
+	if analysis.Format != "table" && analysis.Format != "csv" && analysis.Format != "json" {
+		return fmt.Errorf("invalid format %q, expected one of: table, csv, json", analysis.Format)
+	}
+	matched, err := matchBuckets(c, cfg, analysis.Buckets)
+	if err != nil {
+		return err
+	}
+
+	var wastes []bucketWaste
+	for _, bucket := range matched {
+		waste, err := analyzeWaste(c, cfg, bucket, analysis.Months)
+		if err != nil {
+			log.Printf("Got an error analyzing bucket %v, left out of the report: %v", bucket.name, err)
+			continue
+		}
+		wastes = append(wastes, waste)
+	}
+	sort.SliceStable(wastes, func(i, j int) bool {
+		if wastes[i].ProjectedWaste != wastes[j].ProjectedWaste {
+			return wastes[i].ProjectedWaste > wastes[j].ProjectedWaste
+		}
+		if wastes[i].GrowthGBMonth != wastes[j].GrowthGBMonth {
+			return wastes[i].GrowthGBMonth > wastes[j].GrowthGBMonth
+		}
+		return wastes[i].Bucket < wastes[j].Bucket
+	})
+	return writeWasteReport(w, wastes, analysis)
+}
+
+// writeWasteReport writes the ranked buckets as a table, as CSV or as a JSON array.
+func writeWasteReport(w io.Writer, wastes []bucketWaste, analysis WasteAnalysis) error {
+	switch analysis.Format {
+	case "json":
+		if wastes == nil {
+			wastes = []bucketWaste{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(wastes)
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"bucket", "region", "size_gb", "standard_gb", "growth_gb_per_month", "lifecycle_gaps", "projected_waste_usd"})
+		for _, waste := range wastes {
+			writer.Write([]string{waste.Bucket, waste.Region, strconv.FormatFloat(waste.SizeGB, 'f', 1, 64),
+				strconv.FormatFloat(waste.StandardGB, 'f', 1, 64), strconv.FormatFloat(waste.GrowthGBMonth, 'f', 1, 64),
+				strings.Join(waste.Gaps, "; "), strconv.FormatFloat(waste.ProjectedWaste, 'f', 2, 64)})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		fmt.Fprintf(w, "Projected waste over %d month(s), Standard storage a lifecycle would tier (us-east-1 prices):\n", analysis.Months)
+		if len(wastes) == 0 {
+			fmt.Fprintln(w, "\tnone")
+			return nil
+		}
+		t := newTable(false, column{header: "BUCKET"}, column{header: "REGION"}, column{header: "SIZE GB"}, column{header: "STANDARD GB"},
+			column{header: "GROWTH GB/MONTH"}, column{header: "LIFECYCLE GAPS"}, column{header: "PROJECTED WASTE"})
+		var total float64
+		for _, waste := range wastes {
+			gaps := strings.Join(waste.Gaps, ", ")
+			if gaps == "" {
+				gaps = "none"
+			}
+			t.add(cell{text: waste.Bucket}, cell{text: waste.Region}, cell{text: fmt.Sprintf("%.1f", waste.SizeGB)},
+				cell{text: fmt.Sprintf("%.1f", waste.StandardGB)}, cell{text: fmt.Sprintf("%+.1f", waste.GrowthGBMonth)},
+				cell{text: gaps}, cell{text: fmt.Sprintf("$%.2f", waste.ProjectedWaste)})
+			total += waste.ProjectedWaste
+		}
+		t.write(w)
+		fmt.Fprintf(w, "\nAvoidable spend over %d month(s): $%.2f\n", analysis.Months, total)
+		return nil
+	}
+}
@@ -0,0 +1,616 @@
+// Code generated by gen.go; DO NOT EDIT.
+
+package s3audittest
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"golang-playground/s3audit"
+)
+
+// FakeS3 is a fake s3 client. Each operation returns the response of its function field when set,
+// an empty output otherwise, and every call is recorded.
+type FakeS3 struct {
+	Recorder
+
+	AbortMultipartUploadFunc                       func(ctx context.Context, params *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error)
+	CompleteMultipartUploadFunc                    func(ctx context.Context, params *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error)
+	CreateBucketFunc                               func(ctx context.Context, params *s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
+	CreateMultipartUploadFunc                      func(ctx context.Context, params *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error)
+	DeleteBucketFunc                               func(ctx context.Context, params *s3.DeleteBucketInput) (*s3.DeleteBucketOutput, error)
+	DeleteBucketInventoryConfigurationFunc         func(ctx context.Context, params *s3.DeleteBucketInventoryConfigurationInput) (*s3.DeleteBucketInventoryConfigurationOutput, error)
+	DeleteBucketPolicyFunc                         func(ctx context.Context, params *s3.DeleteBucketPolicyInput) (*s3.DeleteBucketPolicyOutput, error)
+	DeleteBucketReplicationFunc                    func(ctx context.Context, params *s3.DeleteBucketReplicationInput) (*s3.DeleteBucketReplicationOutput, error)
+	DeleteObjectFunc                               func(ctx context.Context, params *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	DeleteObjectsFunc                              func(ctx context.Context, params *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error)
+	GetBucketAccelerateConfigurationFunc           func(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput) (*s3.GetBucketAccelerateConfigurationOutput, error)
+	GetBucketAclFunc                               func(ctx context.Context, params *s3.GetBucketAclInput) (*s3.GetBucketAclOutput, error)
+	GetBucketEncryptionFunc                        func(ctx context.Context, params *s3.GetBucketEncryptionInput) (*s3.GetBucketEncryptionOutput, error)
+	GetBucketLifecycleConfigurationFunc            func(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput) (*s3.GetBucketLifecycleConfigurationOutput, error)
+	GetBucketLocationFunc                          func(ctx context.Context, params *s3.GetBucketLocationInput) (*s3.GetBucketLocationOutput, error)
+	GetBucketLoggingFunc                           func(ctx context.Context, params *s3.GetBucketLoggingInput) (*s3.GetBucketLoggingOutput, error)
+	GetBucketNotificationConfigurationFunc         func(ctx context.Context, params *s3.GetBucketNotificationConfigurationInput) (*s3.GetBucketNotificationConfigurationOutput, error)
+	GetBucketOwnershipControlsFunc                 func(ctx context.Context, params *s3.GetBucketOwnershipControlsInput) (*s3.GetBucketOwnershipControlsOutput, error)
+	GetBucketPolicyFunc                            func(ctx context.Context, params *s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error)
+	GetBucketPolicyStatusFunc                      func(ctx context.Context, params *s3.GetBucketPolicyStatusInput) (*s3.GetBucketPolicyStatusOutput, error)
+	GetBucketReplicationFunc                       func(ctx context.Context, params *s3.GetBucketReplicationInput) (*s3.GetBucketReplicationOutput, error)
+	GetBucketRequestPaymentFunc                    func(ctx context.Context, params *s3.GetBucketRequestPaymentInput) (*s3.GetBucketRequestPaymentOutput, error)
+	GetBucketTaggingFunc                           func(ctx context.Context, params *s3.GetBucketTaggingInput) (*s3.GetBucketTaggingOutput, error)
+	GetBucketVersioningFunc                        func(ctx context.Context, params *s3.GetBucketVersioningInput) (*s3.GetBucketVersioningOutput, error)
+	GetObjectFunc                                  func(ctx context.Context, params *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	GetObjectLockConfigurationFunc                 func(ctx context.Context, params *s3.GetObjectLockConfigurationInput) (*s3.GetObjectLockConfigurationOutput, error)
+	GetPublicAccessBlockFunc                       func(ctx context.Context, params *s3.GetPublicAccessBlockInput) (*s3.GetPublicAccessBlockOutput, error)
+	HeadBucketFunc                                 func(ctx context.Context, params *s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
+	HeadObjectFunc                                 func(ctx context.Context, params *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	ListBucketIntelligentTieringConfigurationsFunc func(ctx context.Context, params *s3.ListBucketIntelligentTieringConfigurationsInput) (*s3.ListBucketIntelligentTieringConfigurationsOutput, error)
+	ListBucketInventoryConfigurationsFunc          func(ctx context.Context, params *s3.ListBucketInventoryConfigurationsInput) (*s3.ListBucketInventoryConfigurationsOutput, error)
+	ListBucketsFunc                                func(ctx context.Context, params *s3.ListBucketsInput) (*s3.ListBucketsOutput, error)
+	ListDirectoryBucketsFunc                       func(ctx context.Context, params *s3.ListDirectoryBucketsInput) (*s3.ListDirectoryBucketsOutput, error)
+	ListMultipartUploadsFunc                       func(ctx context.Context, params *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error)
+	ListObjectVersionsFunc                         func(ctx context.Context, params *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error)
+	ListObjectsV2Func                              func(ctx context.Context, params *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	PutBucketAclFunc                               func(ctx context.Context, params *s3.PutBucketAclInput) (*s3.PutBucketAclOutput, error)
+	PutBucketEncryptionFunc                        func(ctx context.Context, params *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error)
+	PutBucketIntelligentTieringConfigurationFunc   func(ctx context.Context, params *s3.PutBucketIntelligentTieringConfigurationInput) (*s3.PutBucketIntelligentTieringConfigurationOutput, error)
+	PutBucketLifecycleConfigurationFunc            func(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput) (*s3.PutBucketLifecycleConfigurationOutput, error)
+	PutBucketLoggingFunc                           func(ctx context.Context, params *s3.PutBucketLoggingInput) (*s3.PutBucketLoggingOutput, error)
+	PutBucketNotificationConfigurationFunc         func(ctx context.Context, params *s3.PutBucketNotificationConfigurationInput) (*s3.PutBucketNotificationConfigurationOutput, error)
+	PutBucketOwnershipControlsFunc                 func(ctx context.Context, params *s3.PutBucketOwnershipControlsInput) (*s3.PutBucketOwnershipControlsOutput, error)
+	PutBucketPolicyFunc                            func(ctx context.Context, params *s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error)
+	PutBucketReplicationFunc                       func(ctx context.Context, params *s3.PutBucketReplicationInput) (*s3.PutBucketReplicationOutput, error)
+	PutBucketTaggingFunc                           func(ctx context.Context, params *s3.PutBucketTaggingInput) (*s3.PutBucketTaggingOutput, error)
+	PutBucketVersioningFunc                        func(ctx context.Context, params *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error)
+	PutObjectFunc                                  func(ctx context.Context, params *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	PutPublicAccessBlockFunc                       func(ctx context.Context, params *s3.PutPublicAccessBlockInput) (*s3.PutPublicAccessBlockOutput, error)
+	SelectObjectContentFunc                        func(ctx context.Context, params *s3.SelectObjectContentInput) (*s3.SelectObjectContentOutput, error)
+	UploadPartFunc                                 func(ctx context.Context, params *s3.UploadPartInput) (*s3.UploadPartOutput, error)
+}
+
+// AbortMultipartUpload implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	f.record("AbortMultipartUpload", params)
+	if f.AbortMultipartUploadFunc != nil {
+		return f.AbortMultipartUploadFunc(ctx, params)
+	}
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// CompleteMultipartUpload implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	f.record("CompleteMultipartUpload", params)
+	if f.CompleteMultipartUploadFunc != nil {
+		return f.CompleteMultipartUploadFunc(ctx, params)
+	}
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+// CreateBucket implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) CreateBucket(ctx context.Context, params *s3.CreateBucketInput, optFns ...func(*s3.Options)) (*s3.CreateBucketOutput, error) {
+	f.record("CreateBucket", params)
+	if f.CreateBucketFunc != nil {
+		return f.CreateBucketFunc(ctx, params)
+	}
+	return &s3.CreateBucketOutput{}, nil
+}
+
+// CreateMultipartUpload implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	f.record("CreateMultipartUpload", params)
+	if f.CreateMultipartUploadFunc != nil {
+		return f.CreateMultipartUploadFunc(ctx, params)
+	}
+	return &s3.CreateMultipartUploadOutput{}, nil
+}
+
+// DeleteBucket implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) DeleteBucket(ctx context.Context, params *s3.DeleteBucketInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketOutput, error) {
+	f.record("DeleteBucket", params)
+	if f.DeleteBucketFunc != nil {
+		return f.DeleteBucketFunc(ctx, params)
+	}
+	return &s3.DeleteBucketOutput{}, nil
+}
+
+// DeleteBucketInventoryConfiguration implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) DeleteBucketInventoryConfiguration(ctx context.Context, params *s3.DeleteBucketInventoryConfigurationInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketInventoryConfigurationOutput, error) {
+	f.record("DeleteBucketInventoryConfiguration", params)
+	if f.DeleteBucketInventoryConfigurationFunc != nil {
+		return f.DeleteBucketInventoryConfigurationFunc(ctx, params)
+	}
+	return &s3.DeleteBucketInventoryConfigurationOutput{}, nil
+}
+
+// DeleteBucketPolicy implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) DeleteBucketPolicy(ctx context.Context, params *s3.DeleteBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketPolicyOutput, error) {
+	f.record("DeleteBucketPolicy", params)
+	if f.DeleteBucketPolicyFunc != nil {
+		return f.DeleteBucketPolicyFunc(ctx, params)
+	}
+	return &s3.DeleteBucketPolicyOutput{}, nil
+}
+
+// DeleteBucketReplication implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) DeleteBucketReplication(ctx context.Context, params *s3.DeleteBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.DeleteBucketReplicationOutput, error) {
+	f.record("DeleteBucketReplication", params)
+	if f.DeleteBucketReplicationFunc != nil {
+		return f.DeleteBucketReplicationFunc(ctx, params)
+	}
+	return &s3.DeleteBucketReplicationOutput{}, nil
+}
+
+// DeleteObject implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.record("DeleteObject", params)
+	if f.DeleteObjectFunc != nil {
+		return f.DeleteObjectFunc(ctx, params)
+	}
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// DeleteObjects implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) DeleteObjects(ctx context.Context, params *s3.DeleteObjectsInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.record("DeleteObjects", params)
+	if f.DeleteObjectsFunc != nil {
+		return f.DeleteObjectsFunc(ctx, params)
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+// GetBucketAccelerateConfiguration implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketAccelerateConfiguration(ctx context.Context, params *s3.GetBucketAccelerateConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketAccelerateConfigurationOutput, error) {
+	f.record("GetBucketAccelerateConfiguration", params)
+	if f.GetBucketAccelerateConfigurationFunc != nil {
+		return f.GetBucketAccelerateConfigurationFunc(ctx, params)
+	}
+	return &s3.GetBucketAccelerateConfigurationOutput{}, nil
+}
+
+// GetBucketAcl implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketAcl(ctx context.Context, params *s3.GetBucketAclInput, optFns ...func(*s3.Options)) (*s3.GetBucketAclOutput, error) {
+	f.record("GetBucketAcl", params)
+	if f.GetBucketAclFunc != nil {
+		return f.GetBucketAclFunc(ctx, params)
+	}
+	return &s3.GetBucketAclOutput{}, nil
+}
+
+// GetBucketEncryption implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketEncryption(ctx context.Context, params *s3.GetBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.GetBucketEncryptionOutput, error) {
+	f.record("GetBucketEncryption", params)
+	if f.GetBucketEncryptionFunc != nil {
+		return f.GetBucketEncryptionFunc(ctx, params)
+	}
+	return &s3.GetBucketEncryptionOutput{}, nil
+}
+
+// GetBucketLifecycleConfiguration implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketLifecycleConfiguration(ctx context.Context, params *s3.GetBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLifecycleConfigurationOutput, error) {
+	f.record("GetBucketLifecycleConfiguration", params)
+	if f.GetBucketLifecycleConfigurationFunc != nil {
+		return f.GetBucketLifecycleConfigurationFunc(ctx, params)
+	}
+	return &s3.GetBucketLifecycleConfigurationOutput{}, nil
+}
+
+// GetBucketLocation implements s3audit.BucketListerAPI.
+func (f *FakeS3) GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	f.record("GetBucketLocation", params)
+	if f.GetBucketLocationFunc != nil {
+		return f.GetBucketLocationFunc(ctx, params)
+	}
+	return &s3.GetBucketLocationOutput{}, nil
+}
+
+// GetBucketLogging implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketLogging(ctx context.Context, params *s3.GetBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketLoggingOutput, error) {
+	f.record("GetBucketLogging", params)
+	if f.GetBucketLoggingFunc != nil {
+		return f.GetBucketLoggingFunc(ctx, params)
+	}
+	return &s3.GetBucketLoggingOutput{}, nil
+}
+
+// GetBucketNotificationConfiguration implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketNotificationConfiguration(ctx context.Context, params *s3.GetBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetBucketNotificationConfigurationOutput, error) {
+	f.record("GetBucketNotificationConfiguration", params)
+	if f.GetBucketNotificationConfigurationFunc != nil {
+		return f.GetBucketNotificationConfigurationFunc(ctx, params)
+	}
+	return &s3.GetBucketNotificationConfigurationOutput{}, nil
+}
+
+// GetBucketOwnershipControls implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketOwnershipControls(ctx context.Context, params *s3.GetBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.GetBucketOwnershipControlsOutput, error) {
+	f.record("GetBucketOwnershipControls", params)
+	if f.GetBucketOwnershipControlsFunc != nil {
+		return f.GetBucketOwnershipControlsFunc(ctx, params)
+	}
+	return &s3.GetBucketOwnershipControlsOutput{}, nil
+}
+
+// GetBucketPolicy implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketPolicy(ctx context.Context, params *s3.GetBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyOutput, error) {
+	f.record("GetBucketPolicy", params)
+	if f.GetBucketPolicyFunc != nil {
+		return f.GetBucketPolicyFunc(ctx, params)
+	}
+	return &s3.GetBucketPolicyOutput{}, nil
+}
+
+// GetBucketPolicyStatus implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketPolicyStatus(ctx context.Context, params *s3.GetBucketPolicyStatusInput, optFns ...func(*s3.Options)) (*s3.GetBucketPolicyStatusOutput, error) {
+	f.record("GetBucketPolicyStatus", params)
+	if f.GetBucketPolicyStatusFunc != nil {
+		return f.GetBucketPolicyStatusFunc(ctx, params)
+	}
+	return &s3.GetBucketPolicyStatusOutput{}, nil
+}
+
+// GetBucketReplication implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketReplication(ctx context.Context, params *s3.GetBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.GetBucketReplicationOutput, error) {
+	f.record("GetBucketReplication", params)
+	if f.GetBucketReplicationFunc != nil {
+		return f.GetBucketReplicationFunc(ctx, params)
+	}
+	return &s3.GetBucketReplicationOutput{}, nil
+}
+
+// GetBucketRequestPayment implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketRequestPayment(ctx context.Context, params *s3.GetBucketRequestPaymentInput, optFns ...func(*s3.Options)) (*s3.GetBucketRequestPaymentOutput, error) {
+	f.record("GetBucketRequestPayment", params)
+	if f.GetBucketRequestPaymentFunc != nil {
+		return f.GetBucketRequestPaymentFunc(ctx, params)
+	}
+	return &s3.GetBucketRequestPaymentOutput{}, nil
+}
+
+// GetBucketTagging implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketTagging(ctx context.Context, params *s3.GetBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.GetBucketTaggingOutput, error) {
+	f.record("GetBucketTagging", params)
+	if f.GetBucketTaggingFunc != nil {
+		return f.GetBucketTaggingFunc(ctx, params)
+	}
+	return &s3.GetBucketTaggingOutput{}, nil
+}
+
+// GetBucketVersioning implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetBucketVersioning(ctx context.Context, params *s3.GetBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.GetBucketVersioningOutput, error) {
+	f.record("GetBucketVersioning", params)
+	if f.GetBucketVersioningFunc != nil {
+		return f.GetBucketVersioningFunc(ctx, params)
+	}
+	return &s3.GetBucketVersioningOutput{}, nil
+}
+
+// GetObject implements s3audit.ObjectReaderAPI.
+func (f *FakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	f.record("GetObject", params)
+	if f.GetObjectFunc != nil {
+		return f.GetObjectFunc(ctx, params)
+	}
+	return &s3.GetObjectOutput{}, nil
+}
+
+// GetObjectLockConfiguration implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetObjectLockConfiguration(ctx context.Context, params *s3.GetObjectLockConfigurationInput, optFns ...func(*s3.Options)) (*s3.GetObjectLockConfigurationOutput, error) {
+	f.record("GetObjectLockConfiguration", params)
+	if f.GetObjectLockConfigurationFunc != nil {
+		return f.GetObjectLockConfigurationFunc(ctx, params)
+	}
+	return &s3.GetObjectLockConfigurationOutput{}, nil
+}
+
+// GetPublicAccessBlock implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) GetPublicAccessBlock(ctx context.Context, params *s3.GetPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.GetPublicAccessBlockOutput, error) {
+	f.record("GetPublicAccessBlock", params)
+	if f.GetPublicAccessBlockFunc != nil {
+		return f.GetPublicAccessBlockFunc(ctx, params)
+	}
+	return &s3.GetPublicAccessBlockOutput{}, nil
+}
+
+// HeadBucket implements s3audit.BucketListerAPI.
+func (f *FakeS3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	f.record("HeadBucket", params)
+	if f.HeadBucketFunc != nil {
+		return f.HeadBucketFunc(ctx, params)
+	}
+	return &s3.HeadBucketOutput{}, nil
+}
+
+// HeadObject implements s3audit.ObjectReaderAPI.
+func (f *FakeS3) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	f.record("HeadObject", params)
+	if f.HeadObjectFunc != nil {
+		return f.HeadObjectFunc(ctx, params)
+	}
+	return &s3.HeadObjectOutput{}, nil
+}
+
+// ListBucketIntelligentTieringConfigurations implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) ListBucketIntelligentTieringConfigurations(ctx context.Context, params *s3.ListBucketIntelligentTieringConfigurationsInput, optFns ...func(*s3.Options)) (*s3.ListBucketIntelligentTieringConfigurationsOutput, error) {
+	f.record("ListBucketIntelligentTieringConfigurations", params)
+	if f.ListBucketIntelligentTieringConfigurationsFunc != nil {
+		return f.ListBucketIntelligentTieringConfigurationsFunc(ctx, params)
+	}
+	return &s3.ListBucketIntelligentTieringConfigurationsOutput{}, nil
+}
+
+// ListBucketInventoryConfigurations implements s3audit.BucketSettingsAPI.
+func (f *FakeS3) ListBucketInventoryConfigurations(ctx context.Context, params *s3.ListBucketInventoryConfigurationsInput, optFns ...func(*s3.Options)) (*s3.ListBucketInventoryConfigurationsOutput, error) {
+	f.record("ListBucketInventoryConfigurations", params)
+	if f.ListBucketInventoryConfigurationsFunc != nil {
+		return f.ListBucketInventoryConfigurationsFunc(ctx, params)
+	}
+	return &s3.ListBucketInventoryConfigurationsOutput{}, nil
+}
+
+// ListBuckets implements s3audit.BucketListerAPI.
+func (f *FakeS3) ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error) {
+	f.record("ListBuckets", params)
+	if f.ListBucketsFunc != nil {
+		return f.ListBucketsFunc(ctx, params)
+	}
+	return &s3.ListBucketsOutput{}, nil
+}
+
+// ListDirectoryBuckets implements s3audit.BucketListerAPI.
+func (f *FakeS3) ListDirectoryBuckets(ctx context.Context, params *s3.ListDirectoryBucketsInput, optFns ...func(*s3.Options)) (*s3.ListDirectoryBucketsOutput, error) {
+	f.record("ListDirectoryBuckets", params)
+	if f.ListDirectoryBucketsFunc != nil {
+		return f.ListDirectoryBucketsFunc(ctx, params)
+	}
+	return &s3.ListDirectoryBucketsOutput{}, nil
+}
+
+// ListMultipartUploads implements s3audit.ObjectReaderAPI.
+func (f *FakeS3) ListMultipartUploads(ctx context.Context, params *s3.ListMultipartUploadsInput, optFns ...func(*s3.Options)) (*s3.ListMultipartUploadsOutput, error) {
+	f.record("ListMultipartUploads", params)
+	if f.ListMultipartUploadsFunc != nil {
+		return f.ListMultipartUploadsFunc(ctx, params)
+	}
+	return &s3.ListMultipartUploadsOutput{}, nil
+}
+
+// ListObjectVersions implements s3audit.ObjectReaderAPI.
+func (f *FakeS3) ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error) {
+	f.record("ListObjectVersions", params)
+	if f.ListObjectVersionsFunc != nil {
+		return f.ListObjectVersionsFunc(ctx, params)
+	}
+	return &s3.ListObjectVersionsOutput{}, nil
+}
+
+// ListObjectsV2 implements s3audit.ObjectReaderAPI.
+func (f *FakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	f.record("ListObjectsV2", params)
+	if f.ListObjectsV2Func != nil {
+		return f.ListObjectsV2Func(ctx, params)
+	}
+	return &s3.ListObjectsV2Output{}, nil
+}
+
+// PutBucketAcl implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketAcl(ctx context.Context, params *s3.PutBucketAclInput, optFns ...func(*s3.Options)) (*s3.PutBucketAclOutput, error) {
+	f.record("PutBucketAcl", params)
+	if f.PutBucketAclFunc != nil {
+		return f.PutBucketAclFunc(ctx, params)
+	}
+	return &s3.PutBucketAclOutput{}, nil
+}
+
+// PutBucketEncryption implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketEncryption(ctx context.Context, params *s3.PutBucketEncryptionInput, optFns ...func(*s3.Options)) (*s3.PutBucketEncryptionOutput, error) {
+	f.record("PutBucketEncryption", params)
+	if f.PutBucketEncryptionFunc != nil {
+		return f.PutBucketEncryptionFunc(ctx, params)
+	}
+	return &s3.PutBucketEncryptionOutput{}, nil
+}
+
+// PutBucketIntelligentTieringConfiguration implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketIntelligentTieringConfiguration(ctx context.Context, params *s3.PutBucketIntelligentTieringConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketIntelligentTieringConfigurationOutput, error) {
+	f.record("PutBucketIntelligentTieringConfiguration", params)
+	if f.PutBucketIntelligentTieringConfigurationFunc != nil {
+		return f.PutBucketIntelligentTieringConfigurationFunc(ctx, params)
+	}
+	return &s3.PutBucketIntelligentTieringConfigurationOutput{}, nil
+}
+
+// PutBucketLifecycleConfiguration implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketLifecycleConfiguration(ctx context.Context, params *s3.PutBucketLifecycleConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketLifecycleConfigurationOutput, error) {
+	f.record("PutBucketLifecycleConfiguration", params)
+	if f.PutBucketLifecycleConfigurationFunc != nil {
+		return f.PutBucketLifecycleConfigurationFunc(ctx, params)
+	}
+	return &s3.PutBucketLifecycleConfigurationOutput{}, nil
+}
+
+// PutBucketLogging implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketLogging(ctx context.Context, params *s3.PutBucketLoggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketLoggingOutput, error) {
+	f.record("PutBucketLogging", params)
+	if f.PutBucketLoggingFunc != nil {
+		return f.PutBucketLoggingFunc(ctx, params)
+	}
+	return &s3.PutBucketLoggingOutput{}, nil
+}
+
+// PutBucketNotificationConfiguration implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketNotificationConfiguration(ctx context.Context, params *s3.PutBucketNotificationConfigurationInput, optFns ...func(*s3.Options)) (*s3.PutBucketNotificationConfigurationOutput, error) {
+	f.record("PutBucketNotificationConfiguration", params)
+	if f.PutBucketNotificationConfigurationFunc != nil {
+		return f.PutBucketNotificationConfigurationFunc(ctx, params)
+	}
+	return &s3.PutBucketNotificationConfigurationOutput{}, nil
+}
+
+// PutBucketOwnershipControls implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketOwnershipControls(ctx context.Context, params *s3.PutBucketOwnershipControlsInput, optFns ...func(*s3.Options)) (*s3.PutBucketOwnershipControlsOutput, error) {
+	f.record("PutBucketOwnershipControls", params)
+	if f.PutBucketOwnershipControlsFunc != nil {
+		return f.PutBucketOwnershipControlsFunc(ctx, params)
+	}
+	return &s3.PutBucketOwnershipControlsOutput{}, nil
+}
+
+// PutBucketPolicy implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketPolicy(ctx context.Context, params *s3.PutBucketPolicyInput, optFns ...func(*s3.Options)) (*s3.PutBucketPolicyOutput, error) {
+	f.record("PutBucketPolicy", params)
+	if f.PutBucketPolicyFunc != nil {
+		return f.PutBucketPolicyFunc(ctx, params)
+	}
+	return &s3.PutBucketPolicyOutput{}, nil
+}
+
+// PutBucketReplication implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketReplication(ctx context.Context, params *s3.PutBucketReplicationInput, optFns ...func(*s3.Options)) (*s3.PutBucketReplicationOutput, error) {
+	f.record("PutBucketReplication", params)
+	if f.PutBucketReplicationFunc != nil {
+		return f.PutBucketReplicationFunc(ctx, params)
+	}
+	return &s3.PutBucketReplicationOutput{}, nil
+}
+
+// PutBucketTagging implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketTagging(ctx context.Context, params *s3.PutBucketTaggingInput, optFns ...func(*s3.Options)) (*s3.PutBucketTaggingOutput, error) {
+	f.record("PutBucketTagging", params)
+	if f.PutBucketTaggingFunc != nil {
+		return f.PutBucketTaggingFunc(ctx, params)
+	}
+	return &s3.PutBucketTaggingOutput{}, nil
+}
+
+// PutBucketVersioning implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutBucketVersioning(ctx context.Context, params *s3.PutBucketVersioningInput, optFns ...func(*s3.Options)) (*s3.PutBucketVersioningOutput, error) {
+	f.record("PutBucketVersioning", params)
+	if f.PutBucketVersioningFunc != nil {
+		return f.PutBucketVersioningFunc(ctx, params)
+	}
+	return &s3.PutBucketVersioningOutput{}, nil
+}
+
+// PutObject implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	f.record("PutObject", params)
+	if f.PutObjectFunc != nil {
+		return f.PutObjectFunc(ctx, params)
+	}
+	return &s3.PutObjectOutput{}, nil
+}
+
+// PutPublicAccessBlock implements s3audit.BucketRemediationAPI.
+func (f *FakeS3) PutPublicAccessBlock(ctx context.Context, params *s3.PutPublicAccessBlockInput, optFns ...func(*s3.Options)) (*s3.PutPublicAccessBlockOutput, error) {
+	f.record("PutPublicAccessBlock", params)
+	if f.PutPublicAccessBlockFunc != nil {
+		return f.PutPublicAccessBlockFunc(ctx, params)
+	}
+	return &s3.PutPublicAccessBlockOutput{}, nil
+}
+
+// SelectObjectContent implements s3audit.ObjectReaderAPI.
+func (f *FakeS3) SelectObjectContent(ctx context.Context, params *s3.SelectObjectContentInput, optFns ...func(*s3.Options)) (*s3.SelectObjectContentOutput, error) {
+	f.record("SelectObjectContent", params)
+	if f.SelectObjectContentFunc != nil {
+		return f.SelectObjectContentFunc(ctx, params)
+	}
+	return &s3.SelectObjectContentOutput{}, nil
+}
+
+// UploadPart implements s3audit.ObjectWriterAPI.
+func (f *FakeS3) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	f.record("UploadPart", params)
+	if f.UploadPartFunc != nil {
+		return f.UploadPartFunc(ctx, params)
+	}
+	return &s3.UploadPartOutput{}, nil
+}
+
+// the fake implements every interface of its operations
+var (
+	_ s3audit.BucketListerAPI      = (*FakeS3)(nil)
+	_ s3audit.BucketRemediationAPI = (*FakeS3)(nil)
+	_ s3audit.BucketSettingsAPI    = (*FakeS3)(nil)
+	_ s3audit.ObjectReaderAPI      = (*FakeS3)(nil)
+	_ s3audit.ObjectWriterAPI      = (*FakeS3)(nil)
+)
+
+// FakeS3Control is a fake s3control client. Each operation returns the response of its function field when set,
+// an empty output otherwise, and every call is recorded.
+type FakeS3Control struct {
+	Recorder
+
+	GetAccessPointPolicyFunc          func(ctx context.Context, params *s3control.GetAccessPointPolicyInput) (*s3control.GetAccessPointPolicyOutput, error)
+	GetAccessPointPolicyStatusFunc    func(ctx context.Context, params *s3control.GetAccessPointPolicyStatusInput) (*s3control.GetAccessPointPolicyStatusOutput, error)
+	GetPublicAccessBlockFunc          func(ctx context.Context, params *s3control.GetPublicAccessBlockInput) (*s3control.GetPublicAccessBlockOutput, error)
+	GetStorageLensConfigurationFunc   func(ctx context.Context, params *s3control.GetStorageLensConfigurationInput) (*s3control.GetStorageLensConfigurationOutput, error)
+	ListAccessPointsFunc              func(ctx context.Context, params *s3control.ListAccessPointsInput) (*s3control.ListAccessPointsOutput, error)
+	ListStorageLensConfigurationsFunc func(ctx context.Context, params *s3control.ListStorageLensConfigurationsInput) (*s3control.ListStorageLensConfigurationsOutput, error)
+}
+
+// GetAccessPointPolicy implements s3audit.S3ControlGetAccessPointPolicyApi.
+func (f *FakeS3Control) GetAccessPointPolicy(ctx context.Context, params *s3control.GetAccessPointPolicyInput, optFns ...func(*s3control.Options)) (*s3control.GetAccessPointPolicyOutput, error) {
+	f.record("GetAccessPointPolicy", params)
+	if f.GetAccessPointPolicyFunc != nil {
+		return f.GetAccessPointPolicyFunc(ctx, params)
+	}
+	return &s3control.GetAccessPointPolicyOutput{}, nil
+}
+
+// GetAccessPointPolicyStatus implements s3audit.S3ControlGetAccessPointPolicyStatusApi.
+func (f *FakeS3Control) GetAccessPointPolicyStatus(ctx context.Context, params *s3control.GetAccessPointPolicyStatusInput, optFns ...func(*s3control.Options)) (*s3control.GetAccessPointPolicyStatusOutput, error) {
+	f.record("GetAccessPointPolicyStatus", params)
+	if f.GetAccessPointPolicyStatusFunc != nil {
+		return f.GetAccessPointPolicyStatusFunc(ctx, params)
+	}
+	return &s3control.GetAccessPointPolicyStatusOutput{}, nil
+}
+
+// GetPublicAccessBlock implements s3audit.S3ControlGetPublicAccessBlockApi.
+func (f *FakeS3Control) GetPublicAccessBlock(ctx context.Context, params *s3control.GetPublicAccessBlockInput, optFns ...func(*s3control.Options)) (*s3control.GetPublicAccessBlockOutput, error) {
+	f.record("GetPublicAccessBlock", params)
+	if f.GetPublicAccessBlockFunc != nil {
+		return f.GetPublicAccessBlockFunc(ctx, params)
+	}
+	return &s3control.GetPublicAccessBlockOutput{}, nil
+}
+
+// GetStorageLensConfiguration implements s3audit.S3ControlGetStorageLensConfigurationApi.
+func (f *FakeS3Control) GetStorageLensConfiguration(ctx context.Context, params *s3control.GetStorageLensConfigurationInput, optFns ...func(*s3control.Options)) (*s3control.GetStorageLensConfigurationOutput, error) {
+	f.record("GetStorageLensConfiguration", params)
+	if f.GetStorageLensConfigurationFunc != nil {
+		return f.GetStorageLensConfigurationFunc(ctx, params)
+	}
+	return &s3control.GetStorageLensConfigurationOutput{}, nil
+}
+
+// ListAccessPoints implements s3audit.S3ControlListAccessPointsApi.
+func (f *FakeS3Control) ListAccessPoints(ctx context.Context, params *s3control.ListAccessPointsInput, optFns ...func(*s3control.Options)) (*s3control.ListAccessPointsOutput, error) {
+	f.record("ListAccessPoints", params)
+	if f.ListAccessPointsFunc != nil {
+		return f.ListAccessPointsFunc(ctx, params)
+	}
+	return &s3control.ListAccessPointsOutput{}, nil
+}
+
+// ListStorageLensConfigurations implements s3audit.S3ControlListStorageLensConfigurationsApi.
+func (f *FakeS3Control) ListStorageLensConfigurations(ctx context.Context, params *s3control.ListStorageLensConfigurationsInput, optFns ...func(*s3control.Options)) (*s3control.ListStorageLensConfigurationsOutput, error) {
+	f.record("ListStorageLensConfigurations", params)
+	if f.ListStorageLensConfigurationsFunc != nil {
+		return f.ListStorageLensConfigurationsFunc(ctx, params)
+	}
+	return &s3control.ListStorageLensConfigurationsOutput{}, nil
+}
+
+// the fake implements every interface of its operations
+var (
+	_ s3audit.S3ControlGetAccessPointPolicyApi          = (*FakeS3Control)(nil)
+	_ s3audit.S3ControlGetAccessPointPolicyStatusApi    = (*FakeS3Control)(nil)
+	_ s3audit.S3ControlGetPublicAccessBlockApi          = (*FakeS3Control)(nil)
+	_ s3audit.S3ControlGetStorageLensConfigurationApi   = (*FakeS3Control)(nil)
+	_ s3audit.S3ControlListAccessPointsApi              = (*FakeS3Control)(nil)
+	_ s3audit.S3ControlListStorageLensConfigurationsApi = (*FakeS3Control)(nil)
+)
+
+// FakeS3 implements the facade of every S3 call of the audit
+var _ s3audit.S3ClientAPI = (*FakeS3)(nil)
@@ -0,0 +1,175 @@
+//go:build ignore
+
+// gen writes fakes.go: a fake per client package implementing the interfaces of package s3audit declaring its
+// calls, the sub-interfaces of the S3ClientAPI facade and the S3Control*Api interfaces. Run it with go generate
+// after adding a call.
+package main
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"sort"
+	"text/template"
+)
+
+// operation defines a call of an interface of package s3audit
+type operation struct {
+	Interface string
+	Name      string
+	Package   string
+	Input     string
+	Output    string
+}
+
+// fake defines the fake of a client package, its operations and the interfaces declaring them
+type fake struct {
+	Name       string
+	Package    string
+	Operations []operation
+	Interfaces []string
+}
+
+var fakes = template.Must(template.New("fakes").Parse(`// Code generated by gen.go; DO NOT EDIT.
+
+package s3audittest
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"golang-playground/s3audit"
+)
+{{range .}}
+// {{.Name}} is a fake {{.Package}} client. Each operation returns the response of its function field when set,
+// an empty output otherwise, and every call is recorded.
+type {{.Name}} struct {
+	Recorder
+{{range .Operations}}
+	{{.Name}}Func func(ctx context.Context, params *{{.Input}}) (*{{.Output}}, error){{end}}
+}
+{{$fake := .}}{{range .Operations}}
+// {{.Name}} implements s3audit.{{.Interface}}.
+func (f *{{$fake.Name}}) {{.Name}}(ctx context.Context, params *{{.Input}}, optFns ...func(*{{.Package}}.Options)) (*{{.Output}}, error) {
+	f.record("{{.Name}}", params)
+	if f.{{.Name}}Func != nil {
+		return f.{{.Name}}Func(ctx, params)
+	}
+	return &{{.Output}}{}, nil
+}
+{{end}}
+// the fake implements every interface of its operations
+var ({{range .Interfaces}}
+	_ s3audit.{{.}} = (*{{$fake.Name}})(nil){{end}}
+)
+{{end}}
+// FakeS3 implements the facade of every S3 call of the audit
+var _ s3audit.S3ClientAPI = (*FakeS3)(nil)
+`))
+
+// clientOperation returns the operation of a method of an interface when it has the signature of a call of a
+// client of the SDK: func(context.Context, *pkg.XInput, ...func(*pkg.Options)) (*pkg.XOutput, error).
+func clientOperation(iface string, method *ast.Field) (operation, bool) {
+	fn, ok := method.Type.(*ast.FuncType)
+	if !ok || len(method.Names) != 1 || len(fn.Params.List) != 3 || fn.Results == nil || len(fn.Results.List) != 2 {
+		return operation{}, false
+	}
+	input, ok := selector(fn.Params.List[1].Type)
+	if !ok {
+		return operation{}, false
+	}
+	output, ok := selector(fn.Results.List[0].Type)
+	if !ok {
+		return operation{}, false
+	}
+	client := input.X.(*ast.Ident).Name
+	return operation{
+		Interface: iface,
+		Name:      method.Names[0].Name,
+		Package:   client,
+		Input:     client + "." + input.Sel.Name,
+		Output:    client + "." + output.Sel.Name,
+	}, true
+}
+
+// selector returns the type a pointer type points to when it is a type of another package, e.g. *s3.XInput.
+func selector(expr ast.Expr) (*ast.SelectorExpr, bool) {
+	star, ok := expr.(*ast.StarExpr)
+	if !ok {
+		return nil, false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return nil, false
+	}
+	if _, ok := sel.X.(*ast.Ident); !ok {
+		return nil, false
+	}
+	return sel, true
+}
+
+func main() {
+	files, err := parser.ParseDir(token.NewFileSet(), "../s3audit", nil, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	byPackage := map[string]*fake{
+		"s3":        {Name: "FakeS3", Package: "s3"},
+		"s3control": {Name: "FakeS3Control", Package: "s3control"},
+	}
+	for _, pkg := range files {
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				gen, ok := decl.(*ast.GenDecl)
+				if !ok || gen.Tok != token.TYPE {
+					continue
+				}
+				for _, spec := range gen.Specs {
+					ts := spec.(*ast.TypeSpec)
+					iface, ok := ts.Type.(*ast.InterfaceType)
+					if !ok {
+						continue
+					}
+					for _, method := range iface.Methods.List {
+						op, ok := clientOperation(ts.Name.Name, method)
+						if !ok {
+							continue
+						}
+						f, ok := byPackage[op.Package]
+						if !ok {
+							continue
+						}
+						if len(f.Interfaces) == 0 || f.Interfaces[len(f.Interfaces)-1] != op.Interface {
+							f.Interfaces = append(f.Interfaces, op.Interface)
+						}
+						f.Operations = append(f.Operations, op)
+					}
+				}
+			}
+		}
+	}
+
+	var all []*fake
+	for _, name := range []string{"s3", "s3control"} {
+		f := byPackage[name]
+		sort.Slice(f.Operations, func(i, j int) bool { return f.Operations[i].Name < f.Operations[j].Name })
+		sort.Strings(f.Interfaces)
+		all = append(all, f)
+	}
+	var buf bytes.Buffer
+	if err := fakes.Execute(&buf, all); err != nil {
+		log.Fatal(err)
+	}
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		log.Fatalf("formatting the fakes: %v\n%s", err, buf.String())
+	}
+	if err := os.WriteFile("fakes.go", source, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
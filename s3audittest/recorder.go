@@ -0,0 +1,57 @@
+// Package s3audittest provides fakes of the S3 and S3 Control clients implementing the S3*Api interfaces of
+// package s3audit, for the programs embedding the library to test their use of it without AWS. The
+// responses are programmed with the function fields of the fakes, and the calls are recorded.
+package s3audittest
+
+//go:generate go run gen.go
+
+import (
+	"sync"
+)
+
+// Call is a recorded call of a fake: the name of the operation and its input, e.g. a *s3.GetBucketAclInput.
+type Call struct {
+	Operation string
+	Input     interface{}
+}
+
+// Recorder records the calls of a fake. It is safe for concurrent use, like the clients the fakes replace.
+type Recorder struct {
+	mutex sync.Mutex
+	calls []Call
+}
+
+// record adds a call.
+func (r *Recorder) record(operation string, input interface{}) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = append(r.calls, Call{Operation: operation, Input: input})
+}
+
+// Calls returns the calls recorded so far, in order.
+func (r *Recorder) Calls() []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the calls of an operation recorded so far, e.g. CallsTo("GetBucketAcl").
+func (r *Recorder) CallsTo(operation string) []Call {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var calls []Call
+	for _, call := range r.calls {
+		if call.Operation == operation {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls.
+func (r *Recorder) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.calls = nil
+}